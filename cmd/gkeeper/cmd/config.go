@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"GophKeeper/internal/security"
+	db "GophKeeper/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// durationKeys are the settings holding durations.
+var durationKeys = []string{
+	"blockstore.janitor.interval",
+	"blockstore.janitor.max_age",
+	"share.max_ttl",
+	"trash.retention",
+	"trash.purge_interval",
+	"accounts.purge_interval",
+	"sync.heartbeat_interval",
+	"auth.access_token_ttl",
+	"auth.refresh_token_ttl",
+	"auth.email_verification_ttl",
+	"auth.password_reset_ttl",
+	"auth.lockout.window",
+	"auth.lockout.backoff",
+	"auth.lockout.duration",
+	"auth.jwt.reload_interval",
+}
+
+// countKeys are the settings holding counts, which must not be negative.
+var countKeys = []string{
+	"auth.lockout.max_failures",
+	"auth.lockout.ip_max_failures",
+}
+
+// configCmd groups the commands working on the config file
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the config file",
+}
+
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file without starting the server",
+	Long: `The validate command reads the config like run does and reports every setting the server would
+reject or misread. Nothing is connected to and no file is written.
+
+Examples:
+  gkeeper config validate --config config.yaml
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		problems := validateConfig()
+		if len(problems) == 0 {
+			fmt.Println(viper.ConfigFileUsed() + " is valid")
+			return nil
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		return fmt.Errorf("%s has %d problems", viper.ConfigFileUsed(), len(problems))
+	},
+}
+
+// validateConfig returns the problems of the loaded config.
+func validateConfig() []string {
+	var problems []string
+	check := func(key string, err error) {
+		if err != nil {
+			problems = append(problems, key+": "+err.Error())
+		}
+	}
+	if _, _, err := net.SplitHostPort(getAddress()); err != nil {
+		check("listen_address", err)
+	}
+	if viper.GetString("database.sqlite.path") == "" {
+		_, err := pgxpool.ParseConfig(viper.GetString("database.postgres.connection_string"))
+		check("database.postgres.connection_string", err)
+	}
+	switch mode := viper.GetString("database.migrate"); mode {
+	case "", db.MigrateAuto, db.MigrateCheck, db.MigrateOff:
+	default:
+		check("database.migrate", fmt.Errorf("unknown mode %q, use %s, %s or %s", mode,
+			db.MigrateAuto, db.MigrateCheck, db.MigrateOff))
+	}
+	// the drivers only check their settings when created, nothing is connected to before Init
+	_, err := newBlobStore(zap.NewNop())
+	check("blockstore", err)
+	_, err = newNotifier(zap.NewNop())
+	check("notify", err)
+	check("auth.jwt", validateJWTKeys())
+	check("crypto.kek", validateKeyProvider())
+	if address := viper.GetString("share.listen_address"); address != "" {
+		_, _, err := net.SplitHostPort(address)
+		check("share.listen_address", err)
+		_, err = url.ParseRequestURI(viper.GetString("share.public_url"))
+		check("share.public_url", err)
+	}
+	for _, key := range durationKeys {
+		if !viper.IsSet(key) {
+			continue
+		}
+		_, err := time.ParseDuration(viper.GetString(key))
+		check(key, err)
+	}
+	for _, key := range countKeys {
+		if !viper.IsSet(key) {
+			continue
+		}
+		n, err := strconv.Atoi(viper.GetString(key))
+		if err == nil && n < 0 {
+			err = errors.New("must not be negative")
+		}
+		check(key, err)
+	}
+	if level := viper.GetString("logger.level"); level != "" {
+		if _, ok := LevelMap[level]; !ok {
+			check("logger.level", fmt.Errorf("unknown level %q", level))
+		}
+	}
+	return problems
+}
+
+// validateJWTKeys checks the signing keys as newKeyRing loads them, but does not create a missing key file.
+func validateJWTKeys() error {
+	if path := viper.GetString("auth.jwt.keys_file"); path != "" {
+		_, err := security.LoadKeyRing(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// created on the first start
+			_, err = security.NewJWTKey(jwtAlgorithm())
+		}
+		return err
+	}
+	if secret := viper.GetString("auth.jwt.secret"); secret != "" {
+		_, err := security.NewSecretKeyRing(secret)
+		return err
+	}
+	return errors.New("no JWT signing key configured, set auth.jwt.keys_file or auth.jwt.secret")
+}
+
+// validateKeyProvider checks the key encryption key as newKeyProvider reads it, but does not create
+// a missing key file or ask for a passphrase.
+func validateKeyProvider() error {
+	switch provider := viper.GetString("crypto.kek.provider"); provider {
+	case "file":
+		path := viper.GetString("crypto.kek.file")
+		if path == "" {
+			return errors.New("crypto.kek.file is required for the file provider")
+		}
+		_, err := security.FileKeyProvider{Path: path}.KEK(context.Background())
+		if errors.Is(err, os.ErrNotExist) {
+			// created on the first start
+			return nil
+		}
+		return err
+	case "env":
+		_, err := security.EnvKeyProvider{Name: viper.GetString("crypto.kek.env")}.KEK(context.Background())
+		return err
+	case "prompt":
+		return nil
+	case "":
+		return errors.New("no key encryption key configured, set crypto.kek.provider to file, env or prompt")
+	default:
+		return fmt.Errorf("unknown key provider %q", provider)
+	}
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"GophKeeper/internal/security"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+)
+
+// keysCmd groups the key management commands
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the server keys",
+}
+
+// keysJWTCmd groups the commands managing the keys signing the access tokens
+var keysJWTCmd = &cobra.Command{
+	Use:   "jwt",
+	Short: "Manage the keys signing the access tokens",
+}
+
+// keysJWTRotateCmd represents the keys jwt rotate command
+var keysJWTRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Sign new tokens with a new key",
+	Long: `The rotate command adds a new key to auth.jwt.keys_file and signs new tokens with it. The previous
+key is kept to verify the tokens it signed until they expire, so nobody is logged out. Running servers
+pick the new key up within auth.jwt.reload_interval.
+
+Examples:
+  gkeeper keys jwt rotate --config config.yaml
+  gkeeper keys jwt rotate --config config.yaml --algorithm ES256
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		path := viper.GetString("auth.jwt.keys_file")
+		if path == "" {
+			return errors.New("auth.jwt.keys_file is not set, a secret from the config cannot be rotated")
+		}
+		algorithm, _ := cmd.Flags().GetString("algorithm")
+		if algorithm == "" {
+			algorithm = jwtAlgorithm()
+		}
+		keep, _ := cmd.Flags().GetDuration("keep")
+		if keep <= 0 {
+			// a retired key is needed until the last token it signed expires
+			keep = viper.GetDuration("auth.access_token_ttl")
+			if keep <= 0 {
+				keep = security.DefaultAccessTokenTTL
+			}
+			keep += viper.GetDuration("auth.jwt.reload_interval")
+		}
+		keys, err := security.LoadKeyRing(path)
+		if errors.Is(err, os.ErrNotExist) {
+			keys, err = security.CreateKeyRing(path, algorithm)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created %s with key %s\n", path, keys.Keys()[0].ID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		key, err := keys.Rotate(algorithm, keep)
+		if err != nil {
+			return err
+		}
+		if err := keys.Save(path); err != nil {
+			return err
+		}
+		fmt.Printf("Signing with %s key %s\n", key.Algorithm, key.ID)
+		for _, old := range keys.Keys()[1:] {
+			fmt.Printf("Verifying with %s key %s, retired %s\n", old.Algorithm, old.ID,
+				old.RetiredAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	},
+}
+
+// keysKEKCmd groups the commands managing the key encryption key
+var keysKEKCmd = &cobra.Command{
+	Use:   "kek",
+	Short: "Manage the key encryption key wrapping the data key",
+}
+
+// keysKEKGenerateCmd represents the keys kek generate command
+var keysKEKGenerateCmd = &cobra.Command{
+	Use:   "generate [file]",
+	Short: "Generate a new key encryption key",
+	Long: `The generate command writes a new random key encryption key to the file, readable by its owner
+only, or prints it for the env provider if no file is given.
+
+Examples:
+  gkeeper keys kek generate ./data/kek-2.key
+  export GKEEPER_KEK=$(gkeeper keys kek generate)
+`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			kek, err := security.NewKEK()
+			if err != nil {
+				return err
+			}
+			fmt.Println(kek)
+			return nil
+		}
+		if err := security.CreateKEKFile(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote a new key encryption key to %s\n", args[0])
+		return nil
+	},
+}
+
+// keysKEKRotateCmd represents the keys kek rotate command
+var keysKEKRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Wrap the data key with a new key encryption key",
+	Long: `The rotate command unwraps the data key with the key encryption key of crypto.kek and wraps it with
+the new one given by --to-file or --to-env. The data itself is not re-encrypted. Running servers keep
+working; point crypto.kek at the new key before restarting them.
+
+Examples:
+  gkeeper keys kek generate ./data/kek-2.key
+  gkeeper keys kek rotate --to-file ./data/kek-2.key --config config.yaml
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, _ := cmd.Flags().GetString("to-file")
+		env, _ := cmd.Flags().GetString("to-env")
+		var next security.KeyProvider
+		switch {
+		case file != "" && env == "":
+			next = security.FileKeyProvider{Path: file}
+		case env != "" && file == "":
+			next = security.EnvKeyProvider{Name: env}
+		default:
+			return errors.New("please provide the new key with either --to-file or --to-env")
+		}
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		logger, err := commandLogger()
+		if err != nil {
+			return err
+		}
+		defer logger.Sync()
+		ctx := cmd.Context()
+		kek, err := next.KEK(ctx)
+		if err != nil {
+			return err
+		}
+		storage, database, err := newStorage(ctx, logger, migrateMode(cmd))
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+		current, err := newKeyProvider(storage, logger)
+		if err != nil {
+			return err
+		}
+		secureService := security.NewSecureService(storage, logger, current)
+		if err := secureService.Init(ctx); err != nil {
+			return err
+		}
+		if err := secureService.RotateKEK(ctx, kek); err != nil {
+			return err
+		}
+		if file != "" {
+			fmt.Printf("Data key wrapped with the key in %s, set crypto.kek.provider to file and crypto.kek.file to it\n", file)
+		} else {
+			fmt.Printf("Data key wrapped with the key in $%s, set crypto.kek.provider to env and crypto.kek.env to %s\n", env, env)
+		}
+		return nil
+	},
+}
+
+func init() {
+	keysKEKRotateCmd.Flags().String("to-file", "", "File holding the new key encryption key")
+	keysKEKRotateCmd.Flags().String("to-env", "", "Environment variable holding the new key encryption key")
+	addMigrateFlag(keysKEKRotateCmd.Flags())
+	keysKEKCmd.AddCommand(keysKEKGenerateCmd, keysKEKRotateCmd)
+	keysCmd.AddCommand(keysKEKCmd)
+
+	keysJWTRotateCmd.Flags().String("algorithm", "", "Algorithm of the new key: Ed25519, ES256 or HS256 (default auth.jwt.algorithm)")
+	keysJWTRotateCmd.Flags().Duration("keep", 0, "Drop keys retired for longer than this (default the access token lifetime)")
+	keysJWTCmd.AddCommand(keysJWTRotateCmd)
+	keysCmd.AddCommand(keysJWTCmd)
+	rootCmd.AddCommand(keysCmd)
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	db "GophKeeper/internal/storage"
+	"GophKeeper/internal/storage/sqlite"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pressly/goose/v3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// migrateCmd groups the commands managing the database schema
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage the database schema",
+	Long: `The migrate commands apply and roll back the migrations built into gkeeper on the database
+configured for the server.
+
+Examples:
+  gkeeper migrate status --config config.yaml
+  gkeeper migrate up --config config.yaml
+`,
+}
+
+// migrateUpCmd represents the migrate up command
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd.Context(), func(ctx context.Context, migrator *goose.Provider) error {
+			results, err := migrator.Up(ctx)
+			printResults(results...)
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				fmt.Println("No pending migrations")
+			}
+			return nil
+		})
+	},
+}
+
+// migrateDownCmd represents the migrate down command
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back the latest migration",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd.Context(), func(ctx context.Context, migrator *goose.Provider) error {
+			return rollback(ctx, migrator)
+		})
+	},
+}
+
+// migrateRedoCmd represents the migrate redo command
+var migrateRedoCmd = &cobra.Command{
+	Use:   "redo",
+	Short: "Roll back the latest migration and apply it again",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd.Context(), func(ctx context.Context, migrator *goose.Provider) error {
+			if err := rollback(ctx, migrator); err != nil {
+				return err
+			}
+			result, err := migrator.UpByOne(ctx)
+			if result != nil {
+				printResults(result)
+			}
+			return err
+		})
+	},
+}
+
+// migrateStatusCmd represents the migrate status command
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List the migrations and whether they are applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd.Context(), func(ctx context.Context, migrator *goose.Provider) error {
+			statuses, err := migrator.Status(ctx)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "APPLIED AT\tMIGRATION")
+			for _, st := range statuses {
+				appliedAt := "pending"
+				if st.State == goose.StateApplied {
+					appliedAt = st.AppliedAt.Local().Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(w, "%s\t%s\n", appliedAt, filepath.Base(st.Source.Path))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			current, latest, err := migrator.GetVersions(ctx)
+			if err != nil {
+				return err
+			}
+			if current > latest {
+				fmt.Printf("The database is at version %d, migrated by a newer release\n", current)
+			}
+			return nil
+		})
+	},
+}
+
+// rollback rolls back the latest migration, if there is one.
+func rollback(ctx context.Context, migrator *goose.Provider) error {
+	result, err := migrator.Down(ctx)
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		return errors.New("no migration to roll back")
+	}
+	if result != nil {
+		printResults(result)
+	}
+	return err
+}
+
+func printResults(results ...*goose.MigrationResult) {
+	for _, result := range results {
+		fmt.Println(result.String())
+	}
+}
+
+// withMigrator loads the config, opens the database of the server without migrating it and runs fn
+// with the provider of its migrations.
+func withMigrator(ctx context.Context, fn func(ctx context.Context, migrator *goose.Provider) error) error {
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	logger, err := commandLogger()
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
+	migrator, database, err := newMigrator(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	return fn(ctx, migrator)
+}
+
+// newMigrator opens the database selected in the config like newStorage, but leaves the schema as it is.
+func newMigrator(ctx context.Context, logger *zap.Logger) (*goose.Provider, io.Closer, error) {
+	if path := viper.GetString("database.sqlite.path"); path != "" {
+		conn, err := sqlite.Open(ctx, logger, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		migrator, err := conn.Migrator()
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+		return migrator, conn, nil
+	}
+	postgres, err := db.Connect(ctx, logger, viper.GetString("database.postgres.connection_string"))
+	if err != nil {
+		return nil, nil, err
+	}
+	migrator, err := postgres.Migrator()
+	if err != nil {
+		_ = postgres.Close()
+		return nil, nil, err
+	}
+	return migrator, postgres, nil
+}
+
+func init() {
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateRedoCmd, migrateStatusCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -16,6 +16,8 @@ var rootCmd = &cobra.Command{
 	Use:     "gkeeper",
 	Short:   "Server side app for storing files",
 	Version: version.Version,
+	// the commands fail on the database or the config far more often than on their arguments
+	SilenceUsage: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("gkeeper v: " + version.Version)
 	},
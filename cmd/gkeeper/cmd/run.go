@@ -2,22 +2,31 @@
 package cmd
 
 import (
+	"GophKeeper/internal/blobstore"
+	"GophKeeper/internal/notify"
 	"GophKeeper/internal/proto/gkeeper/pb"
 	"GophKeeper/internal/security"
 	"GophKeeper/internal/service"
 	db "GophKeeper/internal/storage"
+	"GophKeeper/internal/storage/sqlite"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/term"
 	"google.golang.org/grpc"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 // LevelMap is a map that associates string keys with zapcore.Level values. It is used to map logging levels from string representations to their corresponding zapcore.Level constants
@@ -36,26 +45,16 @@ var runCmd = &cobra.Command{
 	Short: "A brief description of your command",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		configFile := viper.GetString("config")
-		if configFile != "" {
-			viper.SetConfigFile(configFile)
-		} else {
-			panic(fmt.Errorf("config file not exist"))
-		}
-		if err := viper.ReadInConfig(); err != nil {
-			fmt.Printf(": %s\n", err)
-		}
-		logLevel := getLoggerLevel()
-		config := zap.NewProductionConfig()
-		config.Level = zap.NewAtomicLevelAt(logLevel) // Устанавливаем уровень на Debug
-		logger, err := config.Build()
+		readConfig()
+		logger, err := newLogger(getLoggerLevel())
 		if err != nil {
 			panic(err)
 		}
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
+		mode := migrateMode(cmd)
 		go func() {
-			if err := startGRPCServer(ctx, logger); err != nil {
+			if err := startGRPCServer(ctx, logger, mode); err != nil {
 				log.Fatalf("Failed to start gRPC server: %v", err)
 			}
 		}()
@@ -67,31 +66,22 @@ var runCmd = &cobra.Command{
 	},
 }
 
-func startGRPCServer(ctx context.Context, logger *zap.Logger) error {
-	connString := viper.GetString("database.postgres.connection_string")
-	postgres, err := db.New(ctx, logger, connString)
+func startGRPCServer(ctx context.Context, logger *zap.Logger, migrateMode string) error {
+	storage, database, err := newStorage(ctx, logger, migrateMode)
 	if err != nil {
 		logger.Fatal("Fatal error occurred",
 			zap.String("operation", "database connection"),
 			zap.Error(err),
 		)
 	}
-	userRepo := db.NewUserRepository(postgres)
-	settingsRepo := db.NewSettingsRepository(postgres)
-	credRepo := db.NewCredRepository(postgres)
-	storage := db.NewStorage(userRepo, settingsRepo, credRepo)
-	endpoint := viper.GetString("blockstore.s3.endpoint")
-	accessKey := viper.GetString("blockstore.s3.access_key_id")
-	secretKey := viper.GetString("blockstore.s3.secret_access_key")
-	bucket := viper.GetString("blockstore.s3.bucket")
-	s3service, err := service.NewS3Service(logger, endpoint, accessKey, secretKey, bucket, false)
+	blobStore, err := newBlobStore(logger)
 	if err != nil {
 		logger.Fatal("Fatal error occurred",
-			zap.String("operation", "s3 service creation"),
+			zap.String("operation", "blob store creation"),
 			zap.Error(err),
 		)
 	}
-	err = s3service.InitBucket()
+	err = blobStore.Init(ctx)
 	if err != nil {
 		panic(err)
 	}
@@ -101,29 +91,80 @@ func startGRPCServer(ctx context.Context, logger *zap.Logger) error {
 		logger.Fatal("failed to listen: %v", zap.String("error", err.Error()))
 	}
 	userService := service.NewUserServiceServer(storage, logger)
-	s3service, err = service.NewS3Service(logger, endpoint, accessKey, secretKey, bucket, false)
+	keyProvider, err := newKeyProvider(storage, logger)
 	if err != nil {
-		logger.Fatal("failed to create s3 service: %v", zap.String("error", err.Error()))
+		logger.Fatal("failed to create key provider", zap.Error(err))
 	}
-	secureService := security.NewSecureService(storage, logger)
+	secureService := security.NewSecureService(storage, logger, keyProvider)
 	err = secureService.Init(ctx)
 	if err != nil {
 		logger.Fatal("failed to init secure service: %v", zap.String("error", err.Error()))
 	}
-	authService := security.NewAuthService(storage, logger)
+	jwtKeys, err := newKeyRing(logger)
+	if err != nil {
+		logger.Fatal("failed to load JWT signing keys", zap.Error(err))
+	}
+	totpService := security.NewTOTPService(storage, secureService, logger, viper.GetString("auth.totp_issuer"))
+	authService := security.NewAuthService(storage, logger, jwtKeys, totpService, security.AuthConfig{
+		AccessTokenTTL:  viper.GetDuration("auth.access_token_ttl"),
+		RefreshTokenTTL: viper.GetDuration("auth.refresh_token_ttl"),
+		Lockout: security.LockoutPolicy{
+			MaxFailures:   viper.GetInt("auth.lockout.max_failures"),
+			IPMaxFailures: viper.GetInt("auth.lockout.ip_max_failures"),
+			Window:        viper.GetDuration("auth.lockout.window"),
+			Backoff:       viper.GetDuration("auth.lockout.backoff"),
+			Duration:      viper.GetDuration("auth.lockout.duration"),
+		},
+	})
 	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(authService.GetAuthInterceptor()),
 		grpc.StreamInterceptor(authService.GetAuthStreamInterceptor()))
-	credService := service.NewUserCredService(storage, logger)
-	fileManagerService := service.NewFileManagerService(s3service, userService, authService, credService, secureService)
+	syncService := service.NewSyncService(storage, blobStore, secureService, logger,
+		viper.GetDuration("sync.heartbeat_interval"))
+	credService := service.NewUserCredService(storage, syncService, logger)
+	fileService := service.NewFileService(blobStore, syncService, logger)
+	shareService := service.NewShareLinkService(storage, blobStore, logger,
+		viper.GetString("share.public_url"), viper.GetDuration("share.max_ttl"))
+	trashService := service.NewTrashService(storage, blobStore, syncService, logger, viper.GetDuration("trash.retention"))
+	conflictService := service.NewConflictService(storage, secureService, credService, logger)
+	accountService := service.NewAccountService(storage, blobStore, authService, logger)
+	notifier, err := newNotifier(logger)
+	if err != nil {
+		logger.Fatal("failed to create notifier", zap.Error(err))
+	}
+	emailService := service.NewEmailService(storage, notifier, authService, logger,
+		viper.GetDuration("auth.email_verification_ttl"), viper.GetDuration("auth.password_reset_ttl"))
+	fileManagerService := service.NewFileManagerService(fileService, userService, authService, credService, secureService,
+		shareService, trashService, syncService, conflictService, accountService, emailService)
 	pb.RegisterFileManagerServiceServer(grpcServer, fileManagerService)
+	pb.RegisterAdminServiceServer(grpcServer, service.NewAdminService(storage, authService, logger))
+	shareServer := startShareServer(logger, shareService)
 	go func() {
-		logger.Info("starting credentials rotation ticker...")
-		secureService.StartTickerRotation(ctx)
+		jwtKeys.StartReload(ctx, viper.GetDuration("auth.jwt.reload_interval"), logger)
+	}()
+	go func() {
+		logger.Info("starting multipart upload janitor...")
+		blobstore.StartJanitor(ctx, blobStore, logger, viper.GetDuration("blockstore.janitor.interval"),
+			viper.GetDuration("blockstore.janitor.max_age"))
+	}()
+	go func() {
+		logger.Info("starting change feed...")
+		syncService.StartFeed(ctx)
+	}()
+	go func() {
+		logger.Info("starting trash purge job...")
+		trashService.StartPurgeJob(ctx, viper.GetDuration("trash.purge_interval"))
+	}()
+	go func() {
+		logger.Info("starting account purge job...")
+		accountService.StartPurgeJob(ctx, viper.GetDuration("accounts.purge_interval"))
 	}()
 	go func() {
 		<-ctx.Done()
 		logger.Info("stopping gRPC server...")
-		postgres.Close()
+		_ = database.Close()
+		if shareServer != nil {
+			_ = shareServer.Shutdown(context.Background())
+		}
 		grpcServer.GracefulStop()
 	}()
 	logger.Info(" app is starting on ",
@@ -133,10 +174,257 @@ func startGRPCServer(ctx context.Context, logger *zap.Logger) error {
 	return grpcServer.Serve(lis)
 }
 
+// errNoConfig is returned by loadConfig when --config is not given.
+var errNoConfig = errors.New("config file not exist")
+
+// readConfig reads the file given by --config.
+func readConfig() {
+	if err := loadConfig(); err != nil {
+		if errors.Is(err, errNoConfig) {
+			panic(err)
+		}
+		fmt.Printf(": %s\n", err)
+	}
+}
+
+// loadConfig reads the file given by --config and returns the error instead of going on without it.
+func loadConfig() error {
+	configFile := viper.GetString("config")
+	if configFile == "" {
+		return errNoConfig
+	}
+	viper.SetConfigFile(configFile)
+	return viper.ReadInConfig()
+}
+
+// newKeyRing loads the keys signing the access tokens: the key file at auth.jwt.keys_file, created with
+// a key for auth.jwt.algorithm on the first start, or the HS256 secret at auth.jwt.secret.
+func newKeyRing(logger *zap.Logger) (*security.KeyRing, error) {
+	if path := viper.GetString("auth.jwt.keys_file"); path != "" {
+		keys, err := security.LoadKeyRing(path)
+		if !errors.Is(err, os.ErrNotExist) {
+			return keys, err
+		}
+		keys, err = security.CreateKeyRing(path, jwtAlgorithm())
+		if err == nil {
+			logger.Info("generated JWT signing key", zap.String("path", path), zap.String("kid", keys.Keys()[0].ID))
+		}
+		return keys, err
+	}
+	if secret := viper.GetString("auth.jwt.secret"); secret != "" {
+		return security.NewSecretKeyRing(secret)
+	}
+	return nil, errors.New("no JWT signing key configured, set auth.jwt.keys_file or auth.jwt.secret")
+}
+
+// newKeyProvider creates the provider of the key encryption key selected by crypto.kek.provider: "file"
+// reads crypto.kek.file, created on the first start, "env" reads the variable named by crypto.kek.env and
+// "prompt" asks for a passphrase.
+func newKeyProvider(storage *db.Storage, logger *zap.Logger) (security.KeyProvider, error) {
+	switch provider := viper.GetString("crypto.kek.provider"); provider {
+	case "file":
+		path := viper.GetString("crypto.kek.file")
+		if path == "" {
+			return nil, errors.New("crypto.kek.file is required for the file provider")
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if err := security.CreateKEKFile(path); err != nil {
+				return nil, err
+			}
+			logger.Warn("generated key encryption key, back it up: the data cannot be decrypted without it",
+				zap.String("path", path))
+		}
+		return security.FileKeyProvider{Path: path}, nil
+	case "env":
+		return security.EnvKeyProvider{Name: viper.GetString("crypto.kek.env")}, nil
+	case "prompt":
+		return security.NewPassphraseKeyProvider(storage.SettingsRepository, promptPassphrase), nil
+	case "":
+		return nil, errors.New("no key encryption key configured, set crypto.kek.provider to file, env or prompt")
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", provider)
+	}
+}
+
+// promptPassphrase asks for the passphrase of the key encryption key on the terminal.
+func promptPassphrase(confirm bool) ([]byte, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errors.New("the prompt key provider needs a terminal to ask for the passphrase")
+	}
+	fmt.Fprint(os.Stderr, "Passphrase of the key encryption key: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+	fmt.Fprint(os.Stderr, "Repeat the passphrase: ")
+	repeated, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if string(passphrase) != string(repeated) {
+		return nil, errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// jwtAlgorithm returns the algorithm of new JWT signing keys, Ed25519 unless configured.
+func jwtAlgorithm() string {
+	if algorithm := viper.GetString("auth.jwt.algorithm"); algorithm != "" {
+		return algorithm
+	}
+	return security.AlgEdDSA
+}
+
+// newStorage opens the database selected in the config: SQLite when database.sqlite.path is set,
+// Postgres otherwise. The schema is prepared as the migrate mode says, see db.PrepareSchema.
+// The returned closer releases the database on shutdown.
+func newStorage(ctx context.Context, logger *zap.Logger, mode string) (*db.Storage, io.Closer, error) {
+	migrator, database, err := newMigrator(ctx, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := db.PrepareSchema(ctx, migrator, mode)
+	for _, result := range results {
+		logger.Info("applied migration", zap.String("migration", result.String()))
+	}
+	if err != nil {
+		_ = database.Close()
+		return nil, nil, err
+	}
+	if conn, ok := database.(*sqlite.SQLite); ok {
+		return sqlite.NewStorage(conn), conn, nil
+	}
+	postgres := database.(*db.Postgres)
+	storage := db.NewStorage(
+		db.NewUserRepository(postgres),
+		db.NewSettingsRepository(postgres),
+		db.NewCredRepository(postgres),
+		db.NewShareLinkRepository(postgres),
+		db.NewTrashRepository(postgres),
+		db.NewChangeRepository(postgres),
+		db.NewConflictRepository(postgres),
+		db.NewRevokedTokenRepository(postgres),
+		db.NewSessionRepository(postgres),
+		db.NewTOTPRepository(postgres),
+		db.NewLoginAttemptRepository(postgres),
+		db.NewSecurityEventRepository(postgres),
+		db.NewAccountDeletionRepository(postgres),
+		db.NewEmailTokenRepository(postgres),
+	)
+	storage.ChangeFeed = db.NewChangeFeed(postgres)
+	return storage, postgres, nil
+}
+
+// newBlobStore creates the blob store driver selected by blockstore.driver ("s3" by default or "local").
+func newBlobStore(logger *zap.Logger) (blobstore.BlobStore, error) {
+	switch driver := viper.GetString("blockstore.driver"); driver {
+	case "", "s3":
+		return blobstore.NewS3Store(logger,
+			viper.GetString("blockstore.s3.endpoint"),
+			viper.GetString("blockstore.s3.access_key_id"),
+			viper.GetString("blockstore.s3.secret_access_key"),
+			viper.GetString("blockstore.s3.bucket"),
+			viper.GetBool("blockstore.s3.use_ssl"))
+	case "local":
+		path := viper.GetString("blockstore.local.path")
+		if path == "" {
+			return nil, fmt.Errorf("blockstore.local.path is required for the local driver")
+		}
+		return blobstore.NewLocalStore(logger, path), nil
+	default:
+		return nil, fmt.Errorf("unknown blockstore driver %q", driver)
+	}
+}
+
+// newNotifier creates the notifier selected by notify.driver: "log" by default, "file" or "smtp".
+func newNotifier(logger *zap.Logger) (notify.Notifier, error) {
+	switch driver := viper.GetString("notify.driver"); driver {
+	case "", "log":
+		logger.Warn("emails are written to the log, set notify.driver to smtp to deliver them")
+		return notify.NewLogNotifier(logger), nil
+	case "file":
+		path := viper.GetString("notify.file.path")
+		if path == "" {
+			return nil, fmt.Errorf("notify.file.path is required for the file driver")
+		}
+		return notify.NewFileNotifier(path), nil
+	case "smtp":
+		return notify.NewSMTPNotifier(notify.SMTPConfig{
+			Host:     viper.GetString("notify.smtp.host"),
+			Port:     viper.GetInt("notify.smtp.port"),
+			Username: viper.GetString("notify.smtp.username"),
+			Password: viper.GetString("notify.smtp.password"),
+			From:     viper.GetString("notify.smtp.from"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown notify driver %q", driver)
+	}
+}
+
+// startShareServer starts the unauthenticated HTTP endpoint serving share links.
+// It returns nil if share.listen_address is not configured.
+func startShareServer(logger *zap.Logger, shareService *service.ShareLinkService) *http.Server {
+	address := viper.GetString("share.listen_address")
+	if address == "" {
+		logger.Info("share links endpoint is disabled")
+		return nil
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           shareService.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		logger.Info("share links endpoint is starting on ", zap.String("address", address))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("share links endpoint stopped", zap.Error(err))
+		}
+	}()
+	return server
+}
+
+// migrateMode returns how the schema is prepared before the database is used: the --migrate flag of the
+// command if given, database.migrate otherwise, and check by default.
+func migrateMode(cmd *cobra.Command) string {
+	if flag := cmd.Flags().Lookup("migrate"); flag != nil && flag.Changed {
+		return flag.Value.String()
+	}
+	if mode := viper.GetString("database.migrate"); mode != "" {
+		return mode
+	}
+	return db.MigrateCheck
+}
+
+// addMigrateFlag adds the --migrate flag read by migrateMode.
+func addMigrateFlag(flags *pflag.FlagSet) {
+	flags.String("migrate", "", "How to prepare the database schema: auto applies pending migrations, "+
+		"check refuses to start while any are pending, off checks nothing (default database.migrate or check)")
+}
+
 func init() {
+	addMigrateFlag(runCmd.Flags())
 	rootCmd.AddCommand(runCmd)
 }
 
+// newLogger builds the production logger writing entries of the level and above.
+func newLogger(level zapcore.Level) (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(level)
+	return config.Build()
+}
+
+// commandLogger is the logger of the offline commands: it keeps to warnings and errors unless the config
+// asks for even less, so the output of the command stays readable.
+func commandLogger() (*zap.Logger, error) {
+	level := getLoggerLevel()
+	if level < zapcore.WarnLevel {
+		level = zapcore.WarnLevel
+	}
+	return newLogger(level)
+}
+
 func getLoggerLevel() zapcore.Level {
 	val, ok := LevelMap[viper.GetString("logger.level")]
 	if !ok {
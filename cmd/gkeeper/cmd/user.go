@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/service"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"google.golang.org/grpc/status"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// cliActor names the gkeeper commands in the security log.
+const cliActor = "gkeeper CLI"
+
+// userCmd groups the commands managing the accounts directly in the database
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage the users directly in the database",
+	Long: `The user commands work on the database configured for the server, so they also work when the
+server is down or nobody can log in as an administrator. The schema is checked first, as by run.`,
+}
+
+// userCreateCmd represents the user create command
+var userCreateCmd = &cobra.Command{
+	Use:   "create <username>",
+	Short: "Create a user with a verified email address",
+	Long: `The create command creates a user. The password is asked for twice, or read from the first line
+of stdin when it is not a terminal. The email address is taken as verified.
+
+Examples:
+  gkeeper user create alice --email alice@example.com --config config.yaml
+  gkeeper user create root --email root@example.com --role admin --config config.yaml
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		email, _ := cmd.Flags().GetString("email")
+		role, _ := cmd.Flags().GetString("role")
+		if email == "" {
+			return errors.New("please provide the email address with --email")
+		}
+		password, err := readNewPassword()
+		if err != nil {
+			return err
+		}
+		return withUsers(cmd, func(ctx context.Context, users *service.UserManager) error {
+			user, err := users.CreateUser(ctx, args[0], password, email, role)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created %s %s with ID %s\n", user.Role, user.Username, user.ID)
+			return nil
+		})
+	},
+}
+
+// userListCmd represents the user list command
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all users",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withUsers(cmd, func(ctx context.Context, users *service.UserManager) error {
+			list, err := users.ListUsers(ctx)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "USERNAME\tEMAIL\tROLE\tSTATE\tCREATED")
+			for _, user := range list {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", user.Username, user.Email, user.Role, userState(user),
+					user.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+			}
+			return w.Flush()
+		})
+	},
+}
+
+// userDisableCmd represents the user disable command
+var userDisableCmd = &cobra.Command{
+	Use:   "disable <username>",
+	Short: "Keep a user from logging in and end all of the user's sessions",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withUsers(cmd, func(ctx context.Context, users *service.UserManager) error {
+			user, err := users.FindUser(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			revoked, err := users.SetDisabled(ctx, user, true, cliActor)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("User %s disabled, %d sessions ended\n", user.Username, revoked)
+			return nil
+		})
+	},
+}
+
+// userEnableCmd represents the user enable command
+var userEnableCmd = &cobra.Command{
+	Use:   "enable <username>",
+	Short: "Let a disabled user log in again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withUsers(cmd, func(ctx context.Context, users *service.UserManager) error {
+			user, err := users.FindUser(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if _, err := users.SetDisabled(ctx, user, false, cliActor); err != nil {
+				return err
+			}
+			fmt.Printf("User %s enabled\n", user.Username)
+			return nil
+		})
+	},
+}
+
+// userPromoteCmd represents the user promote command
+var userPromoteCmd = &cobra.Command{
+	Use:   "promote <username>",
+	Short: "Change the role of a user",
+	Long: `The promote command gives a user the admin role, or the role given with --role. The user's
+sessions are ended, since their tokens carry the old role.
+
+Examples:
+  gkeeper user promote alice --config config.yaml
+  gkeeper user promote alice --role user --config config.yaml
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		role, _ := cmd.Flags().GetString("role")
+		return withUsers(cmd, func(ctx context.Context, users *service.UserManager) error {
+			user, err := users.FindUser(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if user.Role == role {
+				fmt.Printf("User %s is %s already\n", user.Username, role)
+				return nil
+			}
+			revoked, err := users.SetRole(ctx, user, role, cliActor)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("User %s is %s now, %d sessions ended\n", user.Username, role, revoked)
+			return nil
+		})
+	},
+}
+
+// withUsers loads the config, opens the database of the server for the command and runs fn. Errors of the services
+// are reduced to their message.
+func withUsers(cmd *cobra.Command, fn func(ctx context.Context, users *service.UserManager) error) error {
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	logger, err := commandLogger()
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
+	ctx := cmd.Context()
+	storage, database, err := newStorage(ctx, logger, migrateMode(cmd))
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	if err := fn(ctx, service.NewUserManager(storage, logger)); err != nil {
+		if st, ok := status.FromError(err); ok {
+			return errors.New(st.Message())
+		}
+		return err
+	}
+	return nil
+}
+
+// readNewPassword asks for a password twice without echoing it. When stdin is not a terminal, as in
+// scripts, the first line of it is the password.
+func readNewPassword() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Print("Password: ")
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	fmt.Print("Repeat password: ")
+	repeated, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(repeated) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(password), nil
+}
+
+func userState(user models.UserDTO) string {
+	switch {
+	case user.DisabledAt != nil:
+		return "disabled"
+	case user.EmailVerifiedAt == nil:
+		return "unverified"
+	default:
+		return "active"
+	}
+}
+
+func init() {
+	userCreateCmd.Flags().String("email", "", "Email address of the user")
+	userCreateCmd.Flags().String("role", models.RoleUser, "Role of the user: user or admin")
+	userPromoteCmd.Flags().String("role", models.RoleAdmin, "New role of the user: user or admin")
+	addMigrateFlag(userCmd.PersistentFlags())
+	userCmd.AddCommand(userCreateCmd, userListCmd, userDisableCmd, userEnableCmd, userPromoteCmd)
+	rootCmd.AddCommand(userCmd)
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"text/tabwriter"
+)
+
+// adminCmd represents the admin command
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Manage the accounts of all users, for administrators",
+	Long: `The admin commands list the users of the server, disable and enable their accounts, change
+their roles and reset their passwords. The server only accepts them from users with the admin
+role; a user whose role changed is logged out and gets the new role with the next login.
+
+Examples:
+  keeperctl admin users --user root
+  keeperctl admin disable --user root tester
+  keeperctl admin set-role --user root tester admin
+  keeperctl admin reset-password --user root tester
+`,
+}
+
+var adminUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "List all users",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := adminClient()
+		if fmClient == nil {
+			return
+		}
+		defer fmClient.Close()
+		res, err := fmClient.ListUsers(context.Background())
+		if err != nil {
+			fmt.Println("error listing users: " + err.Error())
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.Debug)
+		fmt.Fprintln(w, "USERNAME\tEMAIL\tROLE\tCREATED\tSTATE\t")
+		for _, user := range res.GetUsers() {
+			state := "active"
+			switch {
+			case user.GetDisabled():
+				state = "disabled"
+			case !user.GetEmailVerified():
+				state = "unverified"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", user.GetUsername(), user.GetEmail(), user.GetRole(),
+				user.GetCreatedAt(), state)
+		}
+		w.Flush()
+	},
+}
+
+var adminDisableCmd = &cobra.Command{
+	Use:   "disable <username>",
+	Short: "Keep a user from logging in and log the user out",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := adminClient()
+		if fmClient == nil {
+			return
+		}
+		defer fmClient.Close()
+		res, err := fmClient.DisableUser(context.Background(), args[0])
+		if err != nil {
+			fmt.Println("error disabling user: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+		fmt.Printf("Logged out on %d devices\n", res.GetRevokedSessions())
+	},
+}
+
+var adminEnableCmd = &cobra.Command{
+	Use:   "enable <username>",
+	Short: "Let a disabled user log in again",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := adminClient()
+		if fmClient == nil {
+			return
+		}
+		defer fmClient.Close()
+		res, err := fmClient.EnableUser(context.Background(), args[0])
+		if err != nil {
+			fmt.Println("error enabling user: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+	},
+}
+
+var adminSetRoleCmd = &cobra.Command{
+	Use:   "set-role <username> <user|admin>",
+	Short: "Change the role of a user",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := adminClient()
+		if fmClient == nil {
+			return
+		}
+		defer fmClient.Close()
+		res, err := fmClient.SetRole(context.Background(), args[0], args[1])
+		if err != nil {
+			fmt.Println("error changing role: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+	},
+}
+
+var adminResetPasswordCmd = &cobra.Command{
+	Use:   "reset-password <username>",
+	Short: "Replace the password of a user with a temporary one",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := adminClient()
+		if fmClient == nil {
+			return
+		}
+		defer fmClient.Close()
+		res, err := fmClient.ResetUserPassword(context.Background(), args[0])
+		if err != nil {
+			fmt.Println("error resetting password: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+		fmt.Println("Temporary password: " + res.GetTemporaryPassword())
+		fmt.Println("Hand it over securely; the user should change it with keeperctl passwd")
+	},
+}
+
+// adminClient returns a client logged in as the user given with --user, or nil if the login failed.
+func adminClient() *client.FileManagerClient {
+	fmClient := client.NewFMClient(viper.GetString("listen_address"))
+	if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+		fmClient.Close()
+		return nil
+	}
+	return fmClient
+}
+
+func init() {
+	adminCmd.AddCommand(adminUsersCmd, adminDisableCmd, adminEnableCmd, adminSetRoleCmd, adminResetPasswordCmd)
+	rootCmd.AddCommand(adminCmd)
+}
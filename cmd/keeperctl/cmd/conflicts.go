@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/proto/gkeeper/pb"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"text/tabwriter"
+)
+
+// conflictsCmd represents the conflicts command
+var conflictsCmd = &cobra.Command{
+	Use:   "conflicts",
+	Short: "List and resolve conflicting edits of credentials",
+	Long: `A conflict is recorded when credentials are saved from a version that was already
+changed on another device. The conflicts command shows, field by field, the version the
+edit was made from (base), the latest version on the server (remote) and the rejected
+edit (local). Passwords are masked unless --reveal is set.
+
+A conflict is resolved by keeping the local edit, the remote version or a merge of both.
+A merge takes every field from the side that changed it; a field changed on both sides
+has to be given with --username or --password.
+
+Examples:
+  keeperctl conflicts --user tester
+  keeperctl conflicts resolve --user tester --keep local 1c6e0f43-2a5d-4b8e-a7f1-3d9c0e2b4a61
+  keeperctl conflicts resolve --user tester --keep merge --password 1c6e0f43-2a5d-4b8e-a7f1-3d9c0e2b4a61
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		reveal, _ := cmd.Flags().GetBool("reveal")
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		res, err := fmClient.ListConflicts(context.Background())
+		if err != nil {
+			fmt.Println("error listing conflicts: " + err.Error())
+			return
+		}
+		if len(res.GetConflicts()) == 0 {
+			fmt.Println("No conflicts")
+			return
+		}
+		for _, conflict := range res.GetConflicts() {
+			printConflict(conflict, reveal)
+		}
+	},
+}
+
+var conflictsResolveCmd = &cobra.Command{
+	Use:   "resolve <id>",
+	Short: "Resolve a conflict",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keep, _ := cmd.Flags().GetString("keep")
+		username, _ := cmd.Flags().GetString("username")
+		askPassword, _ := cmd.Flags().GetBool("password")
+		if keep != "local" && keep != "remote" && keep != "merge" {
+			fmt.Println("--keep must be local, remote or merge")
+			return
+		}
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		req := &pb.ResolveConflictRequest{Id: args[0], Keep: keep, Username: username}
+		if askPassword {
+			req.Password = utils.ReadPassword("Enter password to keep: ")
+		}
+		res, err := fmClient.ResolveConflict(context.Background(), req)
+		if err != nil {
+			fmt.Println("error resolving conflict: " + err.Error())
+			return
+		}
+		if res.GetVersion() != "" {
+			fmt.Printf("%s, saved version %s\n", res.GetMessage(), res.GetVersion())
+		} else {
+			fmt.Println(res.GetMessage())
+		}
+	},
+}
+
+// printConflict prints the fields of the three versions side by side and marks the sides that changed them.
+func printConflict(conflict *pb.Conflict, reveal bool) {
+	base, remote, local := conflictData(conflict.GetBaseData()), conflictData(conflict.GetRemoteData()),
+		conflictData(conflict.GetLocalData())
+	fmt.Printf("Conflict %s on %q, recorded at %s\n", conflict.GetId(), conflict.GetName(), conflict.GetCreateDate())
+	remoteVersion := fmt.Sprint(conflict.GetRemoteVersion())
+	if conflict.GetRemoteData() == "" {
+		remoteVersion = "deleted"
+	}
+	fmt.Printf("base version %d, remote version %s\n", conflict.GetBaseVersion(), remoteVersion)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.Debug)
+	fmt.Fprintln(w, "FIELD\tBASE\tREMOTE\tLOCAL\tCHANGED")
+	fmt.Fprintf(w, "username\t%s\t%s\t%s\t%s\n", base.Username, remote.Username, local.Username,
+		changedBy(base.Username, remote.Username, local.Username))
+	mask := func(password string) string {
+		if reveal || password == "" {
+			return password
+		}
+		return "********"
+	}
+	fmt.Fprintf(w, "password\t%s\t%s\t%s\t%s\n", mask(base.Password), mask(remote.Password), mask(local.Password),
+		changedBy(base.Password, remote.Password, local.Password))
+	w.Flush()
+	fmt.Println()
+}
+
+// changedBy tells which sides changed the field since the base version.
+func changedBy(base string, remote string, local string) string {
+	switch {
+	case remote == local && remote == base:
+		return ""
+	case remote == local:
+		return "both, same value"
+	case remote != base && local != base:
+		return "both"
+	case remote != base:
+		return "remote"
+	default:
+		return "local"
+	}
+}
+
+func conflictData(data string) models.CredData {
+	var cred models.CredData
+	_ = json.Unmarshal([]byte(data), &cred)
+	return cred
+}
+
+func init() {
+	rootCmd.AddCommand(conflictsCmd)
+	conflictsCmd.AddCommand(conflictsResolveCmd)
+	conflictsCmd.Flags().Bool("reveal", false, "show passwords in clear text")
+	conflictsResolveCmd.Flags().String("keep", "", "local, remote or merge")
+	conflictsResolveCmd.Flags().String("username", "", "username to keep when merging")
+	conflictsResolveCmd.Flags().Bool("password", false, "ask for the password to keep when merging")
+}
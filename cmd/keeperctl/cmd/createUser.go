@@ -71,6 +71,7 @@ func registerUser(reader *bufio.Reader, fmtClient *client.FileManagerClient) boo
 			break
 		}
 		fmt.Println("User " + user + " created")
+		fmt.Println("A verification code was sent to " + email + ", confirm it with: keeperctl verify-email <code>")
 		return true
 	}
 	return false
@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"GophKeeper/cmd/keeperctl/internal/vault"
+	"GophKeeper/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// credCmd represents the cred command group
+var credCmd = &cobra.Command{
+	Use:   "cred",
+	Short: "Read and save credentials",
+	Long: `The cred command group works with the user's credentials.
+
+Every successful call refreshes an encrypted copy of the credentials kept in
+$XDG_DATA_HOME/gophkeeper (~/.local/share/gophkeeper by default). When the server
+cannot be reached, or with --offline, the commands work on that copy, and saved
+credentials are queued and pushed on the next connection.
+
+Examples:
+  keeperctl cred list --user tester
+  keeperctl cred get --user tester github
+  keeperctl cred save --user tester --name github --username octocat
+  keeperctl cred list --user tester --offline
+`,
+}
+
+var credListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List credentials",
+	Run: func(cmd *cobra.Command, args []string) {
+		session, ok := openCredSession(cmd)
+		if !ok {
+			return
+		}
+		defer session.close()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.Debug)
+		fmt.Fprintln(w, "NAME\tUSERNAME\tVERSION\tCREATED")
+		for _, entry := range session.vault.List() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Name, credData(entry).Username, entry.Version, entry.CreateDate)
+		}
+		w.Flush()
+		session.printPending()
+	},
+}
+
+var credGetCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Print the latest version of credentials",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		session, ok := openCredSession(cmd)
+		if !ok {
+			return
+		}
+		defer session.close()
+		entry, found := session.vault.Get(args[0])
+		if !found {
+			fmt.Println("credentials not found: " + args[0])
+			return
+		}
+		data := credData(entry)
+		fmt.Println("name:     " + entry.Name)
+		fmt.Println("username: " + data.Username)
+		fmt.Println("password: " + data.Password)
+		fmt.Println("version:  " + entry.Version)
+		session.printPending()
+	},
+}
+
+var credSaveCmd = &cobra.Command{
+	Use:   "save",
+	Short: "Save a new version of credentials",
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		username, _ := cmd.Flags().GetString("username")
+		if name == "" || username == "" {
+			fmt.Println("--name and --username are required")
+			return
+		}
+		session, ok := openCredSession(cmd)
+		if !ok {
+			return
+		}
+		defer session.close()
+		password := utils.ReadPassword("Enter password to store for " + name + ": ")
+		if password == "" {
+			fmt.Println("password is empty")
+			return
+		}
+		session.vault.Queue(vault.PendingWrite{
+			Name:        name,
+			Username:    username,
+			Password:    password,
+			BaseVersion: session.baseVersion(name),
+			QueuedAt:    time.Now(),
+		})
+		if !session.online {
+			// show the queued version until the server has the real one
+			data, _ := json.Marshal(models.CredData{Username: username, Password: password})
+			session.vault.Put(vault.Entry{
+				Name:       name,
+				Data:       string(data),
+				Version:    "pending",
+				CreateDate: time.Now().Format("2006-01-02 15:04:05"),
+			})
+			fmt.Println("Offline, credentials are queued and will be pushed on the next connection")
+			return
+		}
+		if err := session.sync(); err != nil {
+			fmt.Println("error saving credentials: " + err.Error())
+			session.printPending()
+			return
+		}
+		if len(session.vault.Pending()) == 0 {
+			fmt.Println("Credentials saved")
+		} else {
+			session.printPending()
+		}
+	},
+}
+
+// credSession is a vault opened for a cred command, synced with the server when it is reachable.
+type credSession struct {
+	fmClient *client.FileManagerClient
+	vault    *vault.Vault
+	password string
+	online   bool
+}
+
+// openCredSession asks for the password, logs in unless --offline is set or the server is unreachable,
+// opens the user's vault and syncs it when online.
+func openCredSession(cmd *cobra.Command) (*credSession, bool) {
+	offline, _ := cmd.Flags().GetBool("offline")
+	username := viper.GetString("user")
+	session := &credSession{fmClient: client.NewFMClient(viper.GetString("listen_address"))}
+	for {
+		session.password = utils.ReadPassword("Enter password: ")
+		session.online = false
+		if !offline {
+			err := utils.Authenticate(session.fmClient, username, session.password)
+			switch {
+			case err == nil:
+				session.online = true
+				username = utils.LoggedInAs(username, session.fmClient)
+			case utils.IsUnreachable(err):
+				fmt.Println("Server is unreachable, using the offline vault")
+			default:
+				fmt.Println("error during authentication: " + err.Error())
+				continue
+			}
+		}
+		path, err := vault.Path(username)
+		if err != nil {
+			fmt.Println("error locating vault: " + err.Error())
+			session.fmClient.Close()
+			return nil, false
+		}
+		session.vault, err = vault.Open(path, session.password)
+		if errors.Is(err, vault.ErrWrongPassword) && session.online {
+			session.vault, err = recoverVault(path, session.password)
+		}
+		if errors.Is(err, vault.ErrWrongPassword) {
+			fmt.Println(err.Error())
+			continue
+		}
+		if err != nil {
+			fmt.Println("error opening vault: " + err.Error())
+			session.fmClient.Close()
+			return nil, false
+		}
+		break
+	}
+	if session.online {
+		if err := session.sync(); err != nil {
+			fmt.Println("error syncing, using the offline vault: " + err.Error())
+		}
+	} else if synced := session.vault.SyncedAt(); !synced.IsZero() {
+		fmt.Println("Offline, last synced at " + synced.Format("2006-01-02 15:04:05"))
+	}
+	return session, true
+}
+
+// errVaultKept is returned when the user does not agree to rebuild the offline vault.
+var errVaultKept = errors.New("the offline vault was left as it is")
+
+// recoverVault opens the vault encrypted with a password that was changed from another device. The server
+// has everything but the queued writes, so the vault is kept and rekeyed if the user knows the previous
+// password, and rebuilt from the server only once the user agrees to lose the queued writes.
+func recoverVault(path string, password string) (*vault.Vault, error) {
+	fmt.Println("The offline vault was encrypted with another password, probably the one used before a change")
+	for {
+		previous := utils.ReadPassword("Enter the previous password to keep the queued writes, or nothing to rebuild the vault: ")
+		if previous == "" {
+			break
+		}
+		v, err := vault.Open(path, previous)
+		if errors.Is(err, vault.ErrWrongPassword) {
+			fmt.Println(err.Error())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := v.Rekey(password); err != nil {
+			return nil, err
+		}
+		fmt.Printf("The offline vault is kept with %d queued writes\n", len(v.Pending()))
+		return v, nil
+	}
+	confirmation := utils.ReadLine(`Credentials saved offline and not pushed yet will be lost. Type "rebuild" to confirm: `)
+	if confirmation != "rebuild" {
+		return nil, errVaultKept
+	}
+	return vault.New(path)
+}
+
+// sync pushes the queued writes, pulls the changes made since the last sync and saves the vault.
+func (s *credSession) sync() error {
+	ctx := context.Background()
+	defer s.save()
+	pushed := 0
+	// later writes of the same credentials were made on top of the earlier ones pushed here
+	saved := make(map[string]int64)
+	for _, write := range s.vault.Pending() {
+		base := write.BaseVersion
+		if version, ok := saved[write.Name]; ok {
+			base = version
+		}
+		res, err := s.fmClient.SaveCredentials(ctx, write.Name, write.Username, write.Password, base)
+		if err != nil && status.Code(err) != codes.InvalidArgument {
+			// the write and the ones queued after it are pushed on the next sync
+			s.vault.DropPending(pushed)
+			return err
+		}
+		switch {
+		case err != nil:
+			// a write the server never accepts would block the queue forever
+			fmt.Printf("queued credentials %q were rejected by the server and dropped: %v\n", write.Name, err)
+		case res.GetConflictId() != "":
+			fmt.Printf("credentials %q were changed on another device, see \"keeperctl conflicts\" to resolve conflict %s\n",
+				write.Name, res.GetConflictId())
+		default:
+			saved[write.Name], _ = strconv.ParseInt(res.GetVersion(), 10, 64)
+		}
+		pushed++
+	}
+	s.vault.DropPending(pushed)
+	if s.vault.Revision() == 0 {
+		// credentials saved before the server tracked revisions have no changes to replay
+		creds, err := s.fmClient.GetAllCreds(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(creds.GetCreds()) - 1; i >= 0; i-- {
+			cred := creds.GetCreds()[i]
+			s.vault.Put(vault.Entry{Name: cred.Name, Data: cred.Data, Version: cred.Version, CreateDate: cred.CreateDate})
+		}
+	}
+	for {
+		res, err := s.fmClient.GetChanges(ctx, s.vault.Revision(), 0)
+		if err != nil {
+			return err
+		}
+		for _, change := range res.GetChanges() {
+			if change.GetKind() != "credentials" {
+				continue
+			}
+			if cred := change.GetCreds(); !change.GetDeleted() && cred != nil {
+				s.vault.Put(vault.Entry{Name: cred.Name, Data: cred.Data, Version: cred.Version, CreateDate: cred.CreateDate})
+			} else {
+				s.vault.Delete(change.GetName())
+			}
+		}
+		s.vault.MarkSynced(res.GetRevision())
+		if !res.GetHasMore() {
+			return nil
+		}
+	}
+}
+
+// baseVersion returns the server version of the credentials a new save is made from. A provisional
+// entry of an unpushed save carries the base of that save.
+func (s *credSession) baseVersion(name string) int64 {
+	entry, found := s.vault.Get(name)
+	if !found {
+		return 0
+	}
+	if version, err := strconv.ParseInt(entry.Version, 10, 64); err == nil {
+		return version
+	}
+	pending := s.vault.Pending()
+	for i := len(pending) - 1; i >= 0; i-- {
+		if pending[i].Name == name {
+			return pending[i].BaseVersion
+		}
+	}
+	return 0
+}
+
+func (s *credSession) save() {
+	if err := s.vault.Save(s.password); err != nil {
+		fmt.Println("error saving the offline vault: " + err.Error())
+	}
+}
+
+func (s *credSession) printPending() {
+	if pending := len(s.vault.Pending()); pending > 0 {
+		fmt.Printf("%d saved credentials are waiting to be pushed to the server\n", pending)
+	}
+}
+
+func (s *credSession) close() {
+	if !s.online {
+		s.save()
+	}
+	s.fmClient.Close()
+}
+
+// credData decodes the username and password stored in the entry.
+func credData(entry vault.Entry) models.CredData {
+	var data models.CredData
+	_ = json.Unmarshal([]byte(entry.Data), &data)
+	return data
+}
+
+func init() {
+	rootCmd.AddCommand(credCmd)
+	credCmd.AddCommand(credListCmd, credGetCmd, credSaveCmd)
+	credCmd.PersistentFlags().Bool("offline", false, "use the offline vault without contacting the server")
+	credSaveCmd.Flags().String("name", "", "name of the credentials")
+	credSaveCmd.Flags().String("username", "", "username to store")
+}
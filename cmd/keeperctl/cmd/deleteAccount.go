@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"GophKeeper/cmd/keeperctl/internal/vault"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+)
+
+// deleteAccountCmd represents the delete-account command
+var deleteAccountCmd = &cobra.Command{
+	Use:   "delete-account",
+	Short: "Delete your account with all files and credentials",
+	Long: `The delete-account command deletes your account for good: every version of your files, your
+credentials, links, sessions and the account itself. It asks for the password and for a
+confirmation phrase, and prints what was removed. The session and the offline vault of this
+device are deleted as well.
+
+A deletion that is interrupted is finished by the server in the background; logins to the
+account are rejected from the start.
+
+Examples:
+  keeperctl delete-account --user tester
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		username := viper.GetString("user")
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		username, ok := utils.LoginCycle(username, fmClient)
+		if !ok {
+			return
+		}
+		password := utils.ReadPassword("Enter password: ")
+		phrase := "delete " + username
+		confirmation := utils.ReadLine(fmt.Sprintf("This cannot be undone. Type %q to confirm: ", phrase))
+		if confirmation != phrase {
+			fmt.Println("Account deletion cancelled")
+			return
+		}
+		res, err := fmClient.DeleteAccount(context.Background(), password, confirmation)
+		if err != nil {
+			fmt.Println("error deleting account: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+		fmt.Printf("  file versions: %d (%d bytes)\n", res.GetObjectVersions(), res.GetBytesDeleted())
+		fmt.Printf("  database rows: %d\n", res.GetRowsDeleted())
+		fmt.Printf("  completed at:  %s\n", res.GetCompletedAt())
+		if store, err := utils.SessionStore(); err == nil {
+			if err := store.Delete(username); err != nil {
+				fmt.Println("error deleting session: " + err.Error())
+			}
+		}
+		if path, err := vault.Path(username); err == nil {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Println("error deleting vault: " + err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteAccountCmd)
+}
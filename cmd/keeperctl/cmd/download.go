@@ -43,7 +43,7 @@ Examples:
 			return
 		}
 		fmClient := client.NewFMClient(address)
-		if utils.LoginCycle(username, fmClient) {
+		if _, ok := utils.LoginCycle(username, fmClient); ok {
 			err := downloadFile(fmClient, file, path)
 			if err != nil {
 				_ = fmt.Errorf("error downloading file: %v", err)
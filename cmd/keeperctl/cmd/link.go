@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// linkCmd represents the link command group
+var linkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "Manage expiring download links for your files",
+	Long: `The link command group manages time-limited download links that can be handed to
+people without a GophKeeper account. A link stops working when it expires, when its
+download limit is reached or when it is revoked.
+
+Examples:
+  keeperctl link create --user tester --filename report.pdf --ttl 24h --max-downloads 3
+  keeperctl link ls --user tester
+  keeperctl link rm --user tester 6f1c9a52-0d7e-4c3b-9f59-0a8f1f0c2b11
+`,
+}
+
+var linkCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a download link for a file",
+	Run: func(cmd *cobra.Command, args []string) {
+		filename, _ := cmd.Flags().GetString("filename")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		maxDownloads, _ := cmd.Flags().GetInt32("max-downloads")
+		if filename == "" {
+			fmt.Println("filename is required")
+			return
+		}
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		link, err := fmClient.CreateShareLink(context.Background(), filename, ttl, maxDownloads)
+		if err != nil {
+			fmt.Println("error creating link: " + err.Error())
+			return
+		}
+		fmt.Println("Link " + link.Id + " expires at " + link.ExpiresAt)
+		fmt.Println(link.Url)
+	},
+}
+
+var linkListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List your download links",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		links, err := fmClient.ListShareLinks(context.Background())
+		if err != nil {
+			fmt.Println("error listing links: " + err.Error())
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.Debug)
+		fmt.Fprintln(w, "ID\tFILE\tEXPIRES\tDOWNLOADS\tREVOKED")
+		for _, link := range links.Links {
+			limit := "unlimited"
+			if link.MaxDownloads > 0 {
+				limit = fmt.Sprintf("%d", link.MaxDownloads)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d/%s\t%t\n", link.Id, link.Filename, link.ExpiresAt, link.Downloads, limit, link.Revoked)
+		}
+		w.Flush()
+	},
+}
+
+var linkRemoveCmd = &cobra.Command{
+	Use:   "rm <link-id>",
+	Short: "Revoke a download link",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		if err := fmClient.RevokeShareLink(context.Background(), args[0]); err != nil {
+			fmt.Println("error revoking link: " + err.Error())
+			return
+		}
+		fmt.Println("Link " + args[0] + " revoked")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(linkCmd)
+	linkCmd.AddCommand(linkCreateCmd, linkListCmd, linkRemoveCmd)
+	linkCreateCmd.Flags().StringP("filename", "f", "", "file to share")
+	linkCreateCmd.Flags().Duration("ttl", 24*time.Hour, "how long the link stays valid")
+	linkCreateCmd.Flags().Int32("max-downloads", 0, "number of downloads allowed, 0 for unlimited")
+}
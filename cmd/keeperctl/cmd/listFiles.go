@@ -41,7 +41,7 @@ The command performs the following steps:
 		address := viper.GetString("listen_address")
 		username := viper.GetString("user")
 		fmClient := client.NewFMClient(address)
-		if utils.LoginCycle(username, fmClient) {
+		if _, ok := utils.LoginCycle(username, fmClient); ok {
 			ctx := context.Background()
 			md := metadata.New(map[string]string{"authorization": fmClient.CashedToken})
 			ctx = metadata.NewOutgoingContext(ctx, md)
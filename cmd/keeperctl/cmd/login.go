@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/session"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// loginCmd represents the login command
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in and keep the session for other commands",
+	Long: `The login command asks for the password once and stores the session token, encrypted with
+a key kept next to it, in $XDG_CONFIG_HOME/gophkeeper (~/.config/gophkeeper by default).
+Other commands use the stored session, renewing the short-lived access token with the refresh token,
+and only ask for the password again once the refresh token expires or the session is revoked.
+
+The user is given by the username or the email; an email is remembered, so other commands find
+the session by either.
+
+Examples:
+  keeperctl login --user tester
+  keeperctl login --user tester@example.com
+  keeperctl logout --user tester
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		username := viper.GetString("user")
+		store, err := utils.SessionStore()
+		if err != nil {
+			fmt.Println("error locating configuration directory: " + err.Error())
+			return
+		}
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		username, ok := utils.PromptLogin(username, fmClient)
+		if !ok {
+			return
+		}
+		stored, err := session.New(username, fmClient.Target, fmClient.CashedToken)
+		if err != nil {
+			fmt.Println("error reading session token: " + err.Error())
+			return
+		}
+		stored.RefreshToken = fmClient.RefreshToken
+		if err := store.Save(stored); err != nil {
+			fmt.Println("error saving session: " + err.Error())
+			return
+		}
+		fmt.Println("Logged in, the session is kept until you log out")
+	},
+}
+
+// logoutCmd represents the logout command
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke the stored session and delete it",
+	Run: func(cmd *cobra.Command, args []string) {
+		username := viper.GetString("user")
+		store, err := utils.SessionStore()
+		if err != nil {
+			fmt.Println("error locating configuration directory: " + err.Error())
+			return
+		}
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		stored, err := store.Load(username, fmClient.Target)
+		if errors.Is(err, session.ErrNoSession) {
+			fmt.Println("Not logged in")
+			return
+		}
+		if err != nil {
+			fmt.Println("error reading session: " + err.Error())
+			return
+		}
+		usable := stored.Valid()
+		if !usable && stored.RefreshToken != "" {
+			usable = utils.RefreshSession(fmClient, stored) == nil
+		} else {
+			fmClient.CashedToken = stored.Token
+		}
+		if usable {
+			// an Unauthenticated error means the token is already unusable
+			if err := fmClient.Logout(context.Background()); err != nil && status.Code(err) != codes.Unauthenticated {
+				fmt.Println("error revoking the session on the server, deleting it locally anyway: " + err.Error())
+			}
+		}
+		if err := store.Delete(username); err != nil {
+			fmt.Println("error deleting session: " + err.Error())
+			return
+		}
+		fmt.Println("Logged out")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd, logoutCmd)
+}
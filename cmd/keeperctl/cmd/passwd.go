@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"GophKeeper/cmd/keeperctl/internal/vault"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+)
+
+// passwdCmd represents the passwd command
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Change your password",
+	Long: `The passwd command changes your password and logs you out on every other device. The
+offline vault of this device is re-encrypted with the new password, so the credentials and the
+writes queued in it are kept.
+
+Examples:
+  keeperctl passwd --user tester
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		username := viper.GetString("user")
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		username, ok := utils.LoginCycle(username, fmClient)
+		if !ok {
+			return
+		}
+		oldPassword := utils.ReadPassword("Enter current password: ")
+		newPassword := utils.ReadPassword("Enter new password: ")
+		if newPassword == "" {
+			fmt.Println("error changing password: new password is empty")
+			return
+		}
+		if utils.ReadPassword("Repeat new password: ") != newPassword {
+			fmt.Println("error changing password: passwords do not match")
+			return
+		}
+		// the vault is opened before the change, so it cannot fail once the server has the new password
+		offline, vaultErr := openVault(username, oldPassword)
+		if vaultErr != nil && !errors.Is(vaultErr, vault.ErrWrongPassword) {
+			fmt.Println("error opening vault: " + vaultErr.Error())
+			return
+		}
+		res, err := fmClient.ChangePassword(context.Background(), oldPassword, newPassword)
+		if err != nil {
+			fmt.Println("error changing password: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+		if n := res.GetRevokedSessions(); n > 0 {
+			fmt.Printf("Logged out on %d other devices\n", n)
+		}
+		switch {
+		case vaultErr != nil:
+			fmt.Println("The offline vault was encrypted with another password and is rebuilt from the server on the next use")
+		case offline != nil:
+			if err := offline.Rekey(newPassword); err != nil {
+				fmt.Println("error re-encrypting vault: " + err.Error())
+			}
+		}
+	},
+}
+
+// openVault opens the user's offline vault with the password, or returns nil if there is none.
+func openVault(username string, password string) (*vault.Vault, error) {
+	path, err := vault.Path(username)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return vault.Open(path, password)
+}
+
+func init() {
+	rootCmd.AddCommand(passwdCmd)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// resetPasswordCmd represents the reset-password command
+var resetPasswordCmd = &cobra.Command{
+	Use:   "reset-password",
+	Short: "Set a new password with a code sent to your email address",
+	Long: `The reset-password command sets a new password when the current one is forgotten. A reset
+code is sent to the email address of the account, if it is verified, and the command asks for
+the code and the new password. With --token the code received earlier is used and no new one
+is requested.
+
+All sessions of the account are logged out. The offline vault of a device cannot be opened
+without the old password; it is rebuilt from the server on the next use, and writes queued
+in it are lost.
+
+Examples:
+  keeperctl reset-password --email tester@example.com
+  keeperctl reset-password --token <code> --user tester
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		token, _ := cmd.Flags().GetString("token")
+		if token == "" {
+			email, _ := cmd.Flags().GetString("email")
+			if email == "" {
+				email = utils.ReadLine("Enter the email address of your account: ")
+			}
+			res, err := fmClient.RequestPasswordReset(context.Background(), email)
+			if err != nil {
+				fmt.Println("error requesting password reset: " + err.Error())
+				return
+			}
+			fmt.Println(res.GetMessage())
+			token = utils.ReadLine("Enter the code from the email: ")
+		}
+		newPassword := utils.ReadPassword("Enter new password: ")
+		if newPassword == "" {
+			fmt.Println("error resetting password: new password is empty")
+			return
+		}
+		if utils.ReadPassword("Repeat new password: ") != newPassword {
+			fmt.Println("error resetting password: passwords do not match")
+			return
+		}
+		res, err := fmClient.ResetPassword(context.Background(), token, newPassword)
+		if err != nil {
+			fmt.Println("error resetting password: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+		if n := res.GetRevokedSessions(); n > 0 {
+			fmt.Printf("Logged out on %d devices\n", n)
+		}
+		// the stored session was revoked with the others
+		if username := viper.GetString("user"); username != "" {
+			if store, err := utils.SessionStore(); err == nil {
+				if err := store.Delete(username); err != nil {
+					fmt.Println("error deleting session: " + err.Error())
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	resetPasswordCmd.Flags().String("email", "", "email address of the account")
+	resetPasswordCmd.Flags().String("token", "", "reset code received by email")
+	rootCmd.AddCommand(resetPasswordCmd)
+}
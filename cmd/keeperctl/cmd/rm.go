@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// rmCmd represents the rm command
+var rmCmd = &cobra.Command{
+	Use:   "rm",
+	Short: "Move a file or credentials to the trash bin",
+	Long: `The rm command moves a file or a set of credentials to the trash bin.
+Items stay in the trash bin for the retention period configured on the server
+and can be brought back with "keeperctl trash restore".
+
+Examples:
+  keeperctl rm --user tester --filename report.pdf
+  keeperctl rm --user tester --cred github
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filename, _ := cmd.Flags().GetString("filename")
+		credName, _ := cmd.Flags().GetString("cred")
+		if (filename == "") == (credName == "") {
+			fmt.Println("exactly one of --filename or --cred is required")
+			return
+		}
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		var err error
+		if filename != "" {
+			_, err = fmClient.DeleteFile(context.Background(), filename)
+		} else {
+			_, err = fmClient.DeleteCredentials(context.Background(), credName)
+		}
+		if err != nil {
+			fmt.Println("error deleting: " + err.Error())
+			return
+		}
+		fmt.Println("Moved to trash")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rmCmd)
+	rmCmd.Flags().StringP("filename", "f", "", "file to delete")
+	rmCmd.Flags().String("cred", "", "name of the credentials to delete")
+}
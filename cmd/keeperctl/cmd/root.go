@@ -2,6 +2,7 @@
 package cmd
 
 import (
+	"GophKeeper/cmd/keeperctl/internal/utils"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -21,12 +22,28 @@ Usage:
   gophkeeper [command]
 
 Available Commands:
-  upload        Upload a file to the server
-  download      Download a file from the server
-  encrypt       Encrypt a specified file
-  list-files    List all files on the server
-  list-versions List different versions of a specified file
-  help          Help about any command
+  login          Log in and keep the session for other commands
+  logout         Revoke the stored session and delete it
+  sessions       List the devices you are logged in on and log them out
+  2fa            Manage two-factor authentication
+  passwd         Change your password
+  verify-email   Verify your email address with the code sent to it
+  reset-password Set a new password with a code sent to your email address
+  delete-account Delete your account with all files and credentials
+  admin          Manage the accounts of all users, for administrators
+  upload         Upload a file to the server
+  download       Download a file from the server
+  encrypt        Encrypt a specified file
+  list-files     List all files on the server
+  list-versions  List different versions of a specified file
+  cred           Read and save credentials, also offline
+  conflicts      List and resolve conflicting edits of credentials
+  link           Manage expiring download links for files
+  rm             Move a file or credentials to the trash bin
+  trash          List, restore or empty the trash bin
+  sync           Mirror a local directory with your files on the server
+  watch          Print changes of files and credentials as they happen
+  help           Help about any command
 
 Flags:
   -h, --help     Show help for the root command
@@ -50,7 +67,7 @@ func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().String("config", "", "config file (default is ./config.yaml)")
 	viper.BindPFlag("config", rootCmd.PersistentFlags().Lookup("config"))
-	rootCmd.PersistentFlags().String("user", "", "provide user name")
+	rootCmd.PersistentFlags().String("user", "", "provide user name or email")
 	viper.BindPFlag("user", rootCmd.PersistentFlags().Lookup("user"))
 	rootCmd.PersistentFlags().String("path", "", "path to file to upload")
 	viper.BindPFlag("path", rootCmd.PersistentFlags().Lookup("path"))
@@ -68,6 +85,9 @@ func initConfig() {
 		log.Fatalf("Error reading config file: %s", err)
 	}
 	fmt.Println("Using config file:", viper.ConfigFileUsed())
+	if user := viper.GetString("user"); user != "" {
+		viper.Set("user", utils.ResolveUser(user, viper.GetString("listen_address")))
+	}
 }
 
 func Execute() error {
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"text/tabwriter"
+)
+
+// sessionsCmd represents the sessions command
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List the devices you are logged in on and log them out",
+	Long: `Every login starts a session, named after the host it was made from. The sessions command
+lists the active sessions with the address and time of their last request, and revokes the
+session of a lost device; its tokens are rejected from the next request on.
+
+Examples:
+  keeperctl sessions ls --user tester
+  keeperctl sessions revoke --user tester 1c6e0f43-2a5d-4b8e-a7f1-3d9c0e2b4a61
+`,
+}
+
+var sessionsLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the active sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		res, err := fmClient.ListSessions(context.Background())
+		if err != nil {
+			fmt.Println("error listing sessions: " + err.Error())
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.Debug)
+		fmt.Fprintln(w, "ID\tDEVICE\tCLIENT\tIP\tCREATED\tLAST SEEN\t")
+		for _, session := range res.GetSessions() {
+			id := session.GetId()
+			if session.GetCurrent() {
+				id += " (this one)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", id, session.GetDevice(), session.GetClientVersion(),
+				session.GetIp(), session.GetCreatedAt(), session.GetLastSeenAt())
+		}
+		w.Flush()
+	},
+}
+
+var sessionsRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Log a session out",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		res, err := fmClient.RevokeSession(context.Background(), args[0])
+		if err != nil {
+			fmt.Println("error revoking session: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+	},
+}
+
+func init() {
+	sessionsCmd.AddCommand(sessionsLsCmd, sessionsRevokeCmd)
+	rootCmd.AddCommand(sessionsCmd)
+}
@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/dirsync"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"GophKeeper/cmd/keeperctl/internal/vault"
+	"GophKeeper/internal/proto/gkeeper/pb"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync <dir>",
+	Short: "Mirror a local directory with your files on the server",
+	Long: `The sync command keeps a local directory and the files on the server in step: new and
+changed local files are uploaded, files changed on the server are downloaded, and deletes
+are propagated according to --delete:
+
+  both    deletes on either side are applied to the other (default)
+  remote  local deletes are applied to the server, files deleted on the server are uploaded again
+  local   deletes on the server are applied locally, files deleted locally are downloaded again
+  none    deleted files are always copied back from the other side
+
+Files deleted on the server go to the trash bin and can be restored with "keeperctl trash".
+When a file was changed on both sides, the server version is downloaded and the local one is
+kept next to it as <name>.conflict-<time>.<ext>, to be uploaded on the next sync.
+
+The hashes and version IDs seen on the last sync are kept in $XDG_DATA_HOME/gophkeeper/sync.
+
+Examples:
+  keeperctl sync --user tester ~/Documents
+  keeperctl sync --user tester --remote-prefix photos --dry-run ~/Pictures
+  keeperctl sync --user tester --watch --delete none ~/Documents
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		prefix, _ := cmd.Flags().GetString("remote-prefix")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		watch, _ := cmd.Flags().GetBool("watch")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		policyName, _ := cmd.Flags().GetString("delete")
+		policy, err := dirsync.ParsePolicy(policyName)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		if interval <= 0 {
+			fmt.Println("interval must be positive")
+			return
+		}
+		dir, err := filepath.Abs(args[0])
+		if err != nil {
+			fmt.Println("error resolving directory: " + err.Error())
+			return
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			fmt.Println("not a directory: " + dir)
+			return
+		}
+		prefix = strings.Trim(prefix, "/")
+		username := viper.GetString("user")
+		dataDir, err := vault.DataDir()
+		if err != nil {
+			fmt.Println("error locating data directory: " + err.Error())
+			return
+		}
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		username, ok := utils.LoginCycle(username, fmClient)
+		if !ok {
+			return
+		}
+		s := &dirSync{
+			fmClient:  fmClient,
+			dir:       dir,
+			prefix:    prefix,
+			policy:    policy,
+			dryRun:    dryRun,
+			statePath: dirsync.StatePath(dataDir, username, dir, prefix),
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := s.run(ctx); err != nil {
+			fmt.Println("error syncing: " + err.Error())
+			if !watch || status.Code(err) == codes.Unauthenticated {
+				return
+			}
+		}
+		if watch && !dryRun {
+			s.watch(ctx, interval)
+		}
+	},
+}
+
+// dirSync syncs a directory with the files under a remote prefix.
+type dirSync struct {
+	fmClient  *client.FileManagerClient
+	dir       string
+	prefix    string
+	policy    dirsync.DeletePolicy
+	dryRun    bool
+	statePath string
+}
+
+// run makes one sync pass. The state is saved after every pass, also a failed one, so that
+// the files already synced are not transferred again.
+func (s *dirSync) run(ctx context.Context) error {
+	state, err := dirsync.LoadState(s.statePath, s.dir, s.prefix)
+	if err != nil {
+		return err
+	}
+	local, err := dirsync.Scan(s.dir, state)
+	if err != nil {
+		return err
+	}
+	remote, err := s.listRemote(ctx)
+	if err != nil {
+		return err
+	}
+	actions := dirsync.Plan(local, remote, state, s.policy)
+	if s.dryRun {
+		for _, action := range actions {
+			if action.Kind != dirsync.Forget {
+				fmt.Printf("would %s\t%s\n", action.Kind, action.Path)
+			}
+		}
+		if len(actions) == 0 {
+			fmt.Println("Everything is in sync")
+		}
+		return nil
+	}
+	var failed int
+	for _, action := range actions {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := s.apply(ctx, state, local, action); err != nil {
+			if status.Code(err) == codes.Unauthenticated {
+				_ = state.Save(s.statePath)
+				return err
+			}
+			fmt.Printf("error: %s %s: %v\n", action.Kind, action.Path, err)
+			failed++
+		}
+	}
+	if err := state.Save(s.statePath); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files were not synced", failed, len(actions))
+	}
+	return nil
+}
+
+// listRemote returns the latest version IDs of the files under the prefix, keyed by relative path.
+func (s *dirSync) listRemote(ctx context.Context) (map[string]string, error) {
+	files, err := s.fmClient.ListUserFiles(s.fmClient.AuthContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	remote := make(map[string]string)
+	for _, object := range files.GetObjects() {
+		// keys are <user id>/<file name>
+		_, name, found := strings.Cut(object.GetKey(), "/")
+		if !found {
+			continue
+		}
+		if rel, ok := dirsync.LocalPath(s.prefix, name); ok {
+			remote[rel] = object.GetVersionID()
+		}
+	}
+	return remote, nil
+}
+
+func (s *dirSync) apply(ctx context.Context, state *dirsync.State, local map[string]dirsync.LocalFile, action dirsync.Action) error {
+	localPath := filepath.Join(s.dir, filepath.FromSlash(action.Path))
+	remoteName := dirsync.RemoteName(s.prefix, action.Path)
+	switch action.Kind {
+	case dirsync.Upload:
+		versionID, err := syncUpload(ctx, s.fmClient, localPath, remoteName)
+		if err != nil {
+			return err
+		}
+		file := local[action.Path]
+		state.Files[action.Path] = dirsync.FileState{Hash: file.Hash, Size: file.Size, ModTime: file.ModTime, VersionID: versionID}
+		fmt.Println("uploaded\t" + action.Path)
+	case dirsync.Download:
+		tmp, err := s.download(ctx, remoteName, action.VersionID, localPath)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, localPath); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := s.record(state, action, localPath); err != nil {
+			return err
+		}
+		fmt.Println("downloaded\t" + action.Path)
+	case dirsync.DeleteOnRemote:
+		if _, err := s.fmClient.DeleteFile(ctx, remoteName); err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		delete(state.Files, action.Path)
+		fmt.Println("deleted remote\t" + action.Path)
+	case dirsync.DeleteOnLocal:
+		if err := os.Remove(localPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(state.Files, action.Path)
+		fmt.Println("deleted local\t" + action.Path)
+	case dirsync.Conflict:
+		tmp, err := s.download(ctx, remoteName, action.VersionID, localPath)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		remoteHash, err := dirsync.HashFile(tmp)
+		if err != nil {
+			return err
+		}
+		if remoteHash != local[action.Path].Hash {
+			conflictName := dirsync.ConflictName(action.Path, time.Now())
+			if err := os.Rename(localPath, filepath.Join(s.dir, filepath.FromSlash(conflictName))); err != nil {
+				return err
+			}
+			if err := os.Rename(tmp, localPath); err != nil {
+				return err
+			}
+			fmt.Printf("conflict\t%s: changed on both sides, the local copy is kept as %s\n", action.Path, conflictName)
+		}
+		return s.record(state, action, localPath)
+	case dirsync.Forget:
+		delete(state.Files, action.Path)
+	}
+	return nil
+}
+
+// record stores the state of a file that matches the remote version.
+func (s *dirSync) record(state *dirsync.State, action dirsync.Action, localPath string) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	hash, err := dirsync.HashFile(localPath)
+	if err != nil {
+		return err
+	}
+	state.Files[action.Path] = dirsync.FileState{Hash: hash, Size: info.Size(), ModTime: info.ModTime(), VersionID: action.VersionID}
+	return nil
+}
+
+// download fetches the version of the remote file into a temporary file next to localPath and returns its path.
+func (s *dirSync) download(ctx context.Context, remoteName string, versionID string, localPath string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o700); err != nil {
+		return "", err
+	}
+	stream, err := s.fmClient.DownloadFile(s.fmClient.AuthContext(ctx), &pb.DownloadRequest{
+		Filename:  remoteName,
+		VersionID: versionID,
+	})
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), dirsync.TempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			_, err = tmp.Write(res.GetChunk())
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// watch syncs again whenever a file under the prefix changes on the server and every interval,
+// which picks up local changes.
+func (s *dirSync) watch(ctx context.Context, interval time.Duration) {
+	fmt.Println("Watching for changes, press Ctrl+C to stop")
+	remoteChanged := make(chan struct{}, 1)
+	go s.watchRemote(ctx, remoteChanged)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-remoteChanged:
+		}
+		if err := s.run(ctx); err != nil {
+			fmt.Println("error syncing: " + err.Error())
+			if status.Code(err) == codes.Unauthenticated {
+				return
+			}
+		}
+	}
+}
+
+// watchRemote signals changes of files under the prefix until ctx is done, reconnecting when the stream breaks.
+func (s *dirSync) watchRemote(ctx context.Context, changed chan<- struct{}) {
+	var since int64
+	backoff := time.Second
+	for ctx.Err() == nil {
+		stream, err := s.fmClient.WatchChanges(ctx, since)
+		for err == nil {
+			var event *pb.ChangeEvent
+			if event, err = stream.Recv(); err != nil {
+				break
+			}
+			since = event.GetRevision()
+			backoff = time.Second
+			change := event.GetChange()
+			if change == nil || change.GetKind() != "file" {
+				continue
+			}
+			if _, ok := dirsync.LocalPath(s.prefix, change.GetName()); ok {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+		if ctx.Err() != nil || status.Code(err) == codes.Unauthenticated {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxWatchBackoff)
+	}
+}
+
+// syncUpload uploads the local file under the remote name and returns the new version ID.
+func syncUpload(ctx context.Context, fmClient *client.FileManagerClient, localPath string, remoteName string) (string, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	stream, err := fmClient.UploadFile(fmClient.AuthContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, smallFileChunk)
+	for first := true; ; first = false {
+		n, err := file.Read(buf)
+		if err == io.EOF && !first {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		err = stream.Send(&pb.FileChunk{
+			Filename:  remoteName,
+			FileSize:  stat.Size(),
+			ChunkSize: smallFileChunk,
+			Chunk:     buf[:n],
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	return res.GetVersionID(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().String("remote-prefix", "", "directory on the server to mirror, the whole file space by default")
+	syncCmd.Flags().Bool("dry-run", false, "print what would be done without changing anything")
+	syncCmd.Flags().Bool("watch", false, "keep running and sync on every change")
+	syncCmd.Flags().Duration("interval", 10*time.Second, "how often local changes are looked for with --watch")
+	syncCmd.Flags().String("delete", string(dirsync.DeleteBoth), "where deletes are applied: both, remote, local or none")
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"text/tabwriter"
+)
+
+// trashCmd represents the trash command group
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore or empty the trash bin",
+	Long: `The trash command group works with files and credentials deleted by "keeperctl rm".
+
+Examples:
+  keeperctl trash ls --user tester
+  keeperctl trash restore --user tester 2b0b7b0e-8a4c-4f0e-9d2a-52b1c1c4f3aa
+  keeperctl trash empty --user tester
+`,
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the content of the trash bin",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		trash, err := fmClient.ListTrash(context.Background())
+		if err != nil {
+			fmt.Println("error listing trash: " + err.Error())
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.Debug)
+		fmt.Fprintln(w, "ID\tKIND\tNAME\tDELETED\tPURGE AFTER")
+		for _, item := range trash.Items {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", item.Id, item.Kind, item.Name, item.DeletedAt, item.PurgeAfter)
+		}
+		w.Flush()
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Restore an item from the trash bin",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		res, err := fmClient.RestoreFromTrash(context.Background(), args[0])
+		if err != nil {
+			fmt.Println("error restoring: " + err.Error())
+			return
+		}
+		fmt.Println(res.Message)
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Remove everything in the trash bin for good",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		res, err := fmClient.EmptyTrash(context.Background())
+		if err != nil {
+			fmt.Println("error emptying trash: " + err.Error())
+			return
+		}
+		fmt.Printf("%d items removed\n", res.Removed)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashEmptyCmd)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// twoFactorCmd represents the 2fa command
+var twoFactorCmd = &cobra.Command{
+	Use:   "2fa",
+	Short: "Manage two-factor authentication",
+	Long: `With two-factor authentication on, logging in takes a code from an authenticator app
+(Google Authenticator, Aegis, 1Password and the like) besides the password. Recovery codes
+replace the app when it is lost; each of them works once.
+
+Examples:
+  keeperctl 2fa enable --user tester
+`,
+}
+
+var twoFactorEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Turn two-factor authentication on",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		enrollment, err := fmClient.EnableTOTP(context.Background())
+		if err != nil {
+			fmt.Println("error enabling two-factor authentication: " + err.Error())
+			return
+		}
+		fmt.Println("Scan the code with your authenticator app:")
+		fmt.Println()
+		fmt.Print(enrollment.GetQrCode())
+		fmt.Println()
+		fmt.Println("or enter the key " + enrollment.GetSecret() + " by hand.")
+		for {
+			code := utils.ReadLine("Enter the code the app shows: ")
+			res, err := fmClient.ConfirmTOTP(context.Background(), code)
+			if status.Code(err) == codes.Unauthenticated {
+				fmt.Println(status.Convert(err).Message())
+				continue
+			}
+			if err != nil {
+				fmt.Println("error confirming two-factor authentication: " + err.Error())
+				return
+			}
+			fmt.Println(res.GetMessage())
+			fmt.Println("Keep these recovery codes in a safe place, they are shown only once:")
+			for _, recoveryCode := range res.GetRecoveryCodes() {
+				fmt.Println("  " + recoveryCode)
+			}
+			return
+		}
+	},
+}
+
+func init() {
+	twoFactorCmd.AddCommand(twoFactorEnableCmd)
+	rootCmd.AddCommand(twoFactorCmd)
+}
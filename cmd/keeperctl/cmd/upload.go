@@ -55,7 +55,7 @@ The command performs the following steps:
 			return
 		}
 		fmClient := client.NewFMClient(address)
-		if utils.LoginCycle(username, fmClient) {
+		if _, ok := utils.LoginCycle(username, fmClient); ok {
 			uploadFile(path, fmClient)
 
 		}
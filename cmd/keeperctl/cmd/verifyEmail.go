@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// verifyEmailCmd represents the verify-email command
+var verifyEmailCmd = &cobra.Command{
+	Use:   "verify-email [code]",
+	Short: "Verify your email address with the code sent to it",
+	Long: `The verify-email command confirms that the email address of your account belongs to you,
+using the code sent to it when the account was created. Until then the account is limited:
+for example, files cannot be shared with links.
+
+With --resend a new code is sent instead; the previous one stops working.
+
+Examples:
+  keeperctl verify-email <code>
+  keeperctl verify-email --resend --user tester
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if resend, _ := cmd.Flags().GetBool("resend"); resend {
+			if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+				return
+			}
+			res, err := fmClient.ResendVerification(context.Background())
+			if err != nil {
+				fmt.Println("error sending verification code: " + err.Error())
+				return
+			}
+			fmt.Println(res.GetMessage())
+			return
+		}
+		code := ""
+		if len(args) == 1 {
+			code = args[0]
+		} else {
+			code = utils.ReadLine("Enter the code from the email: ")
+		}
+		res, err := fmClient.VerifyEmail(context.Background(), code)
+		if err != nil {
+			fmt.Println("error verifying email: " + err.Error())
+			return
+		}
+		fmt.Println(res.GetMessage())
+	},
+}
+
+func init() {
+	verifyEmailCmd.Flags().Bool("resend", false, "send a new verification code")
+	rootCmd.AddCommand(verifyEmailCmd)
+}
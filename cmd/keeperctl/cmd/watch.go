@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/utils"
+	"GophKeeper/internal/proto/gkeeper/pb"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// maxWatchBackoff caps the delay between reconnect attempts of the watch command.
+const maxWatchBackoff = 30 * time.Second
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print changes of files and credentials as they happen",
+	Long: `The watch command prints every change of the user's files and credentials,
+including the ones made from other devices, until it is interrupted.
+After a lost connection it reconnects and resumes from the last revision it has seen.
+
+Examples:
+  keeperctl watch --user tester
+  keeperctl watch --user tester --since 42
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		since, _ := cmd.Flags().GetInt64("since")
+		fmClient := client.NewFMClient(viper.GetString("listen_address"))
+		defer fmClient.Close()
+		if _, ok := utils.LoginCycle(viper.GetString("user"), fmClient); !ok {
+			return
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		backoff := time.Second
+		for ctx.Err() == nil {
+			last, err := watchChanges(ctx, fmClient, since)
+			if last > since {
+				since = last
+				backoff = time.Second
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if status.Code(err) == codes.Unauthenticated {
+				fmt.Println("session expired: " + err.Error())
+				return
+			}
+			fmt.Printf("connection lost (%v), reconnecting in %s...\n", err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, maxWatchBackoff)
+		}
+	},
+}
+
+// watchChanges prints the events of one stream and returns the last revision received.
+func watchChanges(ctx context.Context, fmClient *client.FileManagerClient, since int64) (int64, error) {
+	stream, err := fmClient.WatchChanges(ctx, since)
+	if err != nil {
+		return since, err
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return since, err
+		}
+		since = event.GetRevision()
+		if event.GetHeartbeat() {
+			continue
+		}
+		printChange(event.GetChange())
+	}
+}
+
+func printChange(change *pb.Change) {
+	action := "updated"
+	if change.GetDeleted() {
+		action = "deleted"
+	}
+	fmt.Printf("%s\t#%d\t%s %s %s", change.GetChangedAt(), change.GetRevision(), change.GetKind(), change.GetName(), action)
+	if file := change.GetFile(); file != nil {
+		fmt.Printf(" (%d bytes, version %s)", file.GetSize(), file.GetVersionID())
+	}
+	fmt.Println()
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().Int64("since", 0, "revision to resume from; 0 replays the current state")
+}
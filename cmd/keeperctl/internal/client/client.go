@@ -3,6 +3,7 @@ package client
 import (
 	"GophKeeper/internal/proto/gkeeper/pb"
 	"GophKeeper/internal/security"
+	"GophKeeper/internal/version"
 	"context"
 	"fmt"
 	"google.golang.org/grpc"
@@ -10,12 +11,25 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"log"
+	"os"
+	"time"
 )
 
+// loginTimeout bounds the login call, so an unreachable server is detected instead of waited for.
+const loginTimeout = 10 * time.Second
+
 type FileManagerClient struct {
+	// Target is the address of the server.
+	Target      string
 	CashedToken string
-	Client      pb.FileManagerServiceClient
-	Close       func() error
+	// RefreshToken exchanges for a new access token once CashedToken expires.
+	RefreshToken string
+	// Username is the name the server logged in as, which the login may have given by email.
+	Username string
+	Client   pb.FileManagerServiceClient
+	// Admin calls the administration methods, which the server allows to administrators only.
+	Admin pb.AdminServiceClient
+	Close func() error
 }
 
 func NewFMClient(target string) *FileManagerClient {
@@ -27,7 +41,9 @@ func NewFMClient(target string) *FileManagerClient {
 	}
 	client := pb.NewFileManagerServiceClient(conn)
 	return &FileManagerClient{
+		Target: target,
 		Client: client,
+		Admin:  pb.NewAdminServiceClient(conn),
 		Close: func() error {
 			return conn.Close()
 		},
@@ -35,27 +51,57 @@ func NewFMClient(target string) *FileManagerClient {
 
 }
 
-// GetAuthToken retrieves a token from an authentication service
-func (c *FileManagerClient) GetAuthToken(username string, password string) error {
-	ctx := context.Background()
+// GetAuthToken retrieves a token from an authentication service. otp is the code of the second factor,
+// empty unless the server asked for it.
+func (c *FileManagerClient) GetAuthToken(username string, password string, otp string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+	defer cancel()
 	md := metadata.New(nil)
 	ctx = metadata.NewOutgoingContext(ctx, md)
 	headers := metadata.MD{}
-	_, err := c.Client.Login(ctx, &pb.LoginRequest{
-		Username: username,
-		Password: password,
+	device, _ := os.Hostname()
+	resp, err := c.Client.Login(ctx, &pb.LoginRequest{
+		Username:      username,
+		Password:      password,
+		Device:        device,
+		ClientVersion: version.Version,
+		Otp:           otp,
 	}, grpc.Header(&headers))
 	if err != nil {
-		return fmt.Errorf("failed to login: %v", err)
+		return fmt.Errorf("failed to login: %w", err)
 	}
 	if token, ok := headers["authorization"]; ok {
 		c.CashedToken = token[0]
+		c.RefreshToken = resp.GetRefreshToken()
+		c.Username = resp.GetUsername()
 		return nil
 	} else {
 		return fmt.Errorf("authorization header not found in response")
 	}
 }
 
+// Refresh exchanges the refresh token for a new pair of tokens. The old refresh token is no longer valid afterwards.
+func (c *FileManagerClient) Refresh(ctx context.Context) error {
+	if c.RefreshToken == "" {
+		return fmt.Errorf("no refresh token")
+	}
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+	resp, err := c.Client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: c.RefreshToken})
+	if err != nil {
+		return err
+	}
+	c.CashedToken = resp.GetAccessToken()
+	c.RefreshToken = resp.GetRefreshToken()
+	return nil
+}
+
+// Logout revokes the cached token on the server.
+func (c *FileManagerClient) Logout(ctx context.Context) error {
+	_, err := c.Client.Logout(c.AuthContext(ctx), &emptypb.Empty{})
+	return err
+}
+
 func (c *FileManagerClient) CreateUser(username string, password string, email string) (string, error) {
 	user, err := c.Client.CreateUser(context.Background(), &pb.CreateUserRequest{
 		Username: username,
@@ -79,6 +125,149 @@ func (c *FileManagerClient) ListUserFiles(ctx context.Context) (*pb.ListUserFile
 	return c.Client.ListUserFiles(ctx, &emptypb.Empty{})
 }
 
+// AuthContext returns a child of ctx carrying the cached token in the outgoing metadata.
+func (c *FileManagerClient) AuthContext(ctx context.Context) context.Context {
+	md := metadata.New(map[string]string{"authorization": c.CashedToken})
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func (c *FileManagerClient) CreateShareLink(ctx context.Context, filename string, ttl time.Duration, maxDownloads int32) (*pb.CreateShareLinkResponse, error) {
+	return c.Client.CreateShareLink(c.AuthContext(ctx), &pb.CreateShareLinkRequest{
+		Filename:     filename,
+		TtlSeconds:   int64(ttl.Seconds()),
+		MaxDownloads: maxDownloads,
+	})
+}
+
+func (c *FileManagerClient) ListShareLinks(ctx context.Context) (*pb.ListShareLinksResponse, error) {
+	return c.Client.ListShareLinks(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+func (c *FileManagerClient) RevokeShareLink(ctx context.Context, id string) error {
+	_, err := c.Client.RevokeShareLink(c.AuthContext(ctx), &pb.RevokeShareLinkRequest{Id: id})
+	return err
+}
+
+func (c *FileManagerClient) DeleteFile(ctx context.Context, filename string) (*pb.DeleteResponse, error) {
+	return c.Client.DeleteFile(c.AuthContext(ctx), &pb.DeleteFileRequest{Filename: filename})
+}
+
+func (c *FileManagerClient) DeleteCredentials(ctx context.Context, name string) (*pb.DeleteResponse, error) {
+	return c.Client.DeleteCredentials(c.AuthContext(ctx), &pb.DeleteCredentialsRequest{Name: name})
+}
+
+func (c *FileManagerClient) ListTrash(ctx context.Context) (*pb.ListTrashResponse, error) {
+	return c.Client.ListTrash(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+func (c *FileManagerClient) RestoreFromTrash(ctx context.Context, id string) (*pb.RestoreFromTrashResponse, error) {
+	return c.Client.RestoreFromTrash(c.AuthContext(ctx), &pb.RestoreFromTrashRequest{Id: id})
+}
+
+func (c *FileManagerClient) EmptyTrash(ctx context.Context) (*pb.EmptyTrashResponse, error) {
+	return c.Client.EmptyTrash(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+// GetChanges returns a page of files and credentials changed after the given revision.
+func (c *FileManagerClient) GetChanges(ctx context.Context, sinceRevision int64, pageSize int32) (*pb.GetChangesResponse, error) {
+	return c.Client.GetChanges(c.AuthContext(ctx), &pb.GetChangesRequest{
+		SinceRevision: sinceRevision,
+		PageSize:      pageSize,
+	})
+}
+
+// WatchChanges opens a stream of changes recorded after the given revision.
+func (c *FileManagerClient) WatchChanges(ctx context.Context, sinceRevision int64) (grpc.ServerStreamingClient[pb.ChangeEvent], error) {
+	return c.Client.WatchChanges(c.AuthContext(ctx), &pb.WatchChangesRequest{
+		SinceRevision: sinceRevision,
+	})
+}
+
+// SaveCredentials stores a new version of the named credentials edited from baseVersion.
+// A zero baseVersion saves new credentials, so a conflict is recorded if they already exist.
+func (c *FileManagerClient) SaveCredentials(ctx context.Context, name string, username string, password string,
+	baseVersion int64) (*pb.SaveCredentialsResponse, error) {
+	return c.Client.SaveCredentials(c.AuthContext(ctx), &pb.SaveCredentialsRequest{
+		Name:        name,
+		Username:    username,
+		Password:    password,
+		BaseVersion: &baseVersion,
+	})
+}
+
+// GetAllCreds returns every version of the user's credentials, newest first.
+func (c *FileManagerClient) GetAllCreds(ctx context.Context) (*pb.AllCredsResponse, error) {
+	return c.Client.GetAllCreds(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+func (c *FileManagerClient) ListConflicts(ctx context.Context) (*pb.ListConflictsResponse, error) {
+	return c.Client.ListConflicts(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+func (c *FileManagerClient) EnableTOTP(ctx context.Context) (*pb.EnableTOTPResponse, error) {
+	return c.Client.EnableTOTP(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+func (c *FileManagerClient) ConfirmTOTP(ctx context.Context, code string) (*pb.ConfirmTOTPResponse, error) {
+	return c.Client.ConfirmTOTP(c.AuthContext(ctx), &pb.ConfirmTOTPRequest{Code: code})
+}
+
+func (c *FileManagerClient) ListSessions(ctx context.Context) (*pb.ListSessionsResponse, error) {
+	return c.Client.ListSessions(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+func (c *FileManagerClient) RevokeSession(ctx context.Context, id string) (*pb.RevokeSessionResponse, error) {
+	return c.Client.RevokeSession(c.AuthContext(ctx), &pb.RevokeSessionRequest{Id: id})
+}
+
+func (c *FileManagerClient) ChangePassword(ctx context.Context, oldPassword string, newPassword string) (*pb.ChangePasswordResponse, error) {
+	return c.Client.ChangePassword(c.AuthContext(ctx), &pb.ChangePasswordRequest{OldPassword: oldPassword, NewPassword: newPassword})
+}
+
+func (c *FileManagerClient) DeleteAccount(ctx context.Context, password string, confirmation string) (*pb.DeleteAccountResponse, error) {
+	return c.Client.DeleteAccount(c.AuthContext(ctx), &pb.DeleteAccountRequest{Password: password, Confirmation: confirmation})
+}
+
+func (c *FileManagerClient) VerifyEmail(ctx context.Context, token string) (*pb.VerifyEmailResponse, error) {
+	return c.Client.VerifyEmail(ctx, &pb.VerifyEmailRequest{Token: token})
+}
+
+func (c *FileManagerClient) ResendVerification(ctx context.Context) (*pb.ResendVerificationResponse, error) {
+	return c.Client.ResendVerification(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+func (c *FileManagerClient) RequestPasswordReset(ctx context.Context, email string) (*pb.RequestPasswordResetResponse, error) {
+	return c.Client.RequestPasswordReset(ctx, &pb.RequestPasswordResetRequest{Email: email})
+}
+
+func (c *FileManagerClient) ResetPassword(ctx context.Context, token string, newPassword string) (*pb.ResetPasswordResponse, error) {
+	return c.Client.ResetPassword(ctx, &pb.ResetPasswordRequest{Token: token, NewPassword: newPassword})
+}
+
+func (c *FileManagerClient) ListUsers(ctx context.Context) (*pb.ListUsersResponse, error) {
+	return c.Admin.ListUsers(c.AuthContext(ctx), &emptypb.Empty{})
+}
+
+func (c *FileManagerClient) DisableUser(ctx context.Context, username string) (*pb.DisableUserResponse, error) {
+	return c.Admin.DisableUser(c.AuthContext(ctx), &pb.DisableUserRequest{Username: username})
+}
+
+func (c *FileManagerClient) EnableUser(ctx context.Context, username string) (*pb.EnableUserResponse, error) {
+	return c.Admin.EnableUser(c.AuthContext(ctx), &pb.EnableUserRequest{Username: username})
+}
+
+func (c *FileManagerClient) SetRole(ctx context.Context, username string, role string) (*pb.SetRoleResponse, error) {
+	return c.Admin.SetRole(c.AuthContext(ctx), &pb.SetRoleRequest{Username: username, Role: role})
+}
+
+func (c *FileManagerClient) ResetUserPassword(ctx context.Context, username string) (*pb.ResetUserPasswordResponse, error) {
+	return c.Admin.ResetUserPassword(c.AuthContext(ctx), &pb.ResetUserPasswordRequest{Username: username})
+}
+
+func (c *FileManagerClient) ResolveConflict(ctx context.Context, req *pb.ResolveConflictRequest) (*pb.ResolveConflictResponse, error) {
+	return c.Client.ResolveConflict(c.AuthContext(ctx), req)
+}
+
 //func (c *FileManagerClient) UploadFileByChunks(ctx context.Context) (grpc.ClientStreamingClient[pb.FileChunk, pb.UploadStatus], error) {
 //	return c.Client.UploadFileByChunks(ctx)
 //}
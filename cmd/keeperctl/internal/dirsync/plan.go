@@ -0,0 +1,206 @@
+package dirsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TempPrefix starts the names of the files being downloaded; they are never synced.
+const TempPrefix = ".gksync-"
+
+// DeletePolicy tells which side a delete is applied to. A delete that is not applied is undone
+// by copying the file back from the other side.
+type DeletePolicy string
+
+const (
+	DeleteBoth   DeletePolicy = "both"   // deletes on either side are applied to the other
+	DeleteRemote DeletePolicy = "remote" // local deletes are applied to the server only
+	DeleteLocal  DeletePolicy = "local"  // server deletes are applied to the directory only
+	DeleteNone   DeletePolicy = "none"   // deleted files are always restored
+)
+
+// ParsePolicy checks the name of a delete policy.
+func ParsePolicy(name string) (DeletePolicy, error) {
+	switch policy := DeletePolicy(name); policy {
+	case DeleteBoth, DeleteRemote, DeleteLocal, DeleteNone:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown delete policy %q, expected both, remote, local or none", name)
+	}
+}
+
+// ActionKind is what has to be done to bring a file in sync.
+type ActionKind string
+
+const (
+	Upload         ActionKind = "upload"
+	Download       ActionKind = "download"
+	DeleteOnRemote ActionKind = "delete remote"
+	DeleteOnLocal  ActionKind = "delete local"
+	// Conflict means both sides changed the file; the contents have to be compared.
+	Conflict ActionKind = "conflict"
+	// Forget means the file is gone from both sides and only its state is left.
+	Forget ActionKind = "forget"
+)
+
+// Action is a step of a sync. VersionID is the remote version to download.
+type Action struct {
+	Kind      ActionKind
+	Path      string
+	VersionID string
+}
+
+// LocalFile is a file found in the synced directory.
+type LocalFile struct {
+	Hash    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Scan hashes the regular files in dir. Files whose size and modification time match the state
+// keep the recorded hash.
+func Scan(dir string, state *State) (map[string]LocalFile, error) {
+	files := make(map[string]LocalFile)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), TempPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		file := LocalFile{Size: info.Size(), ModTime: info.ModTime()}
+		if known, ok := state.Files[rel]; ok && known.Size == file.Size && known.ModTime.Equal(file.ModTime) {
+			file.Hash = known.Hash
+		} else if file.Hash, err = HashFile(p); err != nil {
+			return err
+		}
+		files[rel] = file
+		return nil
+	})
+	return files, err
+}
+
+// HashFile returns the hex SHA-256 of the file contents.
+func HashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Plan compares the local files and the remote versions, keyed by relative path, with the state
+// and returns the actions sorted by path.
+func Plan(local map[string]LocalFile, remote map[string]string, state *State, policy DeletePolicy) []Action {
+	paths := make(map[string]struct{})
+	for p := range local {
+		paths[p] = struct{}{}
+	}
+	for p := range remote {
+		paths[p] = struct{}{}
+	}
+	for p := range state.Files {
+		paths[p] = struct{}{}
+	}
+	var actions []Action
+	for p := range paths {
+		l, localOK := local[p]
+		versionID, remoteOK := remote[p]
+		known, knownOK := state.Files[p]
+		download := Action{Kind: Download, Path: p, VersionID: versionID}
+		if !knownOK {
+			switch {
+			case localOK && remoteOK:
+				actions = append(actions, Action{Kind: Conflict, Path: p, VersionID: versionID})
+			case localOK:
+				actions = append(actions, Action{Kind: Upload, Path: p})
+			default:
+				actions = append(actions, download)
+			}
+			continue
+		}
+		localChanged := !localOK || l.Hash != known.Hash
+		remoteChanged := !remoteOK || versionID != known.VersionID
+		switch {
+		case !localChanged && !remoteChanged:
+		case !remoteChanged && localOK:
+			actions = append(actions, Action{Kind: Upload, Path: p})
+		case !remoteChanged && (policy == DeleteBoth || policy == DeleteRemote):
+			actions = append(actions, Action{Kind: DeleteOnRemote, Path: p})
+		case !remoteChanged:
+			actions = append(actions, download)
+		case !localChanged && remoteOK:
+			actions = append(actions, download)
+		case !localChanged && (policy == DeleteBoth || policy == DeleteLocal):
+			actions = append(actions, Action{Kind: DeleteOnLocal, Path: p})
+		case !localChanged:
+			actions = append(actions, Action{Kind: Upload, Path: p})
+		// both sides changed; an edit wins over a delete
+		case localOK && remoteOK:
+			actions = append(actions, Action{Kind: Conflict, Path: p, VersionID: versionID})
+		case localOK:
+			actions = append(actions, Action{Kind: Upload, Path: p})
+		case remoteOK:
+			actions = append(actions, download)
+		default:
+			actions = append(actions, Action{Kind: Forget, Path: p})
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Path < actions[j].Path
+	})
+	return actions
+}
+
+// RemoteName returns the name on the server of the file at the relative path.
+func RemoteName(prefix string, rel string) string {
+	if prefix == "" {
+		return rel
+	}
+	return prefix + "/" + rel
+}
+
+// LocalPath returns the relative path of the remote file, or false if the file is outside the prefix
+// or cannot be stored in the directory.
+func LocalPath(prefix string, name string) (string, bool) {
+	rel := name
+	if prefix != "" {
+		if !strings.HasPrefix(name, prefix+"/") {
+			return "", false
+		}
+		rel = strings.TrimPrefix(name, prefix+"/")
+	}
+	if !filepath.IsLocal(filepath.FromSlash(rel)) || strings.HasPrefix(path.Base(rel), TempPrefix) {
+		return "", false
+	}
+	return rel, true
+}
+
+// ConflictName returns the relative path the local side of a conflict is kept at.
+func ConflictName(rel string, at time.Time) string {
+	ext := path.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + ".conflict-" + at.Format("20060102-150405") + ext
+}
@@ -0,0 +1,115 @@
+package dirsync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	state := &State{Files: map[string]FileState{
+		"same.txt":           {Hash: "a", VersionID: "v1"},
+		"edited-local.txt":   {Hash: "a", VersionID: "v1"},
+		"edited-remote.txt":  {Hash: "a", VersionID: "v1"},
+		"edited-both.txt":    {Hash: "a", VersionID: "v1"},
+		"deleted-local.txt":  {Hash: "a", VersionID: "v1"},
+		"deleted-remote.txt": {Hash: "a", VersionID: "v1"},
+		"deleted-both.txt":   {Hash: "a", VersionID: "v1"},
+	}}
+	local := map[string]LocalFile{
+		"same.txt":           {Hash: "a"},
+		"edited-local.txt":   {Hash: "b"},
+		"edited-remote.txt":  {Hash: "a"},
+		"edited-both.txt":    {Hash: "b"},
+		"deleted-remote.txt": {Hash: "a"},
+		"new-local.txt":      {Hash: "c"},
+		"new-both.txt":       {Hash: "c"},
+	}
+	remote := map[string]string{
+		"same.txt":          "v1",
+		"edited-local.txt":  "v1",
+		"edited-remote.txt": "v2",
+		"edited-both.txt":   "v2",
+		"deleted-local.txt": "v1",
+		"new-remote.txt":    "v3",
+		"new-both.txt":      "v4",
+	}
+	want := []Action{
+		{Kind: Forget, Path: "deleted-both.txt"},
+		{Kind: DeleteOnRemote, Path: "deleted-local.txt"},
+		{Kind: DeleteOnLocal, Path: "deleted-remote.txt"},
+		{Kind: Conflict, Path: "edited-both.txt", VersionID: "v2"},
+		{Kind: Upload, Path: "edited-local.txt"},
+		{Kind: Download, Path: "edited-remote.txt", VersionID: "v2"},
+		{Kind: Conflict, Path: "new-both.txt", VersionID: "v4"},
+		{Kind: Upload, Path: "new-local.txt"},
+		{Kind: Download, Path: "new-remote.txt", VersionID: "v3"},
+	}
+	if got := Plan(local, remote, state, DeleteBoth); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected plan:\n got %v\nwant %v", got, want)
+	}
+
+	// without propagation deleted files are copied back from the other side
+	got := Plan(local, remote, state, DeleteNone)
+	for _, action := range got {
+		switch action.Path {
+		case "deleted-local.txt":
+			if action.Kind != Download {
+				t.Fatalf("expected the remote copy to be restored, got %v", action)
+			}
+		case "deleted-remote.txt":
+			if action.Kind != Upload {
+				t.Fatalf("expected the local copy to be restored, got %v", action)
+			}
+		}
+	}
+}
+
+func TestScanReusesKnownHashes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "docs", "a.txt")
+	if err := os.WriteFile(p, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, TempPrefix+"partial"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Scan(dir, &State{Files: map[string]FileState{}})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	file, ok := files["docs/a.txt"]
+	if len(files) != 1 || !ok || file.Hash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("unexpected files: %v", files)
+	}
+
+	state := &State{Files: map[string]FileState{
+		"docs/a.txt": {Hash: "recorded", Size: file.Size, ModTime: file.ModTime},
+	}}
+	if files, _ := Scan(dir, state); files["docs/a.txt"].Hash != "recorded" {
+		t.Fatalf("unchanged file was hashed again: %v", files)
+	}
+}
+
+func TestNames(t *testing.T) {
+	if rel, ok := LocalPath("photos", "photos/2024/a.jpg"); !ok || rel != "2024/a.jpg" {
+		t.Fatalf("unexpected local path %q, %v", rel, ok)
+	}
+	for _, name := range []string{"other/a.jpg", "photos/../a.jpg", "photosa.jpg"} {
+		if _, ok := LocalPath("photos", name); ok {
+			t.Fatalf("%q must not be synced", name)
+		}
+	}
+	if name := RemoteName("photos", "2024/a.jpg"); name != "photos/2024/a.jpg" {
+		t.Fatalf("unexpected remote name %q", name)
+	}
+	at := time.Date(2024, 11, 16, 10, 0, 0, 0, time.UTC)
+	if name := ConflictName("docs/report.pdf", at); name != "docs/report.conflict-20241116-100000.pdf" {
+		t.Fatalf("unexpected conflict name %q", name)
+	}
+}
@@ -0,0 +1,78 @@
+// Package dirsync works out how to mirror a local directory with the user's files on the server.
+// It compares both sides with the state recorded after the previous sync to tell which side changed.
+package dirsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileState is a file as it was on both sides after it was last synced.
+type FileState struct {
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	VersionID string    `json:"version_id"`
+}
+
+// State is the sync state of a directory, keyed by slash-separated paths relative to it.
+type State struct {
+	Dir    string               `json:"dir"`
+	Prefix string               `json:"prefix"`
+	Files  map[string]FileState `json:"files"`
+}
+
+// StatePath returns the location of the state of syncing dir with the remote prefix as the user.
+func StatePath(dataDir string, username string, dir string, prefix string) string {
+	sum := sha256.Sum256([]byte(username + "\x00" + dir + "\x00" + prefix))
+	return filepath.Join(dataDir, "sync", username+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// LoadState reads the state at path. A missing file yields an empty state, as before the first sync.
+func LoadState(path string, dir string, prefix string) (*State, error) {
+	state := &State{Dir: dir, Prefix: prefix, Files: make(map[string]FileState)}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, state); err != nil {
+		return nil, fmt.Errorf("malformed sync state %s: %w", path, err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]FileState)
+	}
+	return state, nil
+}
+
+// Save atomically replaces the state file.
+func (s *State) Save(path string) error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,273 @@
+// Package session keeps the tokens of logged in users between keeperctl runs. Session files are
+// encrypted with a random key stored next to them, so a copied session file alone is useless.
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keySize is the size of the AES-256 key encrypting the session files.
+const keySize = 32
+
+// expiryMargin is how long before its expiry a token is no longer used, so it does not expire mid-request.
+const expiryMargin = 30 * time.Second
+
+// ErrNoSession is returned when the user has no usable session.
+var ErrNoSession = errors.New("not logged in")
+
+// Session is a login of a user to a server.
+type Session struct {
+	Username     string    `json:"username"`
+	Address      string    `json:"address"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// New creates a session for the access token. The expiry is read from the token without verifying it;
+// the server does that on every request.
+func New(username string, address string, token string) (*Session, error) {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token: %w", err)
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	return &Session{Username: username, Address: address, Token: token, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
+
+// Valid reports whether the access token can still be used.
+func (s *Session) Valid() bool {
+	return time.Now().Add(expiryMargin).Before(s.ExpiresAt)
+}
+
+// ConfigDir returns the directory keeperctl keeps its configuration in: $XDG_CONFIG_HOME/gophkeeper
+// or ~/.config/gophkeeper.
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gophkeeper"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gophkeeper"), nil
+}
+
+// Store reads and writes the session files in a directory.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store of the session files in dir.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Load returns the user's session with the server at address. It returns ErrNoSession when there is
+// none, it belongs to another server or it cannot be decrypted. An expired session is returned as well,
+// its refresh token may still be usable.
+func (s *Store) Load(username string, address string) (*Session, error) {
+	path, err := s.path(username)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.key(false)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decrypt(key, raw)
+	if err != nil {
+		return nil, ErrNoSession
+	}
+	var session Session
+	if err := json.Unmarshal(plaintext, &session); err != nil {
+		return nil, ErrNoSession
+	}
+	if session.Username != username || session.Address != address {
+		return nil, ErrNoSession
+	}
+	return &session, nil
+}
+
+// Save encrypts the session and atomically replaces the user's session file, readable by the owner only.
+func (s *Store) Save(session *Session) error {
+	path, err := s.path(session.Username)
+	if err != nil {
+		return err
+	}
+	key, err := s.key(true)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := encrypt(key, plaintext)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, ciphertext)
+}
+
+// Delete removes the user's session file. A missing file is not an error.
+func (s *Store) Delete(username string) error {
+	path, err := s.path(username)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SaveAlias remembers that the email logs in as the user on the server at address, so the session
+// and the vault of the user are found by either.
+func (s *Store) SaveAlias(email string, username string, address string) error {
+	aliases, err := s.aliases()
+	if err != nil {
+		return err
+	}
+	if aliases[address] == nil {
+		aliases[address] = make(map[string]string)
+	}
+	aliases[address][strings.ToLower(email)] = username
+	data, err := json.Marshal(aliases)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(s.dir, "aliases.json"), data)
+}
+
+// ResolveAlias returns the user the email logged in as on the server at address, or the email itself
+// if it never did.
+func (s *Store) ResolveAlias(email string, address string) (string, error) {
+	aliases, err := s.aliases()
+	if err != nil {
+		return email, err
+	}
+	if username, ok := aliases[address][strings.ToLower(email)]; ok {
+		return username, nil
+	}
+	return email, nil
+}
+
+// aliases reads the emails of the users by server address.
+func (s *Store) aliases() (map[string]map[string]string, error) {
+	aliases := make(map[string]map[string]string)
+	data, err := os.ReadFile(filepath.Join(s.dir, "aliases.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return aliases, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("malformed aliases file: %w", err)
+	}
+	return aliases, nil
+}
+
+func (s *Store) path(username string) (string, error) {
+	if username == "" || filepath.Base(username) != username {
+		return "", fmt.Errorf("invalid user name %q", username)
+	}
+	return filepath.Join(s.dir, "sessions", username+".session"), nil
+}
+
+// key reads the local key, creating it first if create is set.
+func (s *Store) key(create bool) ([]byte, error) {
+	path := filepath.Join(s.dir, "session.key")
+	key, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		key = make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, writeFile(path, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("malformed session key %s", path)
+	}
+	return key, nil
+}
+
+// writeFile atomically replaces the file with data readable by the owner only.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// encrypt seals the plaintext with AES-256-GCM and prepends the nonce.
+func encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
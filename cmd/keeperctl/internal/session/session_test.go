@@ -0,0 +1,96 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testToken(t *testing.T, expiresAt time.Time) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+	if _, err := store.Load("tester", "localhost:8080"); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("expected ErrNoSession, got %v", err)
+	}
+	session, err := New("tester", "localhost:8080", testToken(t, time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if !session.Valid() {
+		t.Fatal("fresh session is not valid")
+	}
+	if err := store.Save(session); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	for _, name := range []string{"session.key", filepath.Join("sessions", "tester.session")} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Fatalf("%s is readable by others: %v", name, perm)
+		}
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "sessions", "tester.session"))
+	if len(raw) == 0 || string(raw) == session.Token {
+		t.Fatal("session file is not encrypted")
+	}
+
+	loaded, err := store.Load("tester", "localhost:8080")
+	if err != nil || loaded.Token != session.Token || !loaded.ExpiresAt.Equal(session.ExpiresAt) {
+		t.Fatalf("unexpected session: %+v, %v", loaded, err)
+	}
+	if _, err := store.Load("tester", "other:8080"); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("session of another server was used: %v", err)
+	}
+	if err := store.Delete("tester"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.Load("tester", "localhost:8080"); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("expected ErrNoSession after delete, got %v", err)
+	}
+}
+
+func TestExpiredSessionIsNotValid(t *testing.T) {
+	session, err := New("tester", "localhost:8080", testToken(t, time.Now().Add(10*time.Second)))
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if session.Valid() {
+		t.Fatal("session about to expire is valid")
+	}
+	if _, err := New("tester", "localhost:8080", "not-a-token"); err == nil {
+		t.Fatal("expected an error for a malformed token")
+	}
+}
+
+func TestStoreAliases(t *testing.T) {
+	store := NewStore(t.TempDir())
+	if name, err := store.ResolveAlias("tester@example.com", "localhost:8080"); err != nil || name != "tester@example.com" {
+		t.Fatalf("unknown alias: %q, %v", name, err)
+	}
+	if err := store.SaveAlias("Tester@Example.com", "tester", "localhost:8080"); err != nil {
+		t.Fatalf("save alias: %v", err)
+	}
+	if name, err := store.ResolveAlias("tester@example.COM", "localhost:8080"); err != nil || name != "tester" {
+		t.Fatalf("resolve alias: %q, %v", name, err)
+	}
+	if name, _ := store.ResolveAlias("tester@example.com", "otherhost:8080"); name != "tester@example.com" {
+		t.Fatalf("alias of another server resolved to %q", name)
+	}
+}
@@ -2,24 +2,164 @@ package utils
 
 import (
 	"GophKeeper/cmd/keeperctl/internal/client"
+	"GophKeeper/cmd/keeperctl/internal/session"
+	"bufio"
+	"context"
 	"fmt"
 	"golang.org/x/term"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
 	"strings"
 	"syscall"
 )
 
-func LoginCycle(username string, fmClient *client.FileManagerClient) bool {
+// LoginCycle authorizes the client with the session stored by "keeperctl login", refreshing it when the
+// access token has expired, or asks for the password when there is no usable one. It returns the name
+// of the user logged in, which differs from the given one when the user was given by a new email.
+func LoginCycle(username string, fmClient *client.FileManagerClient) (string, bool) {
+	stored, err := LoadSession(username, fmClient.Target)
+	if err != nil {
+		return PromptLogin(username, fmClient)
+	}
+	fmClient.CashedToken, fmClient.RefreshToken = stored.Token, stored.RefreshToken
+	if stored.Valid() {
+		return username, true
+	}
+	if RefreshSession(fmClient, stored) == nil {
+		return username, true
+	}
+	return PromptLogin(username, fmClient)
+}
+
+// RefreshSession exchanges the session's refresh token for new tokens and stores them.
+func RefreshSession(fmClient *client.FileManagerClient, stored *session.Session) error {
+	fmClient.RefreshToken = stored.RefreshToken
+	if err := fmClient.Refresh(context.Background()); err != nil {
+		return err
+	}
+	refreshed, err := session.New(stored.Username, stored.Address, fmClient.CashedToken)
+	if err != nil {
+		return err
+	}
+	refreshed.RefreshToken = fmClient.RefreshToken
+	store, err := SessionStore()
+	if err != nil {
+		return err
+	}
+	return store.Save(refreshed)
+}
+
+// PromptLogin asks for the password until the login succeeds and returns the name of the user logged in.
+func PromptLogin(username string, fmClient *client.FileManagerClient) (string, bool) {
 	for {
-		fmt.Print("Enter password: ")
-		bytePassword, _ := term.ReadPassword(syscall.Stdin)
-		fmt.Println()
-		password := strings.TrimSpace(string(bytePassword))
-		err := fmClient.GetAuthToken(username, password)
+		password := ReadPassword("Enter password: ")
+		err := Authenticate(fmClient, username, password)
 		if err != nil {
 			fmt.Print("error during authentication: " + err.Error() + "\n")
 			continue
 		}
+		username = LoggedInAs(username, fmClient)
 		fmt.Println("You are logged in as " + username)
+		return username, true
+	}
+}
+
+// LoggedInAs returns the name of the user the client has just logged in as with the given login.
+// A login by email is remembered, so the session and vault of the user are found by either.
+func LoggedInAs(login string, fmClient *client.FileManagerClient) string {
+	name := fmClient.Username
+	if name == "" || name == login {
+		return login
+	}
+	rememberAlias(login, name, fmClient.Target)
+	return name
+}
+
+// Authenticate logs in with the password and, when the server requires a second factor, asks for
+// the code of the authenticator app or a recovery code until the server accepts it.
+func Authenticate(fmClient *client.FileManagerClient, username string, password string) error {
+	err := fmClient.GetAuthToken(username, password, "")
+	if status.Code(err) != codes.FailedPrecondition {
+		return err
+	}
+	for {
+		code := ReadLine("Enter authentication code or recovery code: ")
+		err = fmClient.GetAuthToken(username, password, code)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+		fmt.Println("error during authentication: " + err.Error())
+	}
+}
+
+// ResolveUser returns the name of the user an email given with --user logged in as before, so the
+// user's session and vault are shared by both. Anything else is returned as is.
+func ResolveUser(login string, address string) string {
+	if !strings.Contains(login, "@") {
+		return login
+	}
+	store, err := SessionStore()
+	if err != nil {
+		return login
+	}
+	username, err := store.ResolveAlias(login, address)
+	if err != nil {
+		fmt.Println("error reading aliases: " + err.Error())
+	}
+	return username
+}
+
+func rememberAlias(email string, username string, address string) {
+	store, err := SessionStore()
+	if err == nil {
+		err = store.SaveAlias(email, username, address)
+	}
+	if err != nil {
+		fmt.Println("error saving alias: " + err.Error())
+	}
+}
+
+// SessionStore returns the store of the session files in the configuration directory.
+func SessionStore() (*session.Store, error) {
+	dir, err := session.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return session.NewStore(dir), nil
+}
+
+// LoadSession returns the user's stored session with the server.
+func LoadSession(username string, address string) (*session.Session, error) {
+	store, err := SessionStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Load(username, address)
+}
+
+// ReadPassword prompts for a password without echoing it.
+func ReadPassword(prompt string) string {
+	fmt.Print(prompt)
+	bytePassword, _ := term.ReadPassword(syscall.Stdin)
+	fmt.Println()
+	return strings.TrimSpace(string(bytePassword))
+}
+
+// ReadLine prompts for a line of input and returns it without surrounding spaces.
+func ReadLine(prompt string) string {
+	fmt.Print(prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// IsUnreachable reports whether the error means the server could not be reached at all,
+// as opposed to the server rejecting the request.
+func IsUnreachable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
 		return true
+	default:
+		return false
 	}
 }
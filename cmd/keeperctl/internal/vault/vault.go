@@ -0,0 +1,306 @@
+// Package vault keeps an encrypted copy of the user's credentials on disk, so keeperctl
+// can serve them and queue changes while the server is unreachable.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// formatVersion is the version of the vault file layout.
+const formatVersion = 1
+
+// Parameters of the argon2id derivation of the key encrypting the vault key.
+const (
+	kdfTime    = 1
+	kdfMemory  = 64 * 1024
+	kdfThreads = 4
+	keySize    = 32
+	saltSize   = 16
+)
+
+// ErrWrongPassword is returned when the vault cannot be decrypted with the given password.
+var ErrWrongPassword = errors.New("wrong password or corrupted vault")
+
+// Entry is the latest known version of a set of credentials.
+type Entry struct {
+	Name       string `json:"name"`
+	Data       string `json:"data"`
+	Version    string `json:"version"`
+	CreateDate string `json:"create_date"`
+}
+
+// PendingWrite is a credentials save made while offline, waiting to be pushed to the server.
+// BaseVersion is the server version the edit was made from, 0 if the credentials were new.
+type PendingWrite struct {
+	Name        string    `json:"name"`
+	Username    string    `json:"username"`
+	Password    string    `json:"password"`
+	BaseVersion int64     `json:"base_version"`
+	QueuedAt    time.Time `json:"queued_at"`
+}
+
+// contents is the plaintext of the vault.
+type contents struct {
+	Revision int64            `json:"revision"`
+	SyncedAt time.Time        `json:"synced_at"`
+	Creds    map[string]Entry `json:"creds"`
+	Pending  []PendingWrite   `json:"pending"`
+}
+
+// file is the on-disk layout. The contents are encrypted with a random vault key,
+// which in turn is encrypted with a key derived from the user's password.
+type file struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Data       []byte `json:"data"`
+}
+
+// Vault is an opened vault file.
+type Vault struct {
+	path     string
+	salt     []byte
+	vaultKey []byte
+	contents contents
+}
+
+// DataDir returns the directory keeperctl keeps its data in: $XDG_DATA_HOME/gophkeeper
+// or ~/.local/share/gophkeeper.
+func DataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "gophkeeper"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "gophkeeper"), nil
+}
+
+// Path returns the location of the user's vault in the data directory.
+func Path(username string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	if username == "" || filepath.Base(username) != username {
+		return "", fmt.Errorf("invalid user name %q", username)
+	}
+	return filepath.Join(dir, username+".vault"), nil
+}
+
+// Open decrypts the vault at path with the password. A missing file yields an empty vault
+// that is created on the first Save.
+func Open(path string, password string) (*Vault, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("malformed vault: %w", err)
+	}
+	if f.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported vault version %d", f.Version)
+	}
+	vaultKey, err := decrypt(deriveKey(password, f.Salt), f.WrappedKey)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	plaintext, err := decrypt(vaultKey, f.Data)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	v := &Vault{path: path, salt: f.Salt, vaultKey: vaultKey}
+	if err := json.Unmarshal(plaintext, &v.contents); err != nil {
+		return nil, fmt.Errorf("malformed vault contents: %w", err)
+	}
+	if v.contents.Creds == nil {
+		v.contents.Creds = make(map[string]Entry)
+	}
+	return v, nil
+}
+
+// New creates an empty vault with a fresh key. Saving it replaces the file at path.
+func New(path string) (*Vault, error) {
+	salt, vaultKey := make([]byte, saltSize), make([]byte, keySize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(vaultKey); err != nil {
+		return nil, err
+	}
+	return &Vault{
+		path:     path,
+		salt:     salt,
+		vaultKey: vaultKey,
+		contents: contents{Creds: make(map[string]Entry)},
+	}, nil
+}
+
+// Save encrypts the vault and atomically replaces the file, readable by the owner only.
+func (v *Vault) Save(password string) error {
+	plaintext, err := json.Marshal(v.contents)
+	if err != nil {
+		return err
+	}
+	data, err := encrypt(v.vaultKey, plaintext)
+	if err != nil {
+		return err
+	}
+	wrappedKey, err := encrypt(deriveKey(password, v.salt), v.vaultKey)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(file{
+		Version:    formatVersion,
+		Salt:       v.salt,
+		WrappedKey: wrappedKey,
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(v.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), filepath.Base(v.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), v.path)
+}
+
+// Rekey saves the vault wrapped with a key derived from the new password and a fresh salt. The vault
+// key stays the same, so the credentials and the queued writes are kept as they are.
+func (v *Vault) Rekey(password string) error {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	previous := v.salt
+	v.salt = salt
+	if err := v.Save(password); err != nil {
+		v.salt = previous
+		return err
+	}
+	return nil
+}
+
+// Revision returns the server revision the vault is synced up to.
+func (v *Vault) Revision() int64 {
+	return v.contents.Revision
+}
+
+// SyncedAt returns the time of the last successful sync.
+func (v *Vault) SyncedAt() time.Time {
+	return v.contents.SyncedAt
+}
+
+// MarkSynced records that the vault reflects the server state at the revision.
+func (v *Vault) MarkSynced(revision int64) {
+	v.contents.Revision = revision
+	v.contents.SyncedAt = time.Now()
+}
+
+// Put stores the latest version of the credentials.
+func (v *Vault) Put(entry Entry) {
+	v.contents.Creds[entry.Name] = entry
+}
+
+// Delete forgets the credentials.
+func (v *Vault) Delete(name string) {
+	delete(v.contents.Creds, name)
+}
+
+// Get returns the credentials with the given name.
+func (v *Vault) Get(name string) (Entry, bool) {
+	entry, ok := v.contents.Creds[name]
+	return entry, ok
+}
+
+// List returns all credentials sorted by name.
+func (v *Vault) List() []Entry {
+	entries := make([]Entry, 0, len(v.contents.Creds))
+	for _, entry := range v.contents.Creds {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// Queue adds a write to be pushed on the next connection.
+func (v *Vault) Queue(write PendingWrite) {
+	v.contents.Pending = append(v.contents.Pending, write)
+}
+
+// Pending returns the queued writes in the order they were made.
+func (v *Vault) Pending() []PendingWrite {
+	return v.contents.Pending
+}
+
+// DropPending removes the first n queued writes once they have been pushed.
+func (v *Vault) DropPending(n int) {
+	v.contents.Pending = v.contents.Pending[n:]
+}
+
+func deriveKey(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, kdfTime, kdfMemory, kdfThreads, keySize)
+}
+
+// encrypt seals the plaintext with AES-256-GCM and prepends the nonce.
+func encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,74 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "tester.vault")
+	v, err := Open(path, "secret")
+	if err != nil {
+		t.Fatalf("open new vault: %v", err)
+	}
+	v.Put(Entry{Name: "github", Data: `{"username":"octocat"}`, Version: "3"})
+	v.Queue(PendingWrite{Name: "mail", Username: "me", Password: "pw", QueuedAt: time.Now()})
+	v.MarkSynced(7)
+	if err := v.Save("secret"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("vault is readable by others: %v", perm)
+	}
+
+	if _, err := Open(path, "wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+	reopened, err := Open(path, "secret")
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if entry, ok := reopened.Get("github"); !ok || entry.Version != "3" {
+		t.Fatalf("unexpected entry: %+v, %v", entry, ok)
+	}
+	if reopened.Revision() != 7 || len(reopened.Pending()) != 1 {
+		t.Fatalf("unexpected state: revision %d, pending %v", reopened.Revision(), reopened.Pending())
+	}
+	reopened.DropPending(1)
+	if len(reopened.Pending()) != 0 {
+		t.Fatalf("pending writes were not dropped: %v", reopened.Pending())
+	}
+}
+
+func TestVaultRekey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tester.vault")
+	v, err := Open(path, "old")
+	if err != nil {
+		t.Fatalf("open new vault: %v", err)
+	}
+	v.Put(Entry{Name: "github", Data: "{}", Version: "1"})
+	v.Queue(PendingWrite{Name: "mail", QueuedAt: time.Now()})
+	if err := v.Save("old"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := v.Rekey("new"); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if _, err := Open(path, "old"); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected the old password to be rejected, got %v", err)
+	}
+	reopened, err := Open(path, "new")
+	if err != nil {
+		t.Fatalf("open with the new password: %v", err)
+	}
+	if _, ok := reopened.Get("github"); !ok || len(reopened.Pending()) != 1 {
+		t.Fatalf("rekeying lost data: %v, %v", reopened.List(), reopened.Pending())
+	}
+}
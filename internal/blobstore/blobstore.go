@@ -0,0 +1,90 @@
+// Package blobstore defines the versioned object storage used to keep users' files and its drivers.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when the requested object or version does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a single version of an object or a delete marker.
+type ObjectInfo struct {
+	Key            string
+	VersionID      string
+	Size           int64
+	LastModified   time.Time
+	IsLatest       bool
+	IsDeleteMarker bool
+}
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// BlobStore is a versioned object storage. Deleting an object hides it behind a delete marker,
+// older versions stay available until they are removed with DeleteVersion.
+type BlobStore interface {
+	// Init prepares the storage (bucket, directories) for use.
+	Init(ctx context.Context) error
+	// NewMultipartUpload starts a multipart upload for the key and returns its ID.
+	NewMultipartUpload(ctx context.Context, key string) (string, error)
+	// PutPart stores a part of the multipart upload. Parts are numbered from 1.
+	PutPart(ctx context.Context, key string, uploadID string, partNumber int, data io.Reader, size int64) (Part, error)
+	// CompleteMultipartUpload assembles the parts into a new version of the object and returns the version ID.
+	CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (string, error)
+	// AbortMultipartUpload drops the upload and all parts stored for it.
+	AbortMultipartUpload(ctx context.Context, key string, uploadID string) error
+	// CleanupIncompleteUploads aborts uploads started more than maxAge ago.
+	// It returns the number of aborted uploads and the number of bytes they held.
+	CleanupIncompleteUploads(ctx context.Context, maxAge time.Duration) (int, int64, error)
+	// Get opens a reader for the version of the object starting at offset. An empty versionID means
+	// the latest version and a zero length means up to the end of the object.
+	Get(ctx context.Context, key string, versionID string, offset int64, length int64) (io.ReadCloser, ObjectInfo, error)
+	// Stat returns the latest version of the object.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List returns the latest version of every object under the prefix that is not deleted.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// ListVersions returns all versions and delete markers of exactly the key, newest first.
+	ListVersions(ctx context.Context, key string) ([]ObjectInfo, error)
+	// ListAllVersions returns all versions and delete markers of every object under the prefix.
+	ListAllVersions(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete hides the object behind a delete marker and returns the version ID of the marker.
+	Delete(ctx context.Context, key string) (string, error)
+	// DeleteVersion permanently removes a version or a delete marker of the object.
+	DeleteVersion(ctx context.Context, key string, versionID string) error
+}
+
+// StartJanitor periodically removes abandoned multipart uploads older than maxAge until ctx is done.
+func StartJanitor(ctx context.Context, store BlobStore, log *zap.Logger, interval time.Duration, maxAge time.Duration) {
+	if interval <= 0 {
+		log.Info("multipart upload janitor is disabled")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			aborted, reclaimed, err := store.CleanupIncompleteUploads(ctx, maxAge)
+			if err != nil {
+				log.Error("failed to clean up incomplete uploads", zap.Error(err))
+			}
+			if aborted > 0 {
+				log.Info("incomplete uploads removed",
+					zap.Int("uploads", aborted),
+					zap.Int64("reclaimedBytes", reclaimed),
+				)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
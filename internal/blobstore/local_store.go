@@ -0,0 +1,469 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// versionsSuffix marks the directory keeping all versions of an object.
+	versionsSuffix = ".versions"
+	// markerSuffix marks a version file that is a delete marker.
+	markerSuffix = ".deleted"
+	// uploadKeyFile keeps the key of a multipart upload inside its directory.
+	uploadKeyFile = "key"
+)
+
+// LocalStore is a BlobStore kept in a directory of the local file system.
+//
+// Every object is a directory named after its key with the ".versions" suffix. Each version is a file
+// inside it named by the version ID, and delete markers are empty files with the ".deleted" suffix.
+// Version IDs start with the creation time, so sorting them orders versions chronologically.
+// Multipart uploads are kept under "uploads/<uploadID>" until they are completed or aborted.
+type LocalStore struct {
+	root string
+	log  *zap.Logger
+	mu   sync.Mutex
+}
+
+// NewLocalStore creates a LocalStore rooted at the given directory.
+func NewLocalStore(log *zap.Logger, root string) *LocalStore {
+	return &LocalStore{
+		root: root,
+		log:  log,
+	}
+}
+
+func (s *LocalStore) Init(_ context.Context) error {
+	for _, dir := range []string{s.objectsDir(), s.uploadsDir()} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	s.log.Info("local blob store is ready", zap.String("path", s.root))
+	return nil
+}
+
+func (s *LocalStore) NewMultipartUpload(_ context.Context, key string) (string, error) {
+	if _, err := s.versionsDir(key); err != nil {
+		return "", err
+	}
+	uploadID, err := newVersionID()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(s.uploadsDir(), uploadID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to initialize multipart upload: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, uploadKeyFile), []byte(key), 0o600); err != nil {
+		return "", fmt.Errorf("failed to initialize multipart upload: %v", err)
+	}
+	return uploadID, nil
+}
+
+func (s *LocalStore) PutPart(_ context.Context, key string, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	dir, err := s.uploadDir(key, uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, partFileName(partNumber)), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return Part{}, err
+	}
+	defer file.Close()
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(data, size))
+	if err != nil {
+		return Part{}, err
+	}
+	if written != size {
+		return Part{}, fmt.Errorf("part %d is truncated: %d of %d bytes", partNumber, written, size)
+	}
+	return Part{Number: partNumber, ETag: hex.EncodeToString(hash.Sum(nil)), Size: written}, nil
+}
+
+func (s *LocalStore) CompleteMultipartUpload(_ context.Context, key string, uploadID string, parts []Part) (string, error) {
+	dir, err := s.uploadDir(key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	versionsDir, err := s.versionsDir(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(versionsDir, 0o700); err != nil {
+		return "", err
+	}
+	assembled, err := os.CreateTemp(dir, "assemble-*")
+	if err != nil {
+		return "", err
+	}
+	defer assembled.Close()
+	for _, part := range parts {
+		if err := appendFile(assembled, filepath.Join(dir, partFileName(part.Number))); err != nil {
+			return "", fmt.Errorf("failed to complete multipart upload: %v", err)
+		}
+	}
+	if err := assembled.Close(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versionID, err := newVersionID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(assembled.Name(), filepath.Join(versionsDir, versionID)); err != nil {
+		return "", err
+	}
+	return versionID, os.RemoveAll(dir)
+}
+
+func (s *LocalStore) AbortMultipartUpload(_ context.Context, key string, uploadID string) error {
+	dir, err := s.uploadDir(key, uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *LocalStore) CleanupIncompleteUploads(_ context.Context, maxAge time.Duration) (int, int64, error) {
+	entries, err := os.ReadDir(s.uploadsDir())
+	if err != nil {
+		return 0, 0, err
+	}
+	threshold := time.Now().Add(-maxAge)
+	var aborted int
+	var reclaimed int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return aborted, reclaimed, err
+		}
+		if info.ModTime().After(threshold) {
+			continue
+		}
+		dir := filepath.Join(s.uploadsDir(), entry.Name())
+		size, err := dirSize(dir)
+		if err != nil {
+			return aborted, reclaimed, err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return aborted, reclaimed, err
+		}
+		aborted++
+		reclaimed += size
+	}
+	return aborted, reclaimed, nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string, versionID string, offset int64, length int64) (io.ReadCloser, ObjectInfo, error) {
+	var info ObjectInfo
+	var err error
+	if versionID == "" {
+		info, err = s.Stat(ctx, key)
+	} else {
+		info, err = s.findVersion(key, versionID)
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	if info.IsDeleteMarker {
+		return nil, ObjectInfo{}, ErrNotFound
+	}
+	versionsDir, _ := s.versionsDir(key)
+	file, err := os.Open(filepath.Join(versionsDir, info.VersionID))
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if length <= 0 {
+		return file, info, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, info, nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	versions, err := s.ListVersions(ctx, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if len(versions) == 0 || versions[0].IsDeleteMarker {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return versions[0], nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	base := prefix
+	if !strings.HasSuffix(base, "/") {
+		base = path.Dir(base)
+	}
+	dir := filepath.Join(s.objectsDir(), filepath.FromSlash(base))
+	if !s.isInside(s.objectsDir(), dir) {
+		return nil, fmt.Errorf("invalid prefix %q", prefix)
+	}
+	var result []ObjectInfo
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || !strings.HasSuffix(d.Name(), versionsSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.objectsDir(), strings.TrimSuffix(p, versionsSuffix))
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return filepath.SkipDir
+		}
+		info, err := s.Stat(ctx, key)
+		if err == nil {
+			result = append(result, info)
+		} else if err != ErrNotFound {
+			return err
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *LocalStore) ListVersions(_ context.Context, key string) ([]ObjectInfo, error) {
+	versionsDir, err := s.versionsDir(key)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(versionsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []ObjectInfo
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		versionID, isMarker := strings.CutSuffix(entry.Name(), markerSuffix)
+		result = append(result, ObjectInfo{
+			Key:            key,
+			VersionID:      versionID,
+			Size:           info.Size(),
+			LastModified:   info.ModTime(),
+			IsDeleteMarker: isMarker,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].VersionID > result[j].VersionID
+	})
+	if len(result) > 0 {
+		result[0].IsLatest = true
+	}
+	return result, nil
+}
+
+func (s *LocalStore) ListAllVersions(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	base := prefix
+	if !strings.HasSuffix(base, "/") {
+		base = path.Dir(base)
+	}
+	dir := filepath.Join(s.objectsDir(), filepath.FromSlash(base))
+	if !s.isInside(s.objectsDir(), dir) {
+		return nil, fmt.Errorf("invalid prefix %q", prefix)
+	}
+	var result []ObjectInfo
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || !strings.HasSuffix(d.Name(), versionsSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.objectsDir(), strings.TrimSuffix(p, versionsSuffix))
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return filepath.SkipDir
+		}
+		versions, err := s.ListVersions(ctx, key)
+		if err != nil {
+			return err
+		}
+		result = append(result, versions...)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) (string, error) {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return "", err
+	}
+	versionsDir, err := s.versionsDir(key)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versionID, err := newVersionID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(versionsDir, versionID+markerSuffix), nil, 0o600); err != nil {
+		return "", fmt.Errorf("unable to delete %q: %w", key, err)
+	}
+	return versionID, nil
+}
+
+func (s *LocalStore) DeleteVersion(_ context.Context, key string, versionID string) error {
+	info, err := s.findVersion(key, versionID)
+	if err != nil {
+		return err
+	}
+	versionsDir, _ := s.versionsDir(key)
+	name := info.VersionID
+	if info.IsDeleteMarker {
+		name += markerSuffix
+	}
+	if err := os.Remove(filepath.Join(versionsDir, name)); err != nil {
+		return fmt.Errorf("unable to delete version %q of %q: %w", versionID, key, err)
+	}
+	// drop the object directory together with its last version
+	_ = os.Remove(versionsDir)
+	return nil
+}
+
+func (s *LocalStore) findVersion(key string, versionID string) (ObjectInfo, error) {
+	versions, err := s.ListVersions(context.Background(), key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	for _, version := range versions {
+		if version.VersionID == versionID {
+			return version, nil
+		}
+	}
+	return ObjectInfo{}, ErrNotFound
+}
+
+func (s *LocalStore) objectsDir() string {
+	return filepath.Join(s.root, "objects")
+}
+
+func (s *LocalStore) uploadsDir() string {
+	return filepath.Join(s.root, "uploads")
+}
+
+// versionsDir returns the directory keeping the versions of the key and makes sure it stays inside the store.
+func (s *LocalStore) versionsDir(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.HasSuffix(segment, versionsSuffix) {
+			return "", fmt.Errorf("invalid key %q", key)
+		}
+	}
+	dir := filepath.Join(s.objectsDir(), filepath.FromSlash(key)) + versionsSuffix
+	if !s.isInside(s.objectsDir(), dir) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return dir, nil
+}
+
+func (s *LocalStore) uploadDir(key string, uploadID string) (string, error) {
+	dir := filepath.Join(s.uploadsDir(), uploadID)
+	if filepath.Dir(dir) != s.uploadsDir() {
+		return "", ErrNotFound
+	}
+	storedKey, err := os.ReadFile(filepath.Join(dir, uploadKeyFile))
+	if err != nil || string(storedKey) != key {
+		return "", ErrNotFound
+	}
+	return dir, nil
+}
+
+func (s *LocalStore) isInside(parent string, p string) bool {
+	rel, err := filepath.Rel(parent, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// newVersionID returns an ID that sorts after every ID generated earlier.
+func newVersionID() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%016x%s", time.Now().UnixNano(), hex.EncodeToString(suffix)), nil
+}
+
+func partFileName(partNumber int) string {
+	return fmt.Sprintf("part-%05d", partNumber)
+}
+
+func appendFile(dst io.Writer, name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,273 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+// S3Store is a BlobStore kept in a versioned MinIO/S3 bucket.
+type S3Store struct {
+	minIOCore *minio.Core
+	log       *zap.Logger
+	bucket    string
+}
+
+// NewS3Store initializes a new S3 minIOCore
+func NewS3Store(log *zap.Logger, endpoint string, accessKey string, secretKey string, bucket string, useSSL bool) (*S3Store, error) {
+	minIOCore, err := minio.NewCore(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{
+		minIOCore: minIOCore,
+		bucket:    bucket,
+		log:       log,
+	}, nil
+}
+
+// Init creates the bucket if needed and enables versioning on it.
+func (s *S3Store) Init(ctx context.Context) error {
+	exists, err := s.minIOCore.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if exists {
+		s.log.Info("Bucket already exists", zap.String("name", s.bucket))
+	} else {
+		err = s.minIOCore.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{})
+		if err != nil {
+			return err
+		}
+		err = s.minIOCore.SetBucketPolicy(ctx, s.bucket, "public-read")
+		if err != nil {
+			s.log.Error("Bucket policy has been set", zap.String("name", s.bucket), zap.Error(err))
+		}
+		s.log.Info("Bucket has been created", zap.String("name", s.bucket))
+	}
+	versioning, err := s.minIOCore.GetBucketVersioning(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if versioning.Status != minio.Enabled {
+		err = s.minIOCore.EnableVersioning(ctx, s.bucket)
+		if err != nil {
+			s.log.Info("Bucket versioning has been enabled", zap.String("name", s.bucket))
+		}
+	} else {
+		s.log.Info("Bucket versioning is enabled", zap.String("name", s.bucket))
+	}
+	return nil
+}
+
+func (s *S3Store) NewMultipartUpload(ctx context.Context, key string) (string, error) {
+	uploadID, err := s.minIOCore.NewMultipartUpload(ctx, s.bucket, key, minio.PutObjectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize multipart upload: %v", err)
+	}
+	return uploadID, nil
+}
+
+func (s *S3Store) PutPart(ctx context.Context, key string, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	part, err := s.minIOCore.PutObjectPart(ctx, s.bucket, key, uploadID, partNumber, data, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{Number: partNumber, ETag: part.ETag, Size: part.Size}, nil
+}
+
+func (s *S3Store) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (string, error) {
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+	info, err := s.minIOCore.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, completeParts, minio.PutObjectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	return info.VersionID, nil
+}
+
+func (s *S3Store) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	return s.minIOCore.AbortMultipartUpload(ctx, s.bucket, key, uploadID)
+}
+
+func (s *S3Store) CleanupIncompleteUploads(ctx context.Context, maxAge time.Duration) (int, int64, error) {
+	threshold := time.Now().Add(-maxAge)
+	var aborted int
+	var reclaimed int64
+	var keyMarker, uploadIDMarker string
+	for {
+		result, err := s.minIOCore.ListMultipartUploads(ctx, s.bucket, "", keyMarker, uploadIDMarker, "", 1000)
+		if err != nil {
+			return aborted, reclaimed, err
+		}
+		for _, upload := range result.Uploads {
+			if upload.Initiated.After(threshold) {
+				continue
+			}
+			size, err := s.uploadedPartsSize(ctx, upload.Key, upload.UploadID)
+			if err != nil {
+				return aborted, reclaimed, err
+			}
+			if err := s.minIOCore.AbortMultipartUpload(ctx, s.bucket, upload.Key, upload.UploadID); err != nil {
+				return aborted, reclaimed, err
+			}
+			aborted++
+			reclaimed += size
+		}
+		if !result.IsTruncated {
+			break
+		}
+		keyMarker = result.NextKeyMarker
+		uploadIDMarker = result.NextUploadIDMarker
+	}
+	return aborted, reclaimed, nil
+}
+
+func (s *S3Store) uploadedPartsSize(ctx context.Context, key string, uploadID string) (int64, error) {
+	var size int64
+	var partMarker int
+	for {
+		result, err := s.minIOCore.ListObjectParts(ctx, s.bucket, key, uploadID, partMarker, 1000)
+		if err != nil {
+			return size, err
+		}
+		for _, part := range result.ObjectParts {
+			size += part.Size
+		}
+		if !result.IsTruncated {
+			return size, nil
+		}
+		partMarker = result.NextPartNumberMarker
+	}
+}
+
+func (s *S3Store) Get(ctx context.Context, key string, versionID string, offset int64, length int64) (io.ReadCloser, ObjectInfo, error) {
+	opts := minio.GetObjectOptions{VersionID: versionID}
+	if offset > 0 || length > 0 {
+		end := int64(0)
+		if length > 0 {
+			end = offset + length - 1
+		}
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, ObjectInfo{}, err
+		}
+	}
+	reader, info, _, err := s.minIOCore.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, ObjectInfo{}, s.mapError(err)
+	}
+	return reader, toObjectInfo(info), nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.minIOCore.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s.mapError(err)
+	}
+	return toObjectInfo(info), nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var continuationToken string
+	var result []ObjectInfo
+	for {
+		listObjectsV2Result, err := s.minIOCore.ListObjectsV2(s.bucket, prefix, "", continuationToken, "", 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range listObjectsV2Result.Contents {
+			info := toObjectInfo(object)
+			info.IsLatest = true
+			result = append(result, info)
+		}
+		if !listObjectsV2Result.IsTruncated {
+			break
+		}
+		continuationToken = listObjectsV2Result.NextContinuationToken
+	}
+	return result, nil
+}
+
+func (s *S3Store) ListVersions(ctx context.Context, key string) ([]ObjectInfo, error) {
+	var result []ObjectInfo
+	for object := range s.minIOCore.Client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:       key,
+		WithVersions: true,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if object.Key == key {
+			result = append(result, toObjectInfo(object))
+		}
+	}
+	return result, nil
+}
+
+func (s *S3Store) ListAllVersions(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var result []ObjectInfo
+	for object := range s.minIOCore.Client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithVersions: true,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		result = append(result, toObjectInfo(object))
+	}
+	return result, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) (string, error) {
+	err := s.minIOCore.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to delete %q from bucket %q: %w", key, s.bucket, err)
+	}
+	versions, err := s.ListVersions(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	for _, version := range versions {
+		if version.IsDeleteMarker && version.IsLatest {
+			return version.VersionID, nil
+		}
+	}
+	return "", fmt.Errorf("delete marker for %q not found", key)
+}
+
+func (s *S3Store) DeleteVersion(ctx context.Context, key string, versionID string) error {
+	err := s.minIOCore.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{VersionID: versionID})
+	if err != nil {
+		return fmt.Errorf("unable to delete version %q of %q: %w", versionID, key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) mapError(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchVersion":
+		return ErrNotFound
+	}
+	return err
+}
+
+func toObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:            info.Key,
+		VersionID:      info.VersionID,
+		Size:           info.Size,
+		LastModified:   info.LastModified,
+		IsLatest:       info.IsLatest,
+		IsDeleteMarker: info.IsDeleteMarker,
+	}
+}
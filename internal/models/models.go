@@ -15,8 +15,18 @@ type UserDTO struct {
 	Role      string    `json:"role"`       // Role of the user (e.g., admin, user)
 	CreatedAt time.Time `json:"created_at"` // Timestamp of when the user was created
 	UpdatedAt time.Time `json:"updated_at"` // Timestamp of when the user was last updated
+	// EmailVerifiedAt is set once the user proved to own the email address
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// DisabledAt is set while an administrator keeps the user from logging in
+	DisabledAt *time.Time `json:"disabled_at"`
 }
 
+// Roles of users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // FileDTO represents the data transfer object for a File entity.
 type FileDTO struct {
 	ID        string    `json:"id"`         // UUID of the file
@@ -36,7 +46,9 @@ type SettingsDTO struct {
 
 // Claims represents the custom claims for JWT authentication.
 type Claims struct {
-	UserID string
+	UserID    string
+	SessionID string `json:"sid"`  // session the token was issued for, the token ID is in RegisteredClaims.ID
+	Role      string `json:"role"` // role of the user when the token was issued
 	jwt.RegisteredClaims
 }
 
@@ -59,3 +71,136 @@ type UserCredentials struct {
 	Version   int64     `json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// ShareLink represents a time-limited download link for a user's file.
+type ShareLink struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"user_id"`
+	TokenHash    string     `json:"-"`
+	FileName     string     `json:"file_name"`
+	VersionID    string     `json:"version_id"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	MaxDownloads int32      `json:"max_downloads"` // 0 means unlimited
+	Downloads    int32      `json:"downloads"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TrashItem represents a deleted file or set of credentials kept in the trash bin until PurgeAfter.
+type TrashItem struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Kind         string    `json:"kind"`
+	Name         string    `json:"name"`
+	DeleteMarker string    `json:"delete_marker"` // version of the S3 delete marker, empty for credentials
+	DeletedAt    time.Time `json:"deleted_at"`
+	PurgeAfter   time.Time `json:"purge_after"`
+}
+
+// Change is the latest state of a user's file or credentials as seen by the sync protocol.
+// Every change bumps the user's revision; deleted changes act as tombstones.
+type Change struct {
+	UserID    string    `json:"user_id"`
+	Revision  int64     `json:"revision"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Deleted   bool      `json:"deleted"`
+	VersionID string    `json:"version_id"` // version of the file, empty for credentials
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Conflict is a credentials save that arrived against a stale base version and was kept aside
+// instead of overwriting the newer version.
+type Conflict struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"user_id"`
+	Name          string     `json:"name"`
+	BaseVersion   int64      `json:"base_version"`   // version the client edited from
+	RemoteVersion int64      `json:"remote_version"` // latest version at the time of the save, 0 if deleted
+	Data          string     `json:"-"`              // encrypted data of the rejected save
+	DataType      int        `json:"type"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	Resolution    string     `json:"resolution"`
+}
+
+// Session is a login of a user. It is kept alive by a rotating refresh token, of which only hashes are stored.
+type Session struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"user_id"`
+	RefreshHash   string     `json:"-"` // hash of the current refresh token
+	PreviousHash  string     `json:"-"` // hash of the refresh token rotated last, presenting it again revokes the session
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at"` // the refresh token cannot be used after this time
+	RevokedAt     *time.Time `json:"revoked_at"`
+	Device        string     `json:"device"`
+	ClientVersion string     `json:"client_version"`
+	IP            string     `json:"ip"` // address of the last request
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+}
+
+// TOTP is the second factor of a user. The secret is encrypted with the data key.
+type TOTP struct {
+	UserID      string     `json:"user_id"`
+	Secret      string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at"` // two-factor authentication is enabled once confirmed
+	LastStep    int64      `json:"-"`            // time step of the last accepted code
+}
+
+// LoginAttempt counts the failed logins for a user name or an address.
+type LoginAttempt struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// Kinds of security events.
+const (
+	EventUserLocked      = "user_locked"      // too many failed logins for a user name
+	EventIPLocked        = "ip_locked"        // too many failed logins from an address
+	EventPasswordChanged = "password_changed" // the user changed the password
+	EventPasswordReset   = "password_reset"   // the password was reset with a token sent by email
+	EventEmailVerified   = "email_verified"   // the user proved to own the email address
+	EventUserDisabled    = "user_disabled"    // an administrator disabled the user
+	EventUserEnabled     = "user_enabled"     // an administrator enabled the user again
+	EventRoleChanged     = "role_changed"     // an administrator changed the role of the user
+)
+
+// SecurityEvent is an entry of the security log.
+type SecurityEvent struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"` // empty when the event is not tied to an existing user
+	Kind      string    `json:"kind"`
+	IP        string    `json:"ip"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountDeletion tracks the purge of an account and everything it owns. It outlives the account, so an
+// interrupted purge can be resumed, and reports what was removed once CompletedAt is set.
+type AccountDeletion struct {
+	UserID         string     `json:"user_id"`
+	RequestedAt    time.Time  `json:"requested_at"`
+	ObjectVersions int64      `json:"object_versions"` // file versions and delete markers removed from the blob store
+	BytesDeleted   int64      `json:"bytes_deleted"`
+	RowsDeleted    int64      `json:"rows_deleted"`
+	CompletedAt    *time.Time `json:"completed_at"`
+}
+
+// Purposes of the tokens sent by email.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// EmailToken is a single-use token sent to the email address of a user. Only its hash is stored,
+// and a user has at most one token for each purpose.
+type EmailToken struct {
+	UserID    string    `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	TokenHash string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
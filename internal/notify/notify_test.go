@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mailbox")
+	n := NewFileNotifier(path)
+	ctx := context.Background()
+	if err := n.Send(ctx, Message{To: "a@example.com", Subject: "first", Body: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(ctx, Message{To: "b@example.com", Subject: "second", Body: "two"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: a@example.com\nSubject: first\n\none\n", "To: b@example.com\nSubject: second\n\ntwo\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("mailbox %q does not contain %q", data, want)
+		}
+	}
+	err = n.Send(ctx, Message{To: "a@example.com", Subject: "hi\r\nBcc: c@example.com"})
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("header injection: got %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	from := &mail.Address{Name: "GophKeeper", Address: "noreply@example.com"}
+	to := &mail.Address{Address: "user@example.com"}
+	date := time.Date(2024, 11, 22, 9, 0, 0, 0, time.UTC)
+	got := string(formatMessage(from, to, Message{Subject: "Подтверждение", Body: "line 1\nline 2"}, date))
+	for _, want := range []string{
+		"From: \"GophKeeper\" <noreply@example.com>\r\n",
+		"To: <user@example.com>\r\n",
+		"Subject: =?utf-8?q?",
+		"Date: Fri, 22 Nov 2024 09:00:00 +0000\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message %q does not contain %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig is the mail server messages are sent through.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // no authentication when empty
+	Password string
+	From     string // sender address, e.g. "GophKeeper <noreply@example.com>"
+}
+
+// SMTPNotifier sends messages as email. The connection is upgraded with STARTTLS when the server offers it.
+type SMTPNotifier struct {
+	config SMTPConfig
+	from   *mail.Address
+	auth   smtp.Auth
+}
+
+func NewSMTPNotifier(config SMTPConfig) (*SMTPNotifier, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("notify: smtp host is required")
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("notify: invalid sender address: %w", err)
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	n := &SMTPNotifier{config: config, from: from}
+	if config.Username != "" {
+		n.auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	return n, nil
+}
+
+func (n *SMTPNotifier) Send(_ context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("notify: invalid recipient address: %w", err)
+	}
+	addr := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+	return smtp.SendMail(addr, n.auth, n.from.Address, []string{to.Address}, formatMessage(n.from, to, msg, time.Now()))
+}
+
+// formatMessage builds an RFC 5322 message with a plain text UTF-8 body.
+func formatMessage(from *mail.Address, to *mail.Address, msg Message, date time.Time) []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
@@ -4,22 +4,59 @@ import (
 	"GophKeeper/internal/models"
 	db "GophKeeper/internal/storage"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"net"
 	"strings"
 	"time"
 )
 
-// TokenExp is a constant that represents the expiration time for JWT tokens.
-const TokenExp = time.Hour * 3
+// Default lifetimes of the tokens, used when they are not configured.
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
 const LoginFullMethod = "/pb.FileManagerService/Login"
 const CreateUserFullMethod = "/pb.FileManagerService/CreateUser"
+const RefreshTokenFullMethod = "/pb.FileManagerService/RefreshToken"
+const VerifyEmailFullMethod = "/pb.FileManagerService/VerifyEmail"
+const RequestPasswordResetFullMethod = "/pb.FileManagerService/RequestPasswordReset"
+const ResetPasswordFullMethod = "/pb.FileManagerService/ResetPassword"
+
+// publicMethods are called without a token: the caller is logging in, signing up or proving to own
+// an email address.
+var publicMethods = map[string]bool{
+	LoginFullMethod:                true,
+	CreateUserFullMethod:           true,
+	RefreshTokenFullMethod:         true,
+	VerifyEmailFullMethod:          true,
+	RequestPasswordResetFullMethod: true,
+	ResetPasswordFullMethod:        true,
+}
+
+// maxPasswordLength is the longest password in bytes bcrypt accepts.
+const maxPasswordLength = 72
+
+// refreshTokenSize is the number of random bytes in a refresh token.
+const refreshTokenSize = 32
+
+// lastSeenResolution is how stale the last-seen time of a session may get before a request updates it,
+// so not every request writes to the database.
+const lastSeenResolution = time.Minute
 
 var TokenExpiredErr = errors.New("token expired")
 
@@ -27,109 +64,248 @@ type contextKey string
 
 const UserIDKey = contextKey("userID")
 
+// SessionIDKey holds the ID of the session the request was authenticated for.
+const SessionIDKey = contextKey("sessionID")
+
+// RoleKey holds the role of the user the access token was issued to.
+const RoleKey = contextKey("role")
+
 // AuthService сервер
 type AuthService struct {
-	storage *db.Storage
-	log     *zap.Logger
+	storage    *db.Storage
+	log        *zap.Logger
+	keys       *KeyRing
+	totp       *TOTPService
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	lockout    LockoutPolicy
 }
 
-func (auth *AuthService) Login(ctx context.Context, userName string, pass string) (string, error) {
-	user, err := auth.storage.UserRepository.FindByName(ctx, userName)
+// Tokens are issued on login and on every refresh.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	// Username is the name of the user logged in, which the client may have identified by email. It is
+	// set on login only.
+	Username string
+}
+
+// ClientInfo describes the client a user logs in with.
+type ClientInfo struct {
+	Device  string
+	Version string
+}
+
+// Login checks the password, and the code of the second factor if the user enabled it, and starts
+// a new session for the client. The user is identified by the username or the email.
+func (auth *AuthService) Login(ctx context.Context, login string, pass string, otpCode string,
+	client ClientInfo) (Tokens, error) {
+	ip := peerIP(ctx)
+	user, err := auth.findLogin(ctx, login)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return Tokens{}, status.Error(codes.Internal, err.Error())
+	}
+	// failures count against the account however it was identified
+	userName := login
+	if err == nil {
+		userName = user.Username
+	}
+	if err := auth.checkLockout(ctx, userAttemptKey(userName), ipAttemptKey(ip)); err != nil {
+		return Tokens{}, err
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		checkDummyPassword(pass)
+		auth.recordFailure(ctx, userName, "", ip)
+		return Tokens{}, invalidCredentials
+	}
+	if !CheckPass(pass, user.Password) {
+		auth.recordFailure(ctx, userName, user.ID, ip)
+		return Tokens{}, invalidCredentials
+	}
+	required, err := auth.totp.Required(ctx, user.ID)
 	if err != nil {
-		return "", status.Error(codes.Unauthenticated, "User not found")
+		return Tokens{}, status.Error(codes.Internal, err.Error())
 	}
-	if CheckPass(pass, user.Password) {
-		token, err := auth.BuildJWTString(user.ID)
-		if err != nil {
-			return "", status.Error(codes.Internal, "Could not generate token")
+	if required && otpCode == "" {
+		return Tokens{}, status.Error(codes.FailedPrecondition, SecondFactorRequired)
+	}
+	if required {
+		if err := auth.totp.Verify(ctx, user.ID, otpCode); err != nil {
+			if status.Code(err) == codes.Unauthenticated {
+				auth.recordFailure(ctx, userName, user.ID, ip)
+			}
+			return Tokens{}, err
 		}
-		return token, nil
 	}
-	return "", status.Error(codes.Unauthenticated, "Invalid credentials")
+	if user.DisabledAt != nil {
+		return Tokens{}, errDisabled
+	}
+	deletion, err := auth.storage.AccountDeletionRepository.FindDeletion(ctx, user.ID)
+	if err == nil && deletion.CompletedAt == nil {
+		return Tokens{}, status.Error(codes.PermissionDenied, "account is being deleted")
+	}
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return Tokens{}, status.Error(codes.Internal, err.Error())
+	}
+	auth.resetFailures(ctx, userName)
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, status.Error(codes.Internal, "Could not generate token")
+	}
+	session, err := auth.storage.SessionRepository.CreateSession(ctx, models.Session{
+		UserID:        user.ID,
+		RefreshHash:   hashToken(refreshToken),
+		ExpiresAt:     time.Now().Add(auth.refreshTTL),
+		Device:        client.Device,
+		ClientVersion: client.Version,
+		IP:            ip,
+	})
+	if err != nil {
+		return Tokens{}, status.Error(codes.Internal, "Could not create session")
+	}
+	accessToken, err := auth.BuildJWTString(user.ID, session.ID, user.Role)
+	if err != nil {
+		return Tokens{}, status.Error(codes.Internal, "Could not generate token")
+	}
+	return Tokens{AccessToken: accessToken, RefreshToken: refreshToken, Username: user.Username}, nil
 }
 
-// NewAuthService constructs a new instance of Authorization with a user service and logger.
-func NewAuthService(storage *db.Storage, logger *zap.Logger) *AuthService {
-	return &AuthService{
-		storage: storage,
-		log:     logger,
+// findLogin finds the user by the email if the login looks like one, and by the username otherwise.
+// Usernames with an @ predate logins by email and are still found by the username.
+func (auth *AuthService) findLogin(ctx context.Context, login string) (models.UserDTO, error) {
+	if !strings.Contains(login, "@") {
+		return auth.storage.UserRepository.FindByName(ctx, login)
 	}
+	user, err := auth.storage.UserRepository.FindByEmail(ctx, login)
+	if errors.Is(err, db.ErrNotFound) {
+		return auth.storage.UserRepository.FindByName(ctx, login)
+	}
+	return user, err
 }
 
-// BuildJWTString generates a JWT for a specified user ID.
-func (auth *AuthService) BuildJWTString(userID string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, models.Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExp)),
-		},
-		UserID: userID,
-	})
-	tokenString, err := token.SignedString([]byte(getSecretKeyToken()))
+// Refresh exchanges the refresh token for a new access token and a new refresh token. Presenting
+// a refresh token that was already exchanged revokes the session, as the token must have leaked.
+func (auth *AuthService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	hash := hashToken(refreshToken)
+	session, err := auth.storage.SessionRepository.FindByRefreshHash(ctx, hash)
+	if errors.Is(err, db.ErrNotFound) {
+		return Tokens{}, status.Error(codes.Unauthenticated, "invalid refresh token")
+	}
 	if err != nil {
-		return "", err
+		return Tokens{}, status.Error(codes.Internal, err.Error())
+	}
+	if session.RevokedAt != nil {
+		return Tokens{}, status.Error(codes.Unauthenticated, "session revoked")
+	}
+	if session.RefreshHash != hash {
+		auth.log.Warn("refresh token reused, revoking the session",
+			zap.String("userID", session.UserID), zap.String("sessionID", session.ID))
+		if err := auth.storage.SessionRepository.Revoke(ctx, session.ID); err != nil {
+			return Tokens{}, status.Error(codes.Internal, err.Error())
+		}
+		return Tokens{}, status.Error(codes.Unauthenticated, "refresh token reused, session revoked")
+	}
+	if session.ExpiresAt.Before(time.Now()) {
+		return Tokens{}, status.Error(codes.Unauthenticated, "session expired")
+	}
+	// the role may have changed since the last token was issued
+	user, err := auth.storage.UserRepository.FindByID(ctx, session.UserID)
+	if err != nil {
+		return Tokens{}, status.Error(codes.Internal, err.Error())
+	}
+	if user.DisabledAt != nil {
+		return Tokens{}, errDisabled
 	}
-	return tokenString, nil
+	newToken, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, status.Error(codes.Internal, "Could not generate token")
+	}
+	err = auth.storage.SessionRepository.RotateRefresh(ctx, session.ID, hash, hashToken(newToken), time.Now().Add(auth.refreshTTL))
+	if errors.Is(err, db.ErrNotFound) {
+		// a concurrent refresh with the same token won
+		return Tokens{}, status.Error(codes.Unauthenticated, "invalid refresh token")
+	}
+	if err != nil {
+		return Tokens{}, status.Error(codes.Internal, err.Error())
+	}
+	auth.touch(ctx, session)
+	accessToken, err := auth.BuildJWTString(session.UserID, session.ID, user.Role)
+	if err != nil {
+		return Tokens{}, status.Error(codes.Internal, "Could not generate token")
+	}
+	return Tokens{AccessToken: accessToken, RefreshToken: newToken}, nil
 }
 
-// GetUserID retrieves a user ID from a given JWT.
-func GetUserID(tokenString string) (string, error) {
-	var claims models.Claims
-	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(getSecretKeyToken()), nil
-	})
-	if err != nil {
-		return "", err
+// AuthConfig holds the settings of the AuthService. Unset settings take the defaults.
+type AuthConfig struct {
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	Lockout         LockoutPolicy
+}
+
+// NewAuthService constructs a new instance of Authorization signing the tokens with the key ring and
+// checking second factors with totp.
+func NewAuthService(storage *db.Storage, logger *zap.Logger, keys *KeyRing, totp *TOTPService,
+	config AuthConfig) *AuthService {
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	return &AuthService{
+		storage:    storage,
+		log:        logger,
+		keys:       keys,
+		totp:       totp,
+		accessTTL:  config.AccessTokenTTL,
+		refreshTTL: config.RefreshTokenTTL,
+		lockout:    config.Lockout.withDefaults(),
 	}
-	return claims.UserID, nil
 }
 
-// VerifyToken is a method that takes a token string as input and verifies its validity using JWT.
-// It returns true if the token is valid, otherwise false.
-// If there is an error during verification, it logs the error and returns false.
-func (auth *AuthService) VerifyToken(tokenString string) (bool, error) {
-	claims := &models.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(getSecretKeyToken()), nil
+// BuildJWTString generates a JWT for a specified user ID, session and role with a unique token ID.
+func (auth *AuthService) BuildJWTString(userID string, sessionID string, role string) (string, error) {
+	now := time.Now()
+	return auth.keys.Sign(models.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(auth.accessTTL)),
+		},
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      role,
 	})
-	if err != nil {
-		return false, err
+}
+
+// ParseToken verifies the signature and the expiry of the token and returns its claims.
+func (auth *AuthService) ParseToken(tokenString string) (*models.Claims, error) {
+	claims := &models.Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, auth.keys.Keyfunc,
+		jwt.WithValidMethods([]string{AlgHS256, AlgEdDSA, AlgES256}), jwt.WithExpirationRequired())
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, TokenExpiredErr
 	}
-	expirationTime, err := claims.GetExpirationTime()
 	if err != nil {
-		return false, err
-	}
-	now := time.Now()
-	if expirationTime.Before(now) {
-		return false, TokenExpiredErr
+		return nil, err
 	}
-	return token.Valid, nil
+	return claims, nil
 }
 
 // GetAuthInterceptor returns a grpc.UnaryServerInterceptor that enforces authentication for unary methods.
 func (auth *AuthService) GetAuthInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		if info.FullMethod == LoginFullMethod || info.FullMethod == CreateUserFullMethod {
+		if publicMethods[info.FullMethod] {
 			return handler(ctx, req)
 		}
-		token, err := ExtractToken(ctx)
+		ctxWithVal, err := auth.authenticate(ctx)
 		if err != nil {
-			return nil, status.Error(codes.Unauthenticated, err.Error())
+			return nil, err
 		}
-		if strings.Contains(token, "Bearer") {
-			tokenArr := strings.Split(token, " ")
-			if len(tokenArr) < 2 {
-				return nil, status.Error(codes.Unauthenticated, "Invalid token")
-			}
-			token = tokenArr[1]
-		}
-		if ok, err := auth.VerifyToken(token); !ok || err != nil {
-			return nil, status.Error(codes.Unauthenticated, err.Error())
+		if err := auth.checkAccess(ctxWithVal, info.FullMethod); err != nil {
+			return nil, err
 		}
-		userID, err := GetUserID(token)
-		if err != nil {
-			return nil, status.Error(codes.Unauthenticated, err.Error())
-		}
-		ctxWithVal := context.WithValue(ctx, UserIDKey, userID)
 		return handler(ctxWithVal, req)
 	}
 }
@@ -148,19 +324,13 @@ func (w *WrappedStream) Context() context.Context {
 // GetAuthStreamInterceptor returns a grpc.StreamServerInterceptor that enforces authentication for stream methods.
 func (auth *AuthService) GetAuthStreamInterceptor() grpc.StreamServerInterceptor {
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		token, err := ExtractToken(ss.Context())
+		ctxWithVal, err := auth.authenticate(ss.Context())
 		if err != nil {
-			return status.Error(codes.Unauthenticated, err.Error())
-		}
-		if ok, err := auth.VerifyToken(token); !ok || err != nil {
-			return status.Error(codes.Unauthenticated, err.Error())
+			return err
 		}
-		userID, err := GetUserID(token)
-		if err != nil {
-			return status.Error(codes.Unauthenticated, err.Error())
+		if err := auth.checkAccess(ctxWithVal, info.FullMethod); err != nil {
+			return err
 		}
-		ctx := ss.Context()
-		ctxWithVal := context.WithValue(ctx, UserIDKey, userID)
 		wrappedStream := &WrappedStream{
 			ServerStream:   ss,
 			wrappedContext: ctxWithVal,
@@ -169,11 +339,234 @@ func (auth *AuthService) GetAuthStreamInterceptor() grpc.StreamServerInterceptor
 	}
 }
 
+// authenticate checks the token of the request and returns a context carrying the user ID.
+func (auth *AuthService) authenticate(ctx context.Context) (context.Context, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if claims.ID == "" || claims.SessionID == "" {
+		return nil, status.Error(codes.Unauthenticated, "token has no ID, log in again")
+	}
+	revoked, err := auth.storage.RevokedTokenRepository.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		auth.log.Error("failed to check token revocation", zap.Error(err))
+		return nil, status.Error(codes.Internal, "could not check the token")
+	}
+	if revoked {
+		return nil, status.Error(codes.Unauthenticated, "token revoked")
+	}
+	// the session is checked on every request, so revoking it locks its tokens out at once
+	session, err := auth.storage.SessionRepository.FindByID(ctx, claims.SessionID)
+	if errors.Is(err, db.ErrNotFound) || err == nil && session.RevokedAt != nil {
+		return nil, status.Error(codes.Unauthenticated, "session revoked")
+	}
+	if err != nil {
+		auth.log.Error("failed to check the session", zap.Error(err))
+		return nil, status.Error(codes.Internal, "could not check the token")
+	}
+	auth.touch(ctx, session)
+	ctx = context.WithValue(ctx, SessionIDKey, session.ID)
+	ctx = context.WithValue(ctx, RoleKey, claims.Role)
+	return context.WithValue(ctx, UserIDKey, claims.UserID), nil
+}
+
+// touch records the request in the session when its last-seen time is stale or the address changed.
+func (auth *AuthService) touch(ctx context.Context, session models.Session) {
+	ip := peerIP(ctx)
+	now := time.Now()
+	if ip == session.IP && now.Sub(session.LastSeenAt) < lastSeenResolution {
+		return
+	}
+	if err := auth.storage.SessionRepository.Touch(ctx, session.ID, ip, now); err != nil {
+		auth.log.Warn("failed to update the session", zap.String("sessionID", session.ID), zap.Error(err))
+	}
+}
+
+// EnableTOTP starts enabling two-factor authentication for the user, see TOTPService.Enable.
+func (auth *AuthService) EnableTOTP(ctx context.Context, userID string) (Enrollment, error) {
+	return auth.totp.Enable(ctx, userID)
+}
+
+// ConfirmTOTP enables two-factor authentication for the user, see TOTPService.Confirm.
+func (auth *AuthService) ConfirmTOTP(ctx context.Context, userID string, code string) ([]string, error) {
+	return auth.totp.Confirm(ctx, userID, code)
+}
+
+// ListSessions returns the active sessions of the user.
+func (auth *AuthService) ListSessions(ctx context.Context, userID string) ([]models.Session, error) {
+	return auth.storage.SessionRepository.ListActive(ctx, userID, time.Now())
+}
+
+// RevokeSession ends a session of the user. The tokens issued for it are rejected from the next request on.
+func (auth *AuthService) RevokeSession(ctx context.Context, userID string, sessionID string) error {
+	session, err := auth.storage.SessionRepository.FindByID(ctx, sessionID)
+	if errors.Is(err, db.ErrNotFound) || err == nil && session.UserID != userID {
+		return status.Error(codes.NotFound, "session not found")
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if err := auth.storage.SessionRepository.Revoke(ctx, sessionID); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// CheckPassword confirms the password of a logged in user before a sensitive change and returns the user.
+// Wrong passwords count as failed logins: a stolen token must not be a way around the limit of guesses.
+func (auth *AuthService) CheckPassword(ctx context.Context, userID string, pass string) (models.UserDTO, error) {
+	user, err := auth.storage.UserRepository.FindByID(ctx, userID)
+	if err != nil {
+		return models.UserDTO{}, status.Error(codes.Internal, err.Error())
+	}
+	ip := peerIP(ctx)
+	if err := auth.checkLockout(ctx, userAttemptKey(user.Username), ipAttemptKey(ip)); err != nil {
+		return models.UserDTO{}, err
+	}
+	if !CheckPass(pass, user.Password) {
+		auth.recordFailure(ctx, user.Username, user.ID, ip)
+		return models.UserDTO{}, status.Error(codes.PermissionDenied, "current password is wrong")
+	}
+	return user, nil
+}
+
+// ChangePassword replaces the password of the user once the current one is confirmed, and ends every
+// other session, so whoever knew the old password is logged out. The session of the request is kept.
+// It returns the number of sessions ended.
+func (auth *AuthService) ChangePassword(ctx context.Context, userID string, sessionID string, oldPass string,
+	newPass string) (int64, error) {
+	if err := ValidatePassword(newPass); err != nil {
+		return 0, err
+	}
+	user, err := auth.CheckPassword(ctx, userID, oldPass)
+	if err != nil {
+		return 0, err
+	}
+	if oldPass == newPass {
+		return 0, status.Error(codes.InvalidArgument, "new password is the same as the current one")
+	}
+	if err := auth.setPassword(ctx, user, newPass); err != nil {
+		return 0, err
+	}
+	revoked, err := auth.storage.SessionRepository.RevokeOthers(ctx, userID, sessionID)
+	if err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+	err = auth.storage.SecurityEventRepository.RecordEvent(ctx, models.SecurityEvent{
+		UserID: userID, Kind: models.EventPasswordChanged, IP: peerIP(ctx),
+		Detail: fmt.Sprintf("%d other sessions revoked", revoked),
+	})
+	if err != nil {
+		auth.log.Error("failed to record a security event", zap.Error(err))
+	}
+	return revoked, nil
+}
+
+// ResetPassword sets a new password for a user who proved to own the email address instead of knowing
+// the old password. Every session is ended and the failed logins are forgotten, so a locked out owner
+// gets back in. It returns the number of sessions ended.
+func (auth *AuthService) ResetPassword(ctx context.Context, userID string, newPass string) (int64, error) {
+	if err := ValidatePassword(newPass); err != nil {
+		return 0, err
+	}
+	user, err := auth.storage.UserRepository.FindByID(ctx, userID)
+	if err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+	if err := auth.setPassword(ctx, user, newPass); err != nil {
+		return 0, err
+	}
+	revoked, err := auth.storage.SessionRepository.RevokeOthers(ctx, userID, "")
+	if err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+	err = auth.storage.SecurityEventRepository.RecordEvent(ctx, models.SecurityEvent{
+		UserID: userID, Kind: models.EventPasswordReset, IP: peerIP(ctx),
+		Detail: fmt.Sprintf("%d sessions revoked", revoked),
+	})
+	if err != nil {
+		auth.log.Error("failed to record a security event", zap.Error(err))
+	}
+	return revoked, nil
+}
+
+// ValidatePassword rejects passwords that cannot be set: empty ones and those too long for bcrypt.
+func ValidatePassword(pass string) error {
+	if pass == "" {
+		return status.Error(codes.InvalidArgument, "new password is empty")
+	}
+	if len(pass) > maxPasswordLength {
+		return status.Error(codes.InvalidArgument, "new password is too long")
+	}
+	return nil
+}
+
+// setPassword stores the hash of the new password and clears the failed logins of the user.
+func (auth *AuthService) setPassword(ctx context.Context, user models.UserDTO, newPass string) error {
+	hash, err := EncodePass(newPass)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return status.Error(codes.InvalidArgument, "new password is too long")
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if err := auth.storage.UserRepository.UpdatePassword(ctx, user.ID, string(hash)); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	auth.resetFailures(ctx, user.Username)
+	return nil
+}
+
+// Logout revokes the token of the request, so it is rejected until it expires, and ends its session,
+// so its refresh token cannot be used any more.
+func (auth *AuthService) Logout(ctx context.Context) error {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err := auth.storage.RevokedTokenRepository.Revoke(ctx, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if claims.SessionID != "" {
+		if err := auth.storage.SessionRepository.Revoke(ctx, claims.SessionID); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+	// expired tokens are rejected anyway, there is no need to remember them
+	if _, err := auth.storage.RevokedTokenRepository.DeleteExpired(ctx, time.Now()); err != nil {
+		auth.log.Warn("failed to delete expired revoked tokens", zap.Error(err))
+	}
+	return nil
+}
+
+// newRefreshToken returns a random opaque refresh token.
+func newRefreshToken() (string, error) {
+	raw := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken returns the hash refresh tokens are stored and looked up by.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsExpired reads the expiry of the token without verifying its signature, which clients cannot do.
 func IsExpired(tokenString string) (bool, error) {
 	var claims models.Claims
-	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(getSecretKeyToken()), nil
-	})
+	_, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims)
 	if err != nil {
 		return true, err
 	}
@@ -189,6 +582,35 @@ func IsExpired(tokenString string) (bool, error) {
 
 }
 
+// peerIP returns the address the request came from, without the port.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// bearerToken extracts the token from the request, with or without the "Bearer" scheme.
+func bearerToken(ctx context.Context) (string, error) {
+	token, err := ExtractToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(token, "Bearer") {
+		tokenArr := strings.Split(token, " ")
+		if len(tokenArr) < 2 {
+			return "", errors.New("invalid token")
+		}
+		token = tokenArr[1]
+	}
+	return token, nil
+}
+
 // ExtractToken retrieves the 'authorization' token from the gRPC metadata in the given context. Returns an error if the token is missing.
 func ExtractToken(ctx context.Context) (string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
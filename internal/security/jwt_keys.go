@@ -0,0 +1,335 @@
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signing algorithms of the access tokens, named as in the JWT "alg" header.
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgES256 = "ES256"
+)
+
+// minSecretSize is the shortest HS256 secret accepted, shorter ones can be brute forced.
+const minSecretSize = 32
+
+// JWTKey is a key of the ring. Key holds the HS256 secret or the PKCS#8 private key.
+type JWTKey struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	Key       []byte     `json:"key"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// keyRingFile is the layout of the key file.
+type keyRingFile struct {
+	Active string    `json:"active"`
+	Keys   []*JWTKey `json:"keys"`
+}
+
+// KeyRing signs the tokens with its active key and verifies them with any of its keys, picked by
+// the "kid" header. Keeping the retired keys lets the tokens signed before a rotation stay valid.
+type KeyRing struct {
+	mu      sync.RWMutex
+	active  *JWTKey
+	keys    map[string]*JWTKey
+	path    string
+	modTime time.Time
+}
+
+// ParseAlgorithm returns the JWT name of the algorithm; Ed25519 is accepted for EdDSA.
+func ParseAlgorithm(name string) (string, error) {
+	switch strings.ToUpper(name) {
+	case "HS256":
+		return AlgHS256, nil
+	case "EDDSA", "ED25519":
+		return AlgEdDSA, nil
+	case "ES256":
+		return AlgES256, nil
+	default:
+		return "", fmt.Errorf("unknown JWT algorithm %q, expected HS256, Ed25519 or ES256", name)
+	}
+}
+
+// NewJWTKey generates a key for the algorithm.
+func NewJWTKey(algorithm string) (*JWTKey, error) {
+	algorithm, err := ParseAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key := &JWTKey{ID: hex.EncodeToString(id), Algorithm: algorithm, CreatedAt: time.Now().UTC()}
+	switch algorithm {
+	case AlgHS256:
+		key.Key = make([]byte, minSecretSize)
+		if _, err := rand.Read(key.Key); err != nil {
+			return nil, err
+		}
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if key.Key, err = x509.MarshalPKCS8PrivateKey(private); err != nil {
+			return nil, err
+		}
+	case AlgES256:
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if key.Key, err = x509.MarshalPKCS8PrivateKey(private); err != nil {
+			return nil, err
+		}
+	}
+	return key, key.init()
+}
+
+// init decodes the key material into the signing and verification keys.
+func (k *JWTKey) init() error {
+	switch k.Algorithm {
+	case AlgHS256:
+		if len(k.Key) < minSecretSize {
+			return fmt.Errorf("key %s: HS256 secret must be at least %d bytes", k.ID, minSecretSize)
+		}
+		k.method, k.sign, k.verify = jwt.SigningMethodHS256, k.Key, k.Key
+		return nil
+	case AlgEdDSA, AlgES256:
+		private, err := x509.ParsePKCS8PrivateKey(k.Key)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", k.ID, err)
+		}
+		switch private := private.(type) {
+		case ed25519.PrivateKey:
+			if k.Algorithm == AlgEdDSA {
+				k.method, k.sign, k.verify = jwt.SigningMethodEdDSA, private, private.Public()
+				return nil
+			}
+		case *ecdsa.PrivateKey:
+			if k.Algorithm == AlgES256 && private.Curve == elliptic.P256() {
+				k.method, k.sign, k.verify = jwt.SigningMethodES256, private, &private.PublicKey
+				return nil
+			}
+		}
+		return fmt.Errorf("key %s: private key does not match %s", k.ID, k.Algorithm)
+	default:
+		return fmt.Errorf("key %s: unknown algorithm %q", k.ID, k.Algorithm)
+	}
+}
+
+// PublicKey returns the key verifying the tokens; it is the secret itself for HS256.
+func (k *JWTKey) PublicKey() crypto.PublicKey {
+	return k.verify
+}
+
+// NewKeyRing returns a ring signing with the key.
+func NewKeyRing(key *JWTKey) *KeyRing {
+	return &KeyRing{active: key, keys: map[string]*JWTKey{key.ID: key}}
+}
+
+// NewSecretKeyRing returns a ring with a single HS256 key, for a secret set in the config.
+func NewSecretKeyRing(secret string) (*KeyRing, error) {
+	key := &JWTKey{ID: "config", Algorithm: AlgHS256, Key: []byte(secret)}
+	if err := key.init(); err != nil {
+		return nil, err
+	}
+	return NewKeyRing(key), nil
+}
+
+// LoadKeyRing reads the key file written by Save.
+func LoadKeyRing(path string) (*KeyRing, error) {
+	ring := &KeyRing{path: path}
+	if _, err := ring.reload(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// CreateKeyRing writes a key file with a new key for the algorithm.
+func CreateKeyRing(path string, algorithm string) (*KeyRing, error) {
+	key, err := NewJWTKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	ring := NewKeyRing(key)
+	return ring, ring.Save(path)
+}
+
+// reload reads the key file if it changed since the last read.
+func (r *KeyRing) reload() (bool, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := info.ModTime().Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	raw, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	var file keyRingFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return false, fmt.Errorf("malformed key file %s: %w", r.path, err)
+	}
+	keys := make(map[string]*JWTKey, len(file.Keys))
+	for _, key := range file.Keys {
+		if err := key.init(); err != nil {
+			return false, err
+		}
+		keys[key.ID] = key
+	}
+	active, ok := keys[file.Active]
+	if !ok {
+		return false, fmt.Errorf("key file %s: active key %q not found", r.path, file.Active)
+	}
+	r.mu.Lock()
+	r.active, r.keys, r.modTime = active, keys, info.ModTime()
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Save atomically writes the ring to the key file, readable by the owner only.
+func (r *KeyRing) Save(path string) error {
+	r.mu.RLock()
+	file := keyRingFile{Active: r.active.ID}
+	for _, key := range r.keys {
+		file.Keys = append(file.Keys, key)
+	}
+	r.mu.RUnlock()
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Rotate makes a new key for the algorithm active and retires the current one. Keys retired for longer
+// than keep are dropped: every token they signed has expired by then.
+func (r *KeyRing) Rotate(algorithm string, keep time.Duration) (*JWTKey, error) {
+	key, err := NewJWTKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	r.active.RetiredAt = &now
+	for id, old := range r.keys {
+		if old.RetiredAt != nil && old.RetiredAt.Before(now.Add(-keep)) {
+			delete(r.keys, id)
+		}
+	}
+	r.active = key
+	r.keys[key.ID] = key
+	return key, nil
+}
+
+// Keys returns the keys of the ring, the active one first.
+func (r *KeyRing) Keys() []*JWTKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := []*JWTKey{r.active}
+	for _, key := range r.keys {
+		if key != r.active {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Sign signs the claims with the active key and names it in the "kid" header.
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	key := r.active
+	r.mu.RUnlock()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.sign)
+}
+
+// Keyfunc finds the key of the token by its "kid" header. The algorithm of the token must be the one
+// of the key, so a public key is never used as an HMAC secret.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	if id == "" {
+		return nil, errors.New("token has no key ID")
+	}
+	r.mu.RLock()
+	key, ok := r.keys[id]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", id)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verify, nil
+}
+
+// StartReload reloads the key file every interval, so a "gkeeper keys jwt rotate" is picked up
+// without a restart. Rings not read from a file are never reloaded.
+func (r *KeyRing) StartReload(ctx context.Context, interval time.Duration, logger *zap.Logger) {
+	if r.path == "" || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := r.reload()
+			if err != nil {
+				logger.Error("failed to reload JWT keys", zap.String("path", r.path), zap.Error(err))
+			} else if changed {
+				logger.Info("JWT keys reloaded", zap.String("path", r.path))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package security
+
+import (
+	"GophKeeper/internal/models"
+	"crypto/ed25519"
+	"github.com/golang-jwt/jwt/v5"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testClaims() models.Claims {
+	return models.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ID: "jti", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		UserID:           "user",
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt-keys.json")
+	keys, err := CreateKeyRing(path, "Ed25519")
+	if err != nil {
+		t.Fatalf("create key ring: %v", err)
+	}
+	auth := &AuthService{keys: keys}
+	old, err := keys.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	for _, algorithm := range []string{AlgES256, AlgHS256} {
+		if _, err := keys.Rotate(algorithm, time.Hour); err != nil {
+			t.Fatalf("rotate to %s: %v", algorithm, err)
+		}
+	}
+	if err := keys.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := LoadKeyRing(path)
+	if err != nil || len(loaded.Keys()) != 3 || loaded.Keys()[0].Algorithm != AlgHS256 {
+		t.Fatalf("unexpected key ring: %v, %v", loaded, err)
+	}
+	auth.keys = loaded
+	current, err := loaded.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	for _, token := range []string{old, current} {
+		if claims, err := auth.ParseToken(token); err != nil || claims.UserID != "user" {
+			t.Fatalf("token was not verified after the rotation: %v, %v", claims, err)
+		}
+	}
+
+	// keys retired for longer than keep are dropped with the tokens they signed
+	if _, err := loaded.Rotate(AlgEdDSA, -time.Second); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if _, err := auth.ParseToken(old); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Fatalf("expected the dropped key to be unknown, got %v", err)
+	}
+}
+
+func TestKeyfuncRejectsAlgorithmConfusion(t *testing.T) {
+	key, err := NewJWTKey(AlgEdDSA)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	auth := &AuthService{keys: NewKeyRing(key)}
+	// an HS256 token keyed with the public key must not pass for the EdDSA key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	token.Header["kid"] = key.ID
+	forged, err := token.SignedString([]byte(key.PublicKey().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := auth.ParseToken(forged); err == nil {
+		t.Fatal("token signed with the public key as an HMAC secret was accepted")
+	}
+	token = jwt.NewWithClaims(jwt.SigningMethodEdDSA, testClaims())
+	unnamed, _ := token.SignedString(key.sign)
+	if _, err := auth.ParseToken(unnamed); err == nil {
+		t.Fatal("token without a key ID was accepted")
+	}
+}
@@ -0,0 +1,174 @@
+package security
+
+import (
+	db "GophKeeper/internal/storage"
+	"GophKeeper/utils"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// kekSize is the size of the key encryption key, an AES-256 key.
+	kekSize = 32
+	// kekSaltSize is the size of the salt a KEK is derived from a passphrase with.
+	kekSaltSize = 16
+)
+
+// Argon2id parameters deriving a KEK from a passphrase, the second recommendation of RFC 9106.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+// KeyProvider supplies the key encryption key (KEK) the data key is wrapped with. The KEK is kept
+// out of the database, so a dump of the database alone decrypts nothing.
+type KeyProvider interface {
+	KEK(ctx context.Context) ([]byte, error)
+}
+
+// KeyProviderFunc adapts a function to KeyProvider.
+type KeyProviderFunc func(ctx context.Context) ([]byte, error)
+
+func (f KeyProviderFunc) KEK(ctx context.Context) ([]byte, error) {
+	return f(ctx)
+}
+
+// EnvKeyProvider reads the base64 encoded KEK from an environment variable.
+type EnvKeyProvider struct {
+	Name string
+}
+
+func (p EnvKeyProvider) KEK(_ context.Context) ([]byte, error) {
+	if p.Name == "" {
+		return nil, errors.New("no environment variable holding the key encryption key is configured")
+	}
+	value, ok := os.LookupEnv(p.Name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", p.Name)
+	}
+	return decodeKEK(value)
+}
+
+// FileKeyProvider reads the base64 encoded KEK from a file. The file must be accessible by its owner
+// only, as ssh requires of private keys.
+type FileKeyProvider struct {
+	Path string
+}
+
+func (p FileKeyProvider) KEK(_ context.Context) ([]byte, error) {
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("key file %s is not a regular file", p.Path)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return nil, fmt.Errorf("key file %s is accessible by other users (mode %04o), run chmod 600 %s",
+			p.Path, perm, p.Path)
+	}
+	raw, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKEK(string(raw))
+}
+
+// PassphraseKeyProvider derives the KEK from a passphrase with Argon2id. The salt is not secret and
+// is kept in the settings; it is saved once the first passphrase has been confirmed.
+type PassphraseKeyProvider struct {
+	settings db.SettingsRepository
+	// read asks for the passphrase, twice if confirm is set
+	read func(confirm bool) ([]byte, error)
+}
+
+func NewPassphraseKeyProvider(settings db.SettingsRepository,
+	read func(confirm bool) ([]byte, error)) *PassphraseKeyProvider {
+	return &PassphraseKeyProvider{settings: settings, read: read}
+}
+
+func (p *PassphraseKeyProvider) KEK(ctx context.Context) ([]byte, error) {
+	setting, err := p.settings.FindSettingsByKey(ctx, utils.SettingKeyKekSalt)
+	first := errors.Is(err, db.ErrNotFound)
+	if err != nil && !first {
+		return nil, err
+	}
+	// a mistyped first passphrase would lock the data away for good
+	passphrase, err := p.read(first)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+	encoded := setting.Value
+	if first {
+		if encoded, err = p.createSalt(ctx); err != nil {
+			return nil, err
+		}
+	}
+	salt, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return argon2.IDKey(passphrase, salt, argonTime, argonMemory, argonThreads, kekSize), nil
+}
+
+// createSalt saves a new salt unless a server starting at the same time saved one first, and returns
+// the encoded salt stored.
+func (p *PassphraseKeyProvider) createSalt(ctx context.Context) (string, error) {
+	salt := make([]byte, kekSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return p.settings.SaveSettingsIfAbsent(ctx, utils.SettingKeyKekSalt, base64.StdEncoding.EncodeToString(salt))
+}
+
+// NewKEK returns a random KEK encoded as EnvKeyProvider and FileKeyProvider read it.
+func NewKEK() (string, error) {
+	kek := make([]byte, kekSize)
+	if _, err := rand.Read(kek); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(kek), nil
+}
+
+// CreateKEKFile writes a random KEK to a new file at path, accessible by the owner only.
+func CreateKEKFile(path string) error {
+	kek, err := NewKEK()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(kek + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func decodeKEK(encoded string) ([]byte, error) {
+	kek, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("key encryption key is not base64 encoded: %w", err)
+	}
+	if len(kek) != kekSize {
+		return nil, fmt.Errorf("key encryption key must be %d bytes, got %d", kekSize, len(kek))
+	}
+	return kek, nil
+}
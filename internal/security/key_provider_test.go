@@ -0,0 +1,196 @@
+package security
+
+import (
+	"GophKeeper/internal/storage/memory"
+	"GophKeeper/utils"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func staticKEK(kek []byte) KeyProvider {
+	return KeyProviderFunc(func(context.Context) ([]byte, error) { return kek, nil })
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys", "kek.key")
+	if err := CreateKEKFile(path); err != nil {
+		t.Fatalf("create key file: %v", err)
+	}
+	if err := CreateKEKFile(path); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected an existing key file to be kept, got %v", err)
+	}
+	kek, err := FileKeyProvider{Path: path}.KEK(ctx)
+	if err != nil || len(kek) != kekSize {
+		t.Fatalf("read key file: %d bytes, %v", len(kek), err)
+	}
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (FileKeyProvider{Path: path}).KEK(ctx); err == nil {
+		t.Fatal("expected a key file readable by others to be rejected")
+	}
+}
+
+func TestEnvKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	kek, err := NewKEK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GKEEPER_TEST_KEK", kek)
+	if got, err := (EnvKeyProvider{Name: "GKEEPER_TEST_KEK"}).KEK(ctx); err != nil || len(got) != kekSize {
+		t.Fatalf("read variable: %d bytes, %v", len(got), err)
+	}
+	t.Setenv("GKEEPER_TEST_KEK", base64.StdEncoding.EncodeToString([]byte("short")))
+	if _, err := (EnvKeyProvider{Name: "GKEEPER_TEST_KEK"}).KEK(ctx); err == nil {
+		t.Fatal("expected a short key to be rejected")
+	}
+	if _, err := (EnvKeyProvider{Name: "GKEEPER_TEST_MISSING"}).KEK(ctx); err == nil {
+		t.Fatal("expected a missing variable to be rejected")
+	}
+}
+
+func TestPassphraseKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewStorage()
+	aborted := NewPassphraseKeyProvider(storage.SettingsRepository, func(bool) ([]byte, error) {
+		return nil, errors.New("passphrases do not match")
+	})
+	if _, err := aborted.KEK(ctx); err == nil {
+		t.Fatal("expected the error of the prompt")
+	}
+	if _, err := storage.SettingsRepository.FindSettingsByKey(ctx, utils.SettingKeyKekSalt); err == nil {
+		t.Fatal("expected no salt to be saved before the passphrase is confirmed")
+	}
+	var confirmed []bool
+	provider := NewPassphraseKeyProvider(storage.SettingsRepository, func(confirm bool) ([]byte, error) {
+		confirmed = append(confirmed, confirm)
+		return []byte("correct horse"), nil
+	})
+	first, err := provider.KEK(ctx)
+	if err != nil {
+		t.Fatalf("derive key: %v", err)
+	}
+	second, err := provider.KEK(ctx)
+	if err != nil || !bytes.Equal(first, second) {
+		t.Fatalf("expected the same key from the same passphrase: %v", err)
+	}
+	if len(confirmed) != 2 || !confirmed[0] || confirmed[1] {
+		t.Fatalf("expected the passphrase to be confirmed on the first use only: %v", confirmed)
+	}
+}
+
+func TestSecureServiceKeepsOnlyWrappedDEK(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewStorage()
+	kek := bytes.Repeat([]byte{1}, kekSize)
+	first := NewSecureService(storage, zap.NewNop(), staticKEK(kek))
+	if err := first.Init(ctx); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	encrypted, err := first.EncryptData([]byte("secret"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := storage.SettingsRepository.FindSettingsByKey(ctx, utils.SettingKeyKek); err == nil {
+		t.Fatal("expected the KEK not to be stored")
+	}
+
+	restarted := NewSecureService(storage, zap.NewNop(), staticKEK(kek))
+	if err := restarted.Init(ctx); err != nil {
+		t.Fatalf("init after restart: %v", err)
+	}
+	if plain, err := restarted.DecryptData(encrypted); err != nil || string(plain) != "secret" {
+		t.Fatalf("decrypt after restart: %q, %v", plain, err)
+	}
+	wrong := NewSecureService(storage, zap.NewNop(), staticKEK(bytes.Repeat([]byte{2}, kekSize)))
+	if err := wrong.Init(ctx); !errors.Is(err, ErrWrongKEK) {
+		t.Fatalf("expected ErrWrongKEK, got %v", err)
+	}
+
+	next := bytes.Repeat([]byte{3}, kekSize)
+	if err := restarted.RotateKEK(ctx, next); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	rotated := NewSecureService(storage, zap.NewNop(), staticKEK(next))
+	if err := rotated.Init(ctx); err != nil {
+		t.Fatalf("init with the new KEK: %v", err)
+	}
+	if plain, err := rotated.DecryptData(encrypted); err != nil || string(plain) != "secret" {
+		t.Fatalf("decrypt after rotation: %q, %v", plain, err)
+	}
+}
+
+func TestSecureServiceConcurrentFirstStart(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewStorage()
+	kek := bytes.Repeat([]byte{7}, kekSize)
+	services := make([]*SecureService, 4)
+	errs := make([]error, len(services))
+	var wg sync.WaitGroup
+	for i := range services {
+		services[i] = NewSecureService(storage, zap.NewNop(), staticKEK(kek))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = services[i].Init(ctx)
+		}()
+	}
+	wg.Wait()
+	encrypted, err := services[0].EncryptData([]byte("secret"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	for i, s := range services {
+		if errs[i] != nil {
+			t.Fatalf("init %d: %v", i, errs[i])
+		}
+		if plain, err := s.DecryptData(encrypted); err != nil || string(plain) != "secret" {
+			t.Fatalf("server %d uses another data key: %q, %v", i, plain, err)
+		}
+	}
+}
+
+func TestSecureServiceMigratesStoredKEK(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewStorage()
+	// the key pair of older releases: the KEK and the DEK wrapped with it using AES-CFB
+	legacyKEK := bytes.Repeat([]byte{4}, kekSize)
+	dek := bytes.Repeat([]byte{5}, kekSize)
+	block, err := aes.NewCipher(legacyKEK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := make([]byte, aes.BlockSize+len(dek))
+	cipher.NewCFBEncrypter(block, wrapped[:aes.BlockSize]).XORKeyStream(wrapped[aes.BlockSize:], dek)
+	for key, value := range map[string][]byte{utils.SettingKeyKek: legacyKEK, utils.SettingKeyDek: wrapped} {
+		if _, err := storage.SettingsRepository.SaveSettings(ctx, key, base64.StdEncoding.EncodeToString(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kek := bytes.Repeat([]byte{6}, kekSize)
+	s := NewSecureService(storage, zap.NewNop(), staticKEK(kek))
+	if err := s.Init(ctx); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if got, err := s.decryptDEK(s.kek, s.dek); err != nil || !bytes.Equal(got, dek) {
+		t.Fatalf("expected the data key to be kept: %v", err)
+	}
+	for _, key := range []string{utils.SettingKeyKek, utils.SettingKeyDek} {
+		if _, err := storage.SettingsRepository.FindSettingsByKey(ctx, key); err == nil {
+			t.Fatalf("expected %s to be deleted", key)
+		}
+	}
+}
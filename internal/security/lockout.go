@@ -0,0 +1,181 @@
+package security
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LockoutPolicy limits failed logins. Every failure doubles the time until the next attempt is accepted,
+// starting at Backoff, and after MaxFailures failures of a user name (IPMaxFailures of an address) within
+// Window logins are rejected for Duration.
+type LockoutPolicy struct {
+	MaxFailures   int
+	IPMaxFailures int
+	Window        time.Duration
+	Backoff       time.Duration
+	Duration      time.Duration
+}
+
+// DefaultLockoutPolicy returns the policy used for the settings that are not configured.
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures:   5,
+		IPMaxFailures: 20,
+		Window:        15 * time.Minute,
+		Backoff:       time.Second,
+		Duration:      15 * time.Minute,
+	}
+}
+
+// withDefaults replaces the unset settings with the defaults.
+func (p LockoutPolicy) withDefaults() LockoutPolicy {
+	defaults := DefaultLockoutPolicy()
+	if p.MaxFailures <= 0 {
+		p.MaxFailures = defaults.MaxFailures
+	}
+	if p.IPMaxFailures <= 0 {
+		p.IPMaxFailures = defaults.IPMaxFailures
+	}
+	if p.Window <= 0 {
+		p.Window = defaults.Window
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = defaults.Backoff
+	}
+	if p.Duration <= 0 {
+		p.Duration = defaults.Duration
+	}
+	return p
+}
+
+// delay returns how long after the last of the failures the next attempt is rejected.
+func (p LockoutPolicy) delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	exp := math.Min(float64(failures-1), 32)
+	delay := time.Duration(float64(p.Backoff) * math.Pow(2, exp))
+	if delay > p.Duration || delay <= 0 {
+		return p.Duration
+	}
+	return delay
+}
+
+// invalidCredentials is returned for an unknown user name and a wrong password alike, so logins
+// cannot be used to find out which users exist.
+var invalidCredentials = status.Error(codes.Unauthenticated, "invalid username or password")
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkDummyPassword spends the time of a password check, for users that do not exist.
+func checkDummyPassword(pass string) {
+	dummyHashOnce.Do(func() {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+		dummyHash = string(hash)
+	})
+	CheckPass(pass, dummyHash)
+}
+
+// userAttemptKey and ipAttemptKey name the failure counters of a user name and an address.
+func userAttemptKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLockout rejects the login if the user name or the address is locked or still backing off.
+func (auth *AuthService) checkLockout(ctx context.Context, keys ...string) error {
+	now := time.Now()
+	for _, key := range keys {
+		attempt, err := auth.storage.LoginAttemptRepository.FindAttempt(ctx, key)
+		if errors.Is(err, db.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		retryAt := attempt.LastFailureAt.Add(auth.lockout.delay(attempt.Failures))
+		if now.Sub(attempt.LastFailureAt) > auth.lockout.Window {
+			retryAt = time.Time{}
+		}
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(retryAt) {
+			retryAt = *attempt.LockedUntil
+		}
+		if now.Before(retryAt) {
+			wait := retryAt.Sub(now).Round(time.Second)
+			if wait < time.Second {
+				wait = time.Second
+			}
+			return status.Error(codes.ResourceExhausted,
+				fmt.Sprintf("too many failed login attempts, try again in %s", wait))
+		}
+	}
+	return nil
+}
+
+// recordFailure counts a failed login for the user name and the address, and locks them once they
+// reach the limit. userID is empty for unknown user names.
+func (auth *AuthService) recordFailure(ctx context.Context, username string, userID string, ip string) {
+	now := time.Now()
+	auth.countFailure(ctx, userAttemptKey(username), auth.lockout.MaxFailures, now, models.SecurityEvent{
+		UserID: userID, Kind: models.EventUserLocked, IP: ip, Detail: "username " + username,
+	})
+	if ip != "" {
+		auth.countFailure(ctx, ipAttemptKey(ip), auth.lockout.IPMaxFailures, now, models.SecurityEvent{
+			Kind: models.EventIPLocked, IP: ip, Detail: "last username " + username,
+		})
+	}
+}
+
+func (auth *AuthService) countFailure(ctx context.Context, key string, limit int, now time.Time,
+	event models.SecurityEvent) {
+	attempt, err := auth.storage.LoginAttemptRepository.RecordFailure(ctx, key, now, auth.lockout.Window)
+	if err != nil {
+		auth.log.Error("failed to record a failed login", zap.String("key", key), zap.Error(err))
+		return
+	}
+	if attempt.Failures < limit {
+		return
+	}
+	until := now.Add(auth.lockout.Duration)
+	if err := auth.storage.LoginAttemptRepository.Lock(ctx, key, until); err != nil {
+		auth.log.Error("failed to lock logins", zap.String("key", key), zap.Error(err))
+		return
+	}
+	auth.log.Warn("logins locked after failed attempts", zap.String("key", key), zap.Int("failures", attempt.Failures),
+		zap.Time("until", until))
+	event.Detail = fmt.Sprintf("%s, %d failed logins, locked until %s", event.Detail, attempt.Failures,
+		until.UTC().Format(time.RFC3339))
+	if err := auth.storage.SecurityEventRepository.RecordEvent(ctx, event); err != nil {
+		auth.log.Error("failed to record a security event", zap.Error(err))
+	}
+}
+
+// ForgetUser drops the failed logins of the user name, for a deleted account.
+func (auth *AuthService) ForgetUser(ctx context.Context, username string) error {
+	return auth.storage.LoginAttemptRepository.Reset(ctx, userAttemptKey(username))
+}
+
+// resetFailures forgets the failed logins of the user name after a successful login. The counter of
+// the address is kept, so one valid account does not unlock guessing the passwords of others.
+func (auth *AuthService) resetFailures(ctx context.Context, username string) {
+	if err := auth.storage.LoginAttemptRepository.Reset(ctx, userAttemptKey(username)); err != nil {
+		auth.log.Warn("failed to reset failed logins", zap.Error(err))
+	}
+}
@@ -0,0 +1,89 @@
+package security
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ListUsersFullMethod         = "/pb.AdminService/ListUsers"
+	DisableUserFullMethod       = "/pb.AdminService/DisableUser"
+	EnableUserFullMethod        = "/pb.AdminService/EnableUser"
+	SetRoleFullMethod           = "/pb.AdminService/SetRole"
+	ResetUserPasswordFullMethod = "/pb.AdminService/ResetUserPassword"
+)
+
+const (
+	UploadFileFullMethod         = "/pb.FileManagerService/UploadFile"
+	UploadFileByChunksFullMethod = "/pb.FileManagerService/UploadFileByChunks"
+	SaveCredentialsFullMethod    = "/pb.FileManagerService/SaveCredentials"
+	ResolveConflictFullMethod    = "/pb.FileManagerService/ResolveConflict"
+	CreateShareLinkFullMethod    = "/pb.FileManagerService/CreateShareLink"
+)
+
+// methodRoles maps the methods not open to every user to the role they require. The role is read from
+// the access token, so a changed role applies once the user's sessions are refreshed or revoked.
+var methodRoles = map[string]string{
+	ListUsersFullMethod:         models.RoleAdmin,
+	DisableUserFullMethod:       models.RoleAdmin,
+	EnableUserFullMethod:        models.RoleAdmin,
+	SetRoleFullMethod:           models.RoleAdmin,
+	ResetUserPasswordFullMethod: models.RoleAdmin,
+}
+
+// verifiedMethods store data or make files public, so they are closed to users who have not verified
+// their email address: an account nobody can be reached at must not fill the storage or share files.
+var verifiedMethods = map[string]bool{
+	UploadFileFullMethod:         true,
+	UploadFileByChunksFullMethod: true,
+	SaveCredentialsFullMethod:    true,
+	ResolveConflictFullMethod:    true,
+	CreateShareLinkFullMethod:    true,
+}
+
+// errUnverified is returned on calls of verifiedMethods by a user whose address is not verified yet.
+var errUnverified = status.Error(codes.FailedPrecondition, "verify your email address first")
+
+// errDisabled is returned on logins and refreshes of a user an administrator disabled.
+var errDisabled = status.Error(codes.PermissionDenied, "account is disabled")
+
+// authorize rejects the call of a method that requires a role the authenticated user does not have.
+func authorize(ctx context.Context, fullMethod string) error {
+	required, ok := methodRoles[fullMethod]
+	if !ok {
+		return nil
+	}
+	if role, _ := ctx.Value(RoleKey).(string); role != required {
+		return status.Error(codes.PermissionDenied, "this method requires the "+required+" role")
+	}
+	return nil
+}
+
+// checkAccess applies the method policy to the call of an authenticated user. Unlike the role, the
+// verification of the address is looked up on every call of verifiedMethods, so it applies at once.
+func (auth *AuthService) checkAccess(ctx context.Context, fullMethod string) error {
+	if err := authorize(ctx, fullMethod); err != nil {
+		return err
+	}
+	if !verifiedMethods[fullMethod] {
+		return nil
+	}
+	userID, _ := ctx.Value(UserIDKey).(string)
+	user, err := auth.storage.UserRepository.FindByID(ctx, userID)
+	if err != nil {
+		auth.log.Error("failed to check the email verification", zap.String("userID", userID), zap.Error(err))
+		return status.Error(codes.Internal, "could not check the account")
+	}
+	if user.EmailVerifiedAt == nil {
+		return errUnverified
+	}
+	return nil
+}
+
+// ValidRole reports whether users can be given the role.
+func ValidRole(role string) bool {
+	return role == models.RoleUser || role == models.RoleAdmin
+}
@@ -0,0 +1,65 @@
+package security
+
+import (
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/proto/gkeeper/pb"
+	"GophKeeper/internal/storage/memory"
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMethodRolesCoverAdminService(t *testing.T) {
+	desc := pb.AdminService_ServiceDesc
+	for _, method := range desc.Methods {
+		fullMethod := "/" + desc.ServiceName + "/" + method.MethodName
+		if methodRoles[fullMethod] != models.RoleAdmin {
+			t.Errorf("%s does not require the admin role", fullMethod)
+		}
+	}
+	if len(desc.Streams) != 0 {
+		t.Errorf("streams of %s are not covered by the test", desc.ServiceName)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	user := context.WithValue(context.Background(), RoleKey, models.RoleUser)
+	admin := context.WithValue(context.Background(), RoleKey, models.RoleAdmin)
+	if err := authorize(user, ListUsersFullMethod); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for a user, got %v", err)
+	}
+	if err := authorize(admin, ListUsersFullMethod); err != nil {
+		t.Fatalf("admin rejected: %v", err)
+	}
+	if err := authorize(user, "/pb.FileManagerService/ListUserFiles"); err != nil {
+		t.Fatalf("user rejected from an open method: %v", err)
+	}
+}
+
+func TestCheckAccessRequiresVerifiedAddress(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewStorage()
+	auth := &AuthService{storage: storage, log: zap.NewNop()}
+	userID, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	user := context.WithValue(context.WithValue(ctx, RoleKey, models.RoleUser), UserIDKey, userID.String())
+	for fullMethod := range verifiedMethods {
+		if err := auth.checkAccess(user, fullMethod); status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("expected FailedPrecondition for %s, got %v", fullMethod, err)
+		}
+	}
+	if err := auth.checkAccess(user, "/pb.FileManagerService/ListUserFiles"); err != nil {
+		t.Fatalf("unverified user rejected from an open method: %v", err)
+	}
+	if err := storage.UserRepository.MarkEmailVerified(ctx, userID.String()); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := auth.checkAccess(user, SaveCredentialsFullMethod); err != nil {
+		t.Fatalf("verified user rejected: %v", err)
+	}
+}
@@ -10,32 +10,37 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"io"
 	"log"
 	"sync"
-	"time"
 )
 
 const (
 	// byte12nonce is the size of the nonce used in AES-GCM encryption, set to 12 bytes.
 	byte12nonce int = 12
-	// rotationTime defines the interval at which keys will be rotated, set to 5 minutes. (should be out to config)
-	rotationTime time.Duration = 5 * time.Minute
 )
 
+// ErrWrongKEK is returned by Init when the key encryption key does not unwrap the data key.
+var ErrWrongKEK = errors.New("the key encryption key is not the one the data key was wrapped with")
+
+// SecureService encrypts the data of the users with the data key (DEK). Only the DEK wrapped with
+// the key encryption key (KEK) of the key provider is stored.
 type SecureService struct {
 	storage *db.Storage
+	keys    KeyProvider
 	logger  *zap.Logger
 	kek     []byte
 	dek     []byte
 	mu      sync.Mutex
 }
 
-func NewSecureService(storage *db.Storage, logger *zap.Logger) *SecureService {
+func NewSecureService(storage *db.Storage, logger *zap.Logger, keys KeyProvider) *SecureService {
 	return &SecureService{
 		storage: storage,
+		keys:    keys,
 		logger:  logger,
 		kek:     []byte{},
 		dek:     []byte{},
@@ -53,65 +58,122 @@ func generateKey() []byte {
 	return key
 }
 
-func (s *SecureService) GetKek(ctx context.Context) (string, error) {
-	key, err := s.storage.SettingsRepository.FindSettingsByKey(ctx, utils.SettingKeyKek)
+// Init obtains the KEK from the key provider and unwraps the data key with it. On the first start
+// the data key is generated. A key pair stored by a release that kept the KEK in the database is
+// migrated: its data key is wrapped with the provided KEK and the stored KEK is deleted.
+func (s *SecureService) Init(ctx context.Context) error {
+	kek, err := s.keys.KEK(ctx)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("failed to obtain the key encryption key: %w", err)
+	}
+	if len(kek) != kekSize {
+		return fmt.Errorf("key encryption key must be %d bytes, got %d", kekSize, len(kek))
+	}
+	wrapped, err := s.wrappedDEK(ctx)
+	if errors.Is(err, db.ErrNotFound) {
+		wrapped, err = s.createDEK(ctx, kek)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := s.decryptDEK(kek, wrapped); err != nil {
+		return ErrWrongKEK
 	}
-	return key.Value, nil
+	// also removes what an interrupted migration left behind
+	deleted, err := s.storage.SettingsRepository.DeleteSettings(ctx, utils.SettingKeyKek, utils.SettingKeyDek)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		s.logger.Warn("deleted the key encryption key stored in the database, backups made before still hold it",
+			zap.Int64("rows", deleted))
+	}
+	s.mu.Lock()
+	s.kek = kek
+	s.dek = wrapped
+	s.mu.Unlock()
+	s.logger.Info("data key unwrapped")
+	return nil
 }
 
-func (s *SecureService) GetDek(ctx context.Context) (string, error) {
-	key, err := s.storage.SettingsRepository.FindSettingsByKey(ctx, utils.SettingKeyDek)
+// createDEK wraps the data key stored by an older release, or a new one, with the KEK and stores it
+// unless another server starting at the same time stored its key first. The stored key is returned
+// either way.
+func (s *SecureService) createDEK(ctx context.Context, kek []byte) ([]byte, error) {
+	dek, err := s.legacyDEK(ctx)
+	switch {
+	case err == nil:
+		s.logger.Info("wrapping the data key with the key encryption key of the key provider")
+	case errors.Is(err, db.ErrNotFound):
+		dek = generateKey()
+	default:
+		return nil, err
+	}
+	wrapped, err := s.encryptDEK(kek, dek)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	stored, err := s.storage.SettingsRepository.SaveSettingsIfAbsent(ctx, utils.SettingKeyWrappedDek,
+		base64.StdEncoding.EncodeToString(wrapped))
+	if err != nil {
+		return nil, err
 	}
-	return key.Value, nil
+	return base64.StdEncoding.DecodeString(stored)
 }
 
-func (s *SecureService) getAllKeys(ctx context.Context) ([]byte, []byte, error) {
-	kek, err := s.GetKek(ctx)
+func (s *SecureService) wrappedDEK(ctx context.Context) ([]byte, error) {
+	setting, err := s.storage.SettingsRepository.FindSettingsByKey(ctx, utils.SettingKeyWrappedDek)
 	if err != nil {
-		return []byte{}, []byte{}, err
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(setting.Value)
+}
+
+// legacyDEK returns the data key of the key pair stored by older releases. It is unwrapped with the
+// stored KEK just as those releases did at the start.
+func (s *SecureService) legacyDEK(ctx context.Context) ([]byte, error) {
+	kek, err := s.storage.SettingsRepository.FindSettingsByKey(ctx, utils.SettingKeyKek)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := s.storage.SettingsRepository.FindSettingsByKey(ctx, utils.SettingKeyDek)
+	if err != nil {
+		return nil, err
+	}
+	decodedKek, err := base64.StdEncoding.DecodeString(kek.Value)
+	if err != nil {
+		return nil, err
 	}
-	dek, err := s.GetDek(ctx)
+	decodedDek, err := base64.StdEncoding.DecodeString(dek.Value)
 	if err != nil {
-		return []byte{}, []byte{}, err
+		return nil, err
 	}
-	return []byte(kek), []byte(dek), nil
+	return decryptLegacyDEK(decodedKek, decodedDek)
 }
 
-func (s *SecureService) Init(ctx context.Context) error {
-	kek, dek, keyErr := s.getAllKeys(ctx)
-	if keyErr == nil {
-		decodedKek, decErr := base64.StdEncoding.DecodeString(string(kek))
-		if decErr != nil {
-			return decErr
-		}
-		decodedDek, decErr := base64.StdEncoding.DecodeString(string(dek))
-		if decErr != nil {
-			return decErr
-		}
-		s.kek = decodedKek
-		s.dek = decodedDek
-		s.logger.Info("dek and kek loaded")
-		return nil
-	}
-	kek = generateKey()
-	dek = generateKey()
-	encryptedDEK, err := s.encryptDEK(kek, dek)
+// RotateKEK wraps the data key with a new KEK. The data stays encrypted with the same data key.
+func (s *SecureService) RotateKEK(ctx context.Context, kek []byte) error {
+	if len(kek) != kekSize {
+		return fmt.Errorf("key encryption key must be %d bytes, got %d", kekSize, len(kek))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dek, err := s.decryptDEK(s.kek, s.dek)
 	if err != nil {
 		return err
 	}
-
-	err = s.storage.SettingsRepository.SaveKeys(ctx,
-		base64.StdEncoding.EncodeToString(kek),
-		base64.StdEncoding.EncodeToString(dek))
+	wrapped, err := s.encryptDEK(kek, dek)
+	if err != nil {
+		return err
+	}
+	err = s.storage.SettingsRepository.PutSettings(ctx, utils.SettingKeyWrappedDek,
+		base64.StdEncoding.EncodeToString(wrapped))
 	if err != nil {
 		return err
 	}
 	s.kek = kek
-	s.dek = encryptedDEK
+	s.dek = wrapped
+	s.logger.Info("data key wrapped with a new key encryption key")
 	return nil
 }
 
@@ -201,28 +263,49 @@ func (s *SecureService) DecryptData(encrypted string) ([]byte, error) {
 	return plaintext, nil
 }
 
-// encryptDEK шифрует DEK с использованием текущего KEK
+// encryptDEK wraps the DEK with the KEK using AES-GCM, so a wrong KEK is detected on unwrapping.
 func (s *SecureService) encryptDEK(kek []byte, dek []byte) ([]byte, error) {
 	block, err := aes.NewCipher(kek)
 	if err != nil {
 		return nil, err
 	}
-	ciphertext := make([]byte, aes.BlockSize+len(dek))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
 		return nil, err
 	}
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], dek)
-	return ciphertext, nil
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, dek, nil), nil
 }
 
-// decryptDEK дешифрует DEK с использованием текущего KEK
+// decryptDEK unwraps the DEK wrapped by encryptDEK.
 func (s *SecureService) decryptDEK(kek []byte, encryptedDEK []byte) ([]byte, error) {
 	block, err := aes.NewCipher(kek)
 	if err != nil {
 		return nil, err
 	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(encryptedDEK) < gcm.NonceSize() {
+		return nil, errors.New("wrapped data key too short")
+	}
+	nonce, ciphertext := encryptedDEK[:gcm.NonceSize()], encryptedDEK[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// decryptLegacyDEK unwraps a DEK wrapped by older releases, which used AES-CFB.
+func decryptLegacyDEK(kek []byte, encryptedDEK []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(encryptedDEK) < aes.BlockSize {
+		return nil, errors.New("legacy data key too short")
+	}
 	iv := encryptedDEK[:aes.BlockSize]
 	encryptedDEK = encryptedDEK[aes.BlockSize:]
 	dek := make([]byte, len(encryptedDEK))
@@ -231,39 +314,6 @@ func (s *SecureService) decryptDEK(kek []byte, encryptedDEK []byte) ([]byte, err
 	return dek, nil
 }
 
-func (s *SecureService) StartTickerRotation(ctx context.Context) {
-	ticker := time.NewTicker(rotationTime)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			s.rotateKeys(ctx)
-		case <-ctx.Done():
-			break
-		}
-	}
-}
-
-func (s *SecureService) rotateKeys(ctx context.Context) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	newKey := generateKey()
-	dek, _ := s.decryptDEK(s.kek, s.dek)
-	newEncryptedDEK, _ := s.encryptDEK(newKey, dek)
-	err := s.storage.SettingsRepository.SaveKeys(ctx,
-		base64.StdEncoding.EncodeToString(newKey),
-		base64.StdEncoding.EncodeToString(newEncryptedDEK))
-	if err != nil {
-		log.Fatalf("Failed to update keys: %v", err)
-	}
-	s.kek = newKey
-	s.dek = newEncryptedDEK
-	s.logger.Info("keys rotated")
-}
-func getSecretKeyToken() string {
-	return "secret-key"
-}
-
 func EncodePass(pass string) ([]byte, error) {
 	return bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
 }
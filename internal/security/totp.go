@@ -0,0 +1,222 @@
+package security
+
+import (
+	db "GophKeeper/internal/storage"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"rsc.io/qr"
+	"strings"
+	"time"
+)
+
+// SecondFactorRequired is the message of the FailedPrecondition error answering a login without the code
+// of a user with two-factor authentication.
+const SecondFactorRequired = "second factor required"
+
+const (
+	// totpPeriod is the lifetime of a code in seconds.
+	totpPeriod = 30
+	// totpSkew is the number of periods before and after the current one whose codes are accepted,
+	// for clocks that are a bit off.
+	totpSkew = 1
+	// recoveryCodeCount is the number of recovery codes issued when two-factor authentication is enabled.
+	recoveryCodeCount = 10
+)
+
+// recoveryEncoding writes recovery codes in lower case without padding, so they are easy to type.
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Enrollment is what an authenticator app needs to generate the codes of a user.
+type Enrollment struct {
+	Secret string
+	URI    string // otpauth:// provisioning URI
+	QRCode string // the URI as a QR code printable in a terminal
+}
+
+// TOTPService manages the time-based one-time passwords (RFC 6238) of the users.
+type TOTPService struct {
+	storage *db.Storage
+	secure  *SecureService
+	log     *zap.Logger
+	issuer  string
+}
+
+// NewTOTPService constructs a TOTPService. Secrets are encrypted with the data key of secure, and
+// authenticator apps show them under issuer.
+func NewTOTPService(storage *db.Storage, secure *SecureService, logger *zap.Logger, issuer string) *TOTPService {
+	if issuer == "" {
+		issuer = "GophKeeper"
+	}
+	return &TOTPService{
+		storage: storage,
+		secure:  secure,
+		log:     logger,
+		issuer:  issuer,
+	}
+}
+
+// Enable generates a new secret for the user. Two-factor authentication stays off until a code
+// generated from it is confirmed, so a secret that never made it to the app locks nobody out.
+func (t *TOTPService) Enable(ctx context.Context, userID string) (Enrollment, error) {
+	user, err := t.storage.UserRepository.FindByID(ctx, userID)
+	if err != nil {
+		return Enrollment{}, status.Error(codes.Internal, err.Error())
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: t.issuer, AccountName: user.Username, Period: totpPeriod})
+	if err != nil {
+		return Enrollment{}, status.Error(codes.Internal, err.Error())
+	}
+	encrypted, err := t.secure.EncryptData([]byte(key.Secret()))
+	if err != nil {
+		return Enrollment{}, status.Error(codes.Internal, err.Error())
+	}
+	err = t.storage.TOTPRepository.SaveSecret(ctx, userID, encrypted)
+	if errors.Is(err, db.ErrAlreadyExists) {
+		return Enrollment{}, status.Error(codes.AlreadyExists, "two-factor authentication is already enabled")
+	}
+	if err != nil {
+		return Enrollment{}, status.Error(codes.Internal, err.Error())
+	}
+	qrCode, err := renderQR(key.URL())
+	if err != nil {
+		return Enrollment{}, status.Error(codes.Internal, err.Error())
+	}
+	return Enrollment{Secret: key.Secret(), URI: key.URL(), QRCode: qrCode}, nil
+}
+
+// Confirm enables two-factor authentication once the code matches the secret from Enable, and returns
+// new recovery codes. They are stored hashed, so this is the only time they can be shown.
+func (t *TOTPService) Confirm(ctx context.Context, userID string, code string) ([]string, error) {
+	secret, err := t.storage.TOTPRepository.FindByUser(ctx, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication was not enabled")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if secret.ConfirmedAt != nil {
+		return nil, status.Error(codes.AlreadyExists, "two-factor authentication is already enabled")
+	}
+	if err := t.checkCode(ctx, userID, secret.Secret, code); err != nil {
+		return nil, err
+	}
+	recoveryCodes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range recoveryCodes {
+		raw := make([]byte, 6)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		encoded := recoveryEncoding.EncodeToString(raw)
+		recoveryCodes[i] = encoded[:5] + "-" + encoded[5:]
+		hashes[i] = hashToken(recoveryCodes[i])
+	}
+	if err := t.storage.TOTPRepository.Confirm(ctx, userID, hashes); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return recoveryCodes, nil
+}
+
+// Required reports whether the user has to give a second factor to log in.
+func (t *TOTPService) Required(ctx context.Context, userID string) (bool, error) {
+	secret, err := t.storage.TOTPRepository.FindByUser(ctx, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return secret.ConfirmedAt != nil, nil
+}
+
+// Verify accepts a current code from the authenticator app or an unused recovery code, which is
+// used up by it.
+func (t *TOTPService) Verify(ctx context.Context, userID string, code string) error {
+	code = strings.TrimSpace(code)
+	if strings.Contains(code, "-") {
+		err := t.storage.TOTPRepository.UseRecoveryCode(ctx, userID, hashToken(strings.ToLower(code)))
+		if errors.Is(err, db.ErrNotFound) {
+			return status.Error(codes.Unauthenticated, "invalid authentication code")
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		t.log.Info("recovery code used", zap.String("userID", userID))
+		return nil
+	}
+	secret, err := t.storage.TOTPRepository.FindByUser(ctx, userID)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return t.checkCode(ctx, userID, secret.Secret, code)
+}
+
+// checkCode compares the code with the codes of the periods around now. The period of the matching code
+// is recorded, so an intercepted code cannot be replayed.
+func (t *TOTPService) checkCode(ctx context.Context, userID string, encryptedSecret string, code string) error {
+	secret, err := t.secure.DecryptData(encryptedSecret)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	now := time.Now()
+	for skew := -totpSkew; skew <= totpSkew; skew++ {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(string(secret), at, totp.ValidateOpts{
+			Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+		err = t.storage.TOTPRepository.UseStep(ctx, userID, at.Unix()/totpPeriod)
+		if errors.Is(err, db.ErrNotFound) {
+			return status.Error(codes.Unauthenticated, "authentication code was already used")
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return nil
+	}
+	return status.Error(codes.Unauthenticated, "invalid authentication code")
+}
+
+// renderQR draws the text as a QR code with half block characters, two modules per character cell.
+// The code is drawn light on dark, with a quiet zone, which phones read from dark terminals as well.
+func renderQR(text string) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+	const quiet = 2
+	black := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.Black(x, y)
+	}
+	var b strings.Builder
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			top, bottom := !black(x, y), !black(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"GophKeeper/internal/blobstore"
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/security"
+	db "GophKeeper/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// AccountService deletes accounts together with everything they own. A deletion is recorded before
+// anything is removed, so one interrupted part-way is resumed by StartPurgeJob.
+type AccountService struct {
+	storage *db.Storage
+	store   blobstore.BlobStore
+	auth    *security.AuthService
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewAccountService(storage *db.Storage, store blobstore.BlobStore, auth *security.AuthService,
+	logger *zap.Logger) *AccountService {
+	return &AccountService{
+		storage: storage,
+		store:   store,
+		auth:    auth,
+		logger:  logger,
+		running: make(map[string]bool),
+	}
+}
+
+// DeletionPhrase is what the user has to type to confirm the deletion of the account.
+func DeletionPhrase(username string) string {
+	return "delete " + username
+}
+
+// DeleteAccount checks the password and the confirmation phrase, logs the user out everywhere and purges
+// the account: every version of the user's files, then all of the user's rows and the user.
+func (s *AccountService) DeleteAccount(ctx context.Context, userID string, password string,
+	confirmation string) (models.AccountDeletion, error) {
+	user, err := s.auth.CheckPassword(ctx, userID, password)
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	if phrase := DeletionPhrase(user.Username); confirmation != phrase {
+		return models.AccountDeletion{}, status.Error(codes.InvalidArgument,
+			fmt.Sprintf("type %q to confirm the deletion", phrase))
+	}
+	if _, err := s.storage.AccountDeletionRepository.StartDeletion(ctx, userID); err != nil {
+		return models.AccountDeletion{}, status.Error(codes.Internal, err.Error())
+	}
+	s.logger.Info("account deletion started", zap.String("userID", userID))
+	// logins are rejected from now on, and the tokens already issued with the sessions
+	if _, err := s.storage.SessionRepository.RevokeOthers(ctx, userID, ""); err != nil {
+		return models.AccountDeletion{}, status.Error(codes.Internal, err.Error())
+	}
+	// a client hanging up must not leave the purge half done until the job picks it up
+	deletion, err := s.purge(context.WithoutCancel(ctx), userID)
+	if err != nil {
+		s.logger.Error("account deletion interrupted", zap.String("userID", userID), zap.Error(err))
+		return models.AccountDeletion{}, status.Error(codes.Internal,
+			"account deletion was interrupted and is resumed in the background: "+err.Error())
+	}
+	return deletion, nil
+}
+
+// StartPurgeJob resumes the interrupted deletions at the start and then every interval until ctx is done.
+func (s *AccountService) StartPurgeJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		s.logger.Info("account purge job is disabled")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.resumePending(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *AccountService) resumePending(ctx context.Context) {
+	deletions, err := s.storage.AccountDeletionRepository.FindPending(ctx, purgeBatchSize)
+	if err != nil {
+		s.logger.Error("failed to find pending account deletions", zap.Error(err))
+		return
+	}
+	for _, deletion := range deletions {
+		if _, err := s.purge(ctx, deletion.UserID); err != nil {
+			s.logger.Error("failed to resume account deletion", zap.String("userID", deletion.UserID), zap.Error(err))
+		}
+	}
+}
+
+// purge removes what is left of the account. Every step can be repeated, so a purge that failed
+// is simply run again.
+func (s *AccountService) purge(ctx context.Context, userID string) (models.AccountDeletion, error) {
+	if !s.start(userID) {
+		return models.AccountDeletion{}, errors.New("the account is being deleted already")
+	}
+	defer s.finish(userID)
+	if err := s.purgeObjects(ctx, userID); err != nil {
+		return models.AccountDeletion{}, err
+	}
+	user, err := s.storage.UserRepository.FindByID(ctx, userID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return models.AccountDeletion{}, err
+	}
+	if err == nil {
+		if err := s.auth.ForgetUser(ctx, user.Username); err != nil {
+			return models.AccountDeletion{}, err
+		}
+	}
+	deletion, err := s.storage.AccountDeletionRepository.PurgeUser(ctx, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		// completed by another server
+		return s.storage.AccountDeletionRepository.FindDeletion(ctx, userID)
+	}
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	s.logger.Info("account deleted", zap.String("userID", userID),
+		zap.Int64("objectVersions", deletion.ObjectVersions),
+		zap.Int64("bytes", deletion.BytesDeleted),
+		zap.Int64("rows", deletion.RowsDeleted),
+	)
+	return deletion, nil
+}
+
+// purgeObjects removes every version and delete marker under the user's prefix, recording the progress
+// every purgeBatchSize versions.
+func (s *AccountService) purgeObjects(ctx context.Context, userID string) error {
+	versions, err := s.store.ListAllVersions(ctx, userID+"/")
+	if err != nil {
+		return err
+	}
+	var count, size int64
+	flush := func() error {
+		if count == 0 {
+			return nil
+		}
+		err := s.storage.AccountDeletionRepository.AddPurgedObjects(ctx, userID, count, size)
+		count, size = 0, 0
+		return err
+	}
+	for _, version := range versions {
+		err := s.store.DeleteVersion(ctx, version.Key, version.VersionID)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return errors.Join(err, flush())
+		}
+		count++
+		size += version.Size
+		if count == purgeBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// start marks the purge of the user as running on this server, unless it is running already.
+func (s *AccountService) start(userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[userID] {
+		return false
+	}
+	s.running[userID] = true
+	return true
+}
+
+func (s *AccountService) finish(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, userID)
+}
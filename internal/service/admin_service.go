@@ -0,0 +1,141 @@
+package service
+
+import (
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/proto/gkeeper/pb"
+	"GophKeeper/internal/security"
+	db "GophKeeper/internal/storage"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// temporaryPasswordSize is the number of random bytes in a password set by an administrator.
+const temporaryPasswordSize = 12
+
+// AdminService lets administrators manage the accounts of all users. The auth interceptors only let
+// users with the admin role call it.
+type AdminService struct {
+	users  *UserManager
+	auth   *security.AuthService
+	logger *zap.Logger
+	pb.UnimplementedAdminServiceServer
+}
+
+func NewAdminService(storage *db.Storage, auth *security.AuthService, logger *zap.Logger) *AdminService {
+	return &AdminService{users: NewUserManager(storage, logger), auth: auth, logger: logger}
+}
+
+// ListUsers lists all users with their role and state.
+func (s *AdminService) ListUsers(ctx context.Context, _ *emptypb.Empty) (*pb.ListUsersResponse, error) {
+	users, err := s.users.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListUsersResponse{Users: make([]*pb.UserInfo, 0, len(users))}
+	for _, user := range users {
+		resp.Users = append(resp.Users, &pb.UserInfo{
+			Id:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			Role:          user.Role,
+			CreatedAt:     user.CreatedAt.Format("2006-01-02 15:04:05"),
+			EmailVerified: user.EmailVerifiedAt != nil,
+			Disabled:      user.DisabledAt != nil,
+		})
+	}
+	return resp, nil
+}
+
+// DisableUser keeps the user from logging in and ends all of the user's sessions.
+func (s *AdminService) DisableUser(ctx context.Context, req *pb.DisableUserRequest) (*pb.DisableUserResponse, error) {
+	adminID, user, err := s.target(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == adminID {
+		return nil, status.Error(codes.FailedPrecondition, "you cannot disable yourself")
+	}
+	revoked, err := s.users.SetDisabled(ctx, user, true, adminID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DisableUserResponse{Message: "User " + user.Username + " disabled", RevokedSessions: revoked}, nil
+}
+
+// EnableUser lets a disabled user log in again.
+func (s *AdminService) EnableUser(ctx context.Context, req *pb.EnableUserRequest) (*pb.EnableUserResponse, error) {
+	adminID, user, err := s.target(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.users.SetDisabled(ctx, user, false, adminID); err != nil {
+		return nil, err
+	}
+	return &pb.EnableUserResponse{Message: "User " + user.Username + " enabled"}, nil
+}
+
+// SetRole changes the role of the user. The user's sessions are ended, since their tokens carry the old role.
+func (s *AdminService) SetRole(ctx context.Context, req *pb.SetRoleRequest) (*pb.SetRoleResponse, error) {
+	role := req.GetRole()
+	if err := checkRole(role); err != nil {
+		return nil, err
+	}
+	adminID, user, err := s.target(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+	// so the last administrator cannot lock everybody out
+	if user.ID == adminID {
+		return nil, status.Error(codes.FailedPrecondition, "you cannot change your own role")
+	}
+	if user.Role == role {
+		return &pb.SetRoleResponse{Message: "User " + user.Username + " is " + role + " already"}, nil
+	}
+	revoked, err := s.users.SetRole(ctx, user, role, adminID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SetRoleResponse{Message: "User " + user.Username + " is " + role + " now", RevokedSessions: revoked}, nil
+}
+
+// ResetUserPassword replaces the password of the user with a random one for the administrator to hand
+// over, and ends all of the user's sessions.
+func (s *AdminService) ResetUserPassword(ctx context.Context, req *pb.ResetUserPasswordRequest) (*pb.ResetUserPasswordResponse, error) {
+	adminID, user, err := s.target(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, temporaryPasswordSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	password := base64.RawURLEncoding.EncodeToString(raw)
+	revoked, err := s.auth.ResetPassword(ctx, user.ID, password)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("password reset by an administrator", zap.String("userID", user.ID), zap.String("adminID", adminID))
+	return &pb.ResetUserPasswordResponse{
+		Message:           "Password of " + user.Username + " reset",
+		TemporaryPassword: password,
+		RevokedSessions:   revoked,
+	}, nil
+}
+
+// target returns the ID of the administrator making the request and the user the request is about.
+func (s *AdminService) target(ctx context.Context, username string) (string, models.UserDTO, error) {
+	adminID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return "", models.UserDTO{}, status.Error(codes.Internal, "userID not found in context")
+	}
+	user, err := s.users.FindUser(ctx, username)
+	if err != nil {
+		return "", models.UserDTO{}, err
+	}
+	return adminID, user, nil
+}
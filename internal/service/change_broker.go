@@ -0,0 +1,87 @@
+package service
+
+import (
+	"GophKeeper/internal/models"
+	"sync"
+)
+
+// subscriptionBuffer is the number of changes a subscriber may lag behind before it is dropped.
+const subscriptionBuffer = 64
+
+// ChangeBroker fans out recorded changes to the watchers of the same user within the process.
+type ChangeBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*subscription]struct{}
+}
+
+type subscription struct {
+	userID  string
+	changes chan models.Change
+}
+
+func NewChangeBroker() *ChangeBroker {
+	return &ChangeBroker{
+		subscribers: make(map[string]map[*subscription]struct{}),
+	}
+}
+
+// Subscribe registers a watcher of the user's changes. The returned channel is closed when the watcher
+// falls too far behind or the broker loses track of changes; the watcher is expected to resume from
+// the last revision it has seen. The returned function unsubscribes.
+func (b *ChangeBroker) Subscribe(userID string) (<-chan models.Change, func()) {
+	sub := &subscription{
+		userID:  userID,
+		changes: make(chan models.Change, subscriptionBuffer),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[*subscription]struct{})
+	}
+	b.subscribers[userID][sub] = struct{}{}
+	return sub.changes, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(sub)
+	}
+}
+
+// Publish delivers the change to every watcher of its owner without blocking.
+func (b *ChangeBroker) Publish(change models.Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers[change.UserID] {
+		select {
+		case sub.changes <- change:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// DropAll closes every subscription, e.g. after notifications from other replicas may have been missed.
+func (b *ChangeBroker) DropAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, subs := range b.subscribers {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+// remove closes the subscription once. The caller holds b.mu.
+func (b *ChangeBroker) remove(sub *subscription) {
+	subs, ok := b.subscribers[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.changes)
+	if len(subs) == 0 {
+		delete(b.subscribers, sub.userID)
+	}
+}
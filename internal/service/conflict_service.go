@@ -0,0 +1,242 @@
+package service
+
+import (
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/security"
+	db "GophKeeper/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+)
+
+// Ways to resolve a conflict.
+const (
+	KeepLocal  = "local"
+	KeepRemote = "remote"
+	KeepMerge  = "merge"
+)
+
+// ConflictService records saves of credentials made against a stale version and resolves them.
+type ConflictService struct {
+	storage       *db.Storage
+	secretService *security.SecureService
+	credService   *UserCredService
+	logger        *zap.Logger
+}
+
+// ConflictView is a conflict with the decrypted credentials of each side. Remote is the latest version,
+// which may be newer than the one the conflict was recorded against.
+type ConflictView struct {
+	Conflict models.Conflict
+	Base     string
+	Remote   string
+	Local    string
+}
+
+func NewConflictService(storage *db.Storage, secretService *security.SecureService, credService *UserCredService,
+	logger *zap.Logger) *ConflictService {
+	return &ConflictService{
+		storage:       storage,
+		secretService: secretService,
+		credService:   credService,
+		logger:        logger,
+	}
+}
+
+// Record keeps the encrypted data the user tried to save against baseVersion for later resolution.
+func (s *ConflictService) Record(ctx context.Context, userID string, credName string, data string, baseVersion int64) (models.Conflict, error) {
+	var remoteVersion int64
+	remote, err := s.storage.CredRepository.GetLastUserCreds(ctx, userID, credName)
+	switch {
+	case err == nil:
+		remoteVersion = remote.Version
+	case !errors.Is(err, db.ErrNotFound):
+		return models.Conflict{}, err
+	}
+	conflict, err := s.storage.ConflictRepository.SaveConflict(ctx, models.Conflict{
+		UserID:        userID,
+		Name:          credName,
+		BaseVersion:   baseVersion,
+		RemoteVersion: remoteVersion,
+		Data:          data,
+		DataType:      int(db.Credentials),
+	})
+	if err != nil {
+		return models.Conflict{}, err
+	}
+	s.logger.Info("credentials conflict recorded", zap.String("userID", userID), zap.String("name", credName),
+		zap.Int64("base", baseVersion), zap.Int64("remote", remoteVersion))
+	return conflict, nil
+}
+
+// List returns the user's open conflicts.
+func (s *ConflictService) List(ctx context.Context, userID string) ([]ConflictView, error) {
+	conflicts, err := s.storage.ConflictRepository.FindOpenByUser(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	views := make([]ConflictView, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		view, err := s.view(ctx, conflict)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// Resolve settles the conflict by keeping the local save, the remote version or a field-level merge of both.
+// When merging, override supplies the value of fields changed on both sides. It returns the saved version,
+// or an empty string when the remote version is kept. The conflict is claimed before anything is saved,
+// so concurrent resolutions cannot both apply, and the save is made against the remote version the
+// resolution was based on: if the credentials changed again meanwhile, the conflict is reopened and
+// Aborted is returned.
+func (s *ConflictService) Resolve(ctx context.Context, userID string, conflictID string, keep string,
+	override models.CredData) (string, error) {
+	conflict, err := s.storage.ConflictRepository.FindByID(ctx, userID, conflictID)
+	if errors.Is(err, db.ErrNotFound) {
+		return "", status.Error(codes.NotFound, "conflict not found")
+	}
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	if conflict.ResolvedAt != nil {
+		return "", status.Error(codes.FailedPrecondition, "conflict is already resolved")
+	}
+	view, err := s.view(ctx, conflict)
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	var data string
+	switch keep {
+	case KeepLocal:
+		data = conflict.Data
+	case KeepRemote:
+	case KeepMerge:
+		data, err = s.merge(view, override)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", status.Error(codes.InvalidArgument, "keep must be local, remote or merge")
+	}
+	if err := s.storage.ConflictRepository.Resolve(ctx, conflict.ID, keep); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return "", status.Error(codes.FailedPrecondition, "conflict is already resolved")
+		}
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	if data == "" {
+		return "", nil
+	}
+	version, err := s.credService.SaveCredsAt(ctx, userID, conflict.Name, data, db.Credentials, view.Conflict.RemoteVersion)
+	if err != nil {
+		if reopenErr := s.storage.ConflictRepository.Reopen(ctx, conflict.ID); reopenErr != nil {
+			s.logger.Error("failed to reopen conflict", zap.String("conflictID", conflict.ID), zap.Error(reopenErr))
+		}
+		if errors.Is(err, db.ErrConflict) {
+			return "", status.Error(codes.Aborted, "credentials were changed again, review the conflict and retry")
+		}
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	return strconv.FormatInt(version, 10), nil
+}
+
+// merge combines the changes of both sides field by field and returns the encrypted result.
+func (s *ConflictService) merge(view ConflictView, override models.CredData) (string, error) {
+	var err error
+	if view.Remote == "" {
+		return "", status.Error(codes.FailedPrecondition, "remote credentials were deleted, keep local or remote")
+	}
+	var base, remote, local models.CredData
+	if view.Base != "" {
+		if err := json.Unmarshal([]byte(view.Base), &base); err != nil {
+			return "", status.Error(codes.Internal, err.Error())
+		}
+	}
+	if err := json.Unmarshal([]byte(view.Remote), &remote); err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	if err := json.Unmarshal([]byte(view.Local), &local); err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	var merged models.CredData
+	if merged.Username, err = mergeField("username", base.Username, remote.Username, local.Username, override.Username); err != nil {
+		return "", err
+	}
+	if merged.Password, err = mergeField("password", base.Password, remote.Password, local.Password, override.Password); err != nil {
+		return "", err
+	}
+	jsonData, err := json.Marshal(merged)
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	data, err := s.secretService.EncryptData(jsonData)
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	return data, nil
+}
+
+// mergeField takes the side that changed the field. A field changed differently on both sides needs an override.
+func mergeField(field string, base string, remote string, local string, override string) (string, error) {
+	switch {
+	case override != "":
+		return override, nil
+	case local == remote || local == base:
+		return remote, nil
+	case remote == base:
+		return local, nil
+	default:
+		return "", status.Errorf(codes.FailedPrecondition, "%s was changed on both sides, pass the value to keep", field)
+	}
+}
+
+// view decrypts the base, remote and local credentials of the conflict.
+func (s *ConflictService) view(ctx context.Context, conflict models.Conflict) (ConflictView, error) {
+	view := ConflictView{Conflict: conflict}
+	local, err := s.secretService.DecryptData(conflict.Data)
+	if err != nil {
+		return ConflictView{}, err
+	}
+	view.Local = string(local)
+	if view.Base, err = s.versionData(ctx, conflict.UserID, conflict.Name, conflict.BaseVersion); err != nil {
+		return ConflictView{}, err
+	}
+	remote, err := s.storage.CredRepository.GetLastUserCreds(ctx, conflict.UserID, conflict.Name)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		view.Conflict.RemoteVersion = 0
+	case err != nil:
+		return ConflictView{}, err
+	default:
+		decrypted, err := s.secretService.DecryptData(remote.Data)
+		if err != nil {
+			return ConflictView{}, err
+		}
+		view.Remote = string(decrypted)
+		view.Conflict.RemoteVersion = remote.Version
+	}
+	return view, nil
+}
+
+// versionData returns the decrypted credentials of the version, or an empty string when it no longer exists.
+func (s *ConflictService) versionData(ctx context.Context, userID string, credName string, version int64) (string, error) {
+	cred, err := s.storage.CredRepository.GetUserCredsVersion(ctx, userID, credName, version)
+	if errors.Is(err, db.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := s.secretService.DecryptData(cred.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(decrypted), nil
+}
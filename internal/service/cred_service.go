@@ -4,25 +4,43 @@ import (
 	"GophKeeper/internal/models"
 	db "GophKeeper/internal/storage"
 	"context"
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 type UserCredService struct {
-	storage *db.Storage
-	logger  *zap.Logger
+	storage     *db.Storage
+	syncService *SyncService
+	logger      *zap.Logger
 }
 
-func NewUserCredService(storage *db.Storage, logger *zap.Logger) *UserCredService {
-	return &UserCredService{storage: storage, logger: logger}
+func NewUserCredService(storage *db.Storage, syncService *SyncService, logger *zap.Logger) *UserCredService {
+	return &UserCredService{storage: storage, syncService: syncService, logger: logger}
 }
 
 func (s *UserCredService) GetCreds(ctx context.Context, userID string, credName string) (models.UserCredentials, error) {
 	return s.storage.CredRepository.GetLastUserCreds(ctx, userID, credName)
 }
 
-func (s *UserCredService) SaveCreds(ctx context.Context, userID string, credName string, data string, dataType db.DataType) (uuid.UUID, error) {
-	return s.storage.CredRepository.SaveUserCreds(ctx, credName, userID, data, dataType)
+// SaveCreds saves a new version of the credentials and returns it.
+func (s *UserCredService) SaveCreds(ctx context.Context, userID string, credName string, data string, dataType db.DataType) (int64, error) {
+	version, change, err := s.storage.CredRepository.SaveUserCreds(ctx, credName, userID, data, dataType)
+	if err != nil {
+		return 0, err
+	}
+	s.syncService.Publish(change)
+	return version, nil
+}
+
+// SaveCredsAt saves a new version of the credentials edited from baseVersion and returns it. It returns
+// db.ErrConflict when another version was saved in the meantime.
+func (s *UserCredService) SaveCredsAt(ctx context.Context, userID string, credName string, data string, dataType db.DataType,
+	baseVersion int64) (int64, error) {
+	version, change, err := s.storage.CredRepository.SaveUserCredsAt(ctx, credName, userID, data, dataType, baseVersion)
+	if err != nil {
+		return 0, err
+	}
+	s.syncService.Publish(change)
+	return version, nil
 }
 
 func (s *UserCredService) GetAllCreds(ctx context.Context, userID string) ([]models.UserCredentials, error) {
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/notify"
+	"GophKeeper/internal/security"
+	db "GophKeeper/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// Default lifetimes of the tokens sent by email, used when they are not configured.
+const (
+	DefaultEmailVerificationTTL = 48 * time.Hour
+	DefaultPasswordResetTTL     = time.Hour
+)
+
+// emailResendInterval is how long a user waits before another token for the same purpose is sent,
+// so the endpoints cannot be used to flood a mailbox.
+const emailResendInterval = time.Minute
+
+// passwordResetRequested is the answer to every reset request, so it does not tell which addresses
+// belong to an account.
+const passwordResetRequested = "If the address belongs to an account, a reset code was sent to it"
+
+var errInvalidEmailToken = status.Error(codes.InvalidArgument, "the code is invalid or expired")
+
+// EmailService proves that users own their email addresses and lets them reset a forgotten password
+// with a code sent to a verified address. Accounts whose address is not verified are limited.
+type EmailService struct {
+	storage         *db.Storage
+	notifier        notify.Notifier
+	auth            *security.AuthService
+	logger          *zap.Logger
+	verificationTTL time.Duration
+	resetTTL        time.Duration
+}
+
+func NewEmailService(storage *db.Storage, notifier notify.Notifier, auth *security.AuthService, logger *zap.Logger,
+	verificationTTL time.Duration, resetTTL time.Duration) *EmailService {
+	if verificationTTL <= 0 {
+		verificationTTL = DefaultEmailVerificationTTL
+	}
+	if resetTTL <= 0 {
+		resetTTL = DefaultPasswordResetTTL
+	}
+	return &EmailService{
+		storage:         storage,
+		notifier:        notifier,
+		auth:            auth,
+		logger:          logger,
+		verificationTTL: verificationTTL,
+		resetTTL:        resetTTL,
+	}
+}
+
+// SendVerification sends a new verification code to the address of the user. It replaces the code sent before.
+// Failures are logged.
+func (s *EmailService) SendVerification(ctx context.Context, user models.UserDTO) error {
+	token, err := s.newToken(ctx, user.ID, models.TokenVerifyEmail, s.verificationTTL)
+	if err != nil {
+		s.logger.Error("failed to create verification code", zap.String("userID", user.ID), zap.Error(err))
+		return err
+	}
+	err = s.notifier.Send(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Verify your GophKeeper email address",
+		Body: fmt.Sprintf("Hello %s,\n\nconfirm that this address belongs to you with the code\n\n    %s\n\n"+
+			"for example by running: keeperctl verify-email <code>\nThe code is valid for %s.\n",
+			user.Username, token, s.verificationTTL),
+	})
+	if err != nil {
+		s.logger.Error("failed to send verification email", zap.String("userID", user.ID), zap.Error(err))
+		return status.Error(codes.Unavailable, "could not send the email, try again later")
+	}
+	return nil
+}
+
+// ResendVerification sends a new verification code to a user whose address is not verified yet.
+func (s *EmailService) ResendVerification(ctx context.Context, userID string) error {
+	user, err := s.storage.UserRepository.FindByID(ctx, userID)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if user.EmailVerifiedAt != nil {
+		return status.Error(codes.FailedPrecondition, "email address is verified already")
+	}
+	if err := s.throttle(ctx, userID, models.TokenVerifyEmail); err != nil {
+		return err
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// VerifyEmail marks the address of the user the code was sent to as verified.
+func (s *EmailService) VerifyEmail(ctx context.Context, code string) error {
+	token, err := s.useToken(ctx, code, models.TokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.UserRepository.MarkEmailVerified(ctx, token.UserID); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	s.recordEvent(ctx, token.UserID, models.EventEmailVerified)
+	return nil
+}
+
+// RequestPasswordReset sends a reset code to the address if it is the verified address of an account.
+// The outcome is the same whether or not it is, so the request cannot be used to look up accounts.
+func (s *EmailService) RequestPasswordReset(ctx context.Context, email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", status.Error(codes.InvalidArgument, "please provide the email address")
+	}
+	user, err := s.storage.UserRepository.FindByEmail(ctx, email)
+	if errors.Is(err, db.ErrNotFound) {
+		return passwordResetRequested, nil
+	}
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	if user.EmailVerifiedAt == nil {
+		s.logger.Info("password reset for an unverified address ignored", zap.String("userID", user.ID))
+		return passwordResetRequested, nil
+	}
+	if err := s.throttle(ctx, user.ID, models.TokenResetPassword); err != nil {
+		return passwordResetRequested, nil
+	}
+	token, err := s.newToken(ctx, user.ID, models.TokenResetPassword, s.resetTTL)
+	if err != nil {
+		// an error here would tell that the address belongs to an account, as a send failure would
+		s.logger.Error("failed to create password reset code", zap.String("userID", user.ID), zap.Error(err))
+		return passwordResetRequested, nil
+	}
+	err = s.notifier.Send(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Reset your GophKeeper password",
+		Body: fmt.Sprintf("Hello %s,\n\na new password was requested for your account. Set it with the code\n\n"+
+			"    %s\n\nfor example by running: keeperctl reset-password --token <code>\n"+
+			"The code is valid for %s. If you did not ask for it, ignore this message.\n",
+			user.Username, token, s.resetTTL),
+	})
+	if err != nil {
+		// reporting the failure would tell that the address belongs to an account
+		s.logger.Error("failed to send password reset email", zap.String("userID", user.ID), zap.Error(err))
+	}
+	return passwordResetRequested, nil
+}
+
+// ResetPassword sets the new password of the user the reset code was sent to and ends all of the user's
+// sessions. It returns the number of sessions ended.
+func (s *EmailService) ResetPassword(ctx context.Context, code string, newPass string) (int64, error) {
+	// a password that cannot be set must not use up the code
+	if err := security.ValidatePassword(newPass); err != nil {
+		return 0, err
+	}
+	token, err := s.useToken(ctx, code, models.TokenResetPassword)
+	if err != nil {
+		return 0, err
+	}
+	return s.auth.ResetPassword(ctx, token.UserID, newPass)
+}
+
+// newToken stores the hash of a new token for the purpose and returns the token.
+func (s *EmailService) newToken(ctx context.Context, userID string, purpose string,
+	ttl time.Duration) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	err = s.storage.EmailTokenRepository.SaveToken(ctx, models.EmailToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	return token, nil
+}
+
+// useToken consumes the token, so every code works once.
+func (s *EmailService) useToken(ctx context.Context, code string, purpose string) (models.EmailToken, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return models.EmailToken{}, errInvalidEmailToken
+	}
+	token, err := s.storage.EmailTokenRepository.UseToken(ctx, hashToken(code), purpose, time.Now())
+	if errors.Is(err, db.ErrNotFound) {
+		return models.EmailToken{}, errInvalidEmailToken
+	}
+	if err != nil {
+		return models.EmailToken{}, status.Error(codes.Internal, err.Error())
+	}
+	return token, nil
+}
+
+// throttle returns ResourceExhausted if a token for the purpose was sent to the user moments ago.
+func (s *EmailService) throttle(ctx context.Context, userID string, purpose string) error {
+	last, err := s.storage.EmailTokenRepository.FindToken(ctx, userID, purpose)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if wait := emailResendInterval - time.Since(last.CreatedAt); wait > 0 {
+		return status.Error(codes.ResourceExhausted,
+			fmt.Sprintf("an email was sent moments ago, try again in %s", wait.Round(time.Second)))
+	}
+	return nil
+}
+
+func (s *EmailService) recordEvent(ctx context.Context, userID string, kind string) {
+	err := s.storage.SecurityEventRepository.RecordEvent(ctx, models.SecurityEvent{UserID: userID, Kind: kind})
+	if err != nil {
+		s.logger.Error("failed to record a security event", zap.Error(err))
+	}
+}
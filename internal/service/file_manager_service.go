@@ -7,32 +7,52 @@ import (
 	db "GophKeeper/internal/storage"
 	"context"
 	"encoding/json"
+	"errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"strconv"
+	"time"
 )
 
 type FileManagerService struct {
-	s3Service     *S3Service
+	fileService   *FileService
 	userService   *UserServiceServer
 	authService   *security.AuthService
 	credService   *UserCredService
 	secretService *security.SecureService
+	shareService  *ShareLinkService
+	trashService  *TrashService
+	syncService   *SyncService
+	conflicts     *ConflictService
+	accounts      *AccountService
+	emails        *EmailService
 	pb.UnimplementedFileManagerServiceServer
 }
 
-func NewFileManagerService(s3Service *S3Service, userService *UserServiceServer, authService *security.AuthService,
+func NewFileManagerService(fileService *FileService, userService *UserServiceServer, authService *security.AuthService,
 	credService *UserCredService,
-	secretService *security.SecureService) *FileManagerService {
+	secretService *security.SecureService,
+	shareService *ShareLinkService,
+	trashService *TrashService,
+	syncService *SyncService,
+	conflicts *ConflictService,
+	accounts *AccountService,
+	emails *EmailService) *FileManagerService {
 	return &FileManagerService{
-		s3Service:     s3Service,
+		fileService:   fileService,
 		userService:   userService,
 		authService:   authService,
 		credService:   credService,
 		secretService: secretService,
+		shareService:  shareService,
+		trashService:  trashService,
+		syncService:   syncService,
+		conflicts:     conflicts,
+		accounts:      accounts,
+		emails:        emails,
 	}
 }
 
@@ -44,6 +64,8 @@ func (s *FileManagerService) CreateUser(ctx context.Context, req *pb.CreateUserR
 	if err != nil {
 		return nil, err
 	}
+	// the account exists either way, the user can ask for another code
+	_ = s.emails.SendVerification(ctx, *usr)
 	return &pb.CreateUserResponse{
 		Id:       usr.ID,
 		Username: usr.Username,
@@ -51,12 +73,186 @@ func (s *FileManagerService) CreateUser(ctx context.Context, req *pb.CreateUserR
 
 }
 
+// Logout revokes the access token the request was made with.
+func (s *FileManagerService) Logout(ctx context.Context, _ *emptypb.Empty) (*pb.LogoutResponse, error) {
+	if err := s.authService.Logout(ctx); err != nil {
+		return nil, err
+	}
+	return &pb.LogoutResponse{Message: "Logged out"}, nil
+}
+
+// RefreshToken issues a new access token for the session of the refresh token and rotates the refresh token.
+func (s *FileManagerService) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh token is empty")
+	}
+	tokens, err := s.authService.Refresh(ctx, req.GetRefreshToken())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RefreshTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+// EnableTOTP generates a TOTP secret for the user. It takes effect once confirmed with ConfirmTOTP.
+func (s *FileManagerService) EnableTOTP(ctx context.Context, _ *emptypb.Empty) (*pb.EnableTOTPResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	enrollment, err := s.authService.EnableTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.EnableTOTPResponse{
+		Secret: enrollment.Secret,
+		Uri:    enrollment.URI,
+		QrCode: enrollment.QRCode,
+	}, nil
+}
+
+// ConfirmTOTP turns two-factor authentication on and returns the recovery codes.
+func (s *FileManagerService) ConfirmTOTP(ctx context.Context, req *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is empty")
+	}
+	recoveryCodes, err := s.authService.ConfirmTOTP(ctx, userID, req.GetCode())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConfirmTOTPResponse{
+		Message:       "Two-factor authentication enabled",
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// ListSessions returns the devices the user is logged in on.
+func (s *FileManagerService) ListSessions(ctx context.Context, _ *emptypb.Empty) (*pb.ListSessionsResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	current, _ := ctx.Value(security.SessionIDKey).(string)
+	sessions, err := s.authService.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &pb.ListSessionsResponse{}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &pb.Session{
+			Id:            session.ID,
+			Device:        session.Device,
+			ClientVersion: session.ClientVersion,
+			Ip:            session.IP,
+			CreatedAt:     session.CreatedAt.Format("2006-01-02 15:04:05"),
+			LastSeenAt:    session.LastSeenAt.Format("2006-01-02 15:04:05"),
+			Current:       session.ID == current,
+		})
+	}
+	return resp, nil
+}
+
+// RevokeSession logs the user out on another device.
+func (s *FileManagerService) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "session ID is empty")
+	}
+	if err := s.authService.RevokeSession(ctx, userID, req.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.RevokeSessionResponse{Message: "Session revoked"}, nil
+}
+
+// ChangePassword changes the password of the user and logs them out on the other devices.
+func (s *FileManagerService) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	sessionID, _ := ctx.Value(security.SessionIDKey).(string)
+	revoked, err := s.authService.ChangePassword(ctx, userID, sessionID, req.GetOldPassword(), req.GetNewPassword())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ChangePasswordResponse{Message: "Password changed", RevokedSessions: revoked}, nil
+}
+
+// DeleteAccount deletes the account of the user with all files and credentials and reports what was removed.
+func (s *FileManagerService) DeleteAccount(ctx context.Context, req *pb.DeleteAccountRequest) (*pb.DeleteAccountResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	deletion, err := s.accounts.DeleteAccount(ctx, userID, req.GetPassword(), req.GetConfirmation())
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.DeleteAccountResponse{
+		Message:        "Account deleted",
+		ObjectVersions: deletion.ObjectVersions,
+		BytesDeleted:   deletion.BytesDeleted,
+		RowsDeleted:    deletion.RowsDeleted,
+	}
+	if deletion.CompletedAt != nil {
+		resp.CompletedAt = deletion.CompletedAt.Format("2006-01-02 15:04:05")
+	}
+	return resp, nil
+}
+
+// VerifyEmail marks the email address the code was sent to as verified.
+func (s *FileManagerService) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	if err := s.emails.VerifyEmail(ctx, req.GetToken()); err != nil {
+		return nil, err
+	}
+	return &pb.VerifyEmailResponse{Message: "Email address verified"}, nil
+}
+
+// ResendVerification sends another verification code to the email address of the user.
+func (s *FileManagerService) ResendVerification(ctx context.Context, _ *emptypb.Empty) (*pb.ResendVerificationResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	if err := s.emails.ResendVerification(ctx, userID); err != nil {
+		return nil, err
+	}
+	return &pb.ResendVerificationResponse{Message: "Verification code sent"}, nil
+}
+
+// RequestPasswordReset sends a password reset code to a verified email address.
+func (s *FileManagerService) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	message, err := s.emails.RequestPasswordReset(ctx, req.GetEmail())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RequestPasswordResetResponse{Message: message}, nil
+}
+
+// ResetPassword sets a new password with a reset code and logs the user out everywhere.
+func (s *FileManagerService) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	revoked, err := s.emails.ResetPassword(ctx, req.GetToken(), req.GetNewPassword())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ResetPasswordResponse{Message: "Password changed", RevokedSessions: revoked}, nil
+}
+
 func (s *FileManagerService) ListUserFiles(ctx context.Context, _ *emptypb.Empty) (*pb.ListUserFileResponse, error) {
 	userID, ok := ctx.Value(security.UserIDKey).(string)
 	if !ok {
 		return nil, status.Error(codes.Internal, "userID not found in context")
 	}
-	return s.s3Service.ListFiles(userID)
+	return s.fileService.ListFiles(ctx, userID)
 
 }
 
@@ -66,7 +262,7 @@ func (s *FileManagerService) DownloadFile(req *pb.DownloadRequest, stream pb.Fil
 	if !ok {
 		return status.Error(codes.Internal, "userID not found in context")
 	}
-	return s.s3Service.DownloadFile(ctx, userID, req, stream)
+	return s.fileService.DownloadFile(ctx, userID, req, stream)
 }
 func (s *FileManagerService) UploadFile(stream pb.FileManagerService_UploadFileServer) error {
 	ctx := stream.Context()
@@ -74,23 +270,28 @@ func (s *FileManagerService) UploadFile(stream pb.FileManagerService_UploadFileS
 	if !ok {
 		return status.Error(codes.Internal, "userID not found in context")
 	}
-	return s.s3Service.UploadFile(stream, userID)
+	return s.fileService.UploadFile(stream, userID)
 }
 
 func (s *FileManagerService) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
 	userName := req.GetUsername()
 	pass := req.GetPassword()
-	token, err := s.authService.Login(ctx, userName, pass)
+	tokens, err := s.authService.Login(ctx, userName, pass, req.GetOtp(), security.ClientInfo{
+		Device:  req.GetDevice(),
+		Version: req.GetClientVersion(),
+	})
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
 	}
-	header := metadata.Pairs("authorization", token)
+	header := metadata.Pairs("authorization", tokens.AccessToken)
 	err = grpc.SendHeader(ctx, header)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "Error sending header")
 	}
 	return &pb.LoginResponse{
-		Message: "Login successful",
+		Message:      "Login successful",
+		RefreshToken: tokens.RefreshToken,
+		Username:     tokens.Username,
 	}, nil
 }
 
@@ -118,12 +319,30 @@ func (s *FileManagerService) SaveCredentials(ctx context.Context, req *pb.SaveCr
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
-	_, err = s.credService.SaveCreds(ctx, userID, username, encryptData, db.Credentials)
+	// clients that predate conflict detection do not send a base version and overwrite unconditionally
+	var version int64
+	if req.BaseVersion != nil {
+		base := req.GetBaseVersion()
+		version, err = s.credService.SaveCredsAt(ctx, userID, name, encryptData, db.Credentials, base)
+		if errors.Is(err, db.ErrConflict) {
+			conflict, err := s.conflicts.Record(ctx, userID, name, encryptData, base)
+			if err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			return &pb.SaveCredentialsResponse{
+				Message:    "Credentials were changed on another device, the save is recorded as a conflict",
+				ConflictId: conflict.ID,
+			}, nil
+		}
+	} else {
+		version, err = s.credService.SaveCreds(ctx, userID, name, encryptData, db.Credentials)
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	return &pb.SaveCredentialsResponse{
 		Message: "Credentials saved",
+		Version: strconv.FormatInt(version, 10),
 	}, nil
 
 }
@@ -154,3 +373,204 @@ func (s *FileManagerService) GetAllCreds(ctx context.Context, _ *emptypb.Empty)
 		Creds: userCreds,
 	}, nil
 }
+
+func (s *FileManagerService) CreateShareLink(ctx context.Context, req *pb.CreateShareLinkRequest) (*pb.CreateShareLinkResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	link, token, err := s.shareService.CreateLink(ctx, userID, req.GetFilename(), ttl, req.GetMaxDownloads())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateShareLinkResponse{
+		Id:        link.ID,
+		Token:     token,
+		Url:       s.shareService.URL(token),
+		ExpiresAt: link.ExpiresAt.Format("2006-01-02 15:04:05"),
+	}, nil
+}
+
+func (s *FileManagerService) ListShareLinks(ctx context.Context, _ *emptypb.Empty) (*pb.ListShareLinksResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	links, err := s.shareService.ListLinks(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var result []*pb.ShareLink
+	for _, link := range links {
+		result = append(result, &pb.ShareLink{
+			Id:           link.ID,
+			Filename:     link.FileName,
+			VersionID:    link.VersionID,
+			ExpiresAt:    link.ExpiresAt.Format("2006-01-02 15:04:05"),
+			MaxDownloads: link.MaxDownloads,
+			Downloads:    link.Downloads,
+			Revoked:      link.RevokedAt != nil,
+			CreateDate:   link.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return &pb.ListShareLinksResponse{
+		Links: result,
+	}, nil
+}
+
+func (s *FileManagerService) RevokeShareLink(ctx context.Context, req *pb.RevokeShareLinkRequest) (*pb.RevokeShareLinkResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	if err := s.shareService.RevokeLink(ctx, userID, req.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.RevokeShareLinkResponse{
+		Message: "Link revoked",
+	}, nil
+}
+
+func (s *FileManagerService) DeleteFile(ctx context.Context, req *pb.DeleteFileRequest) (*pb.DeleteResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	item, err := s.trashService.DeleteFile(ctx, userID, req.GetFilename())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteResponse{
+		Message: "File moved to trash",
+		TrashId: item.ID,
+	}, nil
+}
+
+func (s *FileManagerService) DeleteCredentials(ctx context.Context, req *pb.DeleteCredentialsRequest) (*pb.DeleteResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	item, err := s.trashService.DeleteCreds(ctx, userID, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteResponse{
+		Message: "Credentials moved to trash",
+		TrashId: item.ID,
+	}, nil
+}
+
+func (s *FileManagerService) ListTrash(ctx context.Context, _ *emptypb.Empty) (*pb.ListTrashResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	items, err := s.trashService.ListTrash(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var result []*pb.TrashItem
+	for _, item := range items {
+		result = append(result, &pb.TrashItem{
+			Id:         item.ID,
+			Kind:       item.Kind,
+			Name:       item.Name,
+			DeletedAt:  item.DeletedAt.Format("2006-01-02 15:04:05"),
+			PurgeAfter: item.PurgeAfter.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return &pb.ListTrashResponse{
+		Items: result,
+	}, nil
+}
+
+func (s *FileManagerService) RestoreFromTrash(ctx context.Context, req *pb.RestoreFromTrashRequest) (*pb.RestoreFromTrashResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	item, err := s.trashService.Restore(ctx, userID, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RestoreFromTrashResponse{
+		Message: item.Name + " restored",
+	}, nil
+}
+
+func (s *FileManagerService) EmptyTrash(ctx context.Context, _ *emptypb.Empty) (*pb.EmptyTrashResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	removed, err := s.trashService.EmptyTrash(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.EmptyTrashResponse{
+		Removed: int32(removed),
+	}, nil
+}
+
+func (s *FileManagerService) GetChanges(ctx context.Context, req *pb.GetChangesRequest) (*pb.GetChangesResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	return s.syncService.GetChanges(ctx, userID, req.GetSinceRevision(), req.GetPageSize())
+}
+
+func (s *FileManagerService) WatchChanges(req *pb.WatchChangesRequest, stream pb.FileManagerService_WatchChangesServer) error {
+	ctx := stream.Context()
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return status.Error(codes.Internal, "userID not found in context")
+	}
+	return s.syncService.Watch(ctx, userID, req.GetSinceRevision(), stream.Send)
+}
+
+func (s *FileManagerService) ListConflicts(ctx context.Context, _ *emptypb.Empty) (*pb.ListConflictsResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	views, err := s.conflicts.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := make([]*pb.Conflict, 0, len(views))
+	for _, view := range views {
+		conflicts = append(conflicts, &pb.Conflict{
+			Id:            view.Conflict.ID,
+			Name:          view.Conflict.Name,
+			BaseVersion:   view.Conflict.BaseVersion,
+			RemoteVersion: view.Conflict.RemoteVersion,
+			BaseData:      view.Base,
+			RemoteData:    view.Remote,
+			LocalData:     view.Local,
+			CreateDate:    view.Conflict.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return &pb.ListConflictsResponse{Conflicts: conflicts}, nil
+}
+
+func (s *FileManagerService) ResolveConflict(ctx context.Context, req *pb.ResolveConflictRequest) (*pb.ResolveConflictResponse, error) {
+	userID, ok := ctx.Value(security.UserIDKey).(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "userID not found in context")
+	}
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "conflict id is empty")
+	}
+	override := models.CredData{Username: req.GetUsername(), Password: req.GetPassword()}
+	version, err := s.conflicts.Resolve(ctx, userID, req.GetId(), req.GetKeep(), override)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ResolveConflictResponse{
+		Message: "Conflict resolved",
+		Version: version,
+	}, nil
+}
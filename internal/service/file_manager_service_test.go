@@ -0,0 +1,1260 @@
+package service
+
+import (
+	"GophKeeper/internal/blobstore"
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/notify"
+	"GophKeeper/internal/proto/gkeeper/pb"
+	"GophKeeper/internal/security"
+	db "GophKeeper/internal/storage"
+	"GophKeeper/internal/storage/memory"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// testEnv is a FileManagerService served over an in-memory gRPC connection,
+// backed by the in-memory repositories and a local blob store in a temporary directory.
+type testEnv struct {
+	client   pb.FileManagerServiceClient
+	admin    pb.AdminServiceClient
+	share    *ShareLinkService
+	accounts *AccountService
+	storage  *db.Storage
+	mailbox  *mailbox
+}
+
+// mailbox is a notify.Notifier keeping the messages it was given. While err is set, sending fails with it.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []notify.Message
+	err      error
+}
+
+func (m *mailbox) Send(_ context.Context, msg notify.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *mailbox) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// code returns the code in the latest message to the address, or "" if there is none.
+func (m *mailbox) code(to string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != to {
+			continue
+		}
+		for _, line := range strings.Split(m.messages[i].Body, "\n") {
+			if strings.HasPrefix(line, "    ") {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+	return ""
+}
+
+func (m *mailbox) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.messages)
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+	logger := zap.NewNop()
+	storage := memory.NewStorage()
+	store := blobstore.NewLocalStore(logger, t.TempDir())
+	if err := store.Init(ctx); err != nil {
+		t.Fatalf("init blob store: %v", err)
+	}
+	kek := make([]byte, 32)
+	secureService := security.NewSecureService(storage, logger,
+		security.KeyProviderFunc(func(context.Context) ([]byte, error) { return kek, nil }))
+	if err := secureService.Init(ctx); err != nil {
+		t.Fatalf("init secure service: %v", err)
+	}
+	jwtKey, err := security.NewJWTKey(security.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("generate JWT key: %v", err)
+	}
+	totpService := security.NewTOTPService(storage, secureService, logger, "GophKeeper")
+	authService := security.NewAuthService(storage, logger, security.NewKeyRing(jwtKey), totpService, security.AuthConfig{
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+		Lockout:         security.LockoutPolicy{MaxFailures: 3, Backoff: time.Nanosecond, Duration: time.Hour},
+	})
+	shareService := NewShareLinkService(storage, store, logger, "http://share.test", time.Hour)
+	syncService := NewSyncService(storage, store, secureService, logger, 50*time.Millisecond)
+	credService := NewUserCredService(storage, syncService, logger)
+	accountService := NewAccountService(storage, store, authService, logger)
+	box := &mailbox{}
+	fileManager := NewFileManagerService(
+		NewFileService(store, syncService, logger),
+		NewUserServiceServer(storage, logger),
+		authService,
+		credService,
+		secureService,
+		shareService,
+		NewTrashService(storage, store, syncService, logger, time.Hour),
+		syncService,
+		NewConflictService(storage, secureService, credService, logger),
+		accountService,
+		NewEmailService(storage, box, authService, logger, time.Hour, time.Hour),
+	)
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.UnaryInterceptor(authService.GetAuthInterceptor()),
+		grpc.StreamInterceptor(authService.GetAuthStreamInterceptor()))
+	pb.RegisterFileManagerServiceServer(server, fileManager)
+	pb.RegisterAdminServiceServer(server, NewAdminService(storage, authService, logger))
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+	return &testEnv{
+		client:   pb.NewFileManagerServiceClient(conn),
+		admin:    pb.NewAdminServiceClient(conn),
+		share:    shareService,
+		accounts: accountService,
+		storage:  storage,
+		mailbox:  box,
+	}
+}
+
+// login registers a user with a verified email address and returns a context authorized as that user.
+func (e *testEnv) login(t *testing.T, username string) context.Context {
+	t.Helper()
+	ctx := e.loginUnverified(t, username)
+	_, err := e.client.VerifyEmail(context.Background(), &pb.VerifyEmailRequest{
+		Token: e.mailbox.code(username + "@example.com"),
+	})
+	if err != nil {
+		t.Fatalf("verify email: %v", err)
+	}
+	return ctx
+}
+
+// loginUnverified registers a user without verifying the email address and returns a context authorized
+// as that user.
+func (e *testEnv) loginUnverified(t *testing.T, username string) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	_, err := e.client.CreateUser(ctx, &pb.CreateUserRequest{
+		Username: username,
+		Password: "secret",
+		Email:    username + "@example.com",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return e.session(t, username)
+}
+
+// session logs in as an existing user and returns a context authorized for the new session.
+func (e *testEnv) session(t *testing.T, username string) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	var header metadata.MD
+	_, err := e.client.Login(ctx, &pb.LoginRequest{Username: username, Password: "secret"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	token := header.Get("authorization")
+	if len(token) == 0 {
+		t.Fatal("login did not return a token")
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", token[0])
+}
+
+func (e *testEnv) upload(t *testing.T, ctx context.Context, name string, content []byte) *pb.UploadStatus {
+	t.Helper()
+	stream, err := e.client.UploadFile(ctx)
+	if err != nil {
+		t.Fatalf("open upload stream: %v", err)
+	}
+	for i := 0; i < len(content) || i == 0; i += 1024 {
+		end := min(i+1024, len(content))
+		if err := stream.Send(&pb.FileChunk{Filename: name, Chunk: content[i:end]}); err != nil {
+			t.Fatalf("send chunk: %v", err)
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	return res
+}
+
+func (e *testEnv) download(t *testing.T, ctx context.Context, req *pb.DownloadRequest) ([]byte, error) {
+	t.Helper()
+	stream, err := e.client.DownloadFile(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(res.GetChunk())
+	}
+}
+
+func (e *testEnv) fileNames(t *testing.T, ctx context.Context) []string {
+	t.Helper()
+	files, err := e.client.ListUserFiles(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	var names []string
+	for _, object := range files.GetObjects() {
+		names = append(names, object.GetFileName())
+	}
+	return names
+}
+
+func TestFileManagerService_RequiresToken(t *testing.T) {
+	env := newTestEnv(t)
+	_, err := env.client.ListUserFiles(context.Background(), &emptypb.Empty{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", err)
+	}
+}
+
+func TestFileManagerService_Logout(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	if _, err := env.client.ListUserFiles(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	if _, err := env.client.Logout(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if _, err := env.client.ListUserFiles(ctx, &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated after logout, got %v", err)
+	}
+	stream, err := env.client.WatchChanges(ctx, &pb.WatchChangesRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated for streams after logout, got %v", err)
+	}
+}
+
+func TestFileManagerService_RefreshToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.login(t, "alice")
+	ctx := context.Background()
+	login, err := env.client.Login(ctx, &pb.LoginRequest{Username: "alice", Password: "secret"})
+	if err != nil || login.GetRefreshToken() == "" {
+		t.Fatalf("login: %v, %v", login, err)
+	}
+	refreshed, err := env.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	if err != nil || refreshed.GetAccessToken() == "" || refreshed.GetRefreshToken() == login.GetRefreshToken() {
+		t.Fatalf("refresh: %v, %v", refreshed, err)
+	}
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", refreshed.GetAccessToken())
+	if _, err := env.client.ListUserFiles(authCtx, &emptypb.Empty{}); err != nil {
+		t.Fatalf("list files with the refreshed token: %v", err)
+	}
+
+	// the rotated token must not be accepted again, and its reuse ends the session
+	_, err = env.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated for a reused token, got %v", err)
+	}
+	_, err = env.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: refreshed.GetRefreshToken()})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the session to be revoked, got %v", err)
+	}
+
+	login, err = env.client.Login(ctx, &pb.LoginRequest{Username: "alice", Password: "secret"}, grpc.Header(new(metadata.MD)))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	refreshed, err = env.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	authCtx = metadata.AppendToOutgoingContext(ctx, "authorization", refreshed.GetAccessToken())
+	if _, err := env.client.Logout(authCtx, &emptypb.Empty{}); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	_, err = env.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: refreshed.GetRefreshToken()})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated after logout, got %v", err)
+	}
+}
+
+func TestFileManagerService_Sessions(t *testing.T) {
+	env := newTestEnv(t)
+	laptop := env.login(t, "alice")
+	var header metadata.MD
+	_, err := env.client.Login(context.Background(), &pb.LoginRequest{
+		Username: "alice", Password: "secret", Device: "phone", ClientVersion: "1.2.3",
+	}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	phone := metadata.AppendToOutgoingContext(context.Background(), "authorization", header.Get("authorization")[0])
+
+	list, err := env.client.ListSessions(laptop, &emptypb.Empty{})
+	if err != nil || len(list.GetSessions()) != 2 {
+		t.Fatalf("list sessions: %v, %v", list, err)
+	}
+	var phoneID string
+	for _, session := range list.GetSessions() {
+		if session.GetDevice() == "phone" {
+			phoneID = session.GetId()
+			if session.GetCurrent() || session.GetClientVersion() != "1.2.3" || session.GetIp() == "" {
+				t.Fatalf("unexpected phone session: %v", session)
+			}
+		} else if !session.GetCurrent() {
+			t.Fatalf("the session of the request is not marked current: %v", session)
+		}
+	}
+
+	bob := env.login(t, "bob")
+	if _, err := env.client.RevokeSession(bob, &pb.RevokeSessionRequest{Id: phoneID}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for a session of another user, got %v", err)
+	}
+	if _, err := env.client.RevokeSession(laptop, &pb.RevokeSessionRequest{Id: phoneID}); err != nil {
+		t.Fatalf("revoke session: %v", err)
+	}
+	// the access token of the revoked session is rejected right away, not only once it expires
+	if _, err := env.client.ListUserFiles(phone, &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated for a revoked session, got %v", err)
+	}
+	if _, err := env.client.ListUserFiles(laptop, &emptypb.Empty{}); err != nil {
+		t.Fatalf("the other session was revoked too: %v", err)
+	}
+}
+
+func TestFileManagerService_TOTP(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	enrollment, err := env.client.EnableTOTP(ctx, &emptypb.Empty{})
+	if err != nil || !strings.HasPrefix(enrollment.GetUri(), "otpauth://totp/") || enrollment.GetQrCode() == "" {
+		t.Fatalf("enable TOTP: %v, %v", enrollment, err)
+	}
+	if _, err := env.client.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: "000000"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated for a wrong code, got %v", err)
+	}
+	code, err := totp.GenerateCode(enrollment.GetSecret(), time.Now())
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	confirmed, err := env.client.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: code})
+	if err != nil || len(confirmed.GetRecoveryCodes()) == 0 {
+		t.Fatalf("confirm TOTP: %v, %v", confirmed, err)
+	}
+
+	login := func(otp string) error {
+		_, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret", Otp: otp})
+		return err
+	}
+	if err := login(""); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition without a code, got %v", err)
+	}
+	if err := login(code); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected a used code to be rejected, got %v", err)
+	}
+	next, _ := totp.GenerateCode(enrollment.GetSecret(), time.Now().Add(30*time.Second))
+	if err := login(next); err != nil {
+		t.Fatalf("login with the next code: %v", err)
+	}
+	recovery := confirmed.GetRecoveryCodes()[0]
+	if err := login(recovery); err != nil {
+		t.Fatalf("login with a recovery code: %v", err)
+	}
+	if err := login(recovery); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected a used recovery code to be rejected, got %v", err)
+	}
+}
+
+func TestFileManagerService_LoginLockout(t *testing.T) {
+	env := newTestEnv(t)
+	env.login(t, "alice")
+	login := func(username string, password string) error {
+		_, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: username, Password: password})
+		return err
+	}
+	wrongPassword, unknownUser := login("alice", "wrong"), login("nobody", "wrong")
+	if status.Code(wrongPassword) != codes.Unauthenticated || wrongPassword.Error() != unknownUser.Error() {
+		t.Fatalf("a wrong password and an unknown user must fail alike: %v, %v", wrongPassword, unknownUser)
+	}
+	if err := login("alice", "secret"); err != nil {
+		t.Fatalf("login resets nothing it should not: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := login("alice", "wrong"); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("attempt %d: expected Unauthenticated, got %v", i, err)
+		}
+	}
+	// the third failure in a row locks the user name, even for the right password
+	if err := login("alice", "secret"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted for a locked user, got %v", err)
+	}
+}
+
+func TestFileManagerService_LoginByEmail(t *testing.T) {
+	env := newTestEnv(t)
+	env.login(t, "alice")
+	res, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: "Alice@Example.com", Password: "secret"})
+	if err != nil || res.GetUsername() != "alice" {
+		t.Fatalf("login by email: %v, %v", res, err)
+	}
+	_, err = env.client.CreateUser(context.Background(), &pb.CreateUserRequest{
+		Username: "bob@example.com", Password: "secret", Email: "bob@example.com",
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a username with an @, got %v", err)
+	}
+	// failures by the email and by the username count against the same account
+	for _, login := range []string{"alice", "alice@example.com", "ALICE@example.com"} {
+		_, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: login, Password: "wrong"})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected Unauthenticated for %s, got %v", login, err)
+		}
+	}
+	_, err = env.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted for a locked user, got %v", err)
+	}
+}
+
+func TestFileManagerService_ChangePassword(t *testing.T) {
+	env := newTestEnv(t)
+	laptop := env.login(t, "alice")
+	var header metadata.MD
+	_, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret"},
+		grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	phone := metadata.AppendToOutgoingContext(context.Background(), "authorization", header.Get("authorization")[0])
+
+	_, err = env.client.ChangePassword(laptop, &pb.ChangePasswordRequest{OldPassword: "wrong", NewPassword: "new secret"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for a wrong password, got %v", err)
+	}
+	changed, err := env.client.ChangePassword(laptop, &pb.ChangePasswordRequest{OldPassword: "secret", NewPassword: "new secret"})
+	if err != nil || changed.GetRevokedSessions() != 1 {
+		t.Fatalf("change password: %v, %v", changed, err)
+	}
+	if _, err := env.client.ListUserFiles(phone, &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the other session to be logged out, got %v", err)
+	}
+	if _, err := env.client.ListUserFiles(laptop, &emptypb.Empty{}); err != nil {
+		t.Fatalf("the session changing the password was logged out: %v", err)
+	}
+	login := func(password string) error {
+		_, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: password})
+		return err
+	}
+	if err := login("secret"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the old password to be rejected, got %v", err)
+	}
+	if err := login("new secret"); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+}
+
+func TestFileManagerService_EmailVerificationAndReset(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.loginUnverified(t, "alice")
+	stream, err := env.client.UploadFile(ctx)
+	if err == nil {
+		_ = stream.Send(&pb.FileChunk{Filename: "report.pdf", Chunk: []byte("quarterly numbers")})
+		_, err = stream.CloseAndRecv()
+	}
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for an upload from an unverified address, got %v", err)
+	}
+	_, err = env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{Name: "github", Username: "alice", Password: "secret"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for credentials of an unverified address, got %v", err)
+	}
+	_, err = env.client.CreateShareLink(ctx, &pb.CreateShareLinkRequest{Filename: "report.pdf", TtlSeconds: 60})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for an unverified address, got %v", err)
+	}
+	if _, err := env.client.ListUserFiles(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatalf("an unverified user must still read the account: %v", err)
+	}
+	_, err = env.client.RequestPasswordReset(context.Background(), &pb.RequestPasswordResetRequest{Email: "alice@example.com"})
+	if err != nil || env.mailbox.count() != 1 {
+		t.Fatalf("a reset code must not be sent to an unverified address: %v, %d messages", err, env.mailbox.count())
+	}
+	if _, err := env.client.ResendVerification(ctx, &emptypb.Empty{}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted for a resend right after sign up, got %v", err)
+	}
+	verification := env.mailbox.code("alice@example.com")
+	if _, err := env.client.VerifyEmail(context.Background(), &pb.VerifyEmailRequest{Token: verification}); err != nil {
+		t.Fatalf("verify email: %v", err)
+	}
+	if _, err := env.client.VerifyEmail(context.Background(), &pb.VerifyEmailRequest{Token: verification}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a used code, got %v", err)
+	}
+	env.upload(t, ctx, "report.pdf", []byte("quarterly numbers"))
+	if _, err := env.client.CreateShareLink(ctx, &pb.CreateShareLinkRequest{Filename: "report.pdf", TtlSeconds: 60}); err != nil {
+		t.Fatalf("share link after verification: %v", err)
+	}
+
+	unknown, err := env.client.RequestPasswordReset(context.Background(), &pb.RequestPasswordResetRequest{Email: "nobody@example.com"})
+	if err != nil {
+		t.Fatalf("request reset for an unknown address: %v", err)
+	}
+	known, err := env.client.RequestPasswordReset(context.Background(), &pb.RequestPasswordResetRequest{Email: "alice@example.com"})
+	if err != nil || known.GetMessage() != unknown.GetMessage() {
+		t.Fatalf("known and unknown addresses must be answered alike: %v, %v, %v", known, unknown, err)
+	}
+	reset := env.mailbox.code("alice@example.com")
+	if reset == verification {
+		t.Fatal("no reset code was sent")
+	}
+	_, err = env.client.ResetPassword(context.Background(), &pb.ResetPasswordRequest{Token: reset})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an empty password, got %v", err)
+	}
+	done, err := env.client.ResetPassword(context.Background(), &pb.ResetPasswordRequest{Token: reset, NewPassword: "new secret"})
+	if err != nil || done.GetRevokedSessions() != 1 {
+		t.Fatalf("reset password: %v, %v", done, err)
+	}
+	if _, err := env.client.ListUserFiles(ctx, &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the session to be logged out, got %v", err)
+	}
+	_, err = env.client.ResetPassword(context.Background(), &pb.ResetPasswordRequest{Token: reset, NewPassword: "other"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a used code, got %v", err)
+	}
+	if _, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the old password to be rejected, got %v", err)
+	}
+	if _, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "new secret"}); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+}
+
+func TestFileManagerService_PasswordResetSendFailure(t *testing.T) {
+	env := newTestEnv(t)
+	env.login(t, "alice")
+	env.mailbox.fail(errors.New("smtp is down"))
+	unknown, err := env.client.RequestPasswordReset(context.Background(), &pb.RequestPasswordResetRequest{Email: "nobody@example.com"})
+	if err != nil {
+		t.Fatalf("request reset for an unknown address: %v", err)
+	}
+	failed, err := env.client.RequestPasswordReset(context.Background(), &pb.RequestPasswordResetRequest{Email: "alice@example.com"})
+	if err != nil || failed.GetMessage() != unknown.GetMessage() {
+		t.Fatalf("a failed send must be answered like an unknown address: %v, %v", failed, err)
+	}
+}
+
+func TestAdminService(t *testing.T) {
+	env := newTestEnv(t)
+	bob := env.login(t, "bob")
+	env.login(t, "alice")
+	user, err := env.storage.UserRepository.FindByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("find user: %v", err)
+	}
+	if err := env.storage.UserRepository.SetRole(context.Background(), user.ID, models.RoleAdmin); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	// the role is read from the token, so it applies from the next login
+	admin := env.session(t, "alice")
+	login := func(password string) error {
+		_, err := env.client.Login(context.Background(), &pb.LoginRequest{Username: "bob", Password: password})
+		return err
+	}
+
+	if _, err := env.admin.ListUsers(bob, &emptypb.Empty{}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for a user, got %v", err)
+	}
+	users, err := env.admin.ListUsers(admin, &emptypb.Empty{})
+	if err != nil || len(users.GetUsers()) != 2 || users.GetUsers()[0].GetRole() != models.RoleAdmin {
+		t.Fatalf("list users: %v, %v", users, err)
+	}
+	if _, err := env.admin.SetRole(admin, &pb.SetRoleRequest{Username: "alice", Role: models.RoleUser}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for the own role, got %v", err)
+	}
+	if _, err := env.admin.SetRole(admin, &pb.SetRoleRequest{Username: "bob", Role: "root"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an unknown role, got %v", err)
+	}
+
+	disabled, err := env.admin.DisableUser(admin, &pb.DisableUserRequest{Username: "bob"})
+	if err != nil || disabled.GetRevokedSessions() != 1 {
+		t.Fatalf("disable user: %v, %v", disabled, err)
+	}
+	if _, err := env.client.ListUserFiles(bob, &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the disabled user to be logged out, got %v", err)
+	}
+	if err := login("secret"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for a disabled user, got %v", err)
+	}
+	if _, err := env.admin.EnableUser(admin, &pb.EnableUserRequest{Username: "bob"}); err != nil {
+		t.Fatalf("enable user: %v", err)
+	}
+	if err := login("secret"); err != nil {
+		t.Fatalf("login after enabling: %v", err)
+	}
+
+	reset, err := env.admin.ResetUserPassword(admin, &pb.ResetUserPasswordRequest{Username: "bob"})
+	if err != nil || reset.GetTemporaryPassword() == "" {
+		t.Fatalf("reset password: %v, %v", reset, err)
+	}
+	if err := login("secret"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the old password to be rejected, got %v", err)
+	}
+	if err := login(reset.GetTemporaryPassword()); err != nil {
+		t.Fatalf("login with the temporary password: %v", err)
+	}
+	if _, err := env.admin.SetRole(admin, &pb.SetRoleRequest{Username: "missing", Role: models.RoleAdmin}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for an unknown user, got %v", err)
+	}
+}
+
+func TestUserManager(t *testing.T) {
+	env := newTestEnv(t)
+	users := NewUserManager(env.storage, zap.NewNop())
+	ctx := context.Background()
+
+	if _, err := users.CreateUser(ctx, "root", "secret", "root@example.com", "boss"); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an unknown role, got %v", err)
+	}
+	root, err := users.CreateUser(ctx, "root", "secret", "root@example.com", models.RoleAdmin)
+	if err != nil || root.Role != models.RoleAdmin || root.EmailVerifiedAt == nil {
+		t.Fatalf("create user: %+v, %v", root, err)
+	}
+	// created offline, the administrator can log in and use the admin API at once
+	admin := env.session(t, "root")
+	if _, err := env.admin.ListUsers(admin, &emptypb.Empty{}); err != nil {
+		t.Fatalf("list users as the created admin: %v", err)
+	}
+
+	revoked, err := users.SetRole(ctx, root, models.RoleUser, "test")
+	if err != nil || revoked != 1 {
+		t.Fatalf("set role: %d, %v", revoked, err)
+	}
+	if _, err := env.admin.ListUsers(admin, &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the demoted admin to be logged out, got %v", err)
+	}
+	root, err = users.FindUser(ctx, "root")
+	if err != nil {
+		t.Fatalf("find user: %v", err)
+	}
+	if _, err := users.SetDisabled(ctx, root, true, "test"); err != nil {
+		t.Fatalf("disable user: %v", err)
+	}
+	_, err = env.client.Login(ctx, &pb.LoginRequest{Username: "root", Password: "secret"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for a disabled user, got %v", err)
+	}
+	events, err := env.storage.SecurityEventRepository.ListEvents(ctx, root.ID, 10)
+	if err != nil || len(events) == 0 || events[0].Kind != models.EventUserDisabled || events[0].Detail != "by test" {
+		t.Fatalf("security events: %+v, %v", events, err)
+	}
+}
+
+func TestFileManagerService_DeleteAccount(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.login(t, "alice")
+	env.upload(t, alice, "notes.txt", []byte("first"))
+	env.upload(t, alice, "notes.txt", []byte("second"))
+	env.upload(t, alice, "photo.jpg", []byte("photo"))
+	if _, err := env.client.DeleteFile(alice, &pb.DeleteFileRequest{Filename: "photo.jpg"}); err != nil {
+		t.Fatalf("delete file: %v", err)
+	}
+	_, err := env.client.SaveCredentials(alice, &pb.SaveCredentialsRequest{Name: "github", Username: "alice", Password: "pw"})
+	if err != nil {
+		t.Fatalf("save credentials: %v", err)
+	}
+	bob := env.login(t, "bob")
+	env.upload(t, bob, "notes.txt", []byte("bob"))
+
+	_, err = env.client.DeleteAccount(alice, &pb.DeleteAccountRequest{Password: "secret", Confirmation: "delete bob"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a wrong confirmation, got %v", err)
+	}
+	_, err = env.client.DeleteAccount(alice, &pb.DeleteAccountRequest{Password: "wrong", Confirmation: "delete alice"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for a wrong password, got %v", err)
+	}
+	report, err := env.client.DeleteAccount(alice, &pb.DeleteAccountRequest{Password: "secret", Confirmation: "delete alice"})
+	if err != nil {
+		t.Fatalf("delete account: %v", err)
+	}
+	// two versions of notes.txt, the photo and its delete marker
+	if report.GetObjectVersions() != 4 || report.GetBytesDeleted() != int64(len("first")+len("second")+len("photo")) ||
+		report.GetRowsDeleted() == 0 || report.GetCompletedAt() == "" {
+		t.Fatalf("unexpected purge report: %v", report)
+	}
+	if _, err := env.client.ListUserFiles(alice, &emptypb.Empty{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the session of a deleted account to be rejected, got %v", err)
+	}
+	_, err = env.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the login of a deleted account to fail, got %v", err)
+	}
+	if names := env.fileNames(t, bob); len(names) != 1 {
+		t.Fatalf("files of another user were deleted: %v", names)
+	}
+	// the name is free again and a new account starts empty
+	carol := env.login(t, "alice")
+	if names := env.fileNames(t, carol); len(names) != 0 {
+		t.Fatalf("a new account with the same name sees old files: %v", names)
+	}
+}
+
+func TestAccountService_ResumesDeletion(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	env.upload(t, ctx, "notes.txt", []byte("notes"))
+	user, err := env.storage.UserRepository.FindByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("find user: %v", err)
+	}
+	// a deletion that was started but interrupted before anything was removed
+	if _, err := env.storage.AccountDeletionRepository.StartDeletion(context.Background(), user.ID); err != nil {
+		t.Fatalf("start deletion: %v", err)
+	}
+	_, err = env.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected logins to be rejected during the deletion, got %v", err)
+	}
+	env.accounts.resumePending(context.Background())
+	deletion, err := env.storage.AccountDeletionRepository.FindDeletion(context.Background(), user.ID)
+	if err != nil || deletion.CompletedAt == nil || deletion.ObjectVersions != 1 {
+		t.Fatalf("deletion was not resumed: %+v, %v", deletion, err)
+	}
+	if _, err := env.storage.UserRepository.FindByID(context.Background(), user.ID); err != db.ErrNotFound {
+		t.Fatalf("expected the user to be deleted, got %v", err)
+	}
+}
+
+func TestFileManagerService_CreateUserTwice(t *testing.T) {
+	env := newTestEnv(t)
+	env.login(t, "alice")
+	_, err := env.client.CreateUser(context.Background(), &pb.CreateUserRequest{
+		Username: "alice",
+		Password: "other",
+		Email:    "other@example.com",
+	})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("expected AlreadyExists, got %v", err)
+	}
+}
+
+func TestFileManagerService_UploadDownload(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	content := bytes.Repeat([]byte("gophkeeper "), 1000)
+	res := env.upload(t, ctx, "notes.txt", content)
+	if !res.GetSuccess() || res.GetVersionID() == "" {
+		t.Fatalf("unexpected upload status: %v", res)
+	}
+
+	got, err := env.download(t, ctx, &pb.DownloadRequest{Filename: "notes.txt"})
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("downloaded %d bytes, want %d", len(got), len(content))
+	}
+	got, err = env.download(t, ctx, &pb.DownloadRequest{Filename: "notes.txt", Offset: 5})
+	if err != nil {
+		t.Fatalf("ranged download: %v", err)
+	}
+	if !bytes.Equal(got, content[5:]) {
+		t.Fatalf("ranged download returned %d bytes, want %d", len(got), len(content)-5)
+	}
+	if names := env.fileNames(t, ctx); len(names) != 1 || names[0] != "notes.txt" {
+		t.Fatalf("unexpected files: %v", names)
+	}
+
+	other := env.login(t, "bob")
+	if names := env.fileNames(t, other); len(names) != 0 {
+		t.Fatalf("bob sees alice's files: %v", names)
+	}
+	_, err = env.download(t, other, &pb.DownloadRequest{Filename: "notes.txt"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for another user, got %v", err)
+	}
+}
+
+func TestFileManagerService_Credentials(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	for _, password := range []string{"first", "second"} {
+		_, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{
+			Name:     "github",
+			Username: "alice",
+			Password: password,
+		})
+		if err != nil {
+			t.Fatalf("save credentials: %v", err)
+		}
+	}
+	_, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{Name: "github"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+
+	creds, err := env.client.GetAllCreds(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("get creds: %v", err)
+	}
+	if len(creds.GetCreds()) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(creds.GetCreds()))
+	}
+	latest := creds.GetCreds()[0]
+	if latest.GetName() != "github" || !strings.Contains(latest.GetData(), `"password":"second"`) {
+		t.Fatalf("unexpected latest credentials: %v", latest)
+	}
+}
+
+func TestFileManagerService_ConflictOnNewCredentials(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	// both devices create the same credentials while offline
+	var conflictID string
+	for _, password := range []string{"desktop", "laptop"} {
+		res, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{
+			Name: "github", Username: "alice", Password: password, BaseVersion: proto.Int64(0),
+		})
+		if err != nil {
+			t.Fatalf("save credentials: %v", err)
+		}
+		conflictID = res.GetConflictId()
+	}
+	if conflictID == "" {
+		t.Fatal("expected the second new credentials to conflict")
+	}
+	creds, err := env.client.GetAllCreds(ctx, &emptypb.Empty{})
+	if err != nil || len(creds.GetCreds()) != 1 || !strings.Contains(creds.GetCreds()[0].GetData(), `"password":"desktop"`) {
+		t.Fatalf("unexpected credentials: %v, %v", creds, err)
+	}
+}
+
+func TestFileManagerService_Conflicts(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	save := func(username string, password string, base int64) *pb.SaveCredentialsResponse {
+		t.Helper()
+		res, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{
+			Name:        "github",
+			Username:    username,
+			Password:    password,
+			BaseVersion: proto.Int64(base),
+		})
+		if err != nil {
+			t.Fatalf("save credentials: %v", err)
+		}
+		return res
+	}
+	base, _ := strconv.ParseInt(save("alice", "first", 0).GetVersion(), 10, 64)
+	if res := save("alice", "remote", base); res.GetConflictId() != "" {
+		t.Fatalf("unexpected conflict on a fresh base: %v", res)
+	}
+	// the laptop edited the username from the same base
+	res := save("alice-laptop", "first", base)
+	if res.GetConflictId() == "" {
+		t.Fatalf("expected a conflict, got %v", res)
+	}
+
+	conflicts, err := env.client.ListConflicts(ctx, &emptypb.Empty{})
+	if err != nil || len(conflicts.GetConflicts()) != 1 {
+		t.Fatalf("unexpected conflicts: %v, %v", conflicts, err)
+	}
+	conflict := conflicts.GetConflicts()[0]
+	if conflict.GetBaseVersion() != base || !strings.Contains(conflict.GetRemoteData(), `"password":"remote"`) ||
+		!strings.Contains(conflict.GetLocalData(), `"username":"alice-laptop"`) {
+		t.Fatalf("unexpected conflict: %v", conflict)
+	}
+
+	_, err = env.client.ResolveConflict(ctx, &pb.ResolveConflictRequest{Id: conflict.GetId(), Keep: "newest"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	resolved, err := env.client.ResolveConflict(ctx, &pb.ResolveConflictRequest{Id: conflict.GetId(), Keep: "merge"})
+	if err != nil || resolved.GetVersion() == "" {
+		t.Fatalf("resolve conflict: %v, %v", resolved, err)
+	}
+	creds, err := env.client.GetAllCreds(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("get creds: %v", err)
+	}
+	if latest := creds.GetCreds()[0]; latest.GetVersion() != resolved.GetVersion() ||
+		!strings.Contains(latest.GetData(), `"username":"alice-laptop"`) || !strings.Contains(latest.GetData(), `"password":"remote"`) {
+		t.Fatalf("unexpected merged credentials: %v", latest)
+	}
+	_, err = env.client.ResolveConflict(ctx, &pb.ResolveConflictRequest{Id: conflict.GetId(), Keep: "local"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+	if conflicts, _ := env.client.ListConflicts(ctx, &emptypb.Empty{}); len(conflicts.GetConflicts()) != 0 {
+		t.Fatalf("resolved conflicts are listed: %v", conflicts)
+	}
+}
+
+func TestFileManagerService_TrashAndRestore(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	env.upload(t, ctx, "photo.jpg", []byte("jpeg"))
+	_, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{Name: "mail", Username: "a", Password: "b"})
+	if err != nil {
+		t.Fatalf("save credentials: %v", err)
+	}
+
+	if _, err := env.client.DeleteFile(ctx, &pb.DeleteFileRequest{Filename: "photo.jpg"}); err != nil {
+		t.Fatalf("delete file: %v", err)
+	}
+	if _, err := env.client.DeleteCredentials(ctx, &pb.DeleteCredentialsRequest{Name: "mail"}); err != nil {
+		t.Fatalf("delete credentials: %v", err)
+	}
+	if names := env.fileNames(t, ctx); len(names) != 0 {
+		t.Fatalf("deleted file is still listed: %v", names)
+	}
+	creds, err := env.client.GetAllCreds(ctx, &emptypb.Empty{})
+	if err != nil || len(creds.GetCreds()) != 0 {
+		t.Fatalf("deleted credentials are still listed: %v, %v", creds, err)
+	}
+	_, err = env.client.DeleteFile(ctx, &pb.DeleteFileRequest{Filename: "photo.jpg"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for a deleted file, got %v", err)
+	}
+
+	trash, err := env.client.ListTrash(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("list trash: %v", err)
+	}
+	if len(trash.GetItems()) != 2 {
+		t.Fatalf("expected 2 trash items, got %v", trash.GetItems())
+	}
+	for _, item := range trash.GetItems() {
+		if _, err := env.client.RestoreFromTrash(ctx, &pb.RestoreFromTrashRequest{Id: item.GetId()}); err != nil {
+			t.Fatalf("restore %s: %v", item.GetName(), err)
+		}
+	}
+	if names := env.fileNames(t, ctx); len(names) != 1 {
+		t.Fatalf("restored file is not listed: %v", names)
+	}
+	creds, err = env.client.GetAllCreds(ctx, &emptypb.Empty{})
+	if err != nil || len(creds.GetCreds()) != 1 {
+		t.Fatalf("restored credentials are not listed: %v, %v", creds, err)
+	}
+
+	if _, err := env.client.DeleteFile(ctx, &pb.DeleteFileRequest{Filename: "photo.jpg"}); err != nil {
+		t.Fatalf("delete file: %v", err)
+	}
+	emptied, err := env.client.EmptyTrash(ctx, &emptypb.Empty{})
+	if err != nil || emptied.GetRemoved() != 1 {
+		t.Fatalf("empty trash: %v, %v", emptied, err)
+	}
+	_, err = env.download(t, ctx, &pb.DownloadRequest{Filename: "photo.jpg"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound after purge, got %v", err)
+	}
+}
+
+func TestFileManagerService_ShareLink(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	env.upload(t, ctx, "report.pdf", []byte("pdf content"))
+
+	link, err := env.client.CreateShareLink(ctx, &pb.CreateShareLinkRequest{
+		Filename:     "report.pdf",
+		TtlSeconds:   60,
+		MaxDownloads: 1,
+	})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	handler := env.share.Handler()
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/share/"+link.GetToken(), nil))
+		return rec
+	}
+	if rec := get(); rec.Code != http.StatusOK || rec.Body.String() != "pdf content" {
+		t.Fatalf("unexpected first download: %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := get(); rec.Code != http.StatusNotFound {
+		t.Fatalf("download limit is not enforced: %d", rec.Code)
+	}
+
+	_, err = env.client.CreateShareLink(ctx, &pb.CreateShareLinkRequest{Filename: "report.pdf", TtlSeconds: 7200})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a ttl above the limit, got %v", err)
+	}
+	if _, err := env.client.RevokeShareLink(ctx, &pb.RevokeShareLinkRequest{Id: link.GetId()}); err != nil {
+		t.Fatalf("revoke link: %v", err)
+	}
+	links, err := env.client.ListShareLinks(ctx, &emptypb.Empty{})
+	if err != nil || len(links.GetLinks()) != 1 || !links.GetLinks()[0].GetRevoked() {
+		t.Fatalf("unexpected links: %v, %v", links, err)
+	}
+}
+
+func TestFileManagerService_ShareLinkDownload(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	env.upload(t, ctx, `relatório "final".pdf`, []byte("pdf content"))
+	link, err := env.client.CreateShareLink(ctx, &pb.CreateShareLinkRequest{Filename: `relatório "final".pdf`, TtlSeconds: 60})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	env.share.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/share/"+link.GetToken(), nil))
+	_, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+	if rec.Code != http.StatusOK || err != nil || params["filename"] != `relatório "final".pdf` {
+		t.Fatalf("unexpected download: %d %q, %v", rec.Code, rec.Header().Get("Content-Disposition"), err)
+	}
+
+	// a file that cannot be opened must not use up the download
+	user, err := env.storage.UserRepository.FindByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("find user: %v", err)
+	}
+	_, err = env.storage.ShareLinkRepository.SaveShareLink(context.Background(), models.ShareLink{
+		UserID: user.ID, TokenHash: hashToken("missing"), FileName: "missing.pdf",
+		ExpiresAt: time.Now().Add(time.Minute), MaxDownloads: 1,
+	})
+	if err != nil {
+		t.Fatalf("save link: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	env.share.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/share/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected NotFound, got %d", rec.Code)
+	}
+	if _, err := env.storage.ShareLinkRepository.FindActive(context.Background(), hashToken("missing")); err != nil {
+		t.Fatalf("the failed download was counted: %v", err)
+	}
+}
+
+func TestFileManagerService_ResolveConflictOnce(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	for _, password := range []string{"first", "remote"} {
+		if _, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{
+			Name: "github", Username: "alice", Password: password,
+		}); err != nil {
+			t.Fatalf("save credentials: %v", err)
+		}
+	}
+	// the laptop saves against the first version
+	res, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{
+		Name: "github", Username: "alice", Password: "laptop", BaseVersion: proto.Int64(1),
+	})
+	if err != nil || res.GetConflictId() == "" {
+		t.Fatalf("expected a conflict, got %v, %v", res, err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = env.client.ResolveConflict(ctx, &pb.ResolveConflictRequest{Id: res.GetConflictId(), Keep: "local"})
+		}()
+	}
+	wg.Wait()
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Fatalf("expected exactly one resolution to apply: %v, %v", errs[0], errs[1])
+	}
+	creds, err := env.client.GetAllCreds(ctx, &emptypb.Empty{})
+	if err != nil || len(creds.GetCreds()) != 3 || !strings.Contains(creds.GetCreds()[0].GetData(), `"password":"laptop"`) {
+		t.Fatalf("unexpected credentials: %v, %v", creds, err)
+	}
+}
+
+func TestFileManagerService_ShareLinkOfTrashedFile(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	env.upload(t, ctx, "report.pdf", []byte("pdf content"))
+
+	link, err := env.client.CreateShareLink(ctx, &pb.CreateShareLinkRequest{Filename: "report.pdf", TtlSeconds: 60})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if _, err := env.client.DeleteFile(ctx, &pb.DeleteFileRequest{Filename: "report.pdf"}); err != nil {
+		t.Fatalf("delete file: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	env.share.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/share/"+link.GetToken(), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("trashed file is still shared: %d %q", rec.Code, rec.Body.String())
+	}
+	links, err := env.client.ListShareLinks(ctx, &emptypb.Empty{})
+	if err != nil || len(links.GetLinks()) != 1 || !links.GetLinks()[0].GetRevoked() {
+		t.Fatalf("link is not revoked: %v, %v", links, err)
+	}
+}
+
+func TestFileManagerService_GetChanges(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	env.upload(t, ctx, "a.txt", []byte("a"))
+	env.upload(t, ctx, "b.txt", []byte("b"))
+	_, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{Name: "mail", Username: "a", Password: "b"})
+	if err != nil {
+		t.Fatalf("save credentials: %v", err)
+	}
+
+	first, err := env.client.GetChanges(ctx, &pb.GetChangesRequest{PageSize: 2})
+	if err != nil {
+		t.Fatalf("get changes: %v", err)
+	}
+	if len(first.GetChanges()) != 2 || !first.GetHasMore() || first.GetRevision() != 2 {
+		t.Fatalf("unexpected first page: %v", first)
+	}
+	second, err := env.client.GetChanges(ctx, &pb.GetChangesRequest{SinceRevision: first.GetRevision(), PageSize: 2})
+	if err != nil {
+		t.Fatalf("get changes: %v", err)
+	}
+	if len(second.GetChanges()) != 1 || second.GetHasMore() || second.GetRevision() != 3 {
+		t.Fatalf("unexpected second page: %v", second)
+	}
+	if creds := second.GetChanges()[0].GetCreds(); creds.GetName() != "mail" || !strings.Contains(creds.GetData(), `"username":"a"`) {
+		t.Fatalf("unexpected credentials payload: %v", second.GetChanges()[0])
+	}
+
+	if _, err := env.client.DeleteFile(ctx, &pb.DeleteFileRequest{Filename: "a.txt"}); err != nil {
+		t.Fatalf("delete file: %v", err)
+	}
+	env.upload(t, ctx, "b.txt", []byte("bb"))
+	latest, err := env.client.GetChanges(ctx, &pb.GetChangesRequest{SinceRevision: second.GetRevision()})
+	if err != nil {
+		t.Fatalf("get changes: %v", err)
+	}
+	changes := latest.GetChanges()
+	if len(changes) != 2 || latest.GetRevision() != 5 {
+		t.Fatalf("unexpected changes: %v", latest)
+	}
+	if changes[0].GetName() != "a.txt" || !changes[0].GetDeleted() || changes[0].GetFile() != nil {
+		t.Fatalf("expected a tombstone for a.txt, got %v", changes[0])
+	}
+	if changes[1].GetName() != "b.txt" || changes[1].GetFile().GetSize() != 2 {
+		t.Fatalf("expected the new version of b.txt, got %v", changes[1])
+	}
+
+	other := env.login(t, "bob")
+	empty, err := env.client.GetChanges(other, &pb.GetChangesRequest{})
+	if err != nil || len(empty.GetChanges()) != 0 {
+		t.Fatalf("bob sees alice's changes: %v, %v", empty, err)
+	}
+}
+
+func TestFileManagerService_WatchChanges(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := env.login(t, "alice")
+	save := func(name string) {
+		t.Helper()
+		_, err := env.client.SaveCredentials(ctx, &pb.SaveCredentialsRequest{Name: name, Username: "a", Password: "b"})
+		if err != nil {
+			t.Fatalf("save credentials: %v", err)
+		}
+	}
+	save("first")
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := env.client.WatchChanges(watchCtx, &pb.WatchChangesRequest{})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	next := func() *pb.ChangeEvent {
+		t.Helper()
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("receive event: %v", err)
+			}
+			if !event.GetHeartbeat() {
+				return event
+			}
+		}
+	}
+	if event := next(); event.GetRevision() != 1 || event.GetChange().GetName() != "first" {
+		t.Fatalf("expected the replayed change, got %v", event)
+	}
+	save("second")
+	if event := next(); event.GetRevision() != 2 || event.GetChange().GetCreds().GetName() != "second" {
+		t.Fatalf("expected the live change, got %v", event)
+	}
+
+	// changes of other users are not delivered
+	other := env.login(t, "bob")
+	_, err = env.client.SaveCredentials(other, &pb.SaveCredentialsRequest{Name: "bobs", Username: "a", Password: "b"})
+	if err != nil {
+		t.Fatalf("save credentials: %v", err)
+	}
+	heartbeat, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("receive event: %v", err)
+	}
+	if !heartbeat.GetHeartbeat() || heartbeat.GetRevision() != 2 {
+		t.Fatalf("expected a heartbeat at revision 2, got %v", heartbeat)
+	}
+
+	// a watcher resuming from a revision gets only what it has not seen
+	resumed, err := env.client.WatchChanges(watchCtx, &pb.WatchChangesRequest{SinceRevision: 1})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	event, err := resumed.Recv()
+	if err != nil || event.GetRevision() != 2 {
+		t.Fatalf("unexpected resumed event: %v, %v", event, err)
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"GophKeeper/internal/blobstore"
+	"GophKeeper/internal/proto/gkeeper/pb"
+	db "GophKeeper/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"path"
+	"strings"
+)
+
+// MinPartSize is the size of the parts the uploaded files are split into; S3 rejects smaller parts except the last one.
+const MinPartSize = 5 * 1024 * 1024
+
+// FileService streams users' files between gRPC clients and the blob store.
+type FileService struct {
+	store       blobstore.BlobStore
+	syncService *SyncService
+	log         *zap.Logger
+}
+
+func NewFileService(store blobstore.BlobStore, syncService *SyncService, log *zap.Logger) *FileService {
+	return &FileService{
+		store:       store,
+		syncService: syncService,
+		log:         log,
+	}
+}
+
+// objectKey returns the key of the user's file in the blob store.
+func objectKey(userID string, fileName string) string {
+	return fmt.Sprintf("%s/%s", userID, fileName)
+}
+
+// validFileName reports whether the name can be used as a part of an object key.
+func validFileName(fileName string) bool {
+	return fileName != "" && !strings.Contains(fileName, "..")
+}
+
+func (s *FileService) UploadFile(stream pb.FileManagerService_UploadFileServer, userID string) error {
+	ctx := context.Background()
+	firstChunk, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("error receiving first chunk: %v", err)
+	}
+	if !validFileName(firstChunk.GetFilename()) {
+		return status.Error(codes.InvalidArgument, "invalid file name")
+	}
+	fileName := objectKey(userID, firstChunk.GetFilename())
+	uploadID, err := s.store.NewMultipartUpload(ctx, fileName)
+	if err != nil {
+		return err
+	}
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		// the client went away or a part failed: drop the parts instead of leaving them in the store
+		if abortErr := s.store.AbortMultipartUpload(ctx, fileName, uploadID); abortErr != nil {
+			s.log.Error("failed to abort multipart upload",
+				zap.String("object", fileName),
+				zap.String("uploadID", uploadID),
+				zap.Error(abortErr),
+			)
+		}
+	}()
+	var partNumber int
+	var parts []blobstore.Part
+	buffer := bytes.NewBuffer(nil) // Accumulate chunks here
+	buffer.Write(firstChunk.GetChunk())
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error receiving chunk: %v", err)
+		}
+		buffer.Write(chunk.GetChunk())
+		if buffer.Len() >= MinPartSize {
+			partNumber++
+			part, err := s.store.PutPart(ctx, fileName, uploadID, partNumber, buffer, int64(buffer.Len()))
+			if err != nil {
+				return fmt.Errorf("failed to upload part %d: %v", partNumber, err)
+			}
+			parts = append(parts, part)
+			buffer.Reset() // Clear buffer for next accumulation
+		}
+	}
+
+	if buffer.Len() > 0 || partNumber == 0 {
+		partNumber++
+		part, err := s.store.PutPart(ctx, fileName, uploadID, partNumber, buffer, int64(buffer.Len()))
+		if err != nil {
+			return fmt.Errorf("failed to upload final part %d: %v", partNumber, err)
+		}
+		parts = append(parts, part)
+	}
+
+	versionID, err := s.store.CompleteMultipartUpload(ctx, fileName, uploadID, parts)
+	if err != nil {
+		return err
+	}
+	completed = true
+	if err := s.syncService.Record(ctx, userID, db.ChangeKindFile, firstChunk.GetFilename(), false, versionID); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return stream.SendAndClose(&pb.UploadStatus{
+		Success:   true,
+		Message:   "File uploaded successfully!",
+		VersionID: versionID,
+	})
+}
+
+func (s *FileService) DownloadFile(ctx context.Context, userID string, req *pb.DownloadRequest, stream pb.FileManagerService_DownloadFileServer) error {
+	if !validFileName(req.GetFilename()) {
+		return status.Error(codes.InvalidArgument, "invalid file name")
+	}
+	reader, _, readErr := s.store.Get(ctx, objectKey(userID, req.GetFilename()), req.GetVersionID(), req.GetOffset(), 0)
+	if errors.Is(readErr, blobstore.ErrNotFound) {
+		return status.Error(codes.NotFound, "file not found")
+	}
+	if readErr != nil {
+		return fmt.Errorf("failed to get object: %v", readErr)
+	}
+	defer reader.Close()
+	buffer := make([]byte, MinPartSize)
+	for {
+		n, readErr := reader.Read(buffer)
+		if n > 0 {
+			if sendErr := stream.Send(&pb.DownloadResponse{Chunk: buffer[:n]}); sendErr != nil {
+				return fmt.Errorf("failed to send chunk: %v", sendErr)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("error reading object: %v", readErr)
+		}
+	}
+	return nil
+}
+
+// ListFiles lists all files of the user
+func (s *FileService) ListFiles(ctx context.Context, userID string) (*pb.ListUserFileResponse, error) {
+	objects, err := s.store.List(ctx, userID+"/")
+	if err != nil {
+		return &pb.ListUserFileResponse{}, err
+	}
+	var result []*pb.FileObject
+	for _, object := range objects {
+		result = append(result, &pb.FileObject{
+			FileName:  path.Base(object.Key),
+			Key:       object.Key,
+			VersionID: object.VersionID,
+			IsLatest:  object.IsLatest,
+			Size:      object.Size,
+		})
+	}
+	return &pb.ListUserFileResponse{
+		Objects: result,
+	}, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"GophKeeper/internal/blobstore"
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenSize is the number of random bytes in the tokens of share links and emails.
+const tokenSize = 32
+
+// ShareLinkService issues expiring download links and serves them over plain HTTP.
+type ShareLinkService struct {
+	storage *db.Storage
+	store   blobstore.BlobStore
+	logger  *zap.Logger
+	baseURL string
+	maxTTL  time.Duration
+}
+
+// NewShareLinkService creates a ShareLinkService. baseURL is the public address of the HTTP endpoint
+// and maxTTL caps the lifetime a user may request for a link.
+func NewShareLinkService(storage *db.Storage, store blobstore.BlobStore, logger *zap.Logger, baseURL string,
+	maxTTL time.Duration) *ShareLinkService {
+	return &ShareLinkService{
+		storage: storage,
+		store:   store,
+		logger:  logger,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		maxTTL:  maxTTL,
+	}
+}
+
+// CreateLink creates a link for the latest version of the user's file and returns it together with the raw token.
+// Only the hash of the token is stored, so the token cannot be recovered later.
+func (s *ShareLinkService) CreateLink(ctx context.Context, userID string, fileName string, ttl time.Duration,
+	maxDownloads int32) (models.ShareLink, string, error) {
+	if !validFileName(fileName) {
+		return models.ShareLink{}, "", status.Error(codes.InvalidArgument, "invalid file name")
+	}
+	if ttl <= 0 || (s.maxTTL > 0 && ttl > s.maxTTL) {
+		return models.ShareLink{}, "", status.Errorf(codes.InvalidArgument, "ttl must be between 1s and %s", s.maxTTL)
+	}
+	if maxDownloads < 0 {
+		return models.ShareLink{}, "", status.Error(codes.InvalidArgument, "max downloads must not be negative")
+	}
+	info, err := s.store.Stat(ctx, objectKey(userID, fileName))
+	if err != nil {
+		return models.ShareLink{}, "", status.Error(codes.NotFound, "file not found")
+	}
+	token, err := generateToken()
+	if err != nil {
+		return models.ShareLink{}, "", status.Error(codes.Internal, "something went wrong")
+	}
+	link := models.ShareLink{
+		UserID:       userID,
+		TokenHash:    hashToken(token),
+		FileName:     fileName,
+		VersionID:    info.VersionID,
+		ExpiresAt:    time.Now().Add(ttl),
+		MaxDownloads: maxDownloads,
+	}
+	id, err := s.storage.ShareLinkRepository.SaveShareLink(ctx, link)
+	if err != nil {
+		return models.ShareLink{}, "", status.Error(codes.Internal, err.Error())
+	}
+	link.ID = id.String()
+	return link, token, nil
+}
+
+// ListLinks returns all links created by the user.
+func (s *ShareLinkService) ListLinks(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	return s.storage.ShareLinkRepository.FindAllByUser(ctx, userID)
+}
+
+// RevokeLink revokes the user's link so it is not served anymore.
+func (s *ShareLinkService) RevokeLink(ctx context.Context, userID string, linkID string) error {
+	ok, err := s.storage.ShareLinkRepository.Revoke(ctx, userID, linkID)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return status.Error(codes.NotFound, "link not found or already revoked")
+	}
+	return nil
+}
+
+// URL builds the public download address for the token.
+func (s *ShareLinkService) URL(token string) string {
+	return s.baseURL + "/share/" + token
+}
+
+// Handler returns the unauthenticated HTTP handler that streams shared files.
+func (s *ShareLinkService) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /share/{token}", s.serveDownload)
+	return mux
+}
+
+func (s *ShareLinkService) serveDownload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tokenHash := hashToken(r.PathValue("token"))
+	link, err := s.storage.ShareLinkRepository.FindActive(ctx, tokenHash)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "link not found or expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to find share link", zap.Error(err))
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+	// the file is opened first, so a missing file does not use up a download
+	reader, info, err := s.store.Get(ctx, objectKey(link.UserID, link.FileName), link.VersionID, 0, 0)
+	if err != nil {
+		s.logger.Error("failed to open shared file", zap.String("link", link.ID), zap.Error(err))
+		http.Error(w, "file is not available", http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+	// the download is counted before streaming, as that is where concurrent requests are held to the limit
+	link, err = s.storage.ShareLinkRepository.ConsumeDownload(ctx, tokenHash)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "link not found or expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to consume share link", zap.Error(err))
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": link.FileName}))
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if _, err := io.Copy(w, reader); err != nil {
+		s.logger.Warn("shared file download interrupted", zap.String("link", link.ID), zap.Error(err))
+		return
+	}
+	s.logger.Info("shared file downloaded",
+		zap.String("link", link.ID),
+		zap.Int32("downloads", link.Downloads),
+	)
+}
+
+// generateToken returns a random URL-safe token. Only its hash is stored.
+func generateToken() (string, error) {
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
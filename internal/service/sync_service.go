@@ -0,0 +1,255 @@
+package service
+
+import (
+	"GophKeeper/internal/blobstore"
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/proto/gkeeper/pb"
+	"GophKeeper/internal/security"
+	db "GophKeeper/internal/storage"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultChangesPageSize is used when the client does not ask for a page size.
+	defaultChangesPageSize = 100
+	// maxChangesPageSize caps the page size a client may ask for.
+	maxChangesPageSize = 1000
+)
+
+// SyncService stamps every change of users' files and credentials with a per-user revision,
+// lets clients fetch what changed since the revision they have seen and pushes new changes to watchers.
+type SyncService struct {
+	storage       *db.Storage
+	store         blobstore.BlobStore
+	secretService *security.SecureService
+	broker        *ChangeBroker
+	logger        *zap.Logger
+	heartbeat     time.Duration
+}
+
+// NewSyncService creates a SyncService. heartbeat is the interval of the keep-alive events sent to watchers.
+func NewSyncService(storage *db.Storage, store blobstore.BlobStore, secretService *security.SecureService,
+	logger *zap.Logger, heartbeat time.Duration) *SyncService {
+	return &SyncService{
+		storage:       storage,
+		store:         store,
+		secretService: secretService,
+		broker:        NewChangeBroker(),
+		logger:        logger,
+		heartbeat:     heartbeat,
+	}
+}
+
+// Record stamps the change of the item with the next revision of the user.
+// The change itself has already happened, so on failure the caller must report an error
+// and let the client retry; otherwise other devices would never learn about the change.
+func (s *SyncService) Record(ctx context.Context, userID string, kind string, name string, deleted bool, versionID string) error {
+	change, err := s.storage.ChangeRepository.RecordChange(ctx, models.Change{
+		UserID:    userID,
+		Kind:      kind,
+		Name:      name,
+		Deleted:   deleted,
+		VersionID: versionID,
+	})
+	if err != nil {
+		s.logger.Error("failed to record change",
+			zap.String("userID", userID),
+			zap.String("kind", kind),
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return err
+	}
+	s.Publish(change)
+	return nil
+}
+
+// Publish pushes the recorded change to the local watchers, unless a shared feed delivers it.
+// Repositories that record changes together with the write hand them over here.
+func (s *SyncService) Publish(change models.Change) {
+	s.logger.Debug("change recorded", zap.String("userID", change.UserID), zap.Int64("revision", change.Revision))
+	if s.storage.ChangeFeed == nil {
+		s.broker.Publish(change)
+	}
+}
+
+// StartFeed forwards the changes recorded by all servers sharing the database to the local watchers
+// until ctx is done. Without a shared feed the changes are published locally by Record.
+func (s *SyncService) StartFeed(ctx context.Context) {
+	if s.storage.ChangeFeed == nil {
+		return
+	}
+	if err := s.storage.ChangeFeed.Listen(ctx, s.broker.Publish, s.broker.DropAll); err != nil {
+		s.logger.Error("change feed stopped", zap.Error(err))
+	}
+}
+
+// Watch sends the user's changes recorded after the given revision and then every new change as it happens,
+// with heartbeats in between, until ctx is done. If the watcher cannot be kept up to date, Watch returns
+// an Unavailable error and the client is expected to resume from the last revision it has received.
+func (s *SyncService) Watch(ctx context.Context, userID string, since int64, send func(*pb.ChangeEvent) error) error {
+	if since < 0 {
+		return status.Error(codes.InvalidArgument, "revision must not be negative")
+	}
+	// subscribe before replaying, so nothing recorded in between is lost
+	changes, unsubscribe := s.broker.Subscribe(userID)
+	defer unsubscribe()
+	last, err := s.replay(ctx, userID, since, send)
+	if err != nil {
+		return err
+	}
+	interval := s.heartbeat
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := send(&pb.ChangeEvent{Heartbeat: true, Revision: last}); err != nil {
+				return err
+			}
+		case change, ok := <-changes:
+			if !ok {
+				return status.Error(codes.Unavailable, "change stream interrupted, resume from the last revision")
+			}
+			switch {
+			case change.Revision <= last:
+				// already sent by the replay
+			case change.Revision == last+1:
+				if err := s.sendChange(ctx, change, send); err != nil {
+					return err
+				}
+				last = change.Revision
+			default:
+				// an earlier change has not been published yet; the database has all of them
+				if last, err = s.replay(ctx, userID, last, send); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// replay sends every change recorded after the given revision and returns the last revision sent.
+func (s *SyncService) replay(ctx context.Context, userID string, since int64, send func(*pb.ChangeEvent) error) (int64, error) {
+	for {
+		changes, err := s.storage.ChangeRepository.FindChanges(ctx, userID, since, maxChangesPageSize)
+		if err != nil {
+			return since, status.Error(codes.Internal, err.Error())
+		}
+		for _, change := range changes {
+			if err := s.sendChange(ctx, change, send); err != nil {
+				return since, err
+			}
+			since = change.Revision
+		}
+		if len(changes) < maxChangesPageSize {
+			return since, nil
+		}
+	}
+}
+
+func (s *SyncService) sendChange(ctx context.Context, change models.Change, send func(*pb.ChangeEvent) error) error {
+	item, err := s.toProto(ctx, change)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return send(&pb.ChangeEvent{Change: item, Revision: change.Revision})
+}
+
+// GetChanges returns a page of the user's items changed after the given revision together with their current state.
+func (s *SyncService) GetChanges(ctx context.Context, userID string, since int64, pageSize int32) (*pb.GetChangesResponse, error) {
+	if since < 0 || pageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "revision and page size must not be negative")
+	}
+	limit := int(pageSize)
+	if limit == 0 {
+		limit = defaultChangesPageSize
+	}
+	limit = min(limit, maxChangesPageSize)
+	// ask for one more to find out whether another page follows
+	changes, err := s.storage.ChangeRepository.FindChanges(ctx, userID, since, limit+1)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+	res := &pb.GetChangesResponse{
+		Revision: since,
+		HasMore:  hasMore,
+	}
+	for _, change := range changes {
+		item, err := s.toProto(ctx, change)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		res.Changes = append(res.Changes, item)
+		res.Revision = change.Revision
+	}
+	return res, nil
+}
+
+// toProto converts the change and attaches the current state of the item to upserts.
+// An item that disappeared after the change was recorded is reported as a tombstone.
+func (s *SyncService) toProto(ctx context.Context, change models.Change) (*pb.Change, error) {
+	res := &pb.Change{
+		Revision:  change.Revision,
+		Kind:      change.Kind,
+		Name:      change.Name,
+		Deleted:   change.Deleted,
+		ChangedAt: change.ChangedAt.Format("2006-01-02 15:04:05"),
+	}
+	if change.Deleted {
+		return res, nil
+	}
+	switch change.Kind {
+	case db.ChangeKindCredentials:
+		cred, err := s.storage.CredRepository.GetLastUserCreds(ctx, change.UserID, change.Name)
+		if errors.Is(err, db.ErrNotFound) {
+			res.Deleted = true
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := s.secretService.DecryptData(cred.Data)
+		if err != nil {
+			return nil, err
+		}
+		res.Creds = &pb.GetCredentialsResponse{
+			Name:       cred.Name,
+			Version:    strconv.FormatInt(cred.Version, 10),
+			Data:       string(data),
+			CreateDate: cred.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+	case db.ChangeKindFile:
+		info, err := s.store.Stat(ctx, objectKey(change.UserID, change.Name))
+		if errors.Is(err, blobstore.ErrNotFound) {
+			res.Deleted = true
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.File = &pb.FileObject{
+			FileName:  change.Name,
+			Key:       info.Key,
+			VersionID: info.VersionID,
+			IsLatest:  true,
+			Size:      info.Size,
+		}
+	}
+	return res, nil
+}
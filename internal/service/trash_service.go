@@ -0,0 +1,191 @@
+package service
+
+import (
+	"GophKeeper/internal/blobstore"
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// purgeBatchSize limits the number of expired entries handled by one purge run.
+const purgeBatchSize = 100
+
+// TrashService moves deleted files and credentials to a trash bin and removes them for good after the retention period.
+type TrashService struct {
+	storage     *db.Storage
+	store       blobstore.BlobStore
+	syncService *SyncService
+	logger      *zap.Logger
+	retention   time.Duration
+}
+
+func NewTrashService(storage *db.Storage, store blobstore.BlobStore, syncService *SyncService, logger *zap.Logger,
+	retention time.Duration) *TrashService {
+	return &TrashService{
+		storage:     storage,
+		store:       store,
+		syncService: syncService,
+		logger:      logger,
+		retention:   retention,
+	}
+}
+
+// DeleteFile moves the user's file to the trash bin. Its share links are revoked, since they pin
+// a version that stays downloadable until the trash is purged.
+func (s *TrashService) DeleteFile(ctx context.Context, userID string, fileName string) (models.TrashItem, error) {
+	if !validFileName(fileName) {
+		return models.TrashItem{}, status.Error(codes.InvalidArgument, "invalid file name")
+	}
+	objectName := objectKey(userID, fileName)
+	if _, err := s.store.Stat(ctx, objectName); err != nil {
+		return models.TrashItem{}, status.Error(codes.NotFound, "file not found")
+	}
+	if _, err := s.storage.ShareLinkRepository.RevokeByFile(ctx, userID, fileName); err != nil {
+		return models.TrashItem{}, status.Error(codes.Internal, err.Error())
+	}
+	marker, err := s.store.Delete(ctx, objectName)
+	if err != nil {
+		return models.TrashItem{}, status.Error(codes.Internal, err.Error())
+	}
+	item, change, err := s.storage.TrashRepository.SaveFileItem(ctx, userID, fileName, marker, time.Now().Add(s.retention))
+	if err != nil {
+		// without its trash entry the file could never be restored or purged, so bring it back
+		if undoErr := s.store.DeleteVersion(ctx, objectName, marker); undoErr != nil {
+			s.logger.Error("failed to remove delete marker", zap.String("object", objectName), zap.Error(undoErr))
+		}
+		return models.TrashItem{}, status.Error(codes.Internal, err.Error())
+	}
+	s.syncService.Publish(change)
+	return item, nil
+}
+
+// DeleteCreds moves every version of the user's credentials with the given name to the trash bin.
+func (s *TrashService) DeleteCreds(ctx context.Context, userID string, credName string) (models.TrashItem, error) {
+	if credName == "" {
+		return models.TrashItem{}, status.Error(codes.InvalidArgument, "name is empty")
+	}
+	item, change, err := s.storage.TrashRepository.TrashCreds(ctx, userID, credName, time.Now().Add(s.retention))
+	if errors.Is(err, db.ErrNotFound) {
+		return models.TrashItem{}, status.Error(codes.NotFound, "credentials not found")
+	}
+	if err != nil {
+		return models.TrashItem{}, status.Error(codes.Internal, err.Error())
+	}
+	s.syncService.Publish(change)
+	return item, nil
+}
+
+// ListTrash returns the content of the user's trash bin.
+func (s *TrashService) ListTrash(ctx context.Context, userID string) ([]models.TrashItem, error) {
+	return s.storage.TrashRepository.FindAllByUser(ctx, userID)
+}
+
+// Restore brings the trash entry back to the user's files or credentials.
+func (s *TrashService) Restore(ctx context.Context, userID string, itemID string) (models.TrashItem, error) {
+	item, err := s.storage.TrashRepository.FindByID(ctx, userID, itemID)
+	if err != nil {
+		return models.TrashItem{}, status.Error(codes.NotFound, "trash item not found")
+	}
+	if item.Kind == db.TrashKindFile {
+		err = s.store.DeleteVersion(ctx, objectKey(userID, item.Name), item.DeleteMarker)
+		if err != nil {
+			return models.TrashItem{}, status.Error(codes.Internal, err.Error())
+		}
+	}
+	change, err := s.storage.TrashRepository.Restore(ctx, item.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		return models.TrashItem{}, status.Error(codes.NotFound, "trash item not found")
+	}
+	if err != nil {
+		return models.TrashItem{}, status.Error(codes.Internal, err.Error())
+	}
+	s.syncService.Publish(change)
+	return item, nil
+}
+
+// EmptyTrash removes every entry of the user's trash bin for good and returns how many were removed.
+func (s *TrashService) EmptyTrash(ctx context.Context, userID string) (int, error) {
+	items, err := s.storage.TrashRepository.FindAllByUser(ctx, userID)
+	if err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+	for i, item := range items {
+		if err := s.purge(ctx, item); err != nil {
+			return i, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return len(items), nil
+}
+
+// StartPurgeJob periodically removes the entries whose retention period is over until ctx is done.
+func (s *TrashService) StartPurgeJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		s.logger.Info("trash purge job is disabled")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.purgeExpired(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *TrashService) purgeExpired(ctx context.Context) {
+	items, err := s.storage.TrashRepository.FindExpired(ctx, time.Now(), purgeBatchSize)
+	if err != nil {
+		s.logger.Error("failed to find expired trash items", zap.Error(err))
+		return
+	}
+	var purged int
+	for _, item := range items {
+		if err := s.purge(ctx, item); err != nil {
+			s.logger.Error("failed to purge trash item", zap.String("id", item.ID), zap.Error(err))
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		s.logger.Info("trash purged", zap.Int("items", purged))
+	}
+}
+
+func (s *TrashService) purge(ctx context.Context, item models.TrashItem) error {
+	if item.Kind == db.TrashKindFile {
+		if err := s.purgeFile(ctx, objectKey(item.UserID, item.Name), item.DeleteMarker); err != nil {
+			return err
+		}
+	}
+	return s.storage.TrashRepository.Purge(ctx, item.ID)
+}
+
+// purgeFile permanently removes the delete marker and every version of the object created before it.
+// Versions uploaded after the deletion are kept.
+func (s *TrashService) purgeFile(ctx context.Context, key string, deleteMarker string) error {
+	versions, err := s.store.ListVersions(ctx, key)
+	if err != nil {
+		return err
+	}
+	olderThanMarker := false
+	for _, version := range versions {
+		if version.VersionID == deleteMarker {
+			olderThanMarker = true
+		}
+		if !olderThanMarker {
+			continue
+		}
+		if err := s.store.DeleteVersion(ctx, key, version.VersionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"GophKeeper/internal/models"
+	"GophKeeper/internal/security"
+	db "GophKeeper/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UserManager changes accounts on behalf of an operator. It backs both the AdminService and the
+// offline gkeeper user commands, which talk to the database directly.
+type UserManager struct {
+	storage *db.Storage
+	users   *UserServiceServer
+	logger  *zap.Logger
+}
+
+func NewUserManager(storage *db.Storage, logger *zap.Logger) *UserManager {
+	return &UserManager{storage: storage, users: NewUserServiceServer(storage, logger), logger: logger}
+}
+
+// CreateUser creates a user with the role whose email address is taken as verified, since it was given
+// by an operator.
+func (m *UserManager) CreateUser(ctx context.Context, name string, pass string, email string,
+	role string) (models.UserDTO, error) {
+	if err := checkRole(role); err != nil {
+		return models.UserDTO{}, err
+	}
+	if err := security.ValidatePassword(pass); err != nil {
+		return models.UserDTO{}, err
+	}
+	_, err := m.users.createUser(name, pass, email, func(hash string) (uuid.UUID, error) {
+		return m.storage.UserRepository.SaveVerifiedUser(ctx, name, hash, email, role)
+	})
+	if err != nil {
+		return models.UserDTO{}, err
+	}
+	return m.FindUser(ctx, name)
+}
+
+// FindUser finds the user by username.
+func (m *UserManager) FindUser(ctx context.Context, username string) (models.UserDTO, error) {
+	if username == "" {
+		return models.UserDTO{}, status.Error(codes.InvalidArgument, "please provide the username")
+	}
+	user, err := m.storage.UserRepository.FindByName(ctx, username)
+	if errors.Is(err, db.ErrNotFound) {
+		return models.UserDTO{}, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return models.UserDTO{}, status.Error(codes.Internal, err.Error())
+	}
+	return user, nil
+}
+
+// ListUsers lists all users ordered by username.
+func (m *UserManager) ListUsers(ctx context.Context) ([]models.UserDTO, error) {
+	users, err := m.storage.UserRepository.ListUsers(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return users, nil
+}
+
+// SetDisabled disables the user or enables it again. Disabling ends all of the user's sessions.
+// It returns the number of sessions ended; by is recorded in the security log as who made the change.
+func (m *UserManager) SetDisabled(ctx context.Context, user models.UserDTO, disabled bool, by string) (int64, error) {
+	if err := m.storage.UserRepository.SetDisabled(ctx, user.ID, disabled); err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+	if !disabled {
+		m.recordEvent(ctx, user.ID, models.EventUserEnabled, "by "+by)
+		return 0, nil
+	}
+	revoked, err := m.storage.SessionRepository.RevokeOthers(ctx, user.ID, "")
+	if err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+	m.recordEvent(ctx, user.ID, models.EventUserDisabled, "by "+by)
+	return revoked, nil
+}
+
+// SetRole changes the role of the user and ends the user's sessions, since their tokens carry the old
+// role. It returns the number of sessions ended and does nothing if the user has the role already.
+func (m *UserManager) SetRole(ctx context.Context, user models.UserDTO, role string, by string) (int64, error) {
+	if err := checkRole(role); err != nil {
+		return 0, err
+	}
+	if user.Role == role {
+		return 0, nil
+	}
+	if err := m.storage.UserRepository.SetRole(ctx, user.ID, role); err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+	revoked, err := m.storage.SessionRepository.RevokeOthers(ctx, user.ID, "")
+	if err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+	m.recordEvent(ctx, user.ID, models.EventRoleChanged, fmt.Sprintf("%s to %s by %s", user.Role, role, by))
+	return revoked, nil
+}
+
+func (m *UserManager) recordEvent(ctx context.Context, userID string, kind string, detail string) {
+	err := m.storage.SecurityEventRepository.RecordEvent(ctx, models.SecurityEvent{
+		UserID: userID, Kind: kind, Detail: detail,
+	})
+	if err != nil {
+		m.logger.Error("failed to record a security event", zap.Error(err))
+	}
+}
+
+func checkRole(role string) error {
+	if !security.ValidRole(role) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("unknown role %q, use %s or %s",
+			role, models.RoleUser, models.RoleAdmin))
+	}
+	return nil
+}
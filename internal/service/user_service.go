@@ -4,12 +4,14 @@ import (
 	"GophKeeper/internal/models"
 	"GophKeeper/internal/security"
 	db "GophKeeper/internal/storage"
-	"GophKeeper/utils"
 	"context"
-	"github.com/jackc/pgerrcode"
+	"errors"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"net/mail"
+	"strings"
 )
 
 // UserServiceServer is the server that provides user services
@@ -24,17 +26,31 @@ func NewUserServiceServer(storage *db.Storage, logger *zap.Logger) *UserServiceS
 
 // CreateUsr handles creating a new user
 func (s *UserServiceServer) CreateUsr(ctx context.Context, name string, pass string, email string) (*models.UserDTO, error) {
+	return s.createUser(name, pass, email, func(hash string) (uuid.UUID, error) {
+		return s.storage.UserRepository.SaveUser(ctx, name, hash, email)
+	})
+}
+
+// createUser checks the new user's details and saves the user with save, which is given the password hash.
+func (s *UserServiceServer) createUser(name string, pass string, email string,
+	save func(hash string) (uuid.UUID, error)) (*models.UserDTO, error) {
 	if name == "" || email == "" || pass == "" {
 		return nil, status.Error(codes.InvalidArgument, "please provide username, email and password")
 	}
+	// logins with an @ are emails
+	if strings.Contains(name, "@") {
+		return nil, status.Error(codes.InvalidArgument, "username must not contain @")
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return nil, status.Error(codes.InvalidArgument, "invalid email address")
+	}
 	password, err := security.EncodePass(pass)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "something went wrong")
 	}
-	userID, err := s.storage.UserRepository.SaveUser(ctx, name, string(password), email)
+	userID, err := save(string(password))
 	if err != nil {
-		code := utils.ErrorCode(err)
-		if code == pgerrcode.UniqueViolation {
+		if errors.Is(err, db.ErrAlreadyExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
 		return nil, status.Error(codes.Internal, "something went wrong")
@@ -42,5 +58,6 @@ func (s *UserServiceServer) CreateUsr(ctx context.Context, name string, pass str
 	return &models.UserDTO{
 		ID:       userID.String(),
 		Username: name,
+		Email:    email,
 	}, nil
 }
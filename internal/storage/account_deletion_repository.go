@@ -0,0 +1,115 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+)
+
+const accountDeletionColumns = `user_id, requested_at, object_versions, bytes_deleted, rows_deleted, completed_at`
+
+// userRowQueries delete the rows owned by a user, in an order that satisfies the foreign keys.
+// The user itself is deleted last.
+var userRowQueries = []string{
+	`DELETE FROM recoverycodes WHERE user_id = $1`,
+	`DELETE FROM totpsecrets WHERE user_id = $1`,
+	`DELETE FROM sessions WHERE user_id = $1`,
+	`DELETE FROM revokedtokens WHERE user_id = $1`,
+	`DELETE FROM conflicts WHERE user_id = $1`,
+	`DELETE FROM changes WHERE user_id = $1`,
+	`DELETE FROM userrevisions WHERE user_id = $1`,
+	`DELETE FROM userscredinfo WHERE user_id = $1`,
+	`DELETE FROM trash WHERE user_id = $1`,
+	`DELETE FROM sharelinks WHERE user_id = $1`,
+	`DELETE FROM files WHERE owner_id = $1`,
+	`DELETE FROM securityevents WHERE user_id = $1::text`,
+	`DELETE FROM emailtokens WHERE user_id = $1`,
+	`DELETE FROM users WHERE id = $1`,
+}
+
+// PgAccountDeletionRepository represents a repository for account deletions.
+type PgAccountDeletionRepository struct {
+	postgres *Postgres
+}
+
+func NewAccountDeletionRepository(postgres *Postgres) *PgAccountDeletionRepository {
+	return &PgAccountDeletionRepository{
+		postgres: postgres,
+	}
+}
+
+func (r *PgAccountDeletionRepository) StartDeletion(ctx context.Context, userID string) (models.AccountDeletion, error) {
+	query := `INSERT INTO accountdeletions(user_id) VALUES($1) ON CONFLICT (user_id) DO NOTHING`
+	if _, err := r.postgres.connPool.Exec(ctx, query, userID); err != nil {
+		return models.AccountDeletion{}, mapError(err)
+	}
+	return r.FindDeletion(ctx, userID)
+}
+
+func (r *PgAccountDeletionRepository) FindDeletion(ctx context.Context, userID string) (models.AccountDeletion, error) {
+	query := `SELECT ` + accountDeletionColumns + ` FROM accountdeletions WHERE user_id = $1`
+	row, err := r.postgres.connPool.Query(ctx, query, userID)
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	deletion, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.AccountDeletion])
+	return deletion, mapError(err)
+}
+
+func (r *PgAccountDeletionRepository) FindPending(ctx context.Context, limit int) ([]models.AccountDeletion, error) {
+	query := `SELECT ` + accountDeletionColumns + ` FROM accountdeletions
+		WHERE completed_at IS NULL ORDER BY requested_at LIMIT $1`
+	rows, err := r.postgres.connPool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.AccountDeletion])
+}
+
+func (r *PgAccountDeletionRepository) AddPurgedObjects(ctx context.Context, userID string, versions int64,
+	bytes int64) error {
+	query := `UPDATE accountdeletions SET object_versions = object_versions + @versions,
+		bytes_deleted = bytes_deleted + @bytes WHERE user_id = @user_id`
+	args := pgx.NamedArgs{
+		"user_id":  userID,
+		"versions": versions,
+		"bytes":    bytes,
+	}
+	_, err := r.postgres.connPool.Exec(ctx, query, args)
+	return err
+}
+
+func (r *PgAccountDeletionRepository) PurgeUser(ctx context.Context, userID string) (models.AccountDeletion, error) {
+	tx, err := r.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	defer tx.Rollback(ctx)
+	// locks the deletion, so a concurrent purge of the same user waits and then finds it completed
+	tag, err := tx.Exec(ctx, `UPDATE accountdeletions SET completed_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND completed_at IS NULL`, userID)
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.AccountDeletion{}, ErrNotFound
+	}
+	var deleted int64
+	for _, query := range userRowQueries {
+		tag, err := tx.Exec(ctx, query, userID)
+		if err != nil {
+			return models.AccountDeletion{}, err
+		}
+		deleted += tag.RowsAffected()
+	}
+	row, err := tx.Query(ctx, `UPDATE accountdeletions SET rows_deleted = $2 WHERE user_id = $1
+		RETURNING `+accountDeletionColumns, userID, deleted)
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	deletion, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.AccountDeletion])
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	return deletion, tx.Commit(ctx)
+}
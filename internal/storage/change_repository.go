@@ -0,0 +1,159 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Kinds of items tracked by the sync protocol. They match the kinds of the trash bin.
+const (
+	ChangeKindFile        = TrashKindFile
+	ChangeKindCredentials = TrashKindCredentials
+)
+
+// changesChannel is the Postgres notification channel carrying recorded changes to all replicas.
+const changesChannel = "gkeeper_changes"
+
+const changeColumns = `user_id, revision, kind, name, deleted, version_id, changed_at`
+
+// PgChangeRepository represents a repository for the sync revisions of users' items.
+type PgChangeRepository struct {
+	postgres *Postgres
+}
+
+func NewChangeRepository(postgres *Postgres) *PgChangeRepository {
+	return &PgChangeRepository{
+		postgres: postgres,
+	}
+}
+
+// RecordChange bumps the user's revision and stamps the change of the item with it.
+// Only the latest change of every item is kept. The row lock on the counter serializes
+// concurrent changes of the same user, so revisions never repeat and notifications, which
+// Postgres sends on commit, arrive in revision order.
+func (r *PgChangeRepository) RecordChange(ctx context.Context, change models.Change) (models.Change, error) {
+	tx, err := r.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return models.Change{}, err
+	}
+	defer tx.Rollback(ctx)
+	change, err = recordChange(ctx, tx, change)
+	if err != nil {
+		return models.Change{}, err
+	}
+	return change, tx.Commit(ctx)
+}
+
+// recordChange records the change within tx, so it commits together with the write it stamps.
+func recordChange(ctx context.Context, tx pgx.Tx, change models.Change) (models.Change, error) {
+	err := tx.QueryRow(ctx,
+		`INSERT INTO userrevisions(user_id, revision) VALUES($1, 1)
+		 ON CONFLICT (user_id) DO UPDATE SET revision = userrevisions.revision + 1 RETURNING revision`,
+		change.UserID).Scan(&change.Revision)
+	if err != nil {
+		return models.Change{}, err
+	}
+	query := `INSERT INTO changes(user_id, kind, name, revision, deleted, version_id) VALUES(@user_id, @kind, @name, @revision, @deleted, @version_id)
+		ON CONFLICT (user_id, kind, name) DO UPDATE
+		SET revision = EXCLUDED.revision, deleted = EXCLUDED.deleted, version_id = EXCLUDED.version_id, changed_at = CURRENT_TIMESTAMP
+		RETURNING ` + changeColumns
+	args := pgx.NamedArgs{
+		"user_id":    change.UserID,
+		"kind":       change.Kind,
+		"name":       change.Name,
+		"revision":   change.Revision,
+		"deleted":    change.Deleted,
+		"version_id": change.VersionID,
+	}
+	row, err := tx.Query(ctx, query, args)
+	if err != nil {
+		return models.Change{}, err
+	}
+	change, err = pgx.CollectOneRow(row, pgx.RowToStructByPos[models.Change])
+	if err != nil {
+		return models.Change{}, err
+	}
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return models.Change{}, err
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, changesChannel, string(payload)); err != nil {
+		return models.Change{}, err
+	}
+	return change, nil
+}
+
+// FindChanges returns up to limit of the user's items changed after the given revision, oldest first.
+func (r *PgChangeRepository) FindChanges(ctx context.Context, userID string, since int64, limit int) ([]models.Change, error) {
+	query := `SELECT ` + changeColumns + ` FROM changes WHERE user_id = $1 AND revision > $2 ORDER BY revision LIMIT $3`
+	rows, err := r.postgres.connPool.Query(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.Change])
+}
+
+// PgChangeFeed listens to the changes recorded by every server connected to the database.
+type PgChangeFeed struct {
+	postgres *Postgres
+}
+
+func NewChangeFeed(postgres *Postgres) *PgChangeFeed {
+	return &PgChangeFeed{
+		postgres: postgres,
+	}
+}
+
+// Listen keeps a dedicated connection listening to the changes channel and reconnects when it is lost.
+func (f *PgChangeFeed) Listen(ctx context.Context, handler func(models.Change), onGap func()) error {
+	connected := false
+	for {
+		err := f.listen(ctx, handler, func() {
+			// notifications sent while no connection was listening are lost
+			if connected {
+				onGap()
+			}
+			connected = true
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		f.postgres.log.Error("change feed connection lost", zap.Error(err))
+		onGap()
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (f *PgChangeFeed) listen(ctx context.Context, handler func(models.Change), onListening func()) error {
+	conn, err := f.postgres.connPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// the connection keeps listening, so it must not go back to the pool
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+	if _, err := pgConn.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+		return err
+	}
+	onListening()
+	for {
+		notification, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var change models.Change
+		if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+			f.postgres.log.Error("malformed change notification", zap.String("payload", notification.Payload), zap.Error(err))
+			continue
+		}
+		handler(change)
+	}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+)
+
+const conflictColumns = `id, user_id, name, base_version, remote_version, data, type, created_at, resolved_at, resolution`
+
+// PgConflictRepository represents a repository for credentials saves rejected because of a stale base version.
+type PgConflictRepository struct {
+	postgres *Postgres
+}
+
+func NewConflictRepository(postgres *Postgres) *PgConflictRepository {
+	return &PgConflictRepository{
+		postgres: postgres,
+	}
+}
+
+// SaveConflict stores the rejected save and returns it with the generated ID.
+func (r *PgConflictRepository) SaveConflict(ctx context.Context, conflict models.Conflict) (models.Conflict, error) {
+	query := `INSERT INTO conflicts(user_id, name, base_version, remote_version, data, type)
+		VALUES(@user_id, @name, @base_version, @remote_version, @data, @type) RETURNING ` + conflictColumns
+	args := pgx.NamedArgs{
+		"user_id":        conflict.UserID,
+		"name":           conflict.Name,
+		"base_version":   conflict.BaseVersion,
+		"remote_version": conflict.RemoteVersion,
+		"data":           conflict.Data,
+		"type":           conflict.DataType,
+	}
+	row, err := r.postgres.connPool.Query(ctx, query, args)
+	if err != nil {
+		return models.Conflict{}, err
+	}
+	return pgx.CollectOneRow(row, pgx.RowToStructByPos[models.Conflict])
+}
+
+// FindOpenByUser returns the user's unresolved conflicts, oldest first.
+func (r *PgConflictRepository) FindOpenByUser(ctx context.Context, userID string) ([]models.Conflict, error) {
+	query := `SELECT ` + conflictColumns + ` FROM conflicts WHERE user_id = $1 AND resolved_at IS NULL ORDER BY created_at`
+	rows, err := r.postgres.connPool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.Conflict])
+}
+
+// FindByID returns the user's conflict with the given ID.
+func (r *PgConflictRepository) FindByID(ctx context.Context, userID string, conflictID string) (models.Conflict, error) {
+	query := `SELECT ` + conflictColumns + ` FROM conflicts WHERE id = $1 AND user_id = $2`
+	row, err := r.postgres.connPool.Query(ctx, query, conflictID, userID)
+	if err != nil {
+		return models.Conflict{}, err
+	}
+	conflict, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.Conflict])
+	return conflict, mapError(err)
+}
+
+// Resolve marks the conflict as resolved. It returns ErrNotFound if it is already resolved.
+func (r *PgConflictRepository) Resolve(ctx context.Context, conflictID string, resolution string) error {
+	tag, err := r.postgres.connPool.Exec(ctx,
+		`UPDATE conflicts SET resolved_at = CURRENT_TIMESTAMP, resolution = $2 WHERE id = $1 AND resolved_at IS NULL`,
+		conflictID, resolution)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Reopen marks the conflict as open again.
+func (r *PgConflictRepository) Reopen(ctx context.Context, conflictID string) error {
+	_, err := r.postgres.connPool.Exec(ctx,
+		`UPDATE conflicts SET resolved_at = NULL, resolution = '' WHERE id = $1`, conflictID)
+	return err
+}
@@ -3,7 +3,6 @@ package db
 import (
 	"GophKeeper/internal/models"
 	"context"
-	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
@@ -14,30 +13,104 @@ const (
 	Credentials
 )
 
-// CredRepository represents a repository for managing user data.
-type CredRepository struct {
+// PgCredRepository represents a repository for managing user data.
+type PgCredRepository struct {
 	postgres *Postgres
 }
 
-func NewCredRepository(postgres *Postgres) *CredRepository {
-	return &CredRepository{
+func NewCredRepository(postgres *Postgres) *PgCredRepository {
+	return &PgCredRepository{
 		postgres: postgres,
 	}
 }
 
-func (u *CredRepository) SaveUserCreds(ctx context.Context, credName string, userID string, data string, dataType DataType) (uuid.UUID, error) {
-	var lastInsertID uuid.UUID
-	err := u.postgres.connPool.QueryRow(
-		ctx, "INSERT INTO userscredinfo(user_id, name, data, type) VALUES($1, $2, $3, $4) RETURNING id", userID, credName, data, dataType).Scan(&lastInsertID)
+// SaveUserCreds saves a new version of the credentials unconditionally. It takes the same advisory lock
+// as SaveUserCredsAt, so a checked save never races with an unchecked one.
+func (u *PgCredRepository) SaveUserCreds(ctx context.Context, credName string, userID string, data string, dataType DataType) (int64, models.Change, error) {
+	tx, err := u.postgres.connPool.Begin(ctx)
 	if err != nil {
-		return lastInsertID, err
+		return 0, models.Change{}, err
 	}
-	return lastInsertID, nil
+	defer tx.Rollback(ctx)
+	if err := lockCreds(ctx, tx, userID, credName); err != nil {
+		return 0, models.Change{}, err
+	}
+	version, change, err := insertCreds(ctx, tx, credName, userID, data, dataType)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	return version, change, tx.Commit(ctx)
+}
+
+// SaveUserCredsAt saves a new version of the credentials unless someone saved another version after baseVersion.
+// Concurrent saves of the same credentials are serialized with an advisory lock, as there may be no row to lock yet.
+func (u *PgCredRepository) SaveUserCredsAt(ctx context.Context, credName string, userID string, data string, dataType DataType,
+	baseVersion int64) (int64, models.Change, error) {
+	tx, err := u.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	defer tx.Rollback(ctx)
+	if err := lockCreds(ctx, tx, userID, credName); err != nil {
+		return 0, models.Change{}, err
+	}
+	var latest int64
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM userscredinfo WHERE user_id = $1 AND name = $2 AND trash_id IS NULL`,
+		userID, credName).Scan(&latest)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	if latest != baseVersion {
+		return 0, models.Change{}, ErrConflict
+	}
+	version, change, err := insertCreds(ctx, tx, credName, userID, data, dataType)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	return version, change, tx.Commit(ctx)
+}
+
+// lockCreds serializes saves of the same credentials until tx ends.
+func lockCreds(ctx context.Context, tx pgx.Tx, userID string, credName string) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1 || '/' || $2))`, userID, credName)
+	return err
+}
+
+// insertCreds adds a new version of the credentials and records its change within tx.
+func insertCreds(ctx context.Context, tx pgx.Tx, credName string, userID string, data string, dataType DataType) (int64, models.Change, error) {
+	var version int64
+	err := tx.QueryRow(ctx, "INSERT INTO userscredinfo(user_id, name, data, type) VALUES($1, $2, $3, $4) RETURNING version",
+		userID, credName, data, dataType).Scan(&version)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	change, err := recordChange(ctx, tx, models.Change{UserID: userID, Kind: ChangeKindCredentials, Name: credName})
+	return version, change, err
+}
+
+// GetUserCredsVersion retrieves the given version of the user's credentials, including trashed ones.
+func (u *PgCredRepository) GetUserCredsVersion(ctx context.Context, userID string, credName string, version int64) (models.UserCredentials, error) {
+	query := `SELECT name, data, type, version, created_at FROM userscredinfo WHERE user_id = @user_id AND name = @name AND version = @version`
+	args := pgx.NamedArgs{
+		"user_id": userID,
+		"name":    credName,
+		"version": version,
+	}
+	row, err := u.postgres.connPool.Query(ctx, query, args)
+	if err != nil {
+		return models.UserCredentials{}, err
+	}
+	data, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.UserCredentials])
+	if err != nil {
+		return data, mapError(err)
+	}
+	return data, nil
 }
 
 // GetLastUserCreds retrieves the most recent set of user credentials for the given user ID from the database.
-func (u *CredRepository) GetLastUserCreds(ctx context.Context, userID string, credName string) (models.UserCredentials, error) {
-	query := `SELECT name, user_id, data, type, version, created_at FROM userscredinfo WHERE user_id = @user_id AND name = @name ORDER BY created_at DESC LIMIT 1;`
+func (u *PgCredRepository) GetLastUserCreds(ctx context.Context, userID string, credName string) (models.UserCredentials, error) {
+	query := `SELECT name, data, type, version, created_at FROM userscredinfo WHERE user_id = @user_id AND name = @name AND trash_id IS NULL ORDER BY version DESC LIMIT 1;`
 	args := pgx.NamedArgs{
 		"user_id": userID,
 		"name":    credName,
@@ -49,14 +122,14 @@ func (u *CredRepository) GetLastUserCreds(ctx context.Context, userID string, cr
 	}
 	data, err = pgx.CollectOneRow(row, pgx.RowToStructByPos[models.UserCredentials])
 	if err != nil {
-		return data, err
+		return data, mapError(err)
 	}
 	return data, nil
 }
 
 // FindAll retrieves all user credentials from the database and returns them as a slice of UserCredentials.
-func (u *CredRepository) FindAll(ctx context.Context, userID string) ([]models.UserCredentials, error) {
-	query := `SELECT name, data, type, version, created_at FROM userscredinfo WHERE user_id = $1 ORDER BY version DESC;`
+func (u *PgCredRepository) FindAll(ctx context.Context, userID string) ([]models.UserCredentials, error) {
+	query := `SELECT name, data, type, version, created_at FROM userscredinfo WHERE user_id = $1 AND trash_id IS NULL ORDER BY version DESC;`
 	rows, err := u.postgres.connPool.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pressly/goose/v3"
 	"go.uber.org/zap"
 )
 
@@ -13,7 +15,7 @@ var (
 	// pgInstance is a pointer to a Postgres struct variable used for storing the initialized instance of the Postgres database connection pool and logger.
 	pgInstance *Postgres
 
-	// pgOnce is a sync.Once variable used for lazy initialization of the pgInstance variable in the New function.
+	// pgOnce is a sync.Once variable used for lazy initialization of the pgInstance variable in the Connect function.
 	pgOnce sync.Once
 )
 
@@ -26,17 +28,45 @@ type Postgres struct {
 
 // Storage Implementation omitted for brevity
 type Storage struct {
-	UserRepository     *UserRepository
-	SettingsRepository *SettingsRepository
-	CredRepository     *CredRepository
+	UserRepository            UserRepository
+	SettingsRepository        SettingsRepository
+	CredRepository            CredRepository
+	ShareLinkRepository       ShareLinkRepository
+	TrashRepository           TrashRepository
+	ChangeRepository          ChangeRepository
+	ConflictRepository        ConflictRepository
+	RevokedTokenRepository    RevokedTokenRepository
+	SessionRepository         SessionRepository
+	TOTPRepository            TOTPRepository
+	LoginAttemptRepository    LoginAttemptRepository
+	SecurityEventRepository   SecurityEventRepository
+	AccountDeletionRepository AccountDeletionRepository
+	EmailTokenRepository      EmailTokenRepository
+	// ChangeFeed is nil when changes are not shared with other server replicas.
+	ChangeFeed ChangeFeed
 }
 
-// NewStorage creates a new instance of Storage by accepting an implementation of UserRepository and ShortenRepository.
-func NewStorage(userRepo *UserRepository, settingsRepo *SettingsRepository, credRepo *CredRepository) *Storage {
+// NewStorage creates a new instance of Storage from the implementations of the repositories.
+func NewStorage(userRepo UserRepository, settingsRepo SettingsRepository, credRepo CredRepository,
+	shareLinkRepo ShareLinkRepository, trashRepo TrashRepository, changeRepo ChangeRepository,
+	conflictRepo ConflictRepository, revokedTokenRepo RevokedTokenRepository, sessionRepo SessionRepository,
+	totpRepo TOTPRepository, loginAttemptRepo LoginAttemptRepository, securityEventRepo SecurityEventRepository,
+	accountDeletionRepo AccountDeletionRepository, emailTokenRepo EmailTokenRepository) *Storage {
 	return &Storage{
-		UserRepository:     userRepo,
-		SettingsRepository: settingsRepo,
-		CredRepository:     credRepo,
+		UserRepository:            userRepo,
+		SettingsRepository:        settingsRepo,
+		CredRepository:            credRepo,
+		ShareLinkRepository:       shareLinkRepo,
+		TrashRepository:           trashRepo,
+		ChangeRepository:          changeRepo,
+		ConflictRepository:        conflictRepo,
+		RevokedTokenRepository:    revokedTokenRepo,
+		SessionRepository:         sessionRepo,
+		TOTPRepository:            totpRepo,
+		LoginAttemptRepository:    loginAttemptRepo,
+		SecurityEventRepository:   securityEventRepo,
+		AccountDeletionRepository: accountDeletionRepo,
+		EmailTokenRepository:      emailTokenRepo,
 	}
 }
 
@@ -52,19 +82,26 @@ func (pg *Postgres) Ping(ctx context.Context) error {
 	return pg.connPool.Ping(ctx)
 }
 
-// New creates a new instance of Postgres by accepting a context, logger, and storage configuration.
-func New(ctx context.Context, log *zap.Logger, connStr string) (*Postgres, error) {
+// Connect creates the pool of connections to the database without touching the schema.
+func Connect(ctx context.Context, log *zap.Logger, connStr string) (*Postgres, error) {
 	log.Info("creating pool of conn to db...", zap.String("connString", connStr))
+	var err error
 	pgOnce.Do(func() {
-		db, err := pgxpool.New(ctx, connStr)
+		var db *pgxpool.Pool
+		db, err = pgxpool.New(ctx, connStr)
 		if err != nil {
 			log.Error(err.Error())
+			return
 		}
 		pgInstance = &Postgres{db, log}
 	})
-	err := StartMigration(pgInstance.connPool)
-	if err != nil {
-		return nil, err
+	if pgInstance == nil {
+		return nil, errors.Join(errors.New("no connection pool to the database"), err)
 	}
 	return pgInstance, nil
 }
+
+// Migrator returns the provider of the migrations of the database.
+func (pg *Postgres) Migrator() (*goose.Provider, error) {
+	return NewMigrator(pg.connPool)
+}
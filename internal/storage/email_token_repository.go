@@ -0,0 +1,58 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const emailTokenColumns = `user_id, purpose, token_hash, created_at, expires_at`
+
+// PgEmailTokenRepository represents a repository for the tokens sent by email.
+type PgEmailTokenRepository struct {
+	postgres *Postgres
+}
+
+func NewEmailTokenRepository(postgres *Postgres) *PgEmailTokenRepository {
+	return &PgEmailTokenRepository{
+		postgres: postgres,
+	}
+}
+
+func (r *PgEmailTokenRepository) SaveToken(ctx context.Context, token models.EmailToken) error {
+	query := `INSERT INTO emailtokens(user_id, purpose, token_hash, created_at, expires_at)
+		VALUES(@user_id, @purpose, @token_hash, CURRENT_TIMESTAMP, @expires_at)
+		ON CONFLICT (user_id, purpose) DO UPDATE SET token_hash = EXCLUDED.token_hash,
+			created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at`
+	args := pgx.NamedArgs{
+		"user_id":    token.UserID,
+		"purpose":    token.Purpose,
+		"token_hash": token.TokenHash,
+		"expires_at": token.ExpiresAt,
+	}
+	_, err := r.postgres.connPool.Exec(ctx, query, args)
+	return mapError(err)
+}
+
+func (r *PgEmailTokenRepository) FindToken(ctx context.Context, userID string, purpose string) (models.EmailToken, error) {
+	query := `SELECT ` + emailTokenColumns + ` FROM emailtokens WHERE user_id = $1 AND purpose = $2`
+	row, err := r.postgres.connPool.Query(ctx, query, userID, purpose)
+	if err != nil {
+		return models.EmailToken{}, err
+	}
+	token, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.EmailToken])
+	return token, mapError(err)
+}
+
+func (r *PgEmailTokenRepository) UseToken(ctx context.Context, tokenHash string, purpose string,
+	now time.Time) (models.EmailToken, error) {
+	query := `DELETE FROM emailtokens WHERE token_hash = $1 AND purpose = $2 AND expires_at > $3
+		RETURNING ` + emailTokenColumns
+	row, err := r.postgres.connPool.Query(ctx, query, tokenHash, purpose, now)
+	if err != nil {
+		return models.EmailToken{}, err
+	}
+	token, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.EmailToken])
+	return token, mapError(err)
+}
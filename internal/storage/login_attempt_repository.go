@@ -0,0 +1,59 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const loginAttemptColumns = `key, failures, last_failure_at, locked_until`
+
+// PgLoginAttemptRepository represents a repository for counting failed logins.
+type PgLoginAttemptRepository struct {
+	postgres *Postgres
+}
+
+func NewLoginAttemptRepository(postgres *Postgres) *PgLoginAttemptRepository {
+	return &PgLoginAttemptRepository{
+		postgres: postgres,
+	}
+}
+
+func (r *PgLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at time.Time,
+	window time.Duration) (models.LoginAttempt, error) {
+	query := `INSERT INTO loginattempts(key, failures, last_failure_at) VALUES(@key, 1, @at)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN loginattempts.last_failure_at < @since THEN 1 ELSE loginattempts.failures + 1 END,
+			last_failure_at = @at
+		RETURNING ` + loginAttemptColumns
+	args := pgx.NamedArgs{
+		"key":   key,
+		"at":    at,
+		"since": at.Add(-window),
+	}
+	row, err := r.postgres.connPool.Query(ctx, query, args)
+	if err != nil {
+		return models.LoginAttempt{}, err
+	}
+	return pgx.CollectOneRow(row, pgx.RowToStructByPos[models.LoginAttempt])
+}
+
+func (r *PgLoginAttemptRepository) FindAttempt(ctx context.Context, key string) (models.LoginAttempt, error) {
+	row, err := r.postgres.connPool.Query(ctx, `SELECT `+loginAttemptColumns+` FROM loginattempts WHERE key = $1`, key)
+	if err != nil {
+		return models.LoginAttempt{}, err
+	}
+	attempt, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.LoginAttempt])
+	return attempt, mapError(err)
+}
+
+func (r *PgLoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.postgres.connPool.Exec(ctx, `UPDATE loginattempts SET locked_until = $2 WHERE key = $1`, key, until)
+	return err
+}
+
+func (r *PgLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.postgres.connPool.Exec(ctx, `DELETE FROM loginattempts WHERE key = $1`, key)
+	return err
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"sort"
+)
+
+// AccountDeletionRepository is an in-memory db.AccountDeletionRepository.
+type AccountDeletionRepository struct {
+	state *state
+}
+
+func (r *AccountDeletionRepository) StartDeletion(_ context.Context, userID string) (models.AccountDeletion, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	deletion, ok := r.state.deletions[userID]
+	if !ok {
+		deletion = models.AccountDeletion{UserID: userID, RequestedAt: now()}
+		r.state.deletions[userID] = deletion
+	}
+	return deletion, nil
+}
+
+func (r *AccountDeletionRepository) FindDeletion(_ context.Context, userID string) (models.AccountDeletion, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	deletion, ok := r.state.deletions[userID]
+	if !ok {
+		return models.AccountDeletion{}, db.ErrNotFound
+	}
+	return deletion, nil
+}
+
+func (r *AccountDeletionRepository) FindPending(_ context.Context, limit int) ([]models.AccountDeletion, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var deletions []models.AccountDeletion
+	for _, deletion := range r.state.deletions {
+		if deletion.CompletedAt == nil {
+			deletions = append(deletions, deletion)
+		}
+	}
+	sort.Slice(deletions, func(i, j int) bool {
+		return deletions[i].RequestedAt.Before(deletions[j].RequestedAt)
+	})
+	if len(deletions) > limit {
+		deletions = deletions[:limit]
+	}
+	return deletions, nil
+}
+
+func (r *AccountDeletionRepository) AddPurgedObjects(_ context.Context, userID string, versions int64,
+	bytes int64) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	if deletion, ok := r.state.deletions[userID]; ok {
+		deletion.ObjectVersions += versions
+		deletion.BytesDeleted += bytes
+		r.state.deletions[userID] = deletion
+	}
+	return nil
+}
+
+func (r *AccountDeletionRepository) PurgeUser(_ context.Context, userID string) (models.AccountDeletion, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	deletion, ok := r.state.deletions[userID]
+	if !ok || deletion.CompletedAt != nil {
+		return models.AccountDeletion{}, db.ErrNotFound
+	}
+	st := r.state
+	var deleted, n int64
+	st.recoveryCodes, n = removeWhere(st.recoveryCodes, func(c recoveryCode) bool { return c.userID == userID })
+	deleted += n
+	if _, ok := st.totp[userID]; ok {
+		delete(st.totp, userID)
+		deleted++
+	}
+	st.sessions, n = removeWhere(st.sessions, func(s models.Session) bool { return s.UserID == userID })
+	deleted += n
+	for id, token := range st.revoked {
+		if token.userID == userID {
+			delete(st.revoked, id)
+			deleted++
+		}
+	}
+	st.conflicts, n = removeWhere(st.conflicts, func(c models.Conflict) bool { return c.UserID == userID })
+	deleted += n
+	for key := range st.changes {
+		if key.userID == userID {
+			delete(st.changes, key)
+			deleted++
+		}
+	}
+	if _, ok := st.revisions[userID]; ok {
+		delete(st.revisions, userID)
+		deleted++
+	}
+	st.creds, n = removeWhere(st.creds, func(c credRow) bool { return c.userID == userID })
+	deleted += n
+	st.trash, n = removeWhere(st.trash, func(t models.TrashItem) bool { return t.UserID == userID })
+	deleted += n
+	st.shareLinks, n = removeWhere(st.shareLinks, func(l models.ShareLink) bool { return l.UserID == userID })
+	deleted += n
+	st.securityEvents, n = removeWhere(st.securityEvents, func(e models.SecurityEvent) bool { return e.UserID == userID })
+	deleted += n
+	for key := range st.emailTokens {
+		if key.userID == userID {
+			delete(st.emailTokens, key)
+			deleted++
+		}
+	}
+	st.users, n = removeWhere(st.users, func(u models.UserDTO) bool { return u.ID == userID })
+	deleted += n
+	completedAt := now()
+	deletion.CompletedAt = &completedAt
+	deletion.RowsDeleted = deleted
+	st.deletions[userID] = deletion
+	return deletion, nil
+}
+
+// removeWhere drops the rows matching the predicate and returns the rest and the number dropped.
+func removeWhere[T any](rows []T, match func(T) bool) ([]T, int64) {
+	kept := rows[:0]
+	for _, row := range rows {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+	return kept, int64(len(rows) - len(kept))
+}
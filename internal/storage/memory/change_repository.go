@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"sort"
+)
+
+type changeKey struct {
+	userID string
+	kind   string
+	name   string
+}
+
+// ChangeRepository is an in-memory db.ChangeRepository.
+type ChangeRepository struct {
+	state *state
+}
+
+func (r *ChangeRepository) RecordChange(_ context.Context, change models.Change) (models.Change, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	return r.state.recordChange(change), nil
+}
+
+// recordChange bumps the user's revision and stamps the change with it. The caller holds the lock.
+func (s *state) recordChange(change models.Change) models.Change {
+	s.revisions[change.UserID]++
+	change.Revision = s.revisions[change.UserID]
+	change.ChangedAt = now()
+	s.changes[changeKey{userID: change.UserID, kind: change.Kind, name: change.Name}] = change
+	return change
+}
+
+func (r *ChangeRepository) FindChanges(_ context.Context, userID string, since int64, limit int) ([]models.Change, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var changes []models.Change
+	for key, change := range r.state.changes {
+		if key.userID == userID && change.Revision > since {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Revision < changes[j].Revision
+	})
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"github.com/google/uuid"
+)
+
+// ConflictRepository is an in-memory db.ConflictRepository.
+type ConflictRepository struct {
+	state *state
+}
+
+func (r *ConflictRepository) SaveConflict(_ context.Context, conflict models.Conflict) (models.Conflict, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	conflict.ID = uuid.NewString()
+	conflict.CreatedAt = now()
+	conflict.ResolvedAt = nil
+	conflict.Resolution = ""
+	r.state.conflicts = append(r.state.conflicts, conflict)
+	return conflict, nil
+}
+
+func (r *ConflictRepository) FindOpenByUser(_ context.Context, userID string) ([]models.Conflict, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var conflicts []models.Conflict
+	for _, conflict := range r.state.conflicts {
+		if conflict.UserID == userID && conflict.ResolvedAt == nil {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts, nil
+}
+
+func (r *ConflictRepository) FindByID(_ context.Context, userID string, conflictID string) (models.Conflict, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, conflict := range r.state.conflicts {
+		if conflict.ID == conflictID && conflict.UserID == userID {
+			return conflict, nil
+		}
+	}
+	return models.Conflict{}, db.ErrNotFound
+}
+
+func (r *ConflictRepository) Resolve(_ context.Context, conflictID string, resolution string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, conflict := range r.state.conflicts {
+		if conflict.ID == conflictID && conflict.ResolvedAt == nil {
+			resolvedAt := now()
+			r.state.conflicts[i].ResolvedAt = &resolvedAt
+			r.state.conflicts[i].Resolution = resolution
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (r *ConflictRepository) Reopen(_ context.Context, conflictID string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, conflict := range r.state.conflicts {
+		if conflict.ID == conflictID {
+			r.state.conflicts[i].ResolvedAt = nil
+			r.state.conflicts[i].Resolution = ""
+		}
+	}
+	return nil
+}
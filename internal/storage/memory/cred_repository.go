@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"github.com/google/uuid"
+	"sort"
+	"strconv"
+)
+
+type credRow struct {
+	id      uuid.UUID
+	userID  string
+	trashID string
+	cred    models.UserCredentials
+}
+
+// CredRepository is an in-memory db.CredRepository. Like the identity column in Postgres,
+// versions grow monotonically across all credentials.
+type CredRepository struct {
+	state *state
+}
+
+func (r *CredRepository) SaveUserCreds(_ context.Context, credName string, userID string, data string, dataType db.DataType) (int64, models.Change, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	version, change := r.insert(credName, userID, data, dataType)
+	return version, change, nil
+}
+
+func (r *CredRepository) SaveUserCredsAt(_ context.Context, credName string, userID string, data string, dataType db.DataType,
+	baseVersion int64) (int64, models.Change, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	var latest int64
+	for _, row := range r.state.creds {
+		if row.userID == userID && row.cred.Name == credName && row.trashID == "" {
+			latest = max(latest, row.cred.Version)
+		}
+	}
+	if latest != baseVersion {
+		return 0, models.Change{}, db.ErrConflict
+	}
+	version, change := r.insert(credName, userID, data, dataType)
+	return version, change, nil
+}
+
+func (r *CredRepository) GetUserCredsVersion(_ context.Context, userID string, credName string, version int64) (models.UserCredentials, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, row := range r.state.creds {
+		if row.userID == userID && row.cred.Name == credName && row.cred.Version == version {
+			return row.cred, nil
+		}
+	}
+	return models.UserCredentials{}, db.ErrNotFound
+}
+
+// insert adds a new version of the credentials and records its change. The caller holds the lock.
+func (r *CredRepository) insert(credName string, userID string, data string, dataType db.DataType) (int64, models.Change) {
+	r.state.credVersion++
+	r.state.creds = append(r.state.creds, credRow{
+		id:     uuid.New(),
+		userID: userID,
+		cred: models.UserCredentials{
+			Name:      credName,
+			Data:      data,
+			DataType:  dataTypeName(dataType),
+			Version:   r.state.credVersion,
+			CreatedAt: now(),
+		},
+	})
+	return r.state.credVersion, r.state.recordChange(models.Change{UserID: userID, Kind: db.ChangeKindCredentials, Name: credName})
+}
+
+func (r *CredRepository) GetLastUserCreds(_ context.Context, userID string, credName string) (models.UserCredentials, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for i := len(r.state.creds) - 1; i >= 0; i-- {
+		row := r.state.creds[i]
+		if row.userID == userID && row.cred.Name == credName && row.trashID == "" {
+			return row.cred, nil
+		}
+	}
+	return models.UserCredentials{}, db.ErrNotFound
+}
+
+func (r *CredRepository) FindAll(_ context.Context, userID string) ([]models.UserCredentials, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var credentials []models.UserCredentials
+	for _, row := range r.state.creds {
+		if row.userID == userID && row.trashID == "" {
+			credentials = append(credentials, row.cred)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].Version > credentials[j].Version
+	})
+	return credentials, nil
+}
+
+// dataTypeName renders the data type the way the integer column is scanned into text.
+func dataTypeName(dataType db.DataType) string {
+	return strconv.Itoa(int(dataType))
+}
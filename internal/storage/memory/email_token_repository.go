@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"time"
+)
+
+type emailTokenKey struct {
+	userID  string
+	purpose string
+}
+
+// EmailTokenRepository is an in-memory db.EmailTokenRepository.
+type EmailTokenRepository struct {
+	state *state
+}
+
+func (r *EmailTokenRepository) SaveToken(_ context.Context, token models.EmailToken) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	token.CreatedAt = now()
+	r.state.emailTokens[emailTokenKey{userID: token.UserID, purpose: token.Purpose}] = token
+	return nil
+}
+
+func (r *EmailTokenRepository) FindToken(_ context.Context, userID string, purpose string) (models.EmailToken, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	token, ok := r.state.emailTokens[emailTokenKey{userID: userID, purpose: purpose}]
+	if !ok {
+		return models.EmailToken{}, db.ErrNotFound
+	}
+	return token, nil
+}
+
+func (r *EmailTokenRepository) UseToken(_ context.Context, tokenHash string, purpose string,
+	now time.Time) (models.EmailToken, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for key, token := range r.state.emailTokens {
+		if token.TokenHash == tokenHash && token.Purpose == purpose && token.ExpiresAt.After(now) {
+			delete(r.state.emailTokens, key)
+			return token, nil
+		}
+	}
+	return models.EmailToken{}, db.ErrNotFound
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"time"
+)
+
+// LoginAttemptRepository is an in-memory db.LoginAttemptRepository.
+type LoginAttemptRepository struct {
+	state *state
+}
+
+func (r *LoginAttemptRepository) RecordFailure(_ context.Context, key string, at time.Time,
+	window time.Duration) (models.LoginAttempt, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	attempt, ok := r.state.loginAttempts[key]
+	if !ok || attempt.LastFailureAt.Before(at.Add(-window)) {
+		attempt.Key, attempt.Failures = key, 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	r.state.loginAttempts[key] = attempt
+	return attempt, nil
+}
+
+func (r *LoginAttemptRepository) FindAttempt(_ context.Context, key string) (models.LoginAttempt, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	attempt, ok := r.state.loginAttempts[key]
+	if !ok {
+		return models.LoginAttempt{}, db.ErrNotFound
+	}
+	return attempt, nil
+}
+
+func (r *LoginAttemptRepository) Lock(_ context.Context, key string, until time.Time) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	if attempt, ok := r.state.loginAttempts[key]; ok {
+		attempt.LockedUntil = &until
+		r.state.loginAttempts[key] = attempt
+	}
+	return nil
+}
+
+func (r *LoginAttemptRepository) Reset(_ context.Context, key string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	delete(r.state.loginAttempts, key)
+	return nil
+}
@@ -0,0 +1,84 @@
+// Package memory provides thread-safe in-memory implementations of the storage repositories.
+// They follow the semantics of the Postgres repositories and are meant for tests and local runs.
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"sync"
+	"time"
+)
+
+var (
+	_ db.UserRepository            = (*UserRepository)(nil)
+	_ db.SettingsRepository        = (*SettingsRepository)(nil)
+	_ db.CredRepository            = (*CredRepository)(nil)
+	_ db.ShareLinkRepository       = (*ShareLinkRepository)(nil)
+	_ db.TrashRepository           = (*TrashRepository)(nil)
+	_ db.ChangeRepository          = (*ChangeRepository)(nil)
+	_ db.ConflictRepository        = (*ConflictRepository)(nil)
+	_ db.RevokedTokenRepository    = (*RevokedTokenRepository)(nil)
+	_ db.SessionRepository         = (*SessionRepository)(nil)
+	_ db.TOTPRepository            = (*TOTPRepository)(nil)
+	_ db.LoginAttemptRepository    = (*LoginAttemptRepository)(nil)
+	_ db.SecurityEventRepository   = (*SecurityEventRepository)(nil)
+	_ db.AccountDeletionRepository = (*AccountDeletionRepository)(nil)
+	_ db.EmailTokenRepository      = (*EmailTokenRepository)(nil)
+)
+
+// state holds the tables shared by the repositories of one storage, so that operations spanning
+// several tables (like moving credentials to the trash bin) stay consistent.
+type state struct {
+	mu             sync.RWMutex
+	users          []models.UserDTO
+	settings       []settingRow
+	creds          []credRow
+	credVersion    int64
+	shareLinks     []models.ShareLink
+	trash          []models.TrashItem
+	revisions      map[string]int64
+	changes        map[changeKey]models.Change
+	conflicts      []models.Conflict
+	revoked        map[string]revokedToken
+	sessions       []models.Session
+	totp           map[string]models.TOTP
+	recoveryCodes  []recoveryCode
+	loginAttempts  map[string]models.LoginAttempt
+	securityEvents []models.SecurityEvent
+	deletions      map[string]models.AccountDeletion
+	emailTokens    map[emailTokenKey]models.EmailToken
+}
+
+// now returns the current time truncated like Postgres timestamps.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// NewStorage creates a db.Storage whose repositories share a single in-memory state.
+func NewStorage() *db.Storage {
+	st := &state{
+		revisions:     make(map[string]int64),
+		changes:       make(map[changeKey]models.Change),
+		revoked:       make(map[string]revokedToken),
+		totp:          make(map[string]models.TOTP),
+		loginAttempts: make(map[string]models.LoginAttempt),
+		deletions:     make(map[string]models.AccountDeletion),
+		emailTokens:   make(map[emailTokenKey]models.EmailToken),
+	}
+	return db.NewStorage(
+		&UserRepository{state: st},
+		&SettingsRepository{state: st},
+		&CredRepository{state: st},
+		&ShareLinkRepository{state: st},
+		&TrashRepository{state: st},
+		&ChangeRepository{state: st},
+		&ConflictRepository{state: st},
+		&RevokedTokenRepository{state: st},
+		&SessionRepository{state: st},
+		&TOTPRepository{state: st},
+		&LoginAttemptRepository{state: st},
+		&SecurityEventRepository{state: st},
+		&AccountDeletionRepository{state: st},
+		&EmailTokenRepository{state: st},
+	)
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+type revokedToken struct {
+	userID    string
+	expiresAt time.Time
+}
+
+// RevokedTokenRepository is an in-memory db.RevokedTokenRepository.
+type RevokedTokenRepository struct {
+	state *state
+}
+
+func (r *RevokedTokenRepository) Revoke(_ context.Context, tokenID string, userID string, expiresAt time.Time) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	if _, ok := r.state.revoked[tokenID]; !ok {
+		r.state.revoked[tokenID] = revokedToken{userID: userID, expiresAt: expiresAt}
+	}
+	return nil
+}
+
+func (r *RevokedTokenRepository) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	_, ok := r.state.revoked[tokenID]
+	return ok, nil
+}
+
+func (r *RevokedTokenRepository) DeleteExpired(_ context.Context, now time.Time) (int64, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	var removed int64
+	for tokenID, token := range r.state.revoked {
+		if token.expiresAt.Before(now) {
+			delete(r.state.revoked, tokenID)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/google/uuid"
+)
+
+// SecurityEventRepository is an in-memory db.SecurityEventRepository.
+type SecurityEventRepository struct {
+	state *state
+}
+
+func (r *SecurityEventRepository) RecordEvent(_ context.Context, event models.SecurityEvent) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	event.ID = uuid.NewString()
+	event.CreatedAt = now()
+	r.state.securityEvents = append(r.state.securityEvents, event)
+	return nil
+}
+
+func (r *SecurityEventRepository) ListEvents(_ context.Context, userID string, limit int) ([]models.SecurityEvent, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var events []models.SecurityEvent
+	for i := len(r.state.securityEvents) - 1; i >= 0 && len(events) < limit; i-- {
+		if event := r.state.securityEvents[i]; userID == "" || event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+// SessionRepository is an in-memory db.SessionRepository.
+type SessionRepository struct {
+	state *state
+}
+
+func (r *SessionRepository) CreateSession(_ context.Context, session models.Session) (models.Session, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for _, existing := range r.state.sessions {
+		if existing.RefreshHash == session.RefreshHash {
+			return models.Session{}, db.ErrAlreadyExists
+		}
+	}
+	session.ID = uuid.NewString()
+	session.CreatedAt = now()
+	session.LastSeenAt = session.CreatedAt
+	session.PreviousHash = ""
+	session.RevokedAt = nil
+	r.state.sessions = append(r.state.sessions, session)
+	return session, nil
+}
+
+func (r *SessionRepository) FindByRefreshHash(_ context.Context, hash string) (models.Session, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, session := range r.state.sessions {
+		if session.RefreshHash == hash || session.PreviousHash == hash {
+			return session, nil
+		}
+	}
+	return models.Session{}, db.ErrNotFound
+}
+
+func (r *SessionRepository) RotateRefresh(_ context.Context, sessionID string, oldHash string, newHash string,
+	expiresAt time.Time) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, session := range r.state.sessions {
+		if session.ID == sessionID && session.RefreshHash == oldHash && session.RevokedAt == nil {
+			r.state.sessions[i].PreviousHash = oldHash
+			r.state.sessions[i].RefreshHash = newHash
+			r.state.sessions[i].ExpiresAt = expiresAt
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (r *SessionRepository) Revoke(_ context.Context, sessionID string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, session := range r.state.sessions {
+		if session.ID == sessionID && session.RevokedAt == nil {
+			revokedAt := now()
+			r.state.sessions[i].RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func (r *SessionRepository) RevokeOthers(_ context.Context, userID string, keepID string) (int64, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	var n int64
+	for i, session := range r.state.sessions {
+		if session.UserID == userID && session.ID != keepID && session.RevokedAt == nil {
+			revokedAt := now()
+			r.state.sessions[i].RevokedAt = &revokedAt
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *SessionRepository) FindByID(_ context.Context, sessionID string) (models.Session, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, session := range r.state.sessions {
+		if session.ID == sessionID {
+			return session, nil
+		}
+	}
+	return models.Session{}, db.ErrNotFound
+}
+
+func (r *SessionRepository) ListActive(_ context.Context, userID string, now time.Time) ([]models.Session, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var sessions []models.Session
+	for _, session := range r.state.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (r *SessionRepository) Touch(_ context.Context, sessionID string, ip string, at time.Time) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, session := range r.state.sessions {
+		if session.ID == sessionID {
+			r.state.sessions[i].IP = ip
+			r.state.sessions[i].LastSeenAt = at
+		}
+	}
+	return nil
+}
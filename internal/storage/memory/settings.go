@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"github.com/google/uuid"
+	"slices"
+)
+
+type settingRow struct {
+	id      uuid.UUID
+	key     string
+	value   string
+	version int
+}
+
+// SettingsRepository is an in-memory db.SettingsRepository. The latest value saved for a key wins.
+type SettingsRepository struct {
+	state *state
+}
+
+func (r *SettingsRepository) SaveSettings(_ context.Context, key string, val string) (uuid.UUID, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	id := uuid.New()
+	r.state.settings = append(r.state.settings, settingRow{id: id, key: key, value: val, version: 1})
+	return id, nil
+}
+
+func (r *SettingsRepository) FindSettingsByKey(_ context.Context, key string) (models.SettingsDTO, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for i := len(r.state.settings) - 1; i >= 0; i-- {
+		if row := r.state.settings[i]; row.key == key {
+			return models.SettingsDTO{Key: row.key, Value: row.value}, nil
+		}
+	}
+	return models.SettingsDTO{}, db.ErrNotFound
+}
+
+func (r *SettingsRepository) SaveSettingsIfAbsent(_ context.Context, key string, val string) (string, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i := len(r.state.settings) - 1; i >= 0; i-- {
+		if row := r.state.settings[i]; row.key == key {
+			return row.value, nil
+		}
+	}
+	r.state.settings = append(r.state.settings, settingRow{id: uuid.New(), key: key, value: val, version: 1})
+	return val, nil
+}
+
+func (r *SettingsRepository) PutSettings(_ context.Context, key string, val string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	r.state.settings, _ = removeWhere(r.state.settings, func(row settingRow) bool { return row.key == key })
+	r.state.settings = append(r.state.settings, settingRow{id: uuid.New(), key: key, value: val, version: 1})
+	return nil
+}
+
+func (r *SettingsRepository) DeleteSettings(_ context.Context, keys ...string) (int64, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	var deleted int64
+	r.state.settings, deleted = removeWhere(r.state.settings, func(row settingRow) bool {
+		return slices.Contains(keys, row.key)
+	})
+	return deleted, nil
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ShareLinkRepository is an in-memory db.ShareLinkRepository.
+type ShareLinkRepository struct {
+	state *state
+}
+
+func (r *ShareLinkRepository) SaveShareLink(_ context.Context, link models.ShareLink) (uuid.UUID, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for _, existing := range r.state.shareLinks {
+		if existing.TokenHash == link.TokenHash {
+			return uuid.UUID{}, db.ErrAlreadyExists
+		}
+	}
+	id := uuid.New()
+	link.ID = id.String()
+	link.Downloads = 0
+	link.RevokedAt = nil
+	link.CreatedAt = now()
+	r.state.shareLinks = append(r.state.shareLinks, link)
+	return id, nil
+}
+
+func (r *ShareLinkRepository) FindAllByUser(_ context.Context, userID string) ([]models.ShareLink, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var links []models.ShareLink
+	for i := len(r.state.shareLinks) - 1; i >= 0; i-- {
+		if link := r.state.shareLinks[i]; link.UserID == userID {
+			links = append(links, copyShareLink(link))
+		}
+	}
+	return links, nil
+}
+
+func (r *ShareLinkRepository) Revoke(_ context.Context, userID string, linkID string) (bool, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, link := range r.state.shareLinks {
+		if link.ID == linkID && link.UserID == userID && link.RevokedAt == nil {
+			revokedAt := now()
+			r.state.shareLinks[i].RevokedAt = &revokedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *ShareLinkRepository) RevokeByFile(_ context.Context, userID string, fileName string) (int64, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	var revoked int64
+	for i, link := range r.state.shareLinks {
+		if link.UserID == userID && link.FileName == fileName && link.RevokedAt == nil {
+			revokedAt := now()
+			r.state.shareLinks[i].RevokedAt = &revokedAt
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (r *ShareLinkRepository) FindActive(_ context.Context, tokenHash string) (models.ShareLink, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, link := range r.state.shareLinks {
+		if link.TokenHash == tokenHash && active(link) {
+			return copyShareLink(link), nil
+		}
+	}
+	return models.ShareLink{}, db.ErrNotFound
+}
+
+func (r *ShareLinkRepository) ConsumeDownload(_ context.Context, tokenHash string) (models.ShareLink, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, link := range r.state.shareLinks {
+		if link.TokenHash != tokenHash {
+			continue
+		}
+		if !active(link) {
+			break
+		}
+		r.state.shareLinks[i].Downloads++
+		return copyShareLink(r.state.shareLinks[i]), nil
+	}
+	return models.ShareLink{}, db.ErrNotFound
+}
+
+// active reports whether the link is not revoked, not expired and has downloads left.
+func active(link models.ShareLink) bool {
+	return link.RevokedAt == nil && link.ExpiresAt.After(time.Now()) &&
+		(link.MaxDownloads == 0 || link.Downloads < link.MaxDownloads)
+}
+
+func copyShareLink(link models.ShareLink) models.ShareLink {
+	if link.RevokedAt != nil {
+		revokedAt := *link.RevokedAt
+		link.RevokedAt = &revokedAt
+	}
+	return link
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+)
+
+// recoveryCode is a row of the recovery codes table.
+type recoveryCode struct {
+	userID string
+	hash   string
+	used   bool
+}
+
+// TOTPRepository is an in-memory db.TOTPRepository.
+type TOTPRepository struct {
+	state *state
+}
+
+func (r *TOTPRepository) SaveSecret(_ context.Context, userID string, secret string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	if existing, ok := r.state.totp[userID]; ok && existing.ConfirmedAt != nil {
+		return db.ErrAlreadyExists
+	}
+	r.state.totp[userID] = models.TOTP{UserID: userID, Secret: secret, CreatedAt: now()}
+	return nil
+}
+
+func (r *TOTPRepository) FindByUser(_ context.Context, userID string) (models.TOTP, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	totp, ok := r.state.totp[userID]
+	if !ok {
+		return models.TOTP{}, db.ErrNotFound
+	}
+	return totp, nil
+}
+
+func (r *TOTPRepository) Confirm(_ context.Context, userID string, recoveryHashes []string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	totp, ok := r.state.totp[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	confirmedAt := now()
+	totp.ConfirmedAt = &confirmedAt
+	r.state.totp[userID] = totp
+	codes := r.state.recoveryCodes[:0]
+	for _, code := range r.state.recoveryCodes {
+		if code.userID != userID {
+			codes = append(codes, code)
+		}
+	}
+	for _, hash := range recoveryHashes {
+		codes = append(codes, recoveryCode{userID: userID, hash: hash})
+	}
+	r.state.recoveryCodes = codes
+	return nil
+}
+
+func (r *TOTPRepository) UseStep(_ context.Context, userID string, step int64) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	totp, ok := r.state.totp[userID]
+	if !ok || totp.LastStep >= step {
+		return db.ErrNotFound
+	}
+	totp.LastStep = step
+	r.state.totp[userID] = totp
+	return nil
+}
+
+func (r *TOTPRepository) UseRecoveryCode(_ context.Context, userID string, hash string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, code := range r.state.recoveryCodes {
+		if code.userID == userID && code.hash == hash && !code.used {
+			r.state.recoveryCodes[i].used = true
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+// TrashRepository is an in-memory db.TrashRepository working on the credentials of the same state.
+type TrashRepository struct {
+	state *state
+}
+
+func (r *TrashRepository) SaveFileItem(_ context.Context, userID string, fileName string, deleteMarker string,
+	purgeAfter time.Time) (models.TrashItem, models.Change, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	item := r.addItem(userID, db.TrashKindFile, fileName, deleteMarker, purgeAfter)
+	change := r.state.recordChange(models.Change{
+		UserID: userID, Kind: db.ChangeKindFile, Name: fileName, Deleted: true, VersionID: deleteMarker,
+	})
+	return item, change, nil
+}
+
+func (r *TrashRepository) TrashCreds(_ context.Context, userID string, credName string,
+	purgeAfter time.Time) (models.TrashItem, models.Change, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	var rows []int
+	for i, row := range r.state.creds {
+		if row.userID == userID && row.cred.Name == credName && row.trashID == "" {
+			rows = append(rows, i)
+		}
+	}
+	if len(rows) == 0 {
+		return models.TrashItem{}, models.Change{}, db.ErrNotFound
+	}
+	item := r.addItem(userID, db.TrashKindCredentials, credName, "", purgeAfter)
+	for _, i := range rows {
+		r.state.creds[i].trashID = item.ID
+	}
+	change := r.state.recordChange(models.Change{UserID: userID, Kind: db.ChangeKindCredentials, Name: credName, Deleted: true})
+	return item, change, nil
+}
+
+func (r *TrashRepository) FindAllByUser(_ context.Context, userID string) ([]models.TrashItem, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var items []models.TrashItem
+	for i := len(r.state.trash) - 1; i >= 0; i-- {
+		if item := r.state.trash[i]; item.UserID == userID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (r *TrashRepository) FindByID(_ context.Context, userID string, itemID string) (models.TrashItem, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, item := range r.state.trash {
+		if item.ID == itemID && item.UserID == userID {
+			return item, nil
+		}
+	}
+	return models.TrashItem{}, db.ErrNotFound
+}
+
+func (r *TrashRepository) FindExpired(_ context.Context, before time.Time, limit int) ([]models.TrashItem, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	var items []models.TrashItem
+	for _, item := range r.state.trash {
+		if item.PurgeAfter.Before(before) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].PurgeAfter.Before(items[j].PurgeAfter)
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (r *TrashRepository) Restore(_ context.Context, itemID string) (models.Change, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	item, ok := r.removeItem(itemID)
+	if !ok {
+		return models.Change{}, db.ErrNotFound
+	}
+	for i := range r.state.creds {
+		if r.state.creds[i].trashID == itemID {
+			r.state.creds[i].trashID = ""
+		}
+	}
+	return r.state.recordChange(models.Change{UserID: item.UserID, Kind: item.Kind, Name: item.Name}), nil
+}
+
+func (r *TrashRepository) Purge(_ context.Context, itemID string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	creds := r.state.creds[:0]
+	for _, row := range r.state.creds {
+		if row.trashID != itemID {
+			creds = append(creds, row)
+		}
+	}
+	r.state.creds = creds
+	r.removeItem(itemID)
+	return nil
+}
+
+// addItem appends a trash entry. The caller must hold the write lock.
+func (r *TrashRepository) addItem(userID string, kind string, name string, deleteMarker string, purgeAfter time.Time) models.TrashItem {
+	item := models.TrashItem{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		Kind:         kind,
+		Name:         name,
+		DeleteMarker: deleteMarker,
+		DeletedAt:    now(),
+		PurgeAfter:   purgeAfter,
+	}
+	r.state.trash = append(r.state.trash, item)
+	return item
+}
+
+// removeItem deletes a trash entry and reports whether it existed. The caller must hold the write lock.
+func (r *TrashRepository) removeItem(itemID string) (models.TrashItem, bool) {
+	for i, item := range r.state.trash {
+		if item.ID == itemID {
+			r.state.trash = append(r.state.trash[:i], r.state.trash[i+1:]...)
+			return item, true
+		}
+	}
+	return models.TrashItem{}, false
+}
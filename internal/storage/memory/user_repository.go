@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+)
+
+// UserRepository is an in-memory db.UserRepository. Usernames and emails are unique, emails regardless of case.
+type UserRepository struct {
+	state *state
+}
+
+func (r *UserRepository) SaveUser(_ context.Context, username string, password string, email string) (uuid.UUID, error) {
+	return r.insert(models.UserDTO{Username: username, Email: email, Password: password, Role: models.RoleUser})
+}
+
+func (r *UserRepository) SaveVerifiedUser(_ context.Context, username string, password string, email string,
+	role string) (uuid.UUID, error) {
+	verified := now()
+	return r.insert(models.UserDTO{Username: username, Email: email, Password: password, Role: role, EmailVerifiedAt: &verified})
+}
+
+func (r *UserRepository) insert(user models.UserDTO) (uuid.UUID, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for _, existing := range r.state.users {
+		if existing.Username == user.Username || strings.EqualFold(existing.Email, user.Email) {
+			return uuid.UUID{}, db.ErrAlreadyExists
+		}
+	}
+	id := uuid.New()
+	user.ID = id.String()
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+	r.state.users = append(r.state.users, user)
+	return id, nil
+}
+
+func (r *UserRepository) FindByName(_ context.Context, userName string) (models.UserDTO, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, user := range r.state.users {
+		if user.Username == userName {
+			return user, nil
+		}
+	}
+	return models.UserDTO{}, db.ErrNotFound
+}
+
+func (r *UserRepository) FindByEmail(_ context.Context, email string) (models.UserDTO, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, user := range r.state.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return models.UserDTO{}, db.ErrNotFound
+}
+
+func (r *UserRepository) FindByID(_ context.Context, userID string) (models.UserDTO, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	for _, user := range r.state.users {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+	return models.UserDTO{}, db.ErrNotFound
+}
+
+func (r *UserRepository) UpdatePassword(_ context.Context, userID string, password string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, user := range r.state.users {
+		if user.ID == userID {
+			r.state.users[i].Password = password
+			r.state.users[i].UpdatedAt = now()
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (r *UserRepository) MarkEmailVerified(_ context.Context, userID string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, user := range r.state.users {
+		if user.ID == userID {
+			if user.EmailVerifiedAt == nil {
+				verifiedAt := now()
+				r.state.users[i].EmailVerifiedAt = &verifiedAt
+			}
+			r.state.users[i].UpdatedAt = now()
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (r *UserRepository) ListUsers(_ context.Context) ([]models.UserDTO, error) {
+	r.state.mu.RLock()
+	defer r.state.mu.RUnlock()
+	users := append([]models.UserDTO(nil), r.state.users...)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (r *UserRepository) SetDisabled(_ context.Context, userID string, disabled bool) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, user := range r.state.users {
+		if user.ID == userID {
+			switch {
+			case !disabled:
+				r.state.users[i].DisabledAt = nil
+			case user.DisabledAt == nil:
+				disabledAt := now()
+				r.state.users[i].DisabledAt = &disabledAt
+			}
+			r.state.users[i].UpdatedAt = now()
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (r *UserRepository) SetRole(_ context.Context, userID string, role string) error {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	for i, user := range r.state.users {
+		if user.ID == userID {
+			r.state.users[i].Role = role
+			r.state.users[i].UpdatedAt = now()
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
@@ -1,48 +1,96 @@
 package db
 
 import (
+	"context"
 	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// Modes of preparing the schema when the server starts.
+const (
+	MigrateAuto  = "auto"  // apply the pending migrations
+	MigrateCheck = "check" // refuse to start while migrations are pending
+	MigrateOff   = "off"   // use the schema as it is
+)
+
+var (
+	// ErrPendingMigrations is returned by PrepareSchema in the check mode when the schema is out of date.
+	ErrPendingMigrations = errors.New("database schema is out of date")
+	// ErrSchemaNewer is returned by PrepareSchema when the database was migrated by a newer release.
+	ErrSchemaNewer = errors.New("database schema is newer than this release")
 )
 
 // embedMigrations is a variable of type `embed.FS` that represents
 // the embedded file system where the migration files are stored.
-// It is used to set the base file system for the `goose` migration
-// tool to read the migration files from.
-//
-// Example usage:
-//
-//	func StartMigration(pool *pgxpool.Pool) error {
-//	    db := stdlib.OpenDBFromPool(pool)
-//	    goose.SetBaseFS(embedMigrations)
-//	    if err := goose.SetDialect("postgres"); err != nil {
-//	        return err
-//	    }
-//	    if err := goose.Up(db, "migrations"); err != nil {
-//	        return err
-//	    }
-//	    return nil
-//	}
+// It is read by the goose provider NewMigrator returns.
 //
 //go:embed migrations/*.sql
 var embedMigrations embed.FS
 
-// StartMigration starts the migration process for a PostgreSQL database using the provided connection pool.
-// It opens a database connection from the pool and sets the base file system for embedded migrations.
-// Then it sets the dialect to "postgres" and runs the migrations using the specified directory.
-// If any error occurs during the migration process, it is returned.
-// Otherwise, it returns nil.
-func StartMigration(pool *pgxpool.Pool) error {
-	db := stdlib.OpenDBFromPool(pool)
-	goose.SetBaseFS(embedMigrations)
-	if err := goose.SetDialect("postgres"); err != nil {
-		return err
+// NewMigrator returns a goose provider that applies the embedded migrations to the database of the pool
+// and reports their status. Closing the provider is not needed; the pool stays open.
+// Migrations are applied holding a Postgres advisory lock, so servers starting together take turns.
+func NewMigrator(pool *pgxpool.Pool) (*goose.Provider, error) {
+	fsys, err := fs.Sub(embedMigrations, "migrations")
+	if err != nil {
+		return nil, err
 	}
-	if err := goose.Up(db, "migrations"); err != nil {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, stdlib.OpenDBFromPool(pool), fsys,
+		goose.WithSessionLocker(locker))
+}
+
+// PrepareSchema makes sure the schema fits this release before the server uses the database.
+// In the auto mode the pending migrations are applied and returned, in the check mode they make it
+// fail with ErrPendingMigrations. Both modes fail with ErrSchemaNewer if the database has migrations
+// this release does not know. The off mode checks nothing.
+func PrepareSchema(ctx context.Context, migrator *goose.Provider, mode string) ([]*goose.MigrationResult, error) {
+	switch mode {
+	case MigrateOff:
+		return nil, nil
+	case MigrateAuto, MigrateCheck:
+	default:
+		return nil, fmt.Errorf("unknown migrate mode %q, use %s, %s or %s", mode, MigrateAuto, MigrateCheck, MigrateOff)
+	}
+	if err := checkNotNewer(ctx, migrator); err != nil {
+		return nil, err
+	}
+	if mode == MigrateCheck {
+		pending, err := migrator.HasPending(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if pending {
+			return nil, fmt.Errorf("%w: run \"gkeeper migrate up\" or start with --migrate=auto", ErrPendingMigrations)
+		}
+		return nil, nil
+	}
+	results, err := migrator.Up(ctx)
+	if err != nil {
+		return results, err
+	}
+	// another server may have applied the migrations of a newer release meanwhile
+	return results, checkNotNewer(ctx, migrator)
+}
+
+func checkNotNewer(ctx context.Context, migrator *goose.Provider) error {
+	current, latest, err := migrator.GetVersions(ctx)
+	if err != nil {
 		return err
 	}
+	if current > latest {
+		return fmt.Errorf("%w: the database is at version %d, this release knows versions up to %d",
+			ErrSchemaNewer, current, latest)
+	}
 	return nil
 }
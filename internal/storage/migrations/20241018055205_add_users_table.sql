@@ -25,6 +25,5 @@ CREATE TABLE Files (
 );
 
 -- +goose Down
--- +goose StatementBegin
-SELECT 'down SQL query';
--- +goose StatementEnd
+DROP TABLE Files;
+DROP TABLE Users;
@@ -11,6 +11,4 @@ CREATE TABLE Settings (
    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP         -- Timestamp of last update
 );
 -- +goose Down
--- +goose StatementBegin
-SELECT 'down SQL query';
--- +goose StatementEnd
+DROP TABLE Settings;
@@ -15,6 +15,4 @@ CREATE TABLE UsersCredInfo (
 
 );
 -- +goose Down
--- +goose StatementBegin
-SELECT 'down SQL query';
--- +goose StatementEnd
+DROP TABLE UsersCredInfo;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE ShareLinks (
+   id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),   -- Unique identifier for each link
+   user_id       UUID NOT NULL,                                -- Owner of the shared file
+   token_hash    VARCHAR(64) NOT NULL UNIQUE,                  -- sha256 of the token handed out to the user
+   file_name     VARCHAR(255) NOT NULL,                        -- Name of the shared file
+   version_id    VARCHAR(255) NOT NULL DEFAULT '',             -- Version of the object pinned at creation
+   expires_at    TIMESTAMP WITH TIME ZONE NOT NULL,            -- Link is not served after this moment
+   max_downloads INT NOT NULL DEFAULT 0,                       -- 0 means unlimited
+   downloads     INT NOT NULL DEFAULT 0,                       -- Number of downloads served so far
+   revoked_at    TIMESTAMP WITH TIME ZONE,                     -- Set when the owner revokes the link
+   created_at    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+-- +goose Down
+DROP TABLE ShareLinks;
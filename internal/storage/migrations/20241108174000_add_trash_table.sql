@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE Trash (
+   id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),   -- Unique identifier for each trash entry
+   user_id       UUID NOT NULL,                                -- Owner of the deleted item
+   kind          VARCHAR(16) NOT NULL,                         -- file or credentials
+   name          VARCHAR(255) NOT NULL,                        -- File name or credentials name
+   delete_marker VARCHAR(255) NOT NULL DEFAULT '',             -- Version of the S3 delete marker for files
+   deleted_at    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+   purge_after   TIMESTAMP WITH TIME ZONE NOT NULL,            -- The item is removed for good after this moment
+   CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+CREATE INDEX trash_purge_after_idx ON Trash (purge_after);
+
+ALTER TABLE UsersCredInfo ADD COLUMN trash_id UUID REFERENCES Trash(id); -- Set while the credentials are in the trash bin
+-- +goose Down
+ALTER TABLE UsersCredInfo DROP COLUMN trash_id;
+DROP TABLE Trash;
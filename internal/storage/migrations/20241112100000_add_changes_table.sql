@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE UserRevisions (
+   user_id    UUID PRIMARY KEY REFERENCES Users(id),  -- Owner of the counter
+   revision   BIGINT NOT NULL                         -- Last revision handed out to the user's changes
+);
+
+CREATE TABLE Changes (
+   user_id    UUID NOT NULL REFERENCES Users(id),
+   kind       VARCHAR(16) NOT NULL,                   -- file or credentials
+   name       VARCHAR(255) NOT NULL,                  -- File name or credentials name
+   revision   BIGINT NOT NULL,                        -- Revision of the latest change of the item
+   deleted    BOOLEAN NOT NULL DEFAULT FALSE,         -- Tombstone of a deleted item
+   version_id VARCHAR(255) NOT NULL DEFAULT '',       -- Version of the file, empty for credentials
+   changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (user_id, kind, name)
+);
+CREATE INDEX changes_user_revision_idx ON Changes (user_id, revision);
+-- +goose Down
+DROP TABLE Changes;
+DROP TABLE UserRevisions;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE Conflicts (
+   id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+   user_id        UUID NOT NULL REFERENCES Users(id),
+   name           VARCHAR(50) NOT NULL,                 -- Name of the credentials
+   base_version   BIGINT NOT NULL,                      -- Version the client edited from
+   remote_version BIGINT NOT NULL,                      -- Latest version when the save arrived, 0 if deleted
+   data           VARCHAR(256),                         -- Encrypted data of the rejected save
+   type           INT NOT NULL,
+   created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+   resolved_at    TIMESTAMP WITH TIME ZONE,             -- Set once the user picked a side
+   resolution     VARCHAR(16) NOT NULL DEFAULT ''       -- local, remote or merge
+);
+CREATE INDEX conflicts_user_idx ON Conflicts (user_id) WHERE resolved_at IS NULL;
+-- +goose Down
+DROP TABLE Conflicts;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE RevokedTokens (
+   token_id   VARCHAR(64) PRIMARY KEY,                   -- ID of the revoked access token
+   user_id    UUID NOT NULL REFERENCES Users(id),
+   expires_at TIMESTAMP WITH TIME ZONE NOT NULL          -- The entry is useless once the token expired
+);
+CREATE INDEX revokedtokens_expires_idx ON RevokedTokens (expires_at);
+-- +goose Down
+DROP TABLE RevokedTokens;
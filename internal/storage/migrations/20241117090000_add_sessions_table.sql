@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE Sessions (
+   id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+   user_id       UUID NOT NULL REFERENCES Users(id),
+   refresh_hash  VARCHAR(64) NOT NULL UNIQUE,              -- SHA-256 of the current refresh token
+   previous_hash VARCHAR(64) NOT NULL DEFAULT '',          -- SHA-256 of the refresh token rotated last
+   created_at    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+   expires_at    TIMESTAMP WITH TIME ZONE NOT NULL,        -- The refresh token is rejected after this time
+   revoked_at    TIMESTAMP WITH TIME ZONE                  -- Set on logout
+);
+CREATE INDEX sessions_previous_hash_idx ON Sessions (previous_hash);
+CREATE INDEX sessions_user_idx ON Sessions (user_id);
+-- +goose Down
+DROP TABLE Sessions;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+ALTER TABLE Sessions
+   ADD COLUMN device         VARCHAR(255) NOT NULL DEFAULT '', -- Name of the device the user logged in from
+   ADD COLUMN client_version VARCHAR(64)  NOT NULL DEFAULT '',
+   ADD COLUMN ip             VARCHAR(64)  NOT NULL DEFAULT '', -- Address of the last request
+   ADD COLUMN last_seen_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+-- +goose Down
+ALTER TABLE Sessions
+   DROP COLUMN last_seen_at,
+   DROP COLUMN ip,
+   DROP COLUMN client_version,
+   DROP COLUMN device;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE TOTPSecrets (
+   user_id      UUID PRIMARY KEY REFERENCES Users(id),
+   secret       TEXT NOT NULL,                            -- Encrypted with the data key
+   created_at   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+   confirmed_at TIMESTAMP WITH TIME ZONE,                 -- Two-factor authentication is enabled once set
+   last_step    BIGINT NOT NULL DEFAULT 0                 -- Time step of the last accepted code
+);
+CREATE TABLE RecoveryCodes (
+   id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+   user_id    UUID NOT NULL REFERENCES Users(id),
+   code_hash  VARCHAR(64) NOT NULL,                       -- SHA-256 of the code
+   used_at    TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX recovery_codes_user_idx ON RecoveryCodes (user_id, code_hash);
+-- +goose Down
+DROP TABLE RecoveryCodes;
+DROP TABLE TOTPSecrets;
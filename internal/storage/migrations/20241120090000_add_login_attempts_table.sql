@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE LoginAttempts (
+   key             VARCHAR(300) PRIMARY KEY,                  -- "user:<name>" or "ip:<address>"
+   failures        INTEGER NOT NULL DEFAULT 0,                -- Failed logins within the window
+   last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+   locked_until    TIMESTAMP WITH TIME ZONE
+);
+CREATE TABLE SecurityEvents (
+   id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+   user_id    VARCHAR(36) NOT NULL DEFAULT '',                -- Empty for events of unknown users
+   kind       VARCHAR(64) NOT NULL,
+   ip         VARCHAR(64) NOT NULL DEFAULT '',
+   detail     TEXT NOT NULL DEFAULT '',
+   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX security_events_user_idx ON SecurityEvents (user_id, created_at);
+-- +goose Down
+DROP TABLE SecurityEvents;
+DROP TABLE LoginAttempts;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE AccountDeletions (
+   user_id         UUID PRIMARY KEY,                               -- No reference, the user is deleted last
+   requested_at    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+   object_versions BIGINT NOT NULL DEFAULT 0,                      -- File versions removed so far
+   bytes_deleted   BIGINT NOT NULL DEFAULT 0,
+   rows_deleted    BIGINT NOT NULL DEFAULT 0,
+   completed_at    TIMESTAMP WITH TIME ZONE                        -- Set once the rows are deleted
+);
+CREATE INDEX account_deletions_pending_idx ON AccountDeletions (requested_at) WHERE completed_at IS NULL;
+-- +goose Down
+DROP TABLE AccountDeletions;
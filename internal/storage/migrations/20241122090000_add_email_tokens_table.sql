@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+ALTER TABLE Users ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE; -- Set once the user proved to own the email
+UPDATE Users SET email_verified_at = created_at; -- accounts created before verification existed keep working
+CREATE TABLE EmailTokens (
+   user_id    UUID NOT NULL REFERENCES Users(id),
+   purpose    VARCHAR(32) NOT NULL,                           -- verify_email or reset_password
+   token_hash VARCHAR(64) NOT NULL UNIQUE,                    -- SHA-256 of the token sent by email
+   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+   expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+   PRIMARY KEY (user_id, purpose)
+);
+-- +goose Down
+DROP TABLE EmailTokens;
+ALTER TABLE Users DROP COLUMN email_verified_at;
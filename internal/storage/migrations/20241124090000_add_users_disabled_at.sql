@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+ALTER TABLE Users ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE; -- Set while an administrator keeps the user from logging in
+UPDATE Users SET role = 'user' WHERE role IS NULL;
+ALTER TABLE Users ALTER COLUMN role SET NOT NULL;
+-- +goose Down
+ALTER TABLE Users ALTER COLUMN role DROP NOT NULL;
+ALTER TABLE Users DROP COLUMN disabled_at;
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"GophKeeper/utils"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by repositories when the requested record does not exist.
+	ErrNotFound = errors.New("record not found")
+	// ErrAlreadyExists is returned by repositories when a record violates a uniqueness constraint.
+	ErrAlreadyExists = errors.New("record already exists")
+	// ErrConflict is returned when a record changed since the version the caller based its update on.
+	ErrConflict = errors.New("record was changed concurrently")
+)
+
+// UserRepository manages user accounts.
+type UserRepository interface {
+	SaveUser(ctx context.Context, username string, password string, email string) (uuid.UUID, error)
+	// SaveVerifiedUser saves a user with the role whose email address is taken as verified.
+	SaveVerifiedUser(ctx context.Context, username string, password string, email string, role string) (uuid.UUID, error)
+	FindByName(ctx context.Context, userName string) (models.UserDTO, error)
+	// FindByEmail finds the user by email regardless of case.
+	FindByEmail(ctx context.Context, email string) (models.UserDTO, error)
+	FindByID(ctx context.Context, userID string) (models.UserDTO, error)
+	// UpdatePassword replaces the password hash of the user and returns ErrNotFound if there is no such user.
+	UpdatePassword(ctx context.Context, userID string, password string) error
+	// MarkEmailVerified records that the user owns the email address and returns ErrNotFound
+	// if there is no such user.
+	MarkEmailVerified(ctx context.Context, userID string) error
+	// ListUsers returns all users ordered by username.
+	ListUsers(ctx context.Context) ([]models.UserDTO, error)
+	// SetDisabled disables the user or enables it again and returns ErrNotFound if there is no such user.
+	SetDisabled(ctx context.Context, userID string, disabled bool) error
+	// SetRole changes the role of the user and returns ErrNotFound if there is no such user.
+	SetRole(ctx context.Context, userID string, role string) error
+}
+
+// SettingsRepository manages server-wide settings such as the wrapped data key.
+type SettingsRepository interface {
+	SaveSettings(ctx context.Context, key string, val string) (uuid.UUID, error)
+	FindSettingsByKey(ctx context.Context, key string) (models.SettingsDTO, error)
+	// SaveSettingsIfAbsent saves val unless a value is saved for the key already and returns the value
+	// the key has, so concurrent callers all end up with the same one.
+	SaveSettingsIfAbsent(ctx context.Context, key string, val string) (string, error)
+	// PutSettings replaces every value saved for the key with val.
+	PutSettings(ctx context.Context, key string, val string) error
+	// DeleteSettings deletes every value saved for the keys and returns the number deleted.
+	DeleteSettings(ctx context.Context, keys ...string) (int64, error)
+}
+
+// CredRepository manages versioned user credentials. Every save creates a new version and records
+// its change for the sync protocol in the same transaction; the new version and the recorded change are returned.
+type CredRepository interface {
+	SaveUserCreds(ctx context.Context, credName string, userID string, data string, dataType DataType) (int64, models.Change, error)
+	// SaveUserCredsAt saves a new version only if baseVersion is still the latest one (0 if there is none)
+	// and returns ErrConflict otherwise.
+	SaveUserCredsAt(ctx context.Context, credName string, userID string, data string, dataType DataType, baseVersion int64) (int64, models.Change, error)
+	GetUserCredsVersion(ctx context.Context, userID string, credName string, version int64) (models.UserCredentials, error)
+	GetLastUserCreds(ctx context.Context, userID string, credName string) (models.UserCredentials, error)
+	FindAll(ctx context.Context, userID string) ([]models.UserCredentials, error)
+}
+
+// ShareLinkRepository manages expiring download links.
+type ShareLinkRepository interface {
+	SaveShareLink(ctx context.Context, link models.ShareLink) (uuid.UUID, error)
+	FindAllByUser(ctx context.Context, userID string) ([]models.ShareLink, error)
+	Revoke(ctx context.Context, userID string, linkID string) (bool, error)
+	// RevokeByFile revokes every active link to the user's file and returns the number revoked.
+	RevokeByFile(ctx context.Context, userID string, fileName string) (int64, error)
+	// FindActive returns the link with the given token hash without counting a download.
+	FindActive(ctx context.Context, tokenHash string) (models.ShareLink, error)
+	ConsumeDownload(ctx context.Context, tokenHash string) (models.ShareLink, error)
+}
+
+// TrashRepository manages deleted files and credentials waiting to be purged. Moving an item to the trash
+// and restoring it record its change for the sync protocol in the same transaction.
+type TrashRepository interface {
+	SaveFileItem(ctx context.Context, userID string, fileName string, deleteMarker string, purgeAfter time.Time) (models.TrashItem, models.Change, error)
+	TrashCreds(ctx context.Context, userID string, credName string, purgeAfter time.Time) (models.TrashItem, models.Change, error)
+	FindAllByUser(ctx context.Context, userID string) ([]models.TrashItem, error)
+	FindByID(ctx context.Context, userID string, itemID string) (models.TrashItem, error)
+	FindExpired(ctx context.Context, before time.Time, limit int) ([]models.TrashItem, error)
+	// Restore returns ErrNotFound if the entry is already gone.
+	Restore(ctx context.Context, itemID string) (models.Change, error)
+	Purge(ctx context.Context, itemID string) error
+}
+
+// ChangeRepository keeps the per-user revision counter and the latest change of every item.
+type ChangeRepository interface {
+	RecordChange(ctx context.Context, change models.Change) (models.Change, error)
+	FindChanges(ctx context.Context, userID string, since int64, limit int) ([]models.Change, error)
+}
+
+// ConflictRepository keeps the credentials saves rejected because of a stale base version.
+type ConflictRepository interface {
+	SaveConflict(ctx context.Context, conflict models.Conflict) (models.Conflict, error)
+	FindOpenByUser(ctx context.Context, userID string) ([]models.Conflict, error)
+	FindByID(ctx context.Context, userID string, conflictID string) (models.Conflict, error)
+	Resolve(ctx context.Context, conflictID string, resolution string) error
+	// Reopen undoes Resolve when the resolution could not be applied.
+	Reopen(ctx context.Context, conflictID string) error
+}
+
+// RevokedTokenRepository keeps the IDs of access tokens revoked before they expire.
+type RevokedTokenRepository interface {
+	// Revoke records the token as revoked until it expires. Revoking a token twice is not an error.
+	Revoke(ctx context.Context, tokenID string, userID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+	// DeleteExpired forgets tokens that expired before now and returns how many were removed.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// SessionRepository keeps the login sessions of users.
+type SessionRepository interface {
+	// CreateSession stores the session and returns it with the generated ID.
+	CreateSession(ctx context.Context, session models.Session) (models.Session, error)
+	// FindByRefreshHash returns the session whose current or previous refresh token has the hash.
+	FindByRefreshHash(ctx context.Context, hash string) (models.Session, error)
+	// RotateRefresh replaces the refresh token of an active session if its current hash is still oldHash,
+	// and returns ErrNotFound otherwise.
+	RotateRefresh(ctx context.Context, sessionID string, oldHash string, newHash string, expiresAt time.Time) error
+	// Revoke ends the session. Revoking a revoked session is not an error.
+	Revoke(ctx context.Context, sessionID string) error
+	// RevokeOthers ends every active session of the user but keepID and returns how many were ended.
+	RevokeOthers(ctx context.Context, userID string, keepID string) (int64, error)
+	// FindByID returns the session with the ID, revoked or not.
+	FindByID(ctx context.Context, sessionID string) (models.Session, error)
+	// ListActive returns the sessions of the user that are neither revoked nor expired at now,
+	// the most recently used first.
+	ListActive(ctx context.Context, userID string, now time.Time) ([]models.Session, error)
+	// Touch records a request of the session from the address.
+	Touch(ctx context.Context, sessionID string, ip string, at time.Time) error
+}
+
+// TOTPRepository stores the TOTP secrets and the recovery codes of the users with two-factor authentication.
+type TOTPRepository interface {
+	// SaveSecret stores a new unconfirmed secret of the user, replacing an unconfirmed one.
+	// It returns ErrAlreadyExists if the user has a confirmed secret.
+	SaveSecret(ctx context.Context, userID string, secret string) error
+	// FindByUser returns the secret of the user, confirmed or not.
+	FindByUser(ctx context.Context, userID string) (models.TOTP, error)
+	// Confirm activates the secret of the user and replaces the recovery codes with the hashes.
+	Confirm(ctx context.Context, userID string, recoveryHashes []string) error
+	// UseStep records that the code of the time step was used. It returns ErrNotFound if a code
+	// of the step or a later one was used already, so no code is accepted twice.
+	UseStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode marks the unused recovery code with the hash as used and returns ErrNotFound
+	// if there is none.
+	UseRecoveryCode(ctx context.Context, userID string, hash string) error
+}
+
+// LoginAttemptRepository counts failed logins by user name and by address.
+type LoginAttemptRepository interface {
+	// RecordFailure counts a failed login for the key at the time and returns the updated count.
+	// Failures before at minus window are forgotten.
+	RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) (models.LoginAttempt, error)
+	// FindAttempt returns the failures of the key, ErrNotFound if there are none.
+	FindAttempt(ctx context.Context, key string) (models.LoginAttempt, error)
+	// Lock rejects logins for the key until the time.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the failures of the key.
+	Reset(ctx context.Context, key string) error
+}
+
+// SecurityEventRepository keeps the security log.
+type SecurityEventRepository interface {
+	RecordEvent(ctx context.Context, event models.SecurityEvent) error
+	// ListEvents returns the latest events of the user, newest first; all users' for an empty userID.
+	ListEvents(ctx context.Context, userID string, limit int) ([]models.SecurityEvent, error)
+}
+
+// AccountDeletionRepository tracks the deletions of accounts and removes the accounts' rows.
+type AccountDeletionRepository interface {
+	// StartDeletion records that the account is being deleted and returns the deletion, the pending or
+	// completed one if the account is being or was deleted already.
+	StartDeletion(ctx context.Context, userID string) (models.AccountDeletion, error)
+	// FindDeletion returns the deletion of the account, ErrNotFound if it was never started.
+	FindDeletion(ctx context.Context, userID string) (models.AccountDeletion, error)
+	// FindPending returns the deletions that were started but not completed, the oldest first.
+	FindPending(ctx context.Context, limit int) ([]models.AccountDeletion, error)
+	// AddPurgedObjects adds the object versions removed from the blob store to the report of the deletion.
+	AddPurgedObjects(ctx context.Context, userID string, versions int64, bytes int64) error
+	// PurgeUser deletes every row owned by the user and the user itself, and completes the deletion, all in
+	// one transaction. It returns ErrNotFound if there is no pending deletion of the user.
+	PurgeUser(ctx context.Context, userID string) (models.AccountDeletion, error)
+}
+
+// EmailTokenRepository keeps the single-use tokens sent by email. Only the hashes of the tokens are stored.
+type EmailTokenRepository interface {
+	// SaveToken stores the token, replacing the one the user had for the same purpose.
+	SaveToken(ctx context.Context, token models.EmailToken) error
+	// FindToken returns the current token of the user for the purpose, ErrNotFound if there is none.
+	FindToken(ctx context.Context, userID string, purpose string) (models.EmailToken, error)
+	// UseToken deletes the token with the hash and returns it. It returns ErrNotFound if there is no
+	// such token for the purpose or if it expired before now.
+	UseToken(ctx context.Context, tokenHash string, purpose string, now time.Time) (models.EmailToken, error)
+}
+
+// ChangeFeed delivers the changes recorded by every server sharing the database.
+type ChangeFeed interface {
+	// Listen calls handler for every recorded change until ctx is done. onGap is called whenever
+	// changes may have been missed, e.g. after the connection to the database was lost.
+	Listen(ctx context.Context, handler func(models.Change), onGap func()) error
+}
+
+// mapError converts pgx errors to the repository errors shared by all implementations.
+func mapError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if utils.ErrorCode(err) == pgerrcode.UniqueViolation {
+		return ErrAlreadyExists
+	}
+	return err
+}
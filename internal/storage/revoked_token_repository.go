@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// PgRevokedTokenRepository represents a repository for access tokens revoked before they expire.
+type PgRevokedTokenRepository struct {
+	postgres *Postgres
+}
+
+func NewRevokedTokenRepository(postgres *Postgres) *PgRevokedTokenRepository {
+	return &PgRevokedTokenRepository{
+		postgres: postgres,
+	}
+}
+
+func (r *PgRevokedTokenRepository) Revoke(ctx context.Context, tokenID string, userID string, expiresAt time.Time) error {
+	query := `INSERT INTO revokedtokens(token_id, user_id, expires_at) VALUES($1, $2, $3) ON CONFLICT (token_id) DO NOTHING`
+	_, err := r.postgres.connPool.Exec(ctx, query, tokenID, userID, expiresAt)
+	return err
+}
+
+func (r *PgRevokedTokenRepository) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var revoked bool
+	query := `SELECT EXISTS(SELECT 1 FROM revokedtokens WHERE token_id = $1)`
+	err := r.postgres.connPool.QueryRow(ctx, query, tokenID).Scan(&revoked)
+	return revoked, err
+}
+
+func (r *PgRevokedTokenRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := r.postgres.connPool.Exec(ctx, `DELETE FROM revokedtokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
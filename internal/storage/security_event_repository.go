@@ -0,0 +1,40 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+)
+
+// PgSecurityEventRepository represents a repository for the security log.
+type PgSecurityEventRepository struct {
+	postgres *Postgres
+}
+
+func NewSecurityEventRepository(postgres *Postgres) *PgSecurityEventRepository {
+	return &PgSecurityEventRepository{
+		postgres: postgres,
+	}
+}
+
+func (r *PgSecurityEventRepository) RecordEvent(ctx context.Context, event models.SecurityEvent) error {
+	query := `INSERT INTO securityevents(user_id, kind, ip, detail) VALUES(@user_id, @kind, @ip, @detail)`
+	args := pgx.NamedArgs{
+		"user_id": event.UserID,
+		"kind":    event.Kind,
+		"ip":      event.IP,
+		"detail":  event.Detail,
+	}
+	_, err := r.postgres.connPool.Exec(ctx, query, args)
+	return err
+}
+
+func (r *PgSecurityEventRepository) ListEvents(ctx context.Context, userID string, limit int) ([]models.SecurityEvent, error) {
+	query := `SELECT id, user_id, kind, ip, detail, created_at FROM securityevents
+		WHERE $1 = '' OR user_id = $1 ORDER BY created_at DESC LIMIT $2`
+	rows, err := r.postgres.connPool.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.SecurityEvent])
+}
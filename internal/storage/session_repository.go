@@ -0,0 +1,107 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const sessionColumns = `id, user_id, refresh_hash, previous_hash, created_at, expires_at, revoked_at, device,
+	client_version, ip, last_seen_at`
+
+// PgSessionRepository represents a repository for login sessions.
+type PgSessionRepository struct {
+	postgres *Postgres
+}
+
+func NewSessionRepository(postgres *Postgres) *PgSessionRepository {
+	return &PgSessionRepository{
+		postgres: postgres,
+	}
+}
+
+func (r *PgSessionRepository) CreateSession(ctx context.Context, session models.Session) (models.Session, error) {
+	query := `INSERT INTO sessions(user_id, refresh_hash, expires_at, device, client_version, ip)
+		VALUES(@user_id, @refresh_hash, @expires_at, @device, @client_version, @ip)
+		RETURNING ` + sessionColumns
+	args := pgx.NamedArgs{
+		"user_id":        session.UserID,
+		"refresh_hash":   session.RefreshHash,
+		"expires_at":     session.ExpiresAt,
+		"device":         session.Device,
+		"client_version": session.ClientVersion,
+		"ip":             session.IP,
+	}
+	row, err := r.postgres.connPool.Query(ctx, query, args)
+	if err != nil {
+		return models.Session{}, err
+	}
+	return pgx.CollectOneRow(row, pgx.RowToStructByPos[models.Session])
+}
+
+func (r *PgSessionRepository) FindByRefreshHash(ctx context.Context, hash string) (models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE refresh_hash = $1 OR previous_hash = $1`
+	row, err := r.postgres.connPool.Query(ctx, query, hash)
+	if err != nil {
+		return models.Session{}, err
+	}
+	session, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.Session])
+	return session, mapError(err)
+}
+
+func (r *PgSessionRepository) RotateRefresh(ctx context.Context, sessionID string, oldHash string, newHash string,
+	expiresAt time.Time) error {
+	query := `UPDATE sessions SET previous_hash = refresh_hash, refresh_hash = $3, expires_at = $4
+		WHERE id = $1 AND refresh_hash = $2 AND revoked_at IS NULL`
+	tag, err := r.postgres.connPool.Exec(ctx, query, sessionID, oldHash, newHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PgSessionRepository) Revoke(ctx context.Context, sessionID string) error {
+	query := `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL`
+	_, err := r.postgres.connPool.Exec(ctx, query, sessionID)
+	return err
+}
+
+func (r *PgSessionRepository) RevokeOthers(ctx context.Context, userID string, keepID string) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND id::text <> $2 AND revoked_at IS NULL`
+	tag, err := r.postgres.connPool.Exec(ctx, query, userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *PgSessionRepository) FindByID(ctx context.Context, sessionID string) (models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+	row, err := r.postgres.connPool.Query(ctx, query, sessionID)
+	if err != nil {
+		return models.Session{}, err
+	}
+	session, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.Session])
+	return session, mapError(err)
+}
+
+func (r *PgSessionRepository) ListActive(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY last_seen_at DESC`
+	rows, err := r.postgres.connPool.Query(ctx, query, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.Session])
+}
+
+func (r *PgSessionRepository) Touch(ctx context.Context, sessionID string, ip string, at time.Time) error {
+	query := `UPDATE sessions SET ip = $2, last_seen_at = $3 WHERE id = $1`
+	_, err := r.postgres.connPool.Exec(ctx, query, sessionID, ip, at)
+	return err
+}
@@ -2,26 +2,24 @@ package db
 
 import (
 	"GophKeeper/internal/models"
-	"GophKeeper/utils"
 	"context"
-	"database/sql"
 	"errors"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
-// SettingsRepository represents a repository for managing user data.
-type SettingsRepository struct {
+// PgSettingsRepository represents a repository for managing user data.
+type PgSettingsRepository struct {
 	postgres *Postgres
 }
 
-func NewSettingsRepository(postgres *Postgres) *SettingsRepository {
-	return &SettingsRepository{
+func NewSettingsRepository(postgres *Postgres) *PgSettingsRepository {
+	return &PgSettingsRepository{
 		postgres: postgres,
 	}
 }
 
-func (s *SettingsRepository) SaveSettings(ctx context.Context, key string, val string) (uuid.UUID, error) {
+func (s *PgSettingsRepository) SaveSettings(ctx context.Context, key string, val string) (uuid.UUID, error) {
 	var lastInsertID uuid.UUID
 	err := s.postgres.connPool.QueryRow(ctx, "INSERT INTO settings(key, value) VALUES($1, $2) RETURNING id", key, val).Scan(&lastInsertID)
 	if err != nil {
@@ -30,7 +28,7 @@ func (s *SettingsRepository) SaveSettings(ctx context.Context, key string, val s
 	return lastInsertID, nil
 }
 
-func (s *SettingsRepository) FindSettingsByKey(ctx context.Context, key string) (models.SettingsDTO, error) {
+func (s *PgSettingsRepository) FindSettingsByKey(ctx context.Context, key string) (models.SettingsDTO, error) {
 	query := `SELECT key, value FROM settings WHERE key = @key ORDER BY created_at DESC LIMIT 1`
 	args := pgx.NamedArgs{
 		"key": key,
@@ -42,41 +40,54 @@ func (s *SettingsRepository) FindSettingsByKey(ctx context.Context, key string)
 	}
 	data, err = pgx.CollectOneRow(row, pgx.RowToStructByPos[models.SettingsDTO])
 	if err != nil {
-		return data, err
+		return data, mapError(err)
 	}
 	return data, nil
 }
 
-func (s *SettingsRepository) SaveKeys(ctx context.Context, kek, dek string) error {
+// SaveSettingsIfAbsent serializes concurrent callers with an advisory lock, as keys are not unique.
+func (s *PgSettingsRepository) SaveSettingsIfAbsent(ctx context.Context, key string, val string) (string, error) {
 	tx, err := s.postgres.connPool.Begin(ctx)
 	if err != nil {
-		return err
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('settings/' || $1))`, key); err != nil {
+		return "", err
+	}
+	var stored string
+	err = tx.QueryRow(ctx, `SELECT value FROM settings WHERE key = $1 ORDER BY created_at DESC LIMIT 1`, key).Scan(&stored)
+	if err == nil {
+		return stored, nil
 	}
-	var version int
-	err = tx.QueryRow(ctx, "SELECT version FROM settings ORDER BY created_at DESC LIMIT 1").Scan(&version)
-	if errors.Is(err, sql.ErrNoRows) {
-		version = 1
-	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		_ = tx.Rollback(ctx)
-	} else if err == nil {
-		version += 1
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
 	}
-	rows := [][]interface{}{
-		{utils.SettingKeyKek, kek, version},
-		{utils.SettingKeyDek, dek, version},
+	if _, err := tx.Exec(ctx, "INSERT INTO settings(key, value) VALUES($1, $2)", key, val); err != nil {
+		return "", err
+	}
+	return val, tx.Commit(ctx)
+}
+
+func (s *PgSettingsRepository) PutSettings(ctx context.Context, key string, val string) error {
+	tx, err := s.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return err
 	}
-	_, txErr := tx.CopyFrom(ctx,
-		pgx.Identifier{"settings"},
-		[]string{"key", "value", "version"},
-		pgx.CopyFromRows(rows),
-	)
-	if txErr != nil {
-		_ = tx.Rollback(ctx)
-		return txErr
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "DELETE FROM settings WHERE key = $1", key); err != nil {
+		return err
 	}
-	if err := tx.Commit(ctx); err != nil {
+	if _, err := tx.Exec(ctx, "INSERT INTO settings(key, value) VALUES($1, $2)", key, val); err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit(ctx)
+}
 
+func (s *PgSettingsRepository) DeleteSettings(ctx context.Context, keys ...string) (int64, error) {
+	tag, err := s.postgres.connPool.Exec(ctx, "DELETE FROM settings WHERE key = ANY($1)", keys)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
 }
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// PgShareLinkRepository represents a repository for managing file share links.
+type PgShareLinkRepository struct {
+	postgres *Postgres
+}
+
+func NewShareLinkRepository(postgres *Postgres) *PgShareLinkRepository {
+	return &PgShareLinkRepository{
+		postgres: postgres,
+	}
+}
+
+// SaveShareLink stores a new share link and returns its ID.
+func (r *PgShareLinkRepository) SaveShareLink(ctx context.Context, link models.ShareLink) (uuid.UUID, error) {
+	var lastInsertID uuid.UUID
+	err := r.postgres.connPool.QueryRow(ctx,
+		`INSERT INTO sharelinks(user_id, token_hash, file_name, version_id, expires_at, max_downloads)
+		 VALUES($1, $2, $3, $4, $5, $6) RETURNING id`,
+		link.UserID, link.TokenHash, link.FileName, link.VersionID, link.ExpiresAt, link.MaxDownloads).Scan(&lastInsertID)
+	if err != nil {
+		return lastInsertID, err
+	}
+	return lastInsertID, nil
+}
+
+// FindAllByUser returns every share link created by the user, newest first.
+func (r *PgShareLinkRepository) FindAllByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	query := `SELECT id, user_id, token_hash, file_name, version_id, expires_at, max_downloads, downloads, revoked_at, created_at
+		FROM sharelinks WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := r.postgres.connPool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.ShareLink])
+}
+
+// Revoke marks the user's link as revoked. It returns false if no active link with the given ID belongs to the user.
+func (r *PgShareLinkRepository) Revoke(ctx context.Context, userID string, linkID string) (bool, error) {
+	tag, err := r.postgres.connPool.Exec(ctx,
+		`UPDATE sharelinks SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		linkID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *PgShareLinkRepository) RevokeByFile(ctx context.Context, userID string, fileName string) (int64, error) {
+	tag, err := r.postgres.connPool.Exec(ctx,
+		`UPDATE sharelinks SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND file_name = $2 AND revoked_at IS NULL`,
+		userID, fileName)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// FindActive returns the link with the given token hash.
+// It returns ErrNotFound if the link does not exist, is revoked, expired or has no downloads left.
+func (r *PgShareLinkRepository) FindActive(ctx context.Context, tokenHash string) (models.ShareLink, error) {
+	query := `SELECT id, user_id, token_hash, file_name, version_id, expires_at, max_downloads, downloads, revoked_at, created_at
+		FROM sharelinks
+		WHERE token_hash = $1
+		  AND revoked_at IS NULL
+		  AND expires_at > CURRENT_TIMESTAMP
+		  AND (max_downloads = 0 OR downloads < max_downloads)`
+	row, err := r.postgres.connPool.Query(ctx, query, tokenHash)
+	if err != nil {
+		return models.ShareLink{}, err
+	}
+	link, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.ShareLink])
+	return link, mapError(err)
+}
+
+// ConsumeDownload atomically counts a download for the link with the given token hash.
+// It returns ErrNotFound if the link does not exist, is revoked, expired or has no downloads left.
+func (r *PgShareLinkRepository) ConsumeDownload(ctx context.Context, tokenHash string) (models.ShareLink, error) {
+	query := `UPDATE sharelinks SET downloads = downloads + 1
+		WHERE token_hash = @token_hash
+		  AND revoked_at IS NULL
+		  AND expires_at > CURRENT_TIMESTAMP
+		  AND (max_downloads = 0 OR downloads < max_downloads)
+		RETURNING id, user_id, token_hash, file_name, version_id, expires_at, max_downloads, downloads, revoked_at, created_at`
+	args := pgx.NamedArgs{
+		"token_hash": tokenHash,
+	}
+	var data models.ShareLink
+	row, err := r.postgres.connPool.Query(ctx, query, args)
+	if err != nil {
+		return data, err
+	}
+	data, err = pgx.CollectOneRow(row, pgx.RowToStructByPos[models.ShareLink])
+	if err != nil {
+		return data, mapError(err)
+	}
+	return data, nil
+}
@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"database/sql"
+)
+
+const accountDeletionColumns = `user_id, requested_at, object_versions, bytes_deleted, rows_deleted, completed_at`
+
+// userRowQueries delete the rows owned by a user, in an order that satisfies the foreign keys.
+// The user itself is deleted last.
+var userRowQueries = []string{
+	`DELETE FROM recoverycodes WHERE user_id = ?`,
+	`DELETE FROM totpsecrets WHERE user_id = ?`,
+	`DELETE FROM sessions WHERE user_id = ?`,
+	`DELETE FROM revokedtokens WHERE user_id = ?`,
+	`DELETE FROM conflicts WHERE user_id = ?`,
+	`DELETE FROM changes WHERE user_id = ?`,
+	`DELETE FROM userrevisions WHERE user_id = ?`,
+	`DELETE FROM userscredinfo WHERE user_id = ?`,
+	`DELETE FROM trash WHERE user_id = ?`,
+	`DELETE FROM sharelinks WHERE user_id = ?`,
+	`DELETE FROM securityevents WHERE user_id = ?`,
+	`DELETE FROM emailtokens WHERE user_id = ?`,
+	`DELETE FROM users WHERE id = ?`,
+}
+
+// AccountDeletionRepository is a SQLite db.AccountDeletionRepository.
+type AccountDeletionRepository struct {
+	sqlite *SQLite
+}
+
+func (r *AccountDeletionRepository) StartDeletion(ctx context.Context, userID string) (models.AccountDeletion, error) {
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO accountdeletions(user_id, requested_at) VALUES(?, ?) ON CONFLICT (user_id) DO NOTHING`,
+		userID, now())
+	if err != nil {
+		return models.AccountDeletion{}, mapError(err)
+	}
+	return r.FindDeletion(ctx, userID)
+}
+
+func (r *AccountDeletionRepository) FindDeletion(ctx context.Context, userID string) (models.AccountDeletion, error) {
+	deletion, err := scanAccountDeletion(r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT `+accountDeletionColumns+` FROM accountdeletions WHERE user_id = ?`, userID))
+	if err != nil {
+		return models.AccountDeletion{}, mapError(err)
+	}
+	return deletion, nil
+}
+
+func (r *AccountDeletionRepository) FindPending(ctx context.Context, limit int) ([]models.AccountDeletion, error) {
+	rows, err := r.sqlite.conn.QueryContext(ctx,
+		`SELECT `+accountDeletionColumns+` FROM accountdeletions
+		 WHERE completed_at IS NULL ORDER BY requested_at LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deletions []models.AccountDeletion
+	for rows.Next() {
+		deletion, err := scanAccountDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, deletion)
+	}
+	return deletions, rows.Err()
+}
+
+func (r *AccountDeletionRepository) AddPurgedObjects(ctx context.Context, userID string, versions int64,
+	bytes int64) error {
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE accountdeletions SET object_versions = object_versions + ?, bytes_deleted = bytes_deleted + ?
+		 WHERE user_id = ?`, versions, bytes, userID)
+	return err
+}
+
+func (r *AccountDeletionRepository) PurgeUser(ctx context.Context, userID string) (models.AccountDeletion, error) {
+	tx, err := r.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`UPDATE accountdeletions SET completed_at = ? WHERE user_id = ? AND completed_at IS NULL`, now(), userID)
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return models.AccountDeletion{}, err
+	}
+	var deleted int64
+	for _, query := range userRowQueries {
+		res, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return models.AccountDeletion{}, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return models.AccountDeletion{}, err
+		}
+		deleted += n
+	}
+	deletion, err := scanAccountDeletion(tx.QueryRowContext(ctx,
+		`UPDATE accountdeletions SET rows_deleted = ? WHERE user_id = ? RETURNING `+accountDeletionColumns,
+		deleted, userID))
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	return deletion, tx.Commit()
+}
+
+func scanAccountDeletion(row rowScanner) (models.AccountDeletion, error) {
+	var deletion models.AccountDeletion
+	var completedAt sql.NullTime
+	err := row.Scan(&deletion.UserID, &deletion.RequestedAt, &deletion.ObjectVersions, &deletion.BytesDeleted,
+		&deletion.RowsDeleted, &completedAt)
+	if err != nil {
+		return models.AccountDeletion{}, err
+	}
+	if completedAt.Valid {
+		deletion.CompletedAt = &completedAt.Time
+	}
+	return deletion, nil
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"database/sql"
+)
+
+const changeColumns = `user_id, revision, kind, name, deleted, version_id, changed_at`
+
+// ChangeRepository is a SQLite db.ChangeRepository.
+type ChangeRepository struct {
+	sqlite *SQLite
+}
+
+// RecordChange bumps the user's revision and stamps the change of the item with it.
+func (r *ChangeRepository) RecordChange(ctx context.Context, change models.Change) (models.Change, error) {
+	tx, err := r.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Change{}, err
+	}
+	defer tx.Rollback()
+	change, err = recordChange(ctx, tx, change)
+	if err != nil {
+		return models.Change{}, err
+	}
+	return change, tx.Commit()
+}
+
+// recordChange records the change within tx, so it commits together with the write it stamps.
+func recordChange(ctx context.Context, tx *sql.Tx, change models.Change) (models.Change, error) {
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO userrevisions(user_id, revision) VALUES(?, 1)
+		 ON CONFLICT (user_id) DO UPDATE SET revision = revision + 1 RETURNING revision`,
+		change.UserID).Scan(&change.Revision)
+	if err != nil {
+		return models.Change{}, err
+	}
+	change.ChangedAt = now()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO changes(user_id, kind, name, revision, deleted, version_id, changed_at) VALUES(?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (user_id, kind, name) DO UPDATE
+		 SET revision = excluded.revision, deleted = excluded.deleted, version_id = excluded.version_id,
+		     changed_at = excluded.changed_at`,
+		change.UserID, change.Kind, change.Name, change.Revision, change.Deleted, change.VersionID, change.ChangedAt)
+	if err != nil {
+		return models.Change{}, err
+	}
+	return change, nil
+}
+
+func (r *ChangeRepository) FindChanges(ctx context.Context, userID string, since int64, limit int) ([]models.Change, error) {
+	rows, err := r.sqlite.conn.QueryContext(ctx,
+		`SELECT `+changeColumns+` FROM changes WHERE user_id = ? AND revision > ? ORDER BY revision LIMIT ?`,
+		userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []models.Change
+	for rows.Next() {
+		var change models.Change
+		err := rows.Scan(&change.UserID, &change.Revision, &change.Kind, &change.Name, &change.Deleted,
+			&change.VersionID, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+)
+
+const conflictColumns = `id, user_id, name, base_version, remote_version, data, type, created_at, resolved_at, resolution`
+
+// ConflictRepository is a SQLite db.ConflictRepository.
+type ConflictRepository struct {
+	sqlite *SQLite
+}
+
+func (r *ConflictRepository) SaveConflict(ctx context.Context, conflict models.Conflict) (models.Conflict, error) {
+	conflict.ID = uuid.NewString()
+	conflict.CreatedAt = now()
+	conflict.ResolvedAt = nil
+	conflict.Resolution = ""
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO conflicts(id, user_id, name, base_version, remote_version, data, type, created_at)
+		 VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		conflict.ID, conflict.UserID, conflict.Name, conflict.BaseVersion, conflict.RemoteVersion, conflict.Data,
+		conflict.DataType, conflict.CreatedAt)
+	if err != nil {
+		return models.Conflict{}, err
+	}
+	return conflict, nil
+}
+
+func (r *ConflictRepository) FindOpenByUser(ctx context.Context, userID string) ([]models.Conflict, error) {
+	rows, err := r.sqlite.conn.QueryContext(ctx,
+		`SELECT `+conflictColumns+` FROM conflicts WHERE user_id = ? AND resolved_at IS NULL ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var conflicts []models.Conflict
+	for rows.Next() {
+		conflict, err := scanConflict(rows)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts, rows.Err()
+}
+
+func (r *ConflictRepository) FindByID(ctx context.Context, userID string, conflictID string) (models.Conflict, error) {
+	conflict, err := scanConflict(r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT `+conflictColumns+` FROM conflicts WHERE id = ? AND user_id = ?`, conflictID, userID))
+	if err != nil {
+		return models.Conflict{}, mapError(err)
+	}
+	return conflict, nil
+}
+
+func (r *ConflictRepository) Resolve(ctx context.Context, conflictID string, resolution string) error {
+	res, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE conflicts SET resolved_at = ?, resolution = ? WHERE id = ? AND resolved_at IS NULL`,
+		now(), resolution, conflictID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *ConflictRepository) Reopen(ctx context.Context, conflictID string) error {
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE conflicts SET resolved_at = NULL, resolution = '' WHERE id = ?`, conflictID)
+	return err
+}
+
+func scanConflict(row rowScanner) (models.Conflict, error) {
+	var conflict models.Conflict
+	var resolvedAt sql.NullTime
+	err := row.Scan(&conflict.ID, &conflict.UserID, &conflict.Name, &conflict.BaseVersion, &conflict.RemoteVersion,
+		&conflict.Data, &conflict.DataType, &conflict.CreatedAt, &resolvedAt, &conflict.Resolution)
+	if err != nil {
+		return models.Conflict{}, err
+	}
+	if resolvedAt.Valid {
+		conflict.ResolvedAt = &resolvedAt.Time
+	}
+	return conflict, nil
+}
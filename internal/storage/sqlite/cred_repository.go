@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+)
+
+// CredRepository is a SQLite db.CredRepository.
+type CredRepository struct {
+	sqlite *SQLite
+}
+
+func (u *CredRepository) SaveUserCreds(ctx context.Context, credName string, userID string, data string, dataType db.DataType) (int64, models.Change, error) {
+	tx, err := u.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	defer tx.Rollback()
+	version, change, err := insertCreds(ctx, tx, credName, userID, data, dataType)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	return version, change, tx.Commit()
+}
+
+// SaveUserCredsAt saves a new version of the credentials unless someone saved another version after baseVersion.
+func (u *CredRepository) SaveUserCredsAt(ctx context.Context, credName string, userID string, data string, dataType db.DataType,
+	baseVersion int64) (int64, models.Change, error) {
+	tx, err := u.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	defer tx.Rollback()
+	var latest int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM userscredinfo WHERE user_id = ? AND name = ? AND trash_id IS NULL`,
+		userID, credName).Scan(&latest)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	if latest != baseVersion {
+		return 0, models.Change{}, db.ErrConflict
+	}
+	version, change, err := insertCreds(ctx, tx, credName, userID, data, dataType)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	return version, change, tx.Commit()
+}
+
+// insertCreds adds a new version of the credentials and records its change within tx.
+func insertCreds(ctx context.Context, tx *sql.Tx, credName string, userID string, data string, dataType db.DataType) (int64, models.Change, error) {
+	createdAt := now()
+	var version int64
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO userscredinfo(id, user_id, name, data, type, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?) RETURNING version`,
+		uuid.NewString(), userID, credName, data, dataType, createdAt, createdAt).Scan(&version)
+	if err != nil {
+		return 0, models.Change{}, err
+	}
+	change, err := recordChange(ctx, tx, models.Change{UserID: userID, Kind: db.ChangeKindCredentials, Name: credName})
+	return version, change, err
+}
+
+// GetUserCredsVersion retrieves the given version of the credentials, including trashed ones.
+func (u *CredRepository) GetUserCredsVersion(ctx context.Context, userID string, credName string, version int64) (models.UserCredentials, error) {
+	var data models.UserCredentials
+	err := u.sqlite.conn.QueryRowContext(ctx,
+		`SELECT name, data, type, version, created_at FROM userscredinfo WHERE user_id = ? AND name = ? AND version = ?`,
+		userID, credName, version).
+		Scan(&data.Name, &data.Data, &data.DataType, &data.Version, &data.CreatedAt)
+	if err != nil {
+		return models.UserCredentials{}, mapError(err)
+	}
+	return data, nil
+}
+
+// GetLastUserCreds retrieves the most recent version of the named credentials.
+func (u *CredRepository) GetLastUserCreds(ctx context.Context, userID string, credName string) (models.UserCredentials, error) {
+	var data models.UserCredentials
+	err := u.sqlite.conn.QueryRowContext(ctx,
+		`SELECT name, data, type, version, created_at FROM userscredinfo
+		 WHERE user_id = ? AND name = ? AND trash_id IS NULL ORDER BY version DESC LIMIT 1`, userID, credName).
+		Scan(&data.Name, &data.Data, &data.DataType, &data.Version, &data.CreatedAt)
+	if err != nil {
+		return models.UserCredentials{}, mapError(err)
+	}
+	return data, nil
+}
+
+// FindAll returns every version of the user's credentials, newest first.
+func (u *CredRepository) FindAll(ctx context.Context, userID string) ([]models.UserCredentials, error) {
+	rows, err := u.sqlite.conn.QueryContext(ctx,
+		`SELECT name, data, type, version, created_at FROM userscredinfo
+		 WHERE user_id = ? AND trash_id IS NULL ORDER BY version DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var credentials []models.UserCredentials
+	for rows.Next() {
+		var cred models.UserCredentials
+		if err := rows.Scan(&cred.Name, &cred.Data, &cred.DataType, &cred.Version, &cred.CreatedAt); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, cred)
+	}
+	return credentials, rows.Err()
+}
@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"time"
+)
+
+const emailTokenColumns = `user_id, purpose, token_hash, created_at, expires_at`
+
+// EmailTokenRepository is a SQLite db.EmailTokenRepository.
+type EmailTokenRepository struct {
+	sqlite *SQLite
+}
+
+func (r *EmailTokenRepository) SaveToken(ctx context.Context, token models.EmailToken) error {
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO emailtokens(user_id, purpose, token_hash, created_at, expires_at) VALUES(?, ?, ?, ?, ?)
+		 ON CONFLICT (user_id, purpose) DO UPDATE SET token_hash = excluded.token_hash,
+			created_at = excluded.created_at, expires_at = excluded.expires_at`,
+		token.UserID, token.Purpose, token.TokenHash, now(), token.ExpiresAt.UTC())
+	return mapError(err)
+}
+
+func (r *EmailTokenRepository) FindToken(ctx context.Context, userID string, purpose string) (models.EmailToken, error) {
+	token, err := scanEmailToken(r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT `+emailTokenColumns+` FROM emailtokens WHERE user_id = ? AND purpose = ?`, userID, purpose))
+	return token, mapError(err)
+}
+
+func (r *EmailTokenRepository) UseToken(ctx context.Context, tokenHash string, purpose string,
+	now time.Time) (models.EmailToken, error) {
+	token, err := scanEmailToken(r.sqlite.conn.QueryRowContext(ctx,
+		`DELETE FROM emailtokens WHERE token_hash = ? AND purpose = ? AND expires_at > ?
+		 RETURNING `+emailTokenColumns, tokenHash, purpose, now.UTC()))
+	return token, mapError(err)
+}
+
+func scanEmailToken(row rowScanner) (models.EmailToken, error) {
+	var token models.EmailToken
+	err := row.Scan(&token.UserID, &token.Purpose, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt)
+	if err != nil {
+		return models.EmailToken{}, err
+	}
+	return token, nil
+}
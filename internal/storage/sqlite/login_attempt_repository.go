@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+const loginAttemptColumns = `key, failures, last_failure_at, locked_until`
+
+// LoginAttemptRepository is a SQLite db.LoginAttemptRepository.
+type LoginAttemptRepository struct {
+	sqlite *SQLite
+}
+
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, key string, at time.Time,
+	window time.Duration) (models.LoginAttempt, error) {
+	return scanLoginAttempt(r.sqlite.conn.QueryRowContext(ctx,
+		`INSERT INTO loginattempts(key, failures, last_failure_at) VALUES(?, 1, ?)
+		 ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN loginattempts.last_failure_at < ? THEN 1 ELSE loginattempts.failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		 RETURNING `+loginAttemptColumns, key, at.UTC(), at.Add(-window).UTC()))
+}
+
+func (r *LoginAttemptRepository) FindAttempt(ctx context.Context, key string) (models.LoginAttempt, error) {
+	attempt, err := scanLoginAttempt(r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT `+loginAttemptColumns+` FROM loginattempts WHERE key = ?`, key))
+	if err != nil {
+		return models.LoginAttempt{}, mapError(err)
+	}
+	return attempt, nil
+}
+
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.sqlite.conn.ExecContext(ctx, `UPDATE loginattempts SET locked_until = ? WHERE key = ?`, until.UTC(), key)
+	return err
+}
+
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.sqlite.conn.ExecContext(ctx, `DELETE FROM loginattempts WHERE key = ?`, key)
+	return err
+}
+
+func scanLoginAttempt(row rowScanner) (models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &lockedUntil); err != nil {
+		return models.LoginAttempt{}, err
+	}
+	if lockedUntil.Valid {
+		attempt.LockedUntil = &lockedUntil.Time
+	}
+	return attempt, nil
+}
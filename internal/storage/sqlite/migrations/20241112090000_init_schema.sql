@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE Users (
+   id         TEXT PRIMARY KEY,                  -- UUID generated by the application
+   username   TEXT NOT NULL UNIQUE,              -- Username, must be unique
+   email      TEXT NOT NULL UNIQUE,              -- Email, must be unique
+   password   TEXT NOT NULL,                     -- Hashed password for authentication
+   role       TEXT NOT NULL DEFAULT 'user',      -- Role of the user (e.g., admin, user)
+   created_at TIMESTAMP NOT NULL,                -- Timestamp of user creation
+   updated_at TIMESTAMP NOT NULL                 -- Timestamp of last update
+);
+
+CREATE TABLE Settings (
+   id         TEXT PRIMARY KEY,
+   key        TEXT NOT NULL,
+   value      TEXT NOT NULL,
+   version    INTEGER NOT NULL DEFAULT 1,        -- Version of the key pair
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE Trash (
+   id            TEXT PRIMARY KEY,
+   user_id       TEXT NOT NULL REFERENCES Users(id),
+   kind          TEXT NOT NULL,                  -- file or credentials
+   name          TEXT NOT NULL,                  -- File name or credentials name
+   delete_marker TEXT NOT NULL DEFAULT '',       -- Version of the delete marker for files
+   deleted_at    TIMESTAMP NOT NULL,
+   purge_after   TIMESTAMP NOT NULL              -- The item is removed for good after this moment
+);
+CREATE INDEX trash_purge_after_idx ON Trash (purge_after);
+
+CREATE TABLE UsersCredInfo (
+   version    INTEGER PRIMARY KEY AUTOINCREMENT, -- Grows across all credentials like the Postgres identity column
+   id         TEXT NOT NULL UNIQUE,
+   user_id    TEXT NOT NULL REFERENCES Users(id),
+   name       TEXT NOT NULL,
+   data       TEXT,                              -- Encrypted data
+   type       INTEGER NOT NULL,                  -- Kind of the data (card, creds)
+   trash_id   TEXT REFERENCES Trash(id),         -- Set while the credentials are in the trash bin
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE ShareLinks (
+   id            TEXT PRIMARY KEY,
+   user_id       TEXT NOT NULL REFERENCES Users(id),
+   token_hash    TEXT NOT NULL UNIQUE,           -- sha256 of the token handed out to the user
+   file_name     TEXT NOT NULL,
+   version_id    TEXT NOT NULL DEFAULT '',       -- Version of the object pinned at creation
+   expires_at    TIMESTAMP NOT NULL,
+   max_downloads INTEGER NOT NULL DEFAULT 0,     -- 0 means unlimited
+   downloads     INTEGER NOT NULL DEFAULT 0,
+   revoked_at    TIMESTAMP,
+   created_at    TIMESTAMP NOT NULL
+);
+-- +goose Down
+DROP TABLE ShareLinks;
+DROP TABLE UsersCredInfo;
+DROP TABLE Trash;
+DROP TABLE Settings;
+DROP TABLE Users;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE UserRevisions (
+   user_id    TEXT PRIMARY KEY REFERENCES Users(id),
+   revision   INTEGER NOT NULL                   -- Last revision handed out to the user's changes
+);
+
+CREATE TABLE Changes (
+   user_id    TEXT NOT NULL REFERENCES Users(id),
+   kind       TEXT NOT NULL,                     -- file or credentials
+   name       TEXT NOT NULL,                     -- File name or credentials name
+   revision   INTEGER NOT NULL,                  -- Revision of the latest change of the item
+   deleted    BOOLEAN NOT NULL DEFAULT FALSE,    -- Tombstone of a deleted item
+   version_id TEXT NOT NULL DEFAULT '',          -- Version of the file, empty for credentials
+   changed_at TIMESTAMP NOT NULL,
+   PRIMARY KEY (user_id, kind, name)
+);
+CREATE INDEX changes_user_revision_idx ON Changes (user_id, revision);
+-- +goose Down
+DROP TABLE Changes;
+DROP TABLE UserRevisions;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE Conflicts (
+   id             TEXT PRIMARY KEY,
+   user_id        TEXT NOT NULL REFERENCES Users(id),
+   name           TEXT NOT NULL,                 -- Name of the credentials
+   base_version   INTEGER NOT NULL,              -- Version the client edited from
+   remote_version INTEGER NOT NULL,              -- Latest version when the save arrived, 0 if deleted
+   data           TEXT,                          -- Encrypted data of the rejected save
+   type           INTEGER NOT NULL,
+   created_at     TIMESTAMP NOT NULL,
+   resolved_at    TIMESTAMP,                     -- Set once the user picked a side
+   resolution     TEXT NOT NULL DEFAULT ''       -- local, remote or merge
+);
+CREATE INDEX conflicts_user_idx ON Conflicts (user_id) WHERE resolved_at IS NULL;
+-- +goose Down
+DROP TABLE Conflicts;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE RevokedTokens (
+   token_id   TEXT PRIMARY KEY,                  -- ID of the revoked access token
+   user_id    TEXT NOT NULL REFERENCES Users(id),
+   expires_at TIMESTAMP NOT NULL                 -- The entry is useless once the token expired
+);
+CREATE INDEX revokedtokens_expires_idx ON RevokedTokens (expires_at);
+-- +goose Down
+DROP TABLE RevokedTokens;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE Sessions (
+   id            TEXT PRIMARY KEY,
+   user_id       TEXT NOT NULL REFERENCES Users(id),
+   refresh_hash  TEXT NOT NULL UNIQUE,           -- SHA-256 of the current refresh token
+   previous_hash TEXT NOT NULL DEFAULT '',       -- SHA-256 of the refresh token rotated last
+   created_at    TIMESTAMP NOT NULL,
+   expires_at    TIMESTAMP NOT NULL,             -- The refresh token is rejected after this time
+   revoked_at    TIMESTAMP                       -- Set on logout
+);
+CREATE INDEX sessions_previous_hash_idx ON Sessions (previous_hash);
+CREATE INDEX sessions_user_idx ON Sessions (user_id);
+-- +goose Down
+DROP TABLE Sessions;
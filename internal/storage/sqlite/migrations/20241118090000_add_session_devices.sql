@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+ALTER TABLE Sessions ADD COLUMN device TEXT NOT NULL DEFAULT '';          -- Name of the device the user logged in from
+ALTER TABLE Sessions ADD COLUMN client_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE Sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';              -- Address of the last request
+ALTER TABLE Sessions ADD COLUMN last_seen_at TIMESTAMP;
+UPDATE Sessions SET last_seen_at = created_at;
+-- +goose Down
+ALTER TABLE Sessions DROP COLUMN last_seen_at;
+ALTER TABLE Sessions DROP COLUMN ip;
+ALTER TABLE Sessions DROP COLUMN client_version;
+ALTER TABLE Sessions DROP COLUMN device;
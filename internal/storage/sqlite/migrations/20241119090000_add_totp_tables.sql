@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE TOTPSecrets (
+   user_id      TEXT PRIMARY KEY REFERENCES Users(id),
+   secret       TEXT NOT NULL,                -- Encrypted with the data key
+   created_at   TIMESTAMP NOT NULL,
+   confirmed_at TIMESTAMP,                    -- Two-factor authentication is enabled once set
+   last_step    INTEGER NOT NULL DEFAULT 0    -- Time step of the last accepted code
+);
+CREATE TABLE RecoveryCodes (
+   id         TEXT PRIMARY KEY,
+   user_id    TEXT NOT NULL REFERENCES Users(id),
+   code_hash  TEXT NOT NULL,                  -- SHA-256 of the code
+   used_at    TIMESTAMP
+);
+CREATE INDEX recovery_codes_user_idx ON RecoveryCodes (user_id, code_hash);
+-- +goose Down
+DROP TABLE RecoveryCodes;
+DROP TABLE TOTPSecrets;
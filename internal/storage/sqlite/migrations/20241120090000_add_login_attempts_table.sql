@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE LoginAttempts (
+   key             TEXT PRIMARY KEY,              -- "user:<name>" or "ip:<address>"
+   failures        INTEGER NOT NULL DEFAULT 0,    -- Failed logins within the window
+   last_failure_at TIMESTAMP NOT NULL,
+   locked_until    TIMESTAMP
+);
+CREATE TABLE SecurityEvents (
+   id         TEXT PRIMARY KEY,
+   user_id    TEXT NOT NULL DEFAULT '',           -- Empty for events of unknown users
+   kind       TEXT NOT NULL,
+   ip         TEXT NOT NULL DEFAULT '',
+   detail     TEXT NOT NULL DEFAULT '',
+   created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX security_events_user_idx ON SecurityEvents (user_id, created_at);
+-- +goose Down
+DROP TABLE SecurityEvents;
+DROP TABLE LoginAttempts;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+CREATE TABLE AccountDeletions (
+   user_id         TEXT PRIMARY KEY,              -- No reference, the user is deleted last
+   requested_at    TIMESTAMP NOT NULL,
+   object_versions INTEGER NOT NULL DEFAULT 0,    -- File versions removed so far
+   bytes_deleted   INTEGER NOT NULL DEFAULT 0,
+   rows_deleted    INTEGER NOT NULL DEFAULT 0,
+   completed_at    TIMESTAMP                      -- Set once the rows are deleted
+);
+-- +goose Down
+DROP TABLE AccountDeletions;
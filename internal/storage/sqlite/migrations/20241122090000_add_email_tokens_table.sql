@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+ALTER TABLE Users ADD COLUMN email_verified_at TIMESTAMP; -- Set once the user proved to own the email
+UPDATE Users SET email_verified_at = created_at;        -- accounts created before verification existed keep working
+CREATE TABLE EmailTokens (
+   user_id    TEXT NOT NULL REFERENCES Users(id),
+   purpose    TEXT NOT NULL,                      -- verify_email or reset_password
+   token_hash TEXT NOT NULL UNIQUE,               -- SHA-256 of the token sent by email
+   created_at TIMESTAMP NOT NULL,
+   expires_at TIMESTAMP NOT NULL,
+   PRIMARY KEY (user_id, purpose)
+);
+-- +goose Down
+DROP TABLE EmailTokens;
+ALTER TABLE Users DROP COLUMN email_verified_at;
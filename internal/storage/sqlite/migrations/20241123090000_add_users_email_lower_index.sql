@@ -0,0 +1,8 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+-- Emails are matched case-insensitively at login, so two accounts must not differ in the case of the email only.
+CREATE UNIQUE INDEX Users_email_lower_idx ON Users (lower(email));
+-- +goose Down
+DROP INDEX Users_email_lower_idx;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+ALTER TABLE Users ADD COLUMN disabled_at TIMESTAMP; -- Set while an administrator keeps the user from logging in
+-- +goose Down
+ALTER TABLE Users DROP COLUMN disabled_at;
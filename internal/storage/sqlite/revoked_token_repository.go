@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+)
+
+// RevokedTokenRepository is a SQLite db.RevokedTokenRepository.
+type RevokedTokenRepository struct {
+	sqlite *SQLite
+}
+
+func (r *RevokedTokenRepository) Revoke(ctx context.Context, tokenID string, userID string, expiresAt time.Time) error {
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO revokedtokens(token_id, user_id, expires_at) VALUES(?, ?, ?) ON CONFLICT (token_id) DO NOTHING`,
+		tokenID, userID, expiresAt.UTC())
+	return err
+}
+
+func (r *RevokedTokenRepository) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var revoked bool
+	err := r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM revokedtokens WHERE token_id = ?)`, tokenID).Scan(&revoked)
+	return revoked, err
+}
+
+func (r *RevokedTokenRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.sqlite.conn.ExecContext(ctx, `DELETE FROM revokedtokens WHERE expires_at < ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,39 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/google/uuid"
+)
+
+// SecurityEventRepository is a SQLite db.SecurityEventRepository.
+type SecurityEventRepository struct {
+	sqlite *SQLite
+}
+
+func (r *SecurityEventRepository) RecordEvent(ctx context.Context, event models.SecurityEvent) error {
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO securityevents(id, user_id, kind, ip, detail, created_at) VALUES(?, ?, ?, ?, ?, ?)`,
+		uuid.NewString(), event.UserID, event.Kind, event.IP, event.Detail, now())
+	return err
+}
+
+func (r *SecurityEventRepository) ListEvents(ctx context.Context, userID string, limit int) ([]models.SecurityEvent, error) {
+	rows, err := r.sqlite.conn.QueryContext(ctx,
+		`SELECT id, user_id, kind, ip, detail, created_at FROM securityevents
+		 WHERE ? = '' OR user_id = ? ORDER BY created_at DESC LIMIT ?`, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []models.SecurityEvent
+	for rows.Next() {
+		var event models.SecurityEvent
+		err := rows.Scan(&event.ID, &event.UserID, &event.Kind, &event.IP, &event.Detail, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
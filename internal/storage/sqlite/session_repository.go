@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"time"
+)
+
+const sessionColumns = `id, user_id, refresh_hash, previous_hash, created_at, expires_at, revoked_at, device,
+	client_version, ip, last_seen_at`
+
+// SessionRepository is a SQLite db.SessionRepository.
+type SessionRepository struct {
+	sqlite *SQLite
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, session models.Session) (models.Session, error) {
+	session.ID = uuid.NewString()
+	session.CreatedAt = now()
+	session.LastSeenAt = session.CreatedAt
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	session.PreviousHash = ""
+	session.RevokedAt = nil
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO sessions(id, user_id, refresh_hash, created_at, expires_at, device, client_version, ip, last_seen_at)
+		 VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.RefreshHash, session.CreatedAt, session.ExpiresAt, session.Device,
+		session.ClientVersion, session.IP, session.LastSeenAt)
+	if err != nil {
+		return models.Session{}, mapError(err)
+	}
+	return session, nil
+}
+
+func (r *SessionRepository) FindByRefreshHash(ctx context.Context, hash string) (models.Session, error) {
+	session, err := scanSession(r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE refresh_hash = ? OR previous_hash = ?`, hash, hash))
+	if err != nil {
+		return models.Session{}, mapError(err)
+	}
+	return session, nil
+}
+
+func (r *SessionRepository) RotateRefresh(ctx context.Context, sessionID string, oldHash string, newHash string,
+	expiresAt time.Time) error {
+	res, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE sessions SET previous_hash = refresh_hash, refresh_hash = ?, expires_at = ?
+		 WHERE id = ? AND refresh_hash = ? AND revoked_at IS NULL`,
+		newHash, expiresAt.UTC(), sessionID, oldHash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return db.ErrNotFound
+	}
+	return nil
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, sessionID string) error {
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, now(), sessionID)
+	return err
+}
+
+func (r *SessionRepository) RevokeOthers(ctx context.Context, userID string, keepID string) (int64, error) {
+	res, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL`, now(), userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *SessionRepository) FindByID(ctx context.Context, sessionID string) (models.Session, error) {
+	session, err := scanSession(r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, sessionID))
+	if err != nil {
+		return models.Session{}, mapError(err)
+	}
+	return session, nil
+}
+
+func (r *SessionRepository) ListActive(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	rows, err := r.sqlite.conn.QueryContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC`, userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionRepository) Touch(ctx context.Context, sessionID string, ip string, at time.Time) error {
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE sessions SET ip = ?, last_seen_at = ? WHERE id = ?`, ip, at.UTC(), sessionID)
+	return err
+}
+
+func scanSession(row rowScanner) (models.Session, error) {
+	var session models.Session
+	var revokedAt, lastSeenAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.RefreshHash, &session.PreviousHash, &session.CreatedAt,
+		&session.ExpiresAt, &revokedAt, &session.Device, &session.ClientVersion, &session.IP, &lastSeenAt)
+	if err != nil {
+		return models.Session{}, err
+	}
+	session.LastSeenAt = lastSeenAt.Time
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, nil
+}
@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/google/uuid"
+)
+
+// SettingsRepository is a SQLite db.SettingsRepository.
+type SettingsRepository struct {
+	sqlite *SQLite
+}
+
+func (s *SettingsRepository) SaveSettings(ctx context.Context, key string, val string) (uuid.UUID, error) {
+	id := uuid.New()
+	createdAt := now()
+	_, err := s.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO settings(id, key, value, created_at, updated_at) VALUES(?, ?, ?, ?, ?)`,
+		id.String(), key, val, createdAt, createdAt)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return id, nil
+}
+
+func (s *SettingsRepository) FindSettingsByKey(ctx context.Context, key string) (models.SettingsDTO, error) {
+	var data models.SettingsDTO
+	err := s.sqlite.conn.QueryRowContext(ctx,
+		`SELECT key, value FROM settings WHERE key = ? ORDER BY version DESC, created_at DESC LIMIT 1`, key).
+		Scan(&data.Key, &data.Value)
+	if err != nil {
+		return models.SettingsDTO{}, mapError(err)
+	}
+	return data, nil
+}
+
+func (s *SettingsRepository) SaveSettingsIfAbsent(ctx context.Context, key string, val string) (string, error) {
+	createdAt := now()
+	// a single statement is atomic, so no other value can be saved in between
+	_, err := s.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO settings(id, key, value, created_at, updated_at) SELECT ?, ?, ?, ?, ?
+		 WHERE NOT EXISTS (SELECT 1 FROM settings WHERE key = ?)`,
+		uuid.NewString(), key, val, createdAt, createdAt, key)
+	if err != nil {
+		return "", err
+	}
+	stored, err := s.FindSettingsByKey(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return stored.Value, nil
+}
+
+func (s *SettingsRepository) PutSettings(ctx context.Context, key string, val string) error {
+	tx, err := s.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM settings WHERE key = ?`, key); err != nil {
+		return err
+	}
+	createdAt := now()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO settings(id, key, value, created_at, updated_at) VALUES(?, ?, ?, ?, ?)`,
+		uuid.NewString(), key, val, createdAt, createdAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SettingsRepository) DeleteSettings(ctx context.Context, keys ...string) (int64, error) {
+	var deleted int64
+	for _, key := range keys {
+		res, err := s.sqlite.conn.ExecContext(ctx, `DELETE FROM settings WHERE key = ?`, key)
+		if err != nil {
+			return deleted, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
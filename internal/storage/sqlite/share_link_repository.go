@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+)
+
+const shareLinkColumns = `id, user_id, token_hash, file_name, version_id, expires_at, max_downloads, downloads, revoked_at, created_at`
+
+// ShareLinkRepository is a SQLite db.ShareLinkRepository.
+type ShareLinkRepository struct {
+	sqlite *SQLite
+}
+
+func (r *ShareLinkRepository) SaveShareLink(ctx context.Context, link models.ShareLink) (uuid.UUID, error) {
+	id := uuid.New()
+	_, err := r.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO sharelinks(id, user_id, token_hash, file_name, version_id, expires_at, max_downloads, created_at)
+		 VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), link.UserID, link.TokenHash, link.FileName, link.VersionID, link.ExpiresAt.UTC(), link.MaxDownloads, now())
+	if err != nil {
+		return uuid.UUID{}, mapError(err)
+	}
+	return id, nil
+}
+
+func (r *ShareLinkRepository) FindAllByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	rows, err := r.sqlite.conn.QueryContext(ctx,
+		`SELECT `+shareLinkColumns+` FROM sharelinks WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []models.ShareLink
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (r *ShareLinkRepository) Revoke(ctx context.Context, userID string, linkID string) (bool, error) {
+	res, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE sharelinks SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		now(), linkID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *ShareLinkRepository) RevokeByFile(ctx context.Context, userID string, fileName string) (int64, error) {
+	res, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE sharelinks SET revoked_at = ? WHERE user_id = ? AND file_name = ? AND revoked_at IS NULL`,
+		now(), userID, fileName)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *ShareLinkRepository) FindActive(ctx context.Context, tokenHash string) (models.ShareLink, error) {
+	row := r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT `+shareLinkColumns+` FROM sharelinks
+		 WHERE token_hash = ?
+		   AND revoked_at IS NULL
+		   AND expires_at > ?
+		   AND (max_downloads = 0 OR downloads < max_downloads)`, tokenHash, now())
+	link, err := scanShareLink(row)
+	if err != nil {
+		return models.ShareLink{}, mapError(err)
+	}
+	return link, nil
+}
+
+// ConsumeDownload counts a download for the link in a single UPDATE, so concurrent requests
+// cannot exceed the download limit.
+func (r *ShareLinkRepository) ConsumeDownload(ctx context.Context, tokenHash string) (models.ShareLink, error) {
+	row := r.sqlite.conn.QueryRowContext(ctx,
+		`UPDATE sharelinks SET downloads = downloads + 1
+		 WHERE token_hash = ?
+		   AND revoked_at IS NULL
+		   AND expires_at > ?
+		   AND (max_downloads = 0 OR downloads < max_downloads)
+		 RETURNING `+shareLinkColumns, tokenHash, now())
+	link, err := scanShareLink(row)
+	if err != nil {
+		return models.ShareLink{}, mapError(err)
+	}
+	return link, nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanShareLink(row rowScanner) (models.ShareLink, error) {
+	var link models.ShareLink
+	var revokedAt sql.NullTime
+	err := row.Scan(&link.ID, &link.UserID, &link.TokenHash, &link.FileName, &link.VersionID, &link.ExpiresAt,
+		&link.MaxDownloads, &link.Downloads, &revokedAt, &link.CreatedAt)
+	if err != nil {
+		return models.ShareLink{}, err
+	}
+	if revokedAt.Valid {
+		link.RevokedAt = &revokedAt.Time
+	}
+	return link, nil
+}
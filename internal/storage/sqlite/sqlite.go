@@ -0,0 +1,137 @@
+// Package sqlite provides SQLite implementations of the storage repositories for single-user
+// and edge deployments where running Postgres is not worth it.
+package sqlite
+
+import (
+	db "GophKeeper/internal/storage"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+)
+
+var (
+	_ db.UserRepository            = (*UserRepository)(nil)
+	_ db.SettingsRepository        = (*SettingsRepository)(nil)
+	_ db.CredRepository            = (*CredRepository)(nil)
+	_ db.ShareLinkRepository       = (*ShareLinkRepository)(nil)
+	_ db.TrashRepository           = (*TrashRepository)(nil)
+	_ db.ChangeRepository          = (*ChangeRepository)(nil)
+	_ db.ConflictRepository        = (*ConflictRepository)(nil)
+	_ db.RevokedTokenRepository    = (*RevokedTokenRepository)(nil)
+	_ db.SessionRepository         = (*SessionRepository)(nil)
+	_ db.TOTPRepository            = (*TOTPRepository)(nil)
+	_ db.LoginAttemptRepository    = (*LoginAttemptRepository)(nil)
+	_ db.SecurityEventRepository   = (*SecurityEventRepository)(nil)
+	_ db.AccountDeletionRepository = (*AccountDeletionRepository)(nil)
+	_ db.EmailTokenRepository      = (*EmailTokenRepository)(nil)
+)
+
+// embedMigrations holds the SQLite flavour of the schema. It is kept apart from the Postgres
+// migrations because the two dialects differ in types and defaults.
+//
+//go:embed migrations/*.sql
+var embedMigrations embed.FS
+
+// SQLite is a handle to a SQLite database file.
+type SQLite struct {
+	conn *sql.DB
+	log  *zap.Logger
+}
+
+// New opens the database file at path, creating it if needed, and applies the migrations.
+func New(ctx context.Context, log *zap.Logger, path string) (*SQLite, error) {
+	s, err := Open(ctx, log, path)
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := s.Migrator()
+	if err == nil {
+		_, err = migrator.Up(ctx)
+	}
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open opens the database file at path, creating it if needed, without touching the schema.
+func Open(ctx context.Context, log *zap.Logger, path string) (*SQLite, error) {
+	log.Info("opening sqlite database...", zap.String("path", path))
+	conn, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite serializes writers anyway; a single connection avoids SQLITE_BUSY between transactions.
+	conn.SetMaxOpenConns(1)
+	if err := conn.PingContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &SQLite{conn: conn, log: log}, nil
+}
+
+// Migrator returns a goose provider that applies the embedded migrations to the database and reports
+// their status.
+func (s *SQLite) Migrator() (*goose.Provider, error) {
+	fsys, err := fs.Sub(embedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectSQLite3, s.conn, fsys)
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.conn.Close()
+}
+
+// Ping checks that the database is reachable.
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.conn.PingContext(ctx)
+}
+
+// NewStorage creates a db.Storage whose repositories work on the given database.
+func NewStorage(s *SQLite) *db.Storage {
+	return db.NewStorage(
+		&UserRepository{sqlite: s},
+		&SettingsRepository{sqlite: s},
+		&CredRepository{sqlite: s},
+		&ShareLinkRepository{sqlite: s},
+		&TrashRepository{sqlite: s},
+		&ChangeRepository{sqlite: s},
+		&ConflictRepository{sqlite: s},
+		&RevokedTokenRepository{sqlite: s},
+		&SessionRepository{sqlite: s},
+		&TOTPRepository{sqlite: s},
+		&LoginAttemptRepository{sqlite: s},
+		&SecurityEventRepository{sqlite: s},
+		&AccountDeletionRepository{sqlite: s},
+		&EmailTokenRepository{sqlite: s},
+	)
+}
+
+// now returns the current time in UTC. Timestamps are stored as text, so keeping a single
+// time zone makes them comparable in queries.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// mapError converts driver errors to the repository errors shared by all implementations.
+func mapError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.ErrNotFound
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return db.ErrAlreadyExists
+	}
+	return err
+}
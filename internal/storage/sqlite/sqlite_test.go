@@ -0,0 +1,517 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestStorage(t *testing.T) *db.Storage {
+	t.Helper()
+	conn, err := New(context.Background(), zap.NewNop(), filepath.Join(t.TempDir(), "gkeeper.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return NewStorage(conn)
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	id, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	_, err = storage.UserRepository.SaveUser(ctx, "alice", "hash", "other@example.com")
+	if !errors.Is(err, db.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %v", err)
+	}
+	_, err = storage.UserRepository.SaveUser(ctx, "bob", "hash", "Alice@Example.com")
+	if !errors.Is(err, db.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists for an email differing in case, got %v", err)
+	}
+	user, err := storage.UserRepository.FindByEmail(ctx, "ALICE@example.com")
+	if err != nil {
+		t.Fatalf("find user: %v", err)
+	}
+	if user.ID != id.String() || user.Username != "alice" || user.Role != "user" || user.CreatedAt.IsZero() {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if _, err := storage.UserRepository.FindByName(ctx, "bob"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSettingsKeepLatestKeys(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	if _, err := storage.SettingsRepository.FindSettingsByKey(ctx, "setting_wrapped_dek"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	for _, dek := range []string{"dek1", "dek2"} {
+		if err := storage.SettingsRepository.PutSettings(ctx, "setting_wrapped_dek", dek); err != nil {
+			t.Fatalf("put settings: %v", err)
+		}
+	}
+	setting, err := storage.SettingsRepository.FindSettingsByKey(ctx, "setting_wrapped_dek")
+	if err != nil || setting.Value != "dek2" {
+		t.Fatalf("unexpected setting: %+v, %v", setting, err)
+	}
+	if stored, err := storage.SettingsRepository.SaveSettingsIfAbsent(ctx, "setting_wrapped_dek", "dek3"); err != nil || stored != "dek2" {
+		t.Fatalf("expected the saved value to be kept: %q, %v", stored, err)
+	}
+	for _, salt := range []string{"salt1", "salt2"} {
+		if stored, err := storage.SettingsRepository.SaveSettingsIfAbsent(ctx, "setting_kek_salt", salt); err != nil || stored != "salt1" {
+			t.Fatalf("expected the first salt to be kept: %q, %v", stored, err)
+		}
+	}
+	for _, kek := range []string{"kek1", "kek2"} {
+		if _, err := storage.SettingsRepository.SaveSettings(ctx, "setting_kek", kek); err != nil {
+			t.Fatalf("save settings: %v", err)
+		}
+	}
+	deleted, err := storage.SettingsRepository.DeleteSettings(ctx, "setting_kek", "setting_wrapped_dek")
+	if err != nil || deleted != 3 {
+		t.Fatalf("delete settings: %d, %v", deleted, err)
+	}
+	if _, err := storage.SettingsRepository.FindSettingsByKey(ctx, "setting_kek"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after deleting, got %v", err)
+	}
+}
+
+func TestCredsTrashLifecycle(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	userID, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	for _, data := range []string{"v1", "v2"} {
+		if _, _, err := storage.CredRepository.SaveUserCreds(ctx, "mail", userID.String(), data, db.Credentials); err != nil {
+			t.Fatalf("save creds: %v", err)
+		}
+	}
+	last, err := storage.CredRepository.GetLastUserCreds(ctx, userID.String(), "mail")
+	if err != nil || last.Data != "v2" || last.DataType != "1" {
+		t.Fatalf("unexpected creds: %+v, %v", last, err)
+	}
+
+	item, change, err := storage.TrashRepository.TrashCreds(ctx, userID.String(), "mail", time.Now().Add(-time.Minute))
+	if err != nil || !change.Deleted || change.Revision != 3 {
+		t.Fatalf("trash creds: %+v, %v", change, err)
+	}
+	if creds, _ := storage.CredRepository.FindAll(ctx, userID.String()); len(creds) != 0 {
+		t.Fatalf("trashed creds are visible: %v", creds)
+	}
+	expired, err := storage.TrashRepository.FindExpired(ctx, time.Now(), 10)
+	if err != nil || len(expired) != 1 || expired[0].ID != item.ID {
+		t.Fatalf("unexpected expired items: %v, %v", expired, err)
+	}
+	change, err = storage.TrashRepository.Restore(ctx, item.ID)
+	if err != nil || change.Deleted || change.Kind != db.ChangeKindCredentials || change.Revision != 4 {
+		t.Fatalf("restore: %+v, %v", change, err)
+	}
+	if creds, _ := storage.CredRepository.FindAll(ctx, userID.String()); len(creds) != 2 {
+		t.Fatalf("restored creds are not visible: %v", creds)
+	}
+	if _, err := storage.TrashRepository.FindByID(ctx, userID.String(), item.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := storage.TrashRepository.Restore(ctx, item.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound on a second restore, got %v", err)
+	}
+}
+
+func TestShareLinkDownloadLimit(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	userID, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	link := models.ShareLink{
+		UserID:       userID.String(),
+		TokenHash:    "hash",
+		FileName:     "report.pdf",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		MaxDownloads: 1,
+	}
+	if _, err := storage.ShareLinkRepository.SaveShareLink(ctx, link); err != nil {
+		t.Fatalf("save link: %v", err)
+	}
+	consumed, err := storage.ShareLinkRepository.ConsumeDownload(ctx, "hash")
+	if err != nil || consumed.Downloads != 1 || consumed.RevokedAt != nil {
+		t.Fatalf("unexpected link: %+v, %v", consumed, err)
+	}
+	if _, err := storage.ShareLinkRepository.ConsumeDownload(ctx, "hash"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after the limit, got %v", err)
+	}
+	ok, err := storage.ShareLinkRepository.Revoke(ctx, userID.String(), consumed.ID)
+	if err != nil || !ok {
+		t.Fatalf("revoke: %v, %v", ok, err)
+	}
+	link.TokenHash = "hash2"
+	if _, err := storage.ShareLinkRepository.SaveShareLink(ctx, link); err != nil {
+		t.Fatalf("save link: %v", err)
+	}
+	revoked, err := storage.ShareLinkRepository.RevokeByFile(ctx, userID.String(), "report.pdf")
+	if err != nil || revoked != 1 {
+		t.Fatalf("revoke by file: %d, %v", revoked, err)
+	}
+	links, err := storage.ShareLinkRepository.FindAllByUser(ctx, userID.String())
+	if err != nil || len(links) != 2 || links[0].RevokedAt == nil || links[1].RevokedAt == nil {
+		t.Fatalf("unexpected links: %v, %v", links, err)
+	}
+}
+
+func TestChangesKeepLatestPerItem(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	userID, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	for _, change := range []models.Change{
+		{UserID: userID.String(), Kind: db.ChangeKindFile, Name: "a.txt", VersionID: "v1"},
+		{UserID: userID.String(), Kind: db.ChangeKindCredentials, Name: "mail"},
+		{UserID: userID.String(), Kind: db.ChangeKindFile, Name: "a.txt", Deleted: true},
+	} {
+		if _, err := storage.ChangeRepository.RecordChange(ctx, change); err != nil {
+			t.Fatalf("record change: %v", err)
+		}
+	}
+	changes, err := storage.ChangeRepository.FindChanges(ctx, userID.String(), 0, 10)
+	if err != nil {
+		t.Fatalf("find changes: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Name != "mail" || changes[1].Revision != 3 || !changes[1].Deleted {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	if changes, _ := storage.ChangeRepository.FindChanges(ctx, userID.String(), 3, 10); len(changes) != 0 {
+		t.Fatalf("unexpected changes after the last revision: %+v", changes)
+	}
+}
+
+func TestCredsSaveAtRecordsConflict(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	userID, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	version, _, err := storage.CredRepository.SaveUserCredsAt(ctx, "mail", userID.String(), "v1", db.Credentials, 0)
+	if err != nil {
+		t.Fatalf("save creds: %v", err)
+	}
+	base, err := storage.CredRepository.GetLastUserCreds(ctx, userID.String(), "mail")
+	if err != nil || base.Version != version {
+		t.Fatalf("unexpected saved version %d: %+v, %v", version, base, err)
+	}
+	version, change, err := storage.CredRepository.SaveUserCredsAt(ctx, "mail", userID.String(), "v2", db.Credentials, base.Version)
+	if err != nil || version != base.Version+1 || change.Revision != 2 || change.Kind != db.ChangeKindCredentials {
+		t.Fatalf("unexpected save: version %d, %+v, %v", version, change, err)
+	}
+	_, _, err = storage.CredRepository.SaveUserCredsAt(ctx, "mail", userID.String(), "v2-laptop", db.Credentials, base.Version)
+	if !errors.Is(err, db.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if changes, err := storage.ChangeRepository.FindChanges(ctx, userID.String(), 0, 10); err != nil || len(changes) != 1 || changes[0].Revision != 2 {
+		t.Fatalf("a rejected save must not be recorded: %v, %v", changes, err)
+	}
+	if old, err := storage.CredRepository.GetUserCredsVersion(ctx, userID.String(), "mail", base.Version); err != nil || old.Data != "v1" {
+		t.Fatalf("unexpected base version: %+v, %v", old, err)
+	}
+
+	conflict, err := storage.ConflictRepository.SaveConflict(ctx, models.Conflict{
+		UserID: userID.String(), Name: "mail", BaseVersion: base.Version, RemoteVersion: base.Version + 1, Data: "v2-laptop",
+	})
+	if err != nil {
+		t.Fatalf("save conflict: %v", err)
+	}
+	if open, err := storage.ConflictRepository.FindOpenByUser(ctx, userID.String()); err != nil || len(open) != 1 {
+		t.Fatalf("unexpected open conflicts: %v, %v", open, err)
+	}
+	if err := storage.ConflictRepository.Resolve(ctx, conflict.ID, "remote"); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if err := storage.ConflictRepository.Resolve(ctx, conflict.ID, "local"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a resolved conflict, got %v", err)
+	}
+	found, err := storage.ConflictRepository.FindByID(ctx, userID.String(), conflict.ID)
+	if err != nil || found.ResolvedAt == nil || found.Resolution != "remote" {
+		t.Fatalf("unexpected conflict: %+v, %v", found, err)
+	}
+}
+
+func TestSessionRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	userID, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	session, err := storage.SessionRepository.CreateSession(ctx, models.Session{
+		UserID: userID.String(), RefreshHash: "h1", ExpiresAt: time.Now().Add(time.Hour), Device: "laptop",
+	})
+	if err != nil || session.ID == "" {
+		t.Fatalf("create session: %+v, %v", session, err)
+	}
+	seen := time.Now().Add(time.Minute).Truncate(time.Second)
+	if err := storage.SessionRepository.Touch(ctx, session.ID, "10.0.0.1", seen); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	active, err := storage.SessionRepository.ListActive(ctx, userID.String(), time.Now())
+	if err != nil || len(active) != 1 || active[0].Device != "laptop" || active[0].IP != "10.0.0.1" ||
+		!active[0].LastSeenAt.Equal(seen) {
+		t.Fatalf("unexpected active sessions: %+v, %v", active, err)
+	}
+	if err := storage.SessionRepository.RotateRefresh(ctx, session.ID, "h1", "h2", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if err := storage.SessionRepository.RotateRefresh(ctx, session.ID, "h1", "h3", time.Now().Add(time.Hour)); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a stale hash, got %v", err)
+	}
+	found, err := storage.SessionRepository.FindByRefreshHash(ctx, "h1")
+	if err != nil || found.ID != session.ID || found.RefreshHash != "h2" || found.PreviousHash != "h1" {
+		t.Fatalf("unexpected session: %+v, %v", found, err)
+	}
+	if err := storage.SessionRepository.Revoke(ctx, session.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if found, _ := storage.SessionRepository.FindByRefreshHash(ctx, "h2"); found.RevokedAt == nil {
+		t.Fatalf("session is not revoked: %+v", found)
+	}
+	if err := storage.SessionRepository.RotateRefresh(ctx, session.ID, "h2", "h3", time.Now().Add(time.Hour)); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a revoked session, got %v", err)
+	}
+}
+
+func TestLoginAttemptsWindow(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	start := time.Now().Truncate(time.Second)
+	for i := 1; i <= 2; i++ {
+		attempt, err := storage.LoginAttemptRepository.RecordFailure(ctx, "user:alice", start, time.Minute)
+		if err != nil || attempt.Failures != i {
+			t.Fatalf("record failure %d: %+v, %v", i, attempt, err)
+		}
+	}
+	if err := storage.LoginAttemptRepository.Lock(ctx, "user:alice", start.Add(time.Hour)); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	attempt, err := storage.LoginAttemptRepository.FindAttempt(ctx, "user:alice")
+	if err != nil || attempt.LockedUntil == nil || !attempt.LockedUntil.Equal(start.Add(time.Hour)) {
+		t.Fatalf("unexpected attempt: %+v, %v", attempt, err)
+	}
+	// failures older than the window are forgotten
+	attempt, err = storage.LoginAttemptRepository.RecordFailure(ctx, "user:alice", start.Add(2*time.Minute), time.Minute)
+	if err != nil || attempt.Failures != 1 {
+		t.Fatalf("expected the count to restart: %+v, %v", attempt, err)
+	}
+	if err := storage.LoginAttemptRepository.Reset(ctx, "user:alice"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if _, err := storage.LoginAttemptRepository.FindAttempt(ctx, "user:alice"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after reset, got %v", err)
+	}
+}
+
+func TestPurgeUser(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	userID, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	otherID, err := storage.UserRepository.SaveUser(ctx, "bob", "hash", "bob@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	for _, id := range []string{userID.String(), otherID.String()} {
+		if _, _, err := storage.CredRepository.SaveUserCreds(ctx, "mail", id, "v1", db.Credentials); err != nil {
+			t.Fatalf("save creds: %v", err)
+		}
+	}
+	// credentials in the trash reference the trash entry
+	if _, _, err := storage.TrashRepository.TrashCreds(ctx, userID.String(), "mail", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("trash creds: %v", err)
+	}
+	if _, err := storage.SessionRepository.CreateSession(ctx, models.Session{
+		UserID: userID.String(), RefreshHash: "hash", ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	if _, err := storage.AccountDeletionRepository.PurgeUser(ctx, userID.String()); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound without a started deletion, got %v", err)
+	}
+	if _, err := storage.AccountDeletionRepository.StartDeletion(ctx, userID.String()); err != nil {
+		t.Fatalf("start deletion: %v", err)
+	}
+	if err := storage.AccountDeletionRepository.AddPurgedObjects(ctx, userID.String(), 2, 10); err != nil {
+		t.Fatalf("add purged objects: %v", err)
+	}
+	if pending, err := storage.AccountDeletionRepository.FindPending(ctx, 10); err != nil || len(pending) != 1 {
+		t.Fatalf("unexpected pending deletions: %v, %v", pending, err)
+	}
+	deletion, err := storage.AccountDeletionRepository.PurgeUser(ctx, userID.String())
+	if err != nil {
+		t.Fatalf("purge user: %v", err)
+	}
+	// the user, the credentials, their change and revision, the trash entry and the session
+	if deletion.CompletedAt == nil || deletion.RowsDeleted != 6 || deletion.ObjectVersions != 2 || deletion.BytesDeleted != 10 {
+		t.Fatalf("unexpected deletion: %+v", deletion)
+	}
+	if _, err := storage.UserRepository.FindByID(ctx, userID.String()); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected the user to be deleted, got %v", err)
+	}
+	if creds, err := storage.CredRepository.FindAll(ctx, otherID.String()); err != nil || len(creds) != 1 {
+		t.Fatalf("credentials of another user were deleted: %v, %v", creds, err)
+	}
+	if _, err := storage.AccountDeletionRepository.PurgeUser(ctx, userID.String()); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a completed deletion, got %v", err)
+	}
+}
+
+func TestEmailTokens(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	userID, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com")
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	if user, _ := storage.UserRepository.FindByID(ctx, userID.String()); user.EmailVerifiedAt != nil {
+		t.Fatal("a new user must not be verified")
+	}
+	save := func(hash string, expiresAt time.Time) {
+		t.Helper()
+		err := storage.EmailTokenRepository.SaveToken(ctx, models.EmailToken{
+			UserID: userID.String(), Purpose: models.TokenVerifyEmail, TokenHash: hash, ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatalf("save token: %v", err)
+		}
+	}
+	save("first", time.Now().Add(time.Hour))
+	save("second", time.Now().Add(time.Hour))
+	if _, err := storage.EmailTokenRepository.UseToken(ctx, "first", models.TokenVerifyEmail, time.Now()); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected the replaced token to be gone, got %v", err)
+	}
+	if _, err := storage.EmailTokenRepository.UseToken(ctx, "second", models.TokenResetPassword, time.Now()); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for another purpose, got %v", err)
+	}
+	token, err := storage.EmailTokenRepository.UseToken(ctx, "second", models.TokenVerifyEmail, time.Now())
+	if err != nil || token.UserID != userID.String() {
+		t.Fatalf("use token: %v, %v", token, err)
+	}
+	if _, err := storage.EmailTokenRepository.UseToken(ctx, "second", models.TokenVerifyEmail, time.Now()); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected a used token to be gone, got %v", err)
+	}
+	// expiry is compared in UTC whatever the zone of the caller
+	save("expired", time.Now().In(time.FixedZone("UTC+5", 5*3600)).Add(-time.Minute))
+	if _, err := storage.EmailTokenRepository.UseToken(ctx, "expired", models.TokenVerifyEmail, time.Now()); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an expired token, got %v", err)
+	}
+
+	if err := storage.UserRepository.MarkEmailVerified(ctx, userID.String()); err != nil {
+		t.Fatalf("mark verified: %v", err)
+	}
+	if user, _ := storage.UserRepository.FindByEmail(ctx, "alice@example.com"); user.EmailVerifiedAt == nil {
+		t.Fatal("expected the user to be verified")
+	}
+}
+
+func TestUserRoleAndDisable(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	bobID, _ := storage.UserRepository.SaveUser(ctx, "bob", "hash", "bob@example.com")
+	if _, err := storage.UserRepository.SaveUser(ctx, "alice", "hash", "alice@example.com"); err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	if err := storage.UserRepository.SetRole(ctx, bobID.String(), models.RoleAdmin); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	if err := storage.UserRepository.SetDisabled(ctx, bobID.String(), true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	users, err := storage.UserRepository.ListUsers(ctx)
+	if err != nil || len(users) != 2 || users[0].Username != "alice" {
+		t.Fatalf("list users: %+v, %v", users, err)
+	}
+	if bob := users[1]; bob.Role != models.RoleAdmin || bob.DisabledAt == nil {
+		t.Fatalf("unexpected user: %+v", bob)
+	}
+	if err := storage.UserRepository.SetDisabled(ctx, bobID.String(), false); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if bob, _ := storage.UserRepository.FindByID(ctx, bobID.String()); bob.DisabledAt != nil {
+		t.Fatal("expected the user to be enabled")
+	}
+	if err := storage.UserRepository.SetRole(ctx, "missing", models.RoleAdmin); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	rootID, err := storage.UserRepository.SaveVerifiedUser(ctx, "root", "hash", "root@example.com", models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("save verified user: %v", err)
+	}
+	if root, err := storage.UserRepository.FindByID(ctx, rootID.String()); err != nil || root.Role != models.RoleAdmin || root.EmailVerifiedAt == nil {
+		t.Fatalf("unexpected verified user: %+v, %v", root, err)
+	}
+}
+
+func TestPrepareSchema(t *testing.T) {
+	ctx := context.Background()
+	conn, err := Open(ctx, zap.NewNop(), filepath.Join(t.TempDir(), "gkeeper.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer conn.Close()
+	migrator, err := conn.Migrator()
+	if err != nil {
+		t.Fatalf("migrator: %v", err)
+	}
+	if _, err := db.PrepareSchema(ctx, migrator, "sometimes"); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+	if _, err := db.PrepareSchema(ctx, migrator, db.MigrateCheck); !errors.Is(err, db.ErrPendingMigrations) {
+		t.Fatalf("expected ErrPendingMigrations, got %v", err)
+	}
+	results, err := db.PrepareSchema(ctx, migrator, db.MigrateAuto)
+	if err != nil || len(results) != len(migrator.ListSources()) {
+		t.Fatalf("auto: %d migrations, %v", len(results), err)
+	}
+	if _, err := db.PrepareSchema(ctx, migrator, db.MigrateCheck); err != nil {
+		t.Fatalf("check after auto: %v", err)
+	}
+
+	// every down migration undoes its up migration
+	if _, err := migrator.DownTo(ctx, 0); err != nil {
+		t.Fatalf("roll back all: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("apply again: %v", err)
+	}
+
+	_, err = conn.conn.ExecContext(ctx, `INSERT INTO goose_db_version(version_id, is_applied) VALUES(?, ?)`,
+		int64(20991231000000), true)
+	if err != nil {
+		t.Fatalf("record a newer migration: %v", err)
+	}
+	for _, mode := range []string{db.MigrateCheck, db.MigrateAuto} {
+		if _, err := db.PrepareSchema(ctx, migrator, mode); !errors.Is(err, db.ErrSchemaNewer) {
+			t.Fatalf("%s: expected ErrSchemaNewer, got %v", mode, err)
+		}
+	}
+	if _, err := db.PrepareSchema(ctx, migrator, db.MigrateOff); err != nil {
+		t.Fatalf("off: %v", err)
+	}
+}
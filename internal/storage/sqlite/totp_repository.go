@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+)
+
+// TOTPRepository is a SQLite db.TOTPRepository.
+type TOTPRepository struct {
+	sqlite *SQLite
+}
+
+func (r *TOTPRepository) SaveSecret(ctx context.Context, userID string, secret string) error {
+	res, err := r.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO totpsecrets(user_id, secret, created_at) VALUES(?, ?, ?)
+		 ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at, last_step = 0
+		 WHERE totpsecrets.confirmed_at IS NULL`, userID, secret, now())
+	if err != nil {
+		return mapError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return db.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *TOTPRepository) FindByUser(ctx context.Context, userID string) (models.TOTP, error) {
+	var totp models.TOTP
+	var confirmedAt sql.NullTime
+	err := r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT user_id, secret, created_at, confirmed_at, last_step FROM totpsecrets WHERE user_id = ?`, userID).
+		Scan(&totp.UserID, &totp.Secret, &totp.CreatedAt, &confirmedAt, &totp.LastStep)
+	if err != nil {
+		return models.TOTP{}, mapError(err)
+	}
+	if confirmedAt.Valid {
+		totp.ConfirmedAt = &confirmedAt.Time
+	}
+	return totp, nil
+}
+
+func (r *TOTPRepository) Confirm(ctx context.Context, userID string, recoveryHashes []string) error {
+	tx, err := r.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE totpsecrets SET confirmed_at = ? WHERE user_id = ?`, now(), userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recoverycodes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryHashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO recoverycodes(id, user_id, code_hash) VALUES(?, ?, ?)`,
+			uuid.NewString(), userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *TOTPRepository) UseStep(ctx context.Context, userID string, step int64) error {
+	res, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE totpsecrets SET last_step = ? WHERE user_id = ? AND last_step < ?`, step, userID, step)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *TOTPRepository) UseRecoveryCode(ctx context.Context, userID string, hash string) error {
+	res, err := r.sqlite.conn.ExecContext(ctx,
+		`UPDATE recoverycodes SET used_at = ?
+		 WHERE id = (SELECT id FROM recoverycodes WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1)`,
+		now(), userID, hash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"time"
+)
+
+const trashColumns = `id, user_id, kind, name, delete_marker, deleted_at, purge_after`
+
+// TrashRepository is a SQLite db.TrashRepository.
+type TrashRepository struct {
+	sqlite *SQLite
+}
+
+func (r *TrashRepository) SaveFileItem(ctx context.Context, userID string, fileName string, deleteMarker string,
+	purgeAfter time.Time) (models.TrashItem, models.Change, error) {
+	tx, err := r.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	defer tx.Rollback()
+	item, err := r.insert(ctx, tx, db.TrashKindFile, userID, fileName, deleteMarker, purgeAfter)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	change, err := recordChange(ctx, tx, models.Change{
+		UserID: userID, Kind: db.ChangeKindFile, Name: fileName, Deleted: true, VersionID: deleteMarker,
+	})
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	return item, change, tx.Commit()
+}
+
+// TrashCreds moves every version of the named credentials to the trash bin.
+func (r *TrashRepository) TrashCreds(ctx context.Context, userID string, credName string,
+	purgeAfter time.Time) (models.TrashItem, models.Change, error) {
+	tx, err := r.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	defer tx.Rollback()
+	item, err := r.insert(ctx, tx, db.TrashKindCredentials, userID, credName, "", purgeAfter)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	res, err := tx.ExecContext(ctx,
+		`UPDATE userscredinfo SET trash_id = ? WHERE user_id = ? AND name = ? AND trash_id IS NULL`,
+		item.ID, userID, credName)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return models.TrashItem{}, models.Change{}, err
+	}
+	change, err := recordChange(ctx, tx, models.Change{UserID: userID, Kind: db.ChangeKindCredentials, Name: credName, Deleted: true})
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	return item, change, tx.Commit()
+}
+
+func (r *TrashRepository) insert(ctx context.Context, tx *sql.Tx, kind string, userID string, name string,
+	deleteMarker string, purgeAfter time.Time) (models.TrashItem, error) {
+	item := models.TrashItem{
+		ID:           uuid.NewString(),
+		UserID:       userID,
+		Kind:         kind,
+		Name:         name,
+		DeleteMarker: deleteMarker,
+		DeletedAt:    now(),
+		PurgeAfter:   purgeAfter.UTC(),
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO trash(`+trashColumns+`) VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		item.ID, item.UserID, item.Kind, item.Name, item.DeleteMarker, item.DeletedAt, item.PurgeAfter)
+	if err != nil {
+		return models.TrashItem{}, err
+	}
+	return item, nil
+}
+
+func (r *TrashRepository) FindAllByUser(ctx context.Context, userID string) ([]models.TrashItem, error) {
+	return r.findMany(ctx, `SELECT `+trashColumns+` FROM trash WHERE user_id = ? ORDER BY deleted_at DESC`, userID)
+}
+
+func (r *TrashRepository) FindByID(ctx context.Context, userID string, itemID string) (models.TrashItem, error) {
+	item, err := scanTrashItem(r.sqlite.conn.QueryRowContext(ctx,
+		`SELECT `+trashColumns+` FROM trash WHERE id = ? AND user_id = ?`, itemID, userID))
+	if err != nil {
+		return models.TrashItem{}, mapError(err)
+	}
+	return item, nil
+}
+
+func (r *TrashRepository) FindExpired(ctx context.Context, before time.Time, limit int) ([]models.TrashItem, error) {
+	return r.findMany(ctx, `SELECT `+trashColumns+` FROM trash WHERE purge_after < ? ORDER BY purge_after LIMIT ?`,
+		before.UTC(), limit)
+}
+
+// Restore takes the entry out of the trash bin. Credentials rows attached to it become visible again.
+func (r *TrashRepository) Restore(ctx context.Context, itemID string) (models.Change, error) {
+	tx, err := r.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Change{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE userscredinfo SET trash_id = NULL WHERE trash_id = ?`, itemID); err != nil {
+		return models.Change{}, err
+	}
+	var change models.Change
+	err = tx.QueryRowContext(ctx, `DELETE FROM trash WHERE id = ? RETURNING user_id, kind, name`, itemID).
+		Scan(&change.UserID, &change.Kind, &change.Name)
+	if err != nil {
+		return models.Change{}, mapError(err)
+	}
+	change, err = recordChange(ctx, tx, change)
+	if err != nil {
+		return models.Change{}, err
+	}
+	return change, tx.Commit()
+}
+
+// Purge removes the entry for good together with the credentials rows attached to it.
+func (r *TrashRepository) Purge(ctx context.Context, itemID string) error {
+	tx, err := r.sqlite.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM userscredinfo WHERE trash_id = ?`, itemID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM trash WHERE id = ?`, itemID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *TrashRepository) findMany(ctx context.Context, query string, args ...any) ([]models.TrashItem, error) {
+	rows, err := r.sqlite.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.TrashItem
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func scanTrashItem(row rowScanner) (models.TrashItem, error) {
+	var item models.TrashItem
+	err := row.Scan(&item.ID, &item.UserID, &item.Kind, &item.Name, &item.DeleteMarker, &item.DeletedAt, &item.PurgeAfter)
+	return item, err
+}
@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"GophKeeper/internal/models"
+	db "GophKeeper/internal/storage"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+)
+
+// UserRepository is a SQLite db.UserRepository.
+type UserRepository struct {
+	sqlite *SQLite
+}
+
+func (u *UserRepository) SaveUser(ctx context.Context, username string, password string, email string) (uuid.UUID, error) {
+	id := uuid.New()
+	createdAt := now()
+	_, err := u.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO users(id, username, password, email, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?)`,
+		id.String(), username, password, email, createdAt, createdAt)
+	if err != nil {
+		return uuid.UUID{}, mapError(err)
+	}
+	return id, nil
+}
+
+func (u *UserRepository) SaveVerifiedUser(ctx context.Context, username string, password string, email string,
+	role string) (uuid.UUID, error) {
+	id := uuid.New()
+	createdAt := now()
+	_, err := u.sqlite.conn.ExecContext(ctx,
+		`INSERT INTO users(id, username, password, email, role, email_verified_at, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), username, password, email, role, createdAt, createdAt, createdAt)
+	if err != nil {
+		return uuid.UUID{}, mapError(err)
+	}
+	return id, nil
+}
+
+func (u *UserRepository) FindByName(ctx context.Context, userName string) (models.UserDTO, error) {
+	return u.findOne(ctx, `SELECT id, username, email, password, role, created_at, updated_at, email_verified_at, disabled_at FROM users WHERE username = ?`, userName)
+}
+
+func (u *UserRepository) FindByEmail(ctx context.Context, email string) (models.UserDTO, error) {
+	return u.findOne(ctx, `SELECT id, username, email, password, role, created_at, updated_at, email_verified_at, disabled_at FROM users WHERE lower(email) = lower(?)`, email)
+}
+
+func (u *UserRepository) FindByID(ctx context.Context, userID string) (models.UserDTO, error) {
+	return u.findOne(ctx, `SELECT id, username, email, password, role, created_at, updated_at, email_verified_at, disabled_at FROM users WHERE id = ?`, userID)
+}
+
+func (u *UserRepository) UpdatePassword(ctx context.Context, userID string, password string) error {
+	res, err := u.sqlite.conn.ExecContext(ctx,
+		`UPDATE users SET password = ?, updated_at = ? WHERE id = ?`, password, now(), userID)
+	if err != nil {
+		return mapError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (u *UserRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	res, err := u.sqlite.conn.ExecContext(ctx,
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?), updated_at = ? WHERE id = ?`,
+		now(), now(), userID)
+	if err != nil {
+		return mapError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (u *UserRepository) ListUsers(ctx context.Context) ([]models.UserDTO, error) {
+	rows, err := u.sqlite.conn.QueryContext(ctx,
+		`SELECT id, username, email, password, role, created_at, updated_at, email_verified_at, disabled_at
+		 FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []models.UserDTO
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (u *UserRepository) SetDisabled(ctx context.Context, userID string, disabled bool) error {
+	res, err := u.sqlite.conn.ExecContext(ctx,
+		`UPDATE users SET disabled_at = CASE WHEN ? THEN COALESCE(disabled_at, ?) END, updated_at = ? WHERE id = ?`,
+		disabled, now(), now(), userID)
+	if err != nil {
+		return mapError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (u *UserRepository) SetRole(ctx context.Context, userID string, role string) error {
+	res, err := u.sqlite.conn.ExecContext(ctx,
+		`UPDATE users SET role = ?, updated_at = ? WHERE id = ?`, role, now(), userID)
+	if err != nil {
+		return mapError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = db.ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (u *UserRepository) findOne(ctx context.Context, query string, args ...any) (models.UserDTO, error) {
+	data, err := scanUser(u.sqlite.conn.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return models.UserDTO{}, mapError(err)
+	}
+	return data, nil
+}
+
+func scanUser(row rowScanner) (models.UserDTO, error) {
+	var data models.UserDTO
+	var verifiedAt, disabledAt sql.NullTime
+	err := row.Scan(&data.ID, &data.Username, &data.Email, &data.Password, &data.Role, &data.CreatedAt,
+		&data.UpdatedAt, &verifiedAt, &disabledAt)
+	if err != nil {
+		return models.UserDTO{}, err
+	}
+	if verifiedAt.Valid {
+		data.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if disabledAt.Valid {
+		data.DisabledAt = &disabledAt.Time
+	}
+	return data, nil
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+)
+
+// PgTOTPRepository represents a repository for TOTP secrets and recovery codes.
+type PgTOTPRepository struct {
+	postgres *Postgres
+}
+
+func NewTOTPRepository(postgres *Postgres) *PgTOTPRepository {
+	return &PgTOTPRepository{
+		postgres: postgres,
+	}
+}
+
+func (r *PgTOTPRepository) SaveSecret(ctx context.Context, userID string, secret string) error {
+	query := `INSERT INTO totpsecrets(user_id, secret) VALUES($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = CURRENT_TIMESTAMP, last_step = 0
+		WHERE totpsecrets.confirmed_at IS NULL`
+	tag, err := r.postgres.connPool.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *PgTOTPRepository) FindByUser(ctx context.Context, userID string) (models.TOTP, error) {
+	query := `SELECT user_id, secret, created_at, confirmed_at, last_step FROM totpsecrets WHERE user_id = $1`
+	row, err := r.postgres.connPool.Query(ctx, query, userID)
+	if err != nil {
+		return models.TOTP{}, err
+	}
+	totp, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.TOTP])
+	return totp, mapError(err)
+}
+
+func (r *PgTOTPRepository) Confirm(ctx context.Context, userID string, recoveryHashes []string) error {
+	tx, err := r.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `UPDATE totpsecrets SET confirmed_at = CURRENT_TIMESTAMP WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recoverycodes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryHashes {
+		_, err := tx.Exec(ctx, `INSERT INTO recoverycodes(user_id, code_hash) VALUES($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PgTOTPRepository) UseStep(ctx context.Context, userID string, step int64) error {
+	query := `UPDATE totpsecrets SET last_step = $2 WHERE user_id = $1 AND last_step < $2`
+	tag, err := r.postgres.connPool.Exec(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PgTOTPRepository) UseRecoveryCode(ctx context.Context, userID string, hash string) error {
+	query := `UPDATE recoverycodes SET used_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT id FROM recoverycodes WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL LIMIT 1)`
+	tag, err := r.postgres.connPool.Exec(ctx, query, userID, hash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"GophKeeper/internal/models"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Kinds of items kept in the trash bin.
+const (
+	TrashKindFile        = "file"
+	TrashKindCredentials = "credentials"
+)
+
+const trashColumns = `id, user_id, kind, name, delete_marker, deleted_at, purge_after`
+
+// PgTrashRepository represents a repository for managing deleted files and credentials.
+type PgTrashRepository struct {
+	postgres *Postgres
+}
+
+func NewTrashRepository(postgres *Postgres) *PgTrashRepository {
+	return &PgTrashRepository{
+		postgres: postgres,
+	}
+}
+
+// SaveFileItem records a deleted file together with the version of its delete marker.
+func (r *PgTrashRepository) SaveFileItem(ctx context.Context, userID string, fileName string, deleteMarker string,
+	purgeAfter time.Time) (models.TrashItem, models.Change, error) {
+	tx, err := r.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	defer tx.Rollback(ctx)
+	query := `INSERT INTO trash(user_id, kind, name, delete_marker, purge_after) VALUES($1, $2, $3, $4, $5)
+		RETURNING ` + trashColumns
+	row, err := tx.Query(ctx, query, userID, TrashKindFile, fileName, deleteMarker, purgeAfter)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	item, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.TrashItem])
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	change, err := recordChange(ctx, tx, models.Change{
+		UserID: userID, Kind: ChangeKindFile, Name: fileName, Deleted: true, VersionID: deleteMarker,
+	})
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	return item, change, tx.Commit(ctx)
+}
+
+// TrashCreds moves every version of the named credentials to the trash bin.
+// It returns ErrNotFound if the user has no such credentials.
+func (r *PgTrashRepository) TrashCreds(ctx context.Context, userID string, credName string,
+	purgeAfter time.Time) (models.TrashItem, models.Change, error) {
+	tx, err := r.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	defer tx.Rollback(ctx)
+	query := `INSERT INTO trash(user_id, kind, name, purge_after) VALUES($1, $2, $3, $4) RETURNING ` + trashColumns
+	row, err := tx.Query(ctx, query, userID, TrashKindCredentials, credName, purgeAfter)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	item, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.TrashItem])
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	tag, err := tx.Exec(ctx,
+		`UPDATE userscredinfo SET trash_id = $1 WHERE user_id = $2 AND name = $3 AND trash_id IS NULL`,
+		item.ID, userID, credName)
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.TrashItem{}, models.Change{}, ErrNotFound
+	}
+	change, err := recordChange(ctx, tx, models.Change{UserID: userID, Kind: ChangeKindCredentials, Name: credName, Deleted: true})
+	if err != nil {
+		return models.TrashItem{}, models.Change{}, err
+	}
+	return item, change, tx.Commit(ctx)
+}
+
+// FindAllByUser returns the content of the user's trash bin, most recently deleted first.
+func (r *PgTrashRepository) FindAllByUser(ctx context.Context, userID string) ([]models.TrashItem, error) {
+	query := `SELECT ` + trashColumns + ` FROM trash WHERE user_id = $1 ORDER BY deleted_at DESC`
+	rows, err := r.postgres.connPool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.TrashItem])
+}
+
+// FindByID returns the user's trash entry with the given ID.
+func (r *PgTrashRepository) FindByID(ctx context.Context, userID string, itemID string) (models.TrashItem, error) {
+	query := `SELECT ` + trashColumns + ` FROM trash WHERE id = $1 AND user_id = $2`
+	row, err := r.postgres.connPool.Query(ctx, query, itemID, userID)
+	if err != nil {
+		return models.TrashItem{}, err
+	}
+	item, err := pgx.CollectOneRow(row, pgx.RowToStructByPos[models.TrashItem])
+	return item, mapError(err)
+}
+
+// FindExpired returns up to limit entries whose retention period ended before the given moment.
+func (r *PgTrashRepository) FindExpired(ctx context.Context, before time.Time, limit int) ([]models.TrashItem, error) {
+	query := `SELECT ` + trashColumns + ` FROM trash WHERE purge_after < $1 ORDER BY purge_after LIMIT $2`
+	rows, err := r.postgres.connPool.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.TrashItem])
+}
+
+// Restore takes the entry out of the trash bin. Credentials rows attached to it become visible again.
+func (r *PgTrashRepository) Restore(ctx context.Context, itemID string) (models.Change, error) {
+	tx, err := r.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return models.Change{}, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `UPDATE userscredinfo SET trash_id = NULL WHERE trash_id = $1`, itemID); err != nil {
+		return models.Change{}, err
+	}
+	var change models.Change
+	err = tx.QueryRow(ctx, `DELETE FROM trash WHERE id = $1 RETURNING user_id, kind, name`, itemID).
+		Scan(&change.UserID, &change.Kind, &change.Name)
+	if err != nil {
+		return models.Change{}, mapError(err)
+	}
+	change, err = recordChange(ctx, tx, change)
+	if err != nil {
+		return models.Change{}, err
+	}
+	return change, tx.Commit(ctx)
+}
+
+// Purge removes the entry for good together with the credentials rows attached to it.
+func (r *PgTrashRepository) Purge(ctx context.Context, itemID string) error {
+	tx, err := r.postgres.connPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM userscredinfo WHERE trash_id = $1`, itemID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM trash WHERE id = $1`, itemID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -7,15 +7,15 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
-// UserRepository represents a repository for managing user data.
-type UserRepository struct {
+// PgUserRepository represents a repository for managing user data.
+type PgUserRepository struct {
 	postgres *Postgres
 }
 
 // NewUserRepository creates a new instance of UserRepository with the given Postgres instance.
 // It takes a reference to a Postgres instance and returns a pointer to a UserRepository.
-func NewUserRepository(postgres *Postgres) *UserRepository {
-	return &UserRepository{
+func NewUserRepository(postgres *Postgres) *PgUserRepository {
+	return &PgUserRepository{
 		postgres: postgres,
 	}
 }
@@ -27,13 +27,25 @@ func NewUserRepository(postgres *Postgres) *UserRepository {
 // The values of the name and pass arguments are used as the parameters for the INSERT statement.
 // If the insertion is successful, the last inserted ID is scanned into the lastInsertID variable.
 // If there is an error during the insertion, the function returns the lastInsertID and the error.
-func (u *UserRepository) SaveUser(ctx context.Context, username string, password string, email string) (uuid.UUID, error) {
+func (u *PgUserRepository) SaveUser(ctx context.Context, username string, password string, email string) (uuid.UUID, error) {
 	var lastInsertID uuid.UUID
 	err := u.postgres.connPool.QueryRow(
 		ctx, "INSERT INTO users(username, password, email) VALUES($1, $2, $3) RETURNING id",
 		username, password, email).Scan(&lastInsertID)
 	if err != nil {
-		return lastInsertID, err
+		return lastInsertID, mapError(err)
+	}
+	return lastInsertID, nil
+}
+
+func (u *PgUserRepository) SaveVerifiedUser(ctx context.Context, username string, password string, email string,
+	role string) (uuid.UUID, error) {
+	var lastInsertID uuid.UUID
+	err := u.postgres.connPool.QueryRow(ctx,
+		`INSERT INTO users(username, password, email, role, email_verified_at) VALUES($1, $2, $3, $4, CURRENT_TIMESTAMP) RETURNING id`,
+		username, password, email, role).Scan(&lastInsertID)
+	if err != nil {
+		return lastInsertID, mapError(err)
 	}
 	return lastInsertID, nil
 }
@@ -45,8 +57,8 @@ func (u *UserRepository) SaveUser(ctx context.Context, username string, password
 // To retrieve the user from the database, the function executes a query with the given userID and scans the result into a models.User object.
 // If no user is found with the given userID, the function returns an empty models.User object.
 // In case of any error during the query execution, the function returns the empty models.User object and the error.
-func (u *UserRepository) FindByName(ctx context.Context, userName string) (models.UserDTO, error) {
-	query := `SELECT id, username, email, password, role, created_at, updated_at FROM users WHERE username = @username`
+func (u *PgUserRepository) FindByName(ctx context.Context, userName string) (models.UserDTO, error) {
+	query := `SELECT id, username, email, password, role, created_at, updated_at, email_verified_at, disabled_at FROM users WHERE username = @username`
 	args := pgx.NamedArgs{
 		"username": userName,
 	}
@@ -57,13 +69,13 @@ func (u *UserRepository) FindByName(ctx context.Context, userName string) (model
 	}
 	data, err = pgx.CollectOneRow(row, pgx.RowToStructByPos[models.UserDTO])
 	if err != nil {
-		return data, err
+		return data, mapError(err)
 	}
 	return data, nil
 }
 
-func (u *UserRepository) FindByEmail(ctx context.Context, email string) (models.UserDTO, error) {
-	query := `SELECT id, username, email, role, created_at FROM users WHERE email = @email`
+func (u *PgUserRepository) FindByEmail(ctx context.Context, email string) (models.UserDTO, error) {
+	query := `SELECT id, username, email, password, role, created_at, updated_at, email_verified_at, disabled_at FROM users WHERE lower(email) = lower(@email)`
 	args := pgx.NamedArgs{
 		"email": email,
 	}
@@ -73,8 +85,103 @@ func (u *UserRepository) FindByEmail(ctx context.Context, email string) (models.
 		return data, err
 	}
 	data, err = pgx.CollectOneRow(row, pgx.RowToStructByPos[models.UserDTO])
+	if err != nil {
+		return data, mapError(err)
+	}
+	return data, nil
+}
+
+func (u *PgUserRepository) FindByID(ctx context.Context, userID string) (models.UserDTO, error) {
+	query := `SELECT id, username, email, password, role, created_at, updated_at, email_verified_at, disabled_at FROM users WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": userID,
+	}
+	var data models.UserDTO
+	row, err := u.postgres.connPool.Query(ctx, query, args)
 	if err != nil {
 		return data, err
 	}
+	data, err = pgx.CollectOneRow(row, pgx.RowToStructByPos[models.UserDTO])
+	if err != nil {
+		return data, mapError(err)
+	}
 	return data, nil
 }
+
+func (u *PgUserRepository) UpdatePassword(ctx context.Context, userID string, password string) error {
+	query := `UPDATE users SET password = @password, updated_at = CURRENT_TIMESTAMP WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":       userID,
+		"password": password,
+	}
+	tag, err := u.postgres.connPool.Exec(ctx, query, args)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user proved to own the email address. A verified address stays verified.
+func (u *PgUserRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP),
+		updated_at = CURRENT_TIMESTAMP WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": userID,
+	}
+	tag, err := u.postgres.connPool.Exec(ctx, query, args)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListUsers returns all users ordered by username.
+func (u *PgUserRepository) ListUsers(ctx context.Context) ([]models.UserDTO, error) {
+	query := `SELECT id, username, email, password, role, created_at, updated_at, email_verified_at, disabled_at
+		FROM users ORDER BY username`
+	rows, err := u.postgres.connPool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.UserDTO])
+}
+
+// SetDisabled disables the user or enables it again.
+func (u *PgUserRepository) SetDisabled(ctx context.Context, userID string, disabled bool) error {
+	query := `UPDATE users SET disabled_at = CASE WHEN @disabled THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END,
+		updated_at = CURRENT_TIMESTAMP WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":       userID,
+		"disabled": disabled,
+	}
+	tag, err := u.postgres.connPool.Exec(ctx, query, args)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (u *PgUserRepository) SetRole(ctx context.Context, userID string, role string) error {
+	query := `UPDATE users SET role = @role, updated_at = CURRENT_TIMESTAMP WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":   userID,
+		"role": role,
+	}
+	tag, err := u.postgres.connPool.Exec(ctx, query, args)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -6,8 +6,14 @@ import (
 )
 
 const (
+	// SettingKeyKek and SettingKeyDek hold the key pair of releases that kept the KEK in the database.
+	// They are migrated to SettingKeyWrappedDek and deleted at the start.
 	SettingKeyKek string = "setting_kek"
 	SettingKeyDek string = "setting_dek"
+	// SettingKeyWrappedDek holds the data key wrapped with the KEK of the key provider.
+	SettingKeyWrappedDek string = "setting_wrapped_dek"
+	// SettingKeyKekSalt holds the salt the KEK is derived from a passphrase with.
+	SettingKeyKekSalt string = "setting_kek_salt"
 )
 
 // ErrorCode - compare errors